@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/sptrader/sptrader/internal/config"
+)
+
+// configFlags defines flags for the most used settings on fs. The returned
+// function, called after parsing, gives the config.Load options for the
+// flags that were set, which take precedence over the environment, the
+// config file and the defaults.
+func configFlags(fs *flag.FlagSet) func() []config.Option {
+	profile := fs.String("profile", "", "environment profile: development, staging or production (SPTRADER_ENV)")
+	addr := fs.String("addr", "", "listen address, e.g. :9090 (SERVER_ADDRESS)")
+	mode := fs.String("mode", "", "gin mode: debug or production (GIN_MODE)")
+	logLevel := fs.String("log-level", "", "log level, e.g. debug or info (LOG_LEVEL)")
+	logFormat := fs.String("log-format", "", "log format: console or json (LOG_FORMAT)")
+	corsOrigins := fs.String("cors-origins", "", "comma-separated origins allowed cross-origin requests, or * (CORS_ALLOWED_ORIGINS)")
+	pprof := fs.Bool("pprof", false, "serve runtime profiles under /debug/pprof (SERVER_PPROF)")
+	tracing := fs.Bool("tracing", false, "export OpenTelemetry traces (TRACING_ENABLED)")
+	databaseURL := fs.String("db", "", "database URL (DATABASE_URL)")
+	maxConns := fs.Int("db-max-conns", 0, "maximum database connections per pool (DB_MAX_CONNECTIONS)")
+	queryTimeout := fs.Duration("db-query-timeout", 0, "deadline for interactive queries (DB_QUERY_TIMEOUT)")
+	slowQuery := fs.Duration("db-slow-query", 0, "log queries slower than this (DB_SLOW_QUERY_THRESHOLD)")
+	cacheBackend := fs.String("cache-backend", "", "cache backend: memory or redis (CACHE_BACKEND)")
+	cacheMaxBytes := fs.Int64("cache-max-bytes", 0, "in-memory cache byte budget (CACHE_MAX_BYTES)")
+
+	return func() []config.Option {
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) {
+			set[f.Name] = true
+		})
+
+		var options []config.Option
+		if set["profile"] {
+			options = append(options, config.WithProfile(*profile))
+		}
+		override := func(name string, fn func(cfg *config.Config)) {
+			if set[name] {
+				options = append(options, config.WithOverride(fn))
+			}
+		}
+		override("addr", func(cfg *config.Config) { cfg.Server.Address = *addr })
+		override("mode", func(cfg *config.Config) { cfg.Server.Mode = *mode })
+		override("log-level", func(cfg *config.Config) { cfg.Server.LogLevel = *logLevel })
+		override("log-format", func(cfg *config.Config) { cfg.Server.LogFormat = *logFormat })
+		override("cors-origins", func(cfg *config.Config) { cfg.Server.CORSOrigins = splitList(*corsOrigins) })
+		override("pprof", func(cfg *config.Config) { cfg.Server.Pprof = *pprof })
+		override("tracing", func(cfg *config.Config) { cfg.Server.Tracing.Enabled = *tracing })
+		override("db", func(cfg *config.Config) { cfg.Database.URL = *databaseURL })
+		override("db-max-conns", func(cfg *config.Config) { cfg.Database.MaxConnections = int32(*maxConns) })
+		override("db-query-timeout", func(cfg *config.Config) { cfg.Database.QueryTimeout = *queryTimeout })
+		override("db-slow-query", func(cfg *config.Config) { cfg.Database.SlowQueryThreshold = *slowQuery })
+		override("cache-backend", func(cfg *config.Config) { cfg.Cache.Backend = *cacheBackend })
+		override("cache-max-bytes", func(cfg *config.Config) { cfg.Cache.MaxBytes = *cacheMaxBytes })
+		return options
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,32 +16,119 @@ import (
 	"github.com/sptrader/sptrader/internal/api"
 	"github.com/sptrader/sptrader/internal/config"
 	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/market"
 	"github.com/sptrader/sptrader/internal/services"
+	"github.com/sptrader/sptrader/internal/tracing"
 )
 
 func main() {
+	configPath := flag.String("config", "", "YAML config file; environment variables override its values")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration, secrets redacted, and exit")
+	overrides := configFlags(flag.CommandLine)
+	flag.Parse()
+
 	// Setup logging
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
 	// Load configuration
-	cfg, err := config.Load()
+	loadOptions := overrides()
+	cfg, err := config.Load(*configPath, loadOptions...)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load config")
 	}
+	if *printConfig {
+		for _, setting := range config.Settings(cfg) {
+			fmt.Printf("%s = %s\n", setting.Name, setting.Value)
+		}
+		return
+	}
+	setupLogging(cfg.Server)
+	log.Info().
+		Str("profile", string(cfg.Profile)).
+		Str("log_level", zerolog.GlobalLevel().String()).
+		Strs("cors_origins", cfg.Server.CORSOrigins).
+		Bool("pprof", cfg.Server.Pprof).
+		Bool("admin_auth", cfg.Server.AdminToken != "").
+		Msg("Active profile")
+	log.Info().Str("config", fmt.Sprintf("%+v", cfg.Redacted())).Msg("Effective configuration")
 
-	// Initialize database
-	dbPool, err := db.NewPool(cfg.Database)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Server.Tracing)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to connect to database")
+		log.Fatal().Err(err).Msg("Failed to set up tracing")
+	}
+
+	// Initialize database. Query paths get a read-only pool; only admin
+	// paths that legitimately write receive the writable one. Each pool may
+	// have its own URL and connection limits.
+	dbPool, err := db.NewReadOnlyPool(cfg.Database.ReadConfig())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to read database")
 	}
 	defer dbPool.Close()
 
+	writePool, err := db.NewPool(cfg.Database.WriteConfig())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to write database")
+	}
+	defer writePool.Close()
+
+	// Open the minimum connections now rather than on the first requests
+	warmCtx, warmCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	for name, pool := range map[string]*db.Pool{"read": dbPool, "write": writePool} {
+		conns, err := pool.WarmUp(warmCtx)
+		if err != nil {
+			log.Warn().Err(err).Str("pool", name).Int("connections", conns).Msg("Failed to warm up database pool")
+			continue
+		}
+		log.Info().Str("pool", name).Int("connections", conns).Msg("Database pool warmed up")
+	}
+	warmCancel()
+
 	// Initialize services
 	dataService := services.NewDataService(dbPool)
-	cacheService := services.NewCacheService(cfg.Cache)
-	viewportService := services.NewViewportService(dbPool, cacheService)
-	dataManager := services.NewDataManager(dbPool)
+	cacheService, err := services.NewCache(cfg.Cache)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize cache")
+	}
+	calendar, err := market.NewCalendar(cfg.Market)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid market calendar")
+	}
+	viewportService := services.NewViewportService(dbPool, cacheService, cfg.Data, cfg.Cache.TTLTiers, calendar)
+	dataManager := services.NewDataManager(dbPool, writePool, cacheService, calendar, cfg.Fetch)
+	schemaCtx, schemaCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := dataManager.EnsureTables(schemaCtx); err != nil {
+		log.Warn().Err(err).Msg("Failed to create data manager tables, fetch history and data quality will be unavailable")
+	}
+	schemaCancel()
+
+	// Verify configured tables exist
+	validateCtx, validateCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	verification := viewportService.VerifyTables(validateCtx)
+	validateCancel()
+	if !verification.OK {
+		if cfg.Data.RequireTables {
+			log.Fatal().
+				Strs("missing", verification.Missing).
+				Strs("failed", verification.Failed).
+				Msg("Required tables unavailable, refusing to start")
+		}
+		log.Warn().
+			Strs("missing", verification.Missing).
+			Strs("failed", verification.Failed).
+			Msg("Configured tables unavailable, queries will aggregate from ticks")
+	}
+	ohlcRefresher := services.NewOHLCRefresher(writePool, cfg.OHLCRefresh)
+	ohlcRefresher.Start()
+	cacheWarmer := services.NewCacheWarmer(viewportService, cfg.CacheWarm)
+	cacheWarmer.Start()
+	dataManager.StartBackfill()
+	dataManager.StartRetention(cfg.Retention)
+	dataManager.StartStaleness(cfg.Staleness)
+	dataManager.StartAlerts(cfg.Alerts)
+	symbolRegistry := services.NewSymbolRegistry(dbPool, cfg.Symbols)
+	symbolRegistry.Start()
 
 	// Setup Gin
 	if cfg.Server.Mode == "production" {
@@ -48,31 +137,56 @@ func main() {
 
 	router := gin.New()
 	router.Use(gin.Recovery())
+	router.Use(api.TracingMiddleware())
 	router.Use(api.LoggerMiddleware())
-	router.Use(api.CORSMiddleware())
+	router.Use(api.CORSMiddleware(cfg.Server.CORSOrigins))
+	router.Use(api.RouteLimitsMiddleware(cfg.Server.Routes))
+
+	// Reload runtime-tunable settings on SIGHUP or through the admin API
+	configReloader := services.NewConfigReloader(*configPath, cfg, cacheService, viewportService, dataManager, loadOptions...)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if _, err := configReloader.Reload(); err != nil {
+				log.Error().Err(err).Msg("Configuration reload failed")
+			}
+		}
+	}()
 
 	// Initialize handlers
-	handlers := api.NewHandlers(dataService, viewportService, dataManager)
+	handlers := api.NewHandlers(dataService, viewportService, dataManager, ohlcRefresher, cacheWarmer, cacheService, configReloader, symbolRegistry)
 
 	// Routes
+	router.GET("/metrics", handlers.Metrics)
+
 	v1 := router.Group("/api/v1")
 	{
 		// Health check
 		v1.GET("/health", handlers.Health)
+		v1.GET("/ready", handlers.Ready)
 		
 		// Data endpoints
 		v1.GET("/candles", handlers.GetCandles)
 		v1.GET("/candles/smart", handlers.GetSmartCandles)
 		v1.GET("/candles/explain", handlers.ExplainQuery)
+		v1.GET("/bars/renko", handlers.GetPriceBars)
+		v1.GET("/correlation", handlers.GetCorrelation)
+		v1.GET("/returns", handlers.GetReturns)
+		v1.GET("/volatility", handlers.GetVolatility)
+		v1.POST("/backtest", handlers.RunBacktest)
 		
 		// Market data
 		v1.GET("/symbols", handlers.GetSymbols)
+		v1.GET("/quote", handlers.GetQuote)
 		v1.GET("/timeframes", handlers.GetTimeframes)
 		v1.GET("/data/range", handlers.GetDataRange)
 		
 		// Stats
 		v1.GET("/stats", handlers.GetStats)
 		v1.GET("/stats/cache", handlers.GetCacheStats)
+		v1.GET("/stats/db", handlers.GetDatabaseStats)
+		v1.GET("/stats/tables", handlers.GetTableStats)
 		
 		// Data contract
 		v1.GET("/contract", handlers.GetDataContract)
@@ -81,7 +195,49 @@ func main() {
 		v1.GET("/data/check", handlers.CheckDataAvailability)
 		v1.POST("/data/ensure", handlers.EnsureData)
 		v1.GET("/data/status", handlers.GetDataStatus)
+		v1.GET("/data/history", handlers.GetFetchHistory)
+		v1.GET("/data/staleness", handlers.GetStaleness)
+		v1.GET("/data/jobs", handlers.ListFetchJobs)
+		v1.GET("/data/jobs/:id", handlers.GetFetchJob)
+		v1.DELETE("/data/jobs/:id", handlers.CancelFetchJob)
 		v1.GET("/candles/lazy", handlers.GetCandlesWithLazyLoad)
+
+		// Price alerts, scoped to the requesting client
+		v1.POST("/alerts", handlers.CreateAlert)
+		v1.GET("/alerts", handlers.ListAlerts)
+		v1.GET("/alerts/:id", handlers.GetAlert)
+		v1.DELETE("/alerts/:id", handlers.DeleteAlert)
+		
+		// Admin endpoints
+		admin := v1.Group("/admin", api.AdminAuthMiddleware(cfg.Server.AdminToken))
+		admin.GET("/ohlc/status", handlers.GetOHLCRefreshStatus)
+		admin.POST("/ohlc/refresh", handlers.TriggerOHLCRefresh)
+		admin.GET("/integrity", handlers.CheckIntegrity)
+		admin.POST("/audit", handlers.StartAudit)
+		admin.GET("/audit", handlers.ListAudits)
+		admin.GET("/audit/:id", handlers.GetAudit)
+		admin.DELETE("/audit/:id", handlers.CancelAudit)
+		admin.GET("/tables/verify", handlers.GetTableVerification)
+		admin.POST("/db/reconnect", handlers.ReconnectDatabase)
+		admin.POST("/cache/invalidate", handlers.InvalidateCache)
+		admin.POST("/cache/stats/reset", handlers.ResetCacheStats)
+		admin.GET("/cache/keys", handlers.ListCacheKeys)
+		admin.GET("/cache/keys/:key", handlers.GetCacheKey)
+		admin.GET("/cache/warm", handlers.GetCacheWarmStatus)
+		admin.POST("/cache/warm", handlers.TriggerCacheWarm)
+		admin.POST("/data/jobs/:id/priority", handlers.SetFetchJobPriority)
+		admin.GET("/backfill", handlers.GetBackfillStatus)
+		admin.POST("/backfill", handlers.TriggerBackfill)
+		admin.GET("/retention", handlers.GetRetentionStatus)
+		admin.GET("/retention/preview", handlers.PreviewRetention)
+		admin.GET("/symbols", handlers.GetSymbolRegistry)
+		admin.POST("/symbols/refresh", handlers.RefreshSymbols)
+		admin.GET("/config", handlers.GetConfig)
+		admin.POST("/config/reload", handlers.ReloadConfig)
+	}
+
+	if cfg.Server.Pprof {
+		api.RegisterPprof(router.Group("/debug", api.AdminAuthMiddleware(cfg.Server.AdminToken)))
 	}
 
 	// Setup server
@@ -107,6 +263,12 @@ func main() {
 
 	log.Info().Msg("Shutting down server...")
 
+	// Stop background services
+	ohlcRefresher.Stop()
+	symbolRegistry.Stop()
+	cacheWarmer.Stop()
+	dataManager.Close()
+
 	// Graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -114,6 +276,23 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal().Err(err).Msg("Server forced to shutdown")
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to flush traces")
+	}
 
 	log.Info().Msg("Server exited")
-}
\ No newline at end of file
+}
+
+// setupLogging applies the configured log level and format
+func setupLogging(cfg config.ServerConfig) {
+	level, err := zerolog.ParseLevel(cfg.LogLevel)
+	if err != nil || level == zerolog.NoLevel {
+		log.Warn().Str("log_level", cfg.LogLevel).Msg("Invalid log level, using info")
+		level = zerolog.InfoLevel
+	}
+	zerolog.SetGlobalLevel(level)
+
+	if cfg.LogFormat == "json" {
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// apiEndpoints are the candle endpoints profiled end to end; only /candles
+// is given the resolution, /candles/smart picks its own
+var apiEndpoints = []struct {
+	path          string
+	setResolution bool
+}{
+	{"/api/v1/candles", true},
+	{"/api/v1/candles/smart", false},
+}
+
+// APIResult is one endpoint's end-to-end timings for a symbol and range,
+// next to the raw SQL time of the same table and range
+type APIResult struct {
+	Endpoint        string  `json:"endpoint"`
+	Symbol          string  `json:"symbol"`
+	Table           string  `json:"table"`
+	Resolution      string  `json:"resolution"`
+	TimeRangeHours  int     `json:"time_range_hours"`
+	Requests        int     `json:"requests"`
+	Errors          int     `json:"errors"`
+	AvgLatencyMs    float64 `json:"avg_latency_ms"`
+	AvgServerMs     float64 `json:"avg_server_query_ms"` // metadata.query_time_ms as the API reported it
+	CacheHitRate    float64 `json:"cache_hit_rate"`
+	AvgPayloadBytes float64 `json:"avg_payload_bytes"`
+	SQLQueryTimeMs  int64   `json:"sql_query_time_ms"` // -1 when the table wasn't profiled
+}
+
+// apiProfiler requests candles from a running API
+type apiProfiler struct {
+	base     string
+	client   *http.Client
+	requests int // per endpoint, symbol and range; repeats show the cache
+}
+
+// profileAPI requests every profiled table's resolution and range for each
+// symbol from the API and compares the timings with the SQL ones measured
+// before
+func (p *DataProfiler) profileAPI(ctx context.Context, api *apiProfiler) {
+	log.Info().Str("api_base", api.base).Msg("\n\n🌐 Profiling the HTTP API")
+
+	for _, symbol := range p.symbols {
+		for _, table := range p.tables {
+			sqlMs := p.sqlQueryTime(symbol, table)
+			for _, endpoint := range apiEndpoints {
+				result := api.profile(ctx, endpoint.path, symbol, table.resolution, table.hours, endpoint.setResolution)
+				result.Table, result.SQLQueryTimeMs = table.name, sqlMs
+				p.apiResults = append(p.apiResults, result)
+
+				log.Info().
+					Str("endpoint", endpoint.path).
+					Str("symbol", symbol).
+					Str("resolution", table.resolution).
+					Int("hours", table.hours).
+					Int64("sql_ms", sqlMs).
+					Float64("server_ms", result.AvgServerMs).
+					Float64("api_ms", result.AvgLatencyMs).
+					Float64("cache_hit_rate", result.CacheHitRate).
+					Float64("payload_bytes", result.AvgPayloadBytes).
+					Int("errors", result.Errors).
+					Msg("API vs SQL")
+			}
+		}
+	}
+}
+
+// sqlQueryTime returns the raw SQL time profiled for symbol on table, or -1
+// if there is none
+func (p *DataProfiler) sqlQueryTime(symbol string, table profileTable) int64 {
+	for _, result := range p.results {
+		if result.Symbol == symbol && result.Table == table.name && result.Resolution == table.resolution &&
+			result.TimeRangeHours == table.hours && !result.Failed {
+			return result.QueryTimeMs
+		}
+	}
+	return -1
+}
+
+// profile requests path the configured number of times, averaging over the
+// successful responses
+func (a *apiProfiler) profile(ctx context.Context, path, symbol, resolution string, hours int, setResolution bool) APIResult {
+	result := APIResult{
+		Endpoint:       path,
+		Symbol:         symbol,
+		Resolution:     resolution,
+		TimeRangeHours: hours,
+	}
+
+	end := time.Now().UTC().Truncate(time.Second)
+	query := url.Values{
+		"symbol": {symbol},
+		"start":  {end.Add(-time.Duration(hours) * time.Hour).Format(time.RFC3339)},
+		"end":    {end.Format(time.RFC3339)},
+	}
+	if setResolution {
+		query.Set("tf", resolution)
+	}
+	target := strings.TrimSuffix(a.base, "/") + path + "?" + query.Encode()
+
+	var latency, server time.Duration
+	var hits, payload int
+	for i := 0; i < a.requests; i++ {
+		result.Requests++
+		start := time.Now()
+		response, size, err := a.get(ctx, target)
+		elapsed := time.Since(start)
+		if err != nil {
+			result.Errors++
+			log.Warn().Err(err).Str("endpoint", path).Str("symbol", symbol).Int("hours", hours).Msg("API request failed")
+			continue
+		}
+
+		latency += elapsed
+		server += time.Duration(response.Metadata.QueryTimeMs) * time.Millisecond
+		payload += size
+		if response.Metadata.CacheHit {
+			hits++
+		}
+	}
+
+	if ok := result.Requests - result.Errors; ok > 0 {
+		result.AvgLatencyMs = float64(latency.Microseconds()) / 1000 / float64(ok)
+		result.AvgServerMs = float64(server.Milliseconds()) / float64(ok)
+		result.CacheHitRate = float64(hits) / float64(ok)
+		result.AvgPayloadBytes = float64(payload) / float64(ok)
+	}
+	return result
+}
+
+// get fetches and decodes a candle response, returning its size in bytes
+func (a *apiProfiler) get(ctx context.Context, target string) (*models.CandleResponse, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, len(body), fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var response models.CandleResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, len(body), fmt.Errorf("failed to decode candles: %w", err)
+	}
+	return &response, len(body), nil
+}
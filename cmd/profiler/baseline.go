@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// noiseFloorMs is how many milliseconds a latency may worsen by without
+// counting as a regression, whatever the tolerance; fast queries jitter by
+// more than any sensible fraction of themselves
+const noiseFloorMs = 5
+
+// Outcomes of comparing a case with the baseline
+const (
+	diffOK         = "ok"
+	diffRegression = "REGRESSION"
+	diffNew        = "new"
+)
+
+// caseKey identifies a profiled case across runs
+type caseKey struct {
+	symbol     string
+	table      string
+	resolution string
+	hours      int
+}
+
+// caseDiff is one case of the current run next to the same case in the
+// baseline
+type caseDiff struct {
+	name           string
+	baselineMs     float64
+	currentMs      float64
+	baselinePoints int
+	currentPoints  int
+	baselineFailed bool
+	currentFailed  bool
+	hasPoints      bool
+	outcome        string
+	reason         string
+}
+
+// compareReports compares every profiled case, and every load case when
+// both runs load tested, against the baseline. Latency regresses when it
+// worsens by more than tolerance and noiseFloorMs, points when they drop by
+// more than tolerance, and a case regresses when it fails now but didn't
+// then. Cases the baseline lacks are only reported as new.
+func compareReports(baseline, current *Report, tolerance float64) []caseDiff {
+	before := slowestResults(baseline.Results)
+	after := slowestResults(current.Results)
+	keys := make([]caseKey, 0, len(after))
+	for key := range after {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.symbol != b.symbol {
+			return a.symbol < b.symbol
+		}
+		if a.table != b.table {
+			return a.table < b.table
+		}
+		if a.resolution != b.resolution {
+			return a.resolution < b.resolution
+		}
+		return a.hours < b.hours
+	})
+
+	var diffs []caseDiff
+	for _, key := range keys {
+		now := after[key]
+		diff := caseDiff{
+			name:          fmt.Sprintf("%s %s %dh", key.symbol, key.resolution, key.hours),
+			currentMs:     float64(now.QueryTimeMs),
+			currentPoints: now.Points,
+			currentFailed: now.Failed,
+			hasPoints:     true,
+		}
+		then, ok := before[key]
+		if !ok {
+			diff.outcome = diffNew
+			diffs = append(diffs, diff)
+			continue
+		}
+		diff.baselineMs = float64(then.QueryTimeMs)
+		diff.baselinePoints = then.Points
+		diff.baselineFailed = then.Failed
+
+		switch {
+		case now.Failed && !then.Failed:
+			diff.outcome, diff.reason = diffRegression, "query fails"
+		case now.Failed || then.Failed:
+			diff.outcome = diffOK
+		case latencyRegressed(diff.baselineMs, diff.currentMs, tolerance):
+			diff.outcome, diff.reason = diffRegression, "slower"
+		case float64(now.Points) < float64(then.Points)*(1-tolerance):
+			diff.outcome, diff.reason = diffRegression, "fewer points"
+		default:
+			diff.outcome = diffOK
+		}
+		diffs = append(diffs, diff)
+	}
+
+	if baseline.Load == nil || current.Load == nil {
+		return diffs
+	}
+	loadBefore := make(map[caseKey]LoadResult, len(baseline.Load.Cases))
+	for _, c := range baseline.Load.Cases {
+		loadBefore[caseKey{table: c.Table, hours: c.TimeRangeHours}] = c
+	}
+	for _, now := range current.Load.Cases {
+		diff := caseDiff{
+			name:      fmt.Sprintf("load %s %dh p95", now.Table, now.TimeRangeHours),
+			currentMs: now.P95Ms,
+		}
+		then, ok := loadBefore[caseKey{table: now.Table, hours: now.TimeRangeHours}]
+		switch {
+		case !ok:
+			diff.outcome = diffNew
+		case latencyRegressed(then.P95Ms, now.P95Ms, tolerance):
+			diff.baselineMs = then.P95Ms
+			diff.outcome, diff.reason = diffRegression, "slower"
+		default:
+			diff.baselineMs = then.P95Ms
+			diff.outcome = diffOK
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// slowestResults indexes results by case, keeping the slowest of repeats
+func slowestResults(results []ProfileResult) map[caseKey]ProfileResult {
+	byCase := make(map[caseKey]ProfileResult, len(results))
+	for _, r := range results {
+		key := caseKey{symbol: r.Symbol, table: r.Table, resolution: r.Resolution, hours: r.TimeRangeHours}
+		if prev, ok := byCase[key]; ok && prev.QueryTimeMs >= r.QueryTimeMs {
+			continue
+		}
+		byCase[key] = r
+	}
+	return byCase
+}
+
+// latencyRegressed reports whether current is worse than baseline by more
+// than tolerance and the noise floor
+func latencyRegressed(baseline, current, tolerance float64) bool {
+	return current > baseline*(1+tolerance) && current-baseline > noiseFloorMs
+}
+
+// countRegressions counts the regressed cases
+func countRegressions(diffs []caseDiff) int {
+	var n int
+	for _, d := range diffs {
+		if d.outcome == diffRegression {
+			n++
+		}
+	}
+	return n
+}
+
+// printDiffs writes the comparison as an aligned table
+func printDiffs(w io.Writer, diffs []caseDiff) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CASE\tBASELINE MS\tCURRENT MS\tCHANGE\tBASELINE POINTS\tCURRENT POINTS\tRESULT")
+	for _, d := range diffs {
+		baselineMs, change, baselinePoints := "-", "-", "-"
+		if d.outcome != diffNew {
+			baselineMs = formatMs(d.baselineMs, d.baselineFailed)
+			if !d.baselineFailed && !d.currentFailed && d.baselineMs > 0 {
+				change = fmt.Sprintf("%+.0f%%", (d.currentMs/d.baselineMs-1)*100)
+			}
+			if d.hasPoints {
+				baselinePoints = fmt.Sprint(d.baselinePoints)
+			}
+		}
+		currentPoints := "-"
+		if d.hasPoints {
+			currentPoints = fmt.Sprint(d.currentPoints)
+		}
+		result := d.outcome
+		if d.reason != "" {
+			result += " (" + d.reason + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.name, baselineMs, formatMs(d.currentMs, d.currentFailed), change, baselinePoints, currentPoints, result)
+	}
+	tw.Flush()
+}
+
+// formatMs formats a latency, or "failed" for a failed query
+func formatMs(ms float64, failed bool) string {
+	if failed {
+		return "failed"
+	}
+	return fmt.Sprintf("%.1f", ms)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// checkContract queries every contract resolution over its max range for
+// each symbol and returns the queries that failed or took acceptable_ms or
+// longer, the slowest symbol's per resolution. Contracts without targets are
+// held to the profiler's own.
+func (p *DataProfiler) checkContract(ctx context.Context, contract *models.DataContract) []WorstCase {
+	log.Info().Msg("\n\n🚦 Checking Data Contract")
+
+	names := make([]string, 0, len(contract.Resolutions))
+	for name := range contract.Resolutions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	acceptable := int64(contract.PerformanceTargets.AcceptableMs)
+	if acceptable <= 0 {
+		acceptable = acceptableMs
+	}
+	var violations []WorstCase
+	for _, name := range names {
+		resolution := contract.Resolutions[name]
+		hours := max(int(time.Duration(resolution.MaxRangeMs)*time.Millisecond/time.Hour), 1)
+
+		worst, failed := WorstCase{Resolution: name, TimeRangeHours: hours}, false
+		for _, symbol := range p.symbols {
+			result := p.profileTable(ctx, resolution.Table, name, symbol, hours)
+			p.results = append(p.results, result)
+
+			log.Info().
+				Str("resolution", name).
+				Str("symbol", symbol).
+				Int("hours", hours).
+				Float64("ms", float64(result.QueryTimeMs)).
+				Str("status", result.Status).
+				Msg("Contract check")
+
+			if result.Failed && !failed {
+				failed = true
+				worst.Symbol, worst.QueryTimeMs = symbol, result.QueryTimeMs
+			}
+			if !failed && (worst.Symbol == "" || result.QueryTimeMs > worst.QueryTimeMs) {
+				worst.Symbol, worst.QueryTimeMs = symbol, result.QueryTimeMs
+			}
+		}
+		p.worstCases = append(p.worstCases, worst)
+
+		if failed || worst.QueryTimeMs >= acceptable {
+			violations = append(violations, worst)
+		}
+	}
+	return violations
+}
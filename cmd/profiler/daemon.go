@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Unhealthy database backoff: the first retry waits daemonBackoff, doubling
+// on each failed check up to the run interval
+const daemonBackoff = 30 * time.Second
+
+// daemonBounds are the upper bounds of the probe duration histograms
+var daemonBounds = []time.Duration{
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// daemonOptions configures the resident profiler
+type daemonOptions struct {
+	interval    time.Duration
+	metricsAddr string
+	historyPath string // JSON lines appended per run; empty keeps no history
+}
+
+// daemonRun is one scheduled probe run, as appended to the history log
+type daemonRun struct {
+	Started    time.Time       `json:"started"`
+	DurationMs int64           `json:"duration_ms"`
+	Results    []ProfileResult `json:"results"`
+}
+
+// probeKey identifies a probed table and symbol
+type probeKey struct {
+	table  string
+	symbol string
+}
+
+// probeHistogram counts probe durations under daemonBounds
+type probeHistogram struct {
+	buckets []int64 // per bound, then +Inf
+	sum     time.Duration
+	count   int64
+}
+
+// daemonMetrics holds what the daemon exports, guarded by mu
+type daemonMetrics struct {
+	mu         sync.Mutex
+	latest     map[probeKey]ProfileResult
+	histograms map[probeKey]*probeHistogram
+	failures   map[probeKey]int64
+	runs       map[string]int64 // by outcome: ok, skipped, unhealthy
+	lastRun    time.Time
+}
+
+// runDaemon probes the profiled tables for every symbol each interval until
+// ctx ends, serving the results as Prometheus metrics. The first run is
+// jittered by up to a tenth of the interval so several profilers don't probe
+// in step; runs due while one is still going are skipped, and an unhealthy
+// database is retried with backoff rather than probed.
+func (p *DataProfiler) runDaemon(ctx context.Context, opts daemonOptions) {
+	metrics := &daemonMetrics{
+		latest:     make(map[probeKey]ProfileResult),
+		histograms: make(map[probeKey]*probeHistogram),
+		failures:   make(map[probeKey]int64),
+		runs:       make(map[string]int64),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metrics.serve)
+	srv := &http.Server{Addr: opts.metricsAddr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		log.Info().Str("address", opts.metricsAddr).Msg("Serving profiler metrics")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("Profiler metrics server failed")
+		}
+	}()
+	defer srv.Close()
+
+	var running atomic.Bool
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	wait := time.Duration(rand.Int63n(int64(opts.interval/10) + 1))
+	backoff := daemonBackoff
+	log.Info().Dur("interval", opts.interval).Dur("first_run_in", wait).Msg("Profiler daemon started")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = opts.interval
+
+		if !running.CompareAndSwap(false, true) {
+			metrics.countRun("skipped")
+			log.Warn().Msg("Previous profiling run still going, skipping this one")
+			continue
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := p.pool.HealthCheck(pingCtx)
+		cancel()
+		if err != nil {
+			running.Store(false)
+			metrics.countRun("unhealthy")
+			wait = min(backoff, opts.interval)
+			backoff *= 2
+			log.Warn().Err(err).Dur("retry_in", wait).Msg("Database unhealthy, backing off")
+			continue
+		}
+		backoff = daemonBackoff
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer running.Store(false)
+			run := p.probe(ctx)
+			metrics.record(run)
+			if opts.historyPath != "" {
+				if err := appendRun(opts.historyPath, run); err != nil {
+					log.Error().Err(err).Msg("Failed to append profiling run to history")
+				}
+			}
+		}()
+	}
+}
+
+// probe runs the reduced probe set: every profiled table once per symbol
+func (p *DataProfiler) probe(ctx context.Context) daemonRun {
+	run := daemonRun{Started: time.Now().UTC()}
+	for _, symbol := range p.symbols {
+		for _, table := range p.tables {
+			if ctx.Err() != nil {
+				break
+			}
+			run.Results = append(run.Results, p.profileTable(ctx, table.name, table.resolution, symbol, table.hours))
+		}
+	}
+	run.DurationMs = time.Since(run.Started).Milliseconds()
+	log.Info().Int("probes", len(run.Results)).Int64("duration_ms", run.DurationMs).Msg("Profiling run complete")
+	return run
+}
+
+// appendRun appends run to the history log as one JSON line
+func appendRun(path string, run daemonRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// countRun counts a run by outcome
+func (m *daemonMetrics) countRun(outcome string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs[outcome]++
+}
+
+// record keeps a completed run's results as the latest and adds them to the
+// histograms
+func (m *daemonMetrics) record(run daemonRun) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.runs["ok"]++
+	m.lastRun = run.Started
+	for _, result := range run.Results {
+		key := probeKey{table: result.Table, symbol: result.Symbol}
+		m.latest[key] = result
+		if result.Failed {
+			m.failures[key]++
+			continue
+		}
+
+		h := m.histograms[key]
+		if h == nil {
+			h = &probeHistogram{buckets: make([]int64, len(daemonBounds)+1)}
+			m.histograms[key] = h
+		}
+		d := time.Duration(result.QueryTimeMs) * time.Millisecond
+		i := sort.Search(len(daemonBounds), func(i int) bool { return d <= daemonBounds[i] })
+		h.buckets[i]++
+		h.sum += d
+		h.count++
+	}
+}
+
+// serve writes the metrics in the Prometheus text exposition format
+func (m *daemonMetrics) serve(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]probeKey, 0, len(m.latest))
+	for key := range m.latest {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].table != keys[j].table {
+			return keys[i].table < keys[j].table
+		}
+		return keys[i].symbol < keys[j].symbol
+	})
+
+	var b strings.Builder
+	writeFamily(&b, "sptrader_profiler_query_seconds", "gauge", "Duration of the latest probe query by table and symbol")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "sptrader_profiler_query_seconds{%s} %s\n", key.labels(), formatSeconds(time.Duration(m.latest[key].QueryTimeMs)*time.Millisecond))
+	}
+
+	writeFamily(&b, "sptrader_profiler_query_points", "gauge", "Rows returned by the latest probe query by table and symbol")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "sptrader_profiler_query_points{%s} %d\n", key.labels(), m.latest[key].Points)
+	}
+
+	writeFamily(&b, "sptrader_profiler_query_duration_seconds", "histogram", "Duration of all successful probe queries by table and symbol")
+	for _, key := range keys {
+		h := m.histograms[key]
+		if h == nil {
+			continue
+		}
+		var cumulative int64
+		for i, count := range h.buckets {
+			cumulative += count
+			le := "+Inf"
+			if i < len(daemonBounds) {
+				le = formatSeconds(daemonBounds[i])
+			}
+			fmt.Fprintf(&b, "sptrader_profiler_query_duration_seconds_bucket{%s,le=%q} %d\n", key.labels(), le, cumulative)
+		}
+		fmt.Fprintf(&b, "sptrader_profiler_query_duration_seconds_sum{%s} %s\n", key.labels(), formatSeconds(h.sum))
+		fmt.Fprintf(&b, "sptrader_profiler_query_duration_seconds_count{%s} %d\n", key.labels(), h.count)
+	}
+
+	writeFamily(&b, "sptrader_profiler_query_failures_total", "counter", "Failed probe queries by table and symbol")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "sptrader_profiler_query_failures_total{%s} %d\n", key.labels(), m.failures[key])
+	}
+
+	writeFamily(&b, "sptrader_profiler_runs_total", "counter", "Scheduled profiling runs by outcome")
+	for _, outcome := range []string{"ok", "skipped", "unhealthy"} {
+		fmt.Fprintf(&b, "sptrader_profiler_runs_total{outcome=%q} %d\n", outcome, m.runs[outcome])
+	}
+
+	writeFamily(&b, "sptrader_profiler_last_run_timestamp_seconds", "gauge", "Start of the last completed profiling run")
+	var last int64
+	if !m.lastRun.IsZero() {
+		last = m.lastRun.Unix()
+	}
+	fmt.Fprintf(&b, "sptrader_profiler_last_run_timestamp_seconds %d\n", last)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// labels returns the key as Prometheus labels
+func (k probeKey) labels() string {
+	return fmt.Sprintf("table=%q,symbol=%q", k.table, k.symbol)
+}
+
+// writeFamily writes a metric family's HELP and TYPE lines
+func writeFamily(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// formatSeconds formats d in seconds for the exposition format
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// explainResult captures the plan of the query result was measured with and
+// flags it when no interval scan narrows it to the queried range. If the
+// server can't EXPLAIN, plans are given up for the rest of the run rather
+// than failing the profile.
+func (p *DataProfiler) explainResult(ctx context.Context, query string, result *ProfileResult) {
+	plan, err := p.explainQuery(ctx, query, result.Symbol)
+	if err != nil {
+		p.explain = false
+		log.Warn().Err(err).Msg("EXPLAIN failed, not capturing query plans; QuestDB 7.3 or later is needed")
+		return
+	}
+
+	result.Plan = plan
+	result.FullScan = !hasIntervalScan(plan)
+	if result.FullScan {
+		log.Warn().
+			Str("symbol", result.Symbol).
+			Str("table", result.Table).
+			Int("hours", result.TimeRangeHours).
+			Msg("Query plan scans without a timestamp interval")
+	}
+}
+
+// explainQuery returns the plan QuestDB chose for query, one node per line
+func (p *DataProfiler) explainQuery(ctx context.Context, query, symbol string) (string, error) {
+	rows, err := p.pool.Query(ctx, "EXPLAIN "+strings.TrimSpace(query), symbol)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// hasIntervalScan reports whether a plan reads its table through an interval
+// scan on the designated timestamp, which the partition pruning of a range
+// filter shows up as, rather than a full frame scan
+func hasIntervalScan(plan string) bool {
+	plan = strings.ToLower(plan)
+	return strings.Contains(plan, "interval forward scan") || strings.Contains(plan, "interval backward scan")
+}
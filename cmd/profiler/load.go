@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// loadOptions configures a load test run
+type loadOptions struct {
+	workers  int
+	duration time.Duration // measured time per case
+	warmup   time.Duration // unmeasured time before it
+}
+
+// LoadReport holds the load test results per (table, range) case and over
+// all of them
+type LoadReport struct {
+	Workers    int          `json:"workers"`
+	DurationMs int64        `json:"duration_ms"`
+	WarmupMs   int64        `json:"warmup_ms"`
+	Overall    LoadResult   `json:"overall"`
+	Cases      []LoadResult `json:"cases"`
+}
+
+// LoadResult summarizes the measured queries of a load test case. The
+// overall result has no table or range.
+type LoadResult struct {
+	Table          string  `json:"table,omitempty"`
+	TimeRangeHours int     `json:"time_range_hours,omitempty"`
+	Requests       int     `json:"requests"`
+	Errors         int     `json:"errors"`
+	ErrorRate      float64 `json:"error_rate"`
+	ThroughputRPS  float64 `json:"throughput_rps"`
+	P50Ms          float64 `json:"p50_ms"`
+	P90Ms          float64 `json:"p90_ms"`
+	P95Ms          float64 `json:"p95_ms"`
+	P99Ms          float64 `json:"p99_ms"`
+}
+
+// loadSample is one query of a load test case; latency covers reading every
+// row, not just the first
+type loadSample struct {
+	latency time.Duration
+	err     error
+}
+
+// runLoad runs each profiled table as a load test case, one after another,
+// with workers querying the profiler's symbols in turn
+func (p *DataProfiler) runLoad(ctx context.Context, opts loadOptions) {
+	log.Info().
+		Int("workers", opts.workers).
+		Dur("duration", opts.duration).
+		Dur("warmup", opts.warmup).
+		Msg("\n🔥 Load Testing")
+
+	report := &LoadReport{
+		Workers:    opts.workers,
+		DurationMs: opts.duration.Milliseconds(),
+		WarmupMs:   opts.warmup.Milliseconds(),
+	}
+	var all []loadSample
+	for _, table := range p.tables {
+		samples := p.loadCase(ctx, table, opts)
+		all = append(all, samples...)
+
+		result := summarizeLoad(samples, opts.duration)
+		result.Table, result.TimeRangeHours = table.name, table.hours
+		report.Cases = append(report.Cases, result)
+
+		log.Info().
+			Str("table", table.name).
+			Int("hours", table.hours).
+			Int("requests", result.Requests).
+			Float64("rps", result.ThroughputRPS).
+			Float64("error_rate", result.ErrorRate).
+			Float64("p50_ms", result.P50Ms).
+			Float64("p99_ms", result.P99Ms).
+			Msg("Load case complete")
+	}
+
+	report.Overall = summarizeLoad(all, opts.duration*time.Duration(len(p.tables)))
+	log.Info().
+		Int("requests", report.Overall.Requests).
+		Float64("rps", report.Overall.ThroughputRPS).
+		Float64("error_rate", report.Overall.ErrorRate).
+		Float64("p50_ms", report.Overall.P50Ms).
+		Float64("p90_ms", report.Overall.P90Ms).
+		Float64("p95_ms", report.Overall.P95Ms).
+		Float64("p99_ms", report.Overall.P99Ms).
+		Msg("Load test complete")
+	p.load = report
+}
+
+// loadCase runs the workers against one table for the warm-up and the
+// measured duration, returning the samples of queries started after the
+// warm-up. Queries cut off by the end of the run aren't counted.
+func (p *DataProfiler) loadCase(ctx context.Context, table profileTable, opts loadOptions) []loadSample {
+	query := candleQuery(table.name, table.resolution, table.hours)
+	measureFrom := time.Now().Add(opts.warmup)
+	ctx, cancel := context.WithDeadline(ctx, measureFrom.Add(opts.duration))
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		samples []loadSample
+		wg      sync.WaitGroup
+	)
+	for w := 0; w < opts.workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; ctx.Err() == nil; i++ {
+				symbol := p.symbols[i%len(p.symbols)]
+				start := time.Now()
+				err := p.drainQuery(ctx, query, symbol)
+				if ctx.Err() != nil || start.Before(measureFrom) {
+					continue
+				}
+
+				mu.Lock()
+				samples = append(samples, loadSample{latency: time.Since(start), err: err})
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	return samples
+}
+
+// drainQuery runs query for symbol and reads every row
+func (p *DataProfiler) drainQuery(ctx context.Context, query, symbol string) error {
+	rows, err := p.pool.Query(ctx, query, symbol)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// summarizeLoad computes throughput over elapsed and the latency
+// percentiles of the successful samples
+func summarizeLoad(samples []loadSample, elapsed time.Duration) LoadResult {
+	result := LoadResult{Requests: len(samples)}
+	latencies := make([]time.Duration, 0, len(samples))
+	for _, s := range samples {
+		if s.err != nil {
+			result.Errors++
+			continue
+		}
+		latencies = append(latencies, s.latency)
+	}
+	if result.Requests > 0 {
+		result.ErrorRate = float64(result.Errors) / float64(result.Requests)
+	}
+	if elapsed > 0 {
+		result.ThroughputRPS = float64(result.Requests) / elapsed.Seconds()
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	result.P50Ms = percentileMs(latencies, 50)
+	result.P90Ms = percentileMs(latencies, 90)
+	result.P95Ms = percentileMs(latencies, 95)
+	result.P99Ms = percentileMs(latencies, 99)
+	return result
+}
+
+// percentileMs returns the nearest-rank percentile of sorted latencies in
+// milliseconds, 0 when there are none
+func percentileMs(sorted []time.Duration, percentile float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	rank = min(max(rank, 1), len(sorted))
+	return float64(sorted[rank-1].Microseconds()) / 1000
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"runtime"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// resultSizes are the measured sizes of one query result: as sent by the
+// database, decoded into candles as the API holds them, and JSON encoded as
+// the API serves them
+type resultSizes struct {
+	rows      int
+	rawBytes  int64
+	heapBytes int64
+	jsonBytes int64
+}
+
+// perRow returns bytes divided over the rows, 0 without rows
+func (s resultSizes) perRow(bytes int64) float64 {
+	if s.rows == 0 {
+		return 0
+	}
+	return float64(bytes) / float64(s.rows)
+}
+
+// measureRows decodes timestamp, open, high, low, close and volume rows into
+// candles, measuring the heap they retain between two collections, then
+// encodes them. The heap delta includes the slice's spare capacity, as a
+// real response's would.
+func measureRows(rows pgx.Rows) (resultSizes, error) {
+	var sizes resultSizes
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	var candles []models.Candle
+	for rows.Next() {
+		for _, value := range rows.RawValues() {
+			sizes.rawBytes += int64(len(value))
+		}
+
+		var candle models.Candle
+		var volume *float64
+		if err := rows.Scan(&candle.Timestamp, &candle.Open, &candle.High, &candle.Low, &candle.Close, &volume); err != nil {
+			return sizes, err
+		}
+		if volume != nil {
+			candle.Volume = *volume
+		}
+		candles = append(candles, candle)
+	}
+	if err := rows.Err(); err != nil {
+		return sizes, err
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	sizes.rows = len(candles)
+	sizes.heapBytes = max(int64(after.HeapAlloc)-int64(before.HeapAlloc), 0)
+
+	encoded, err := json.Marshal(candles)
+	if err != nil {
+		return sizes, err
+	}
+	sizes.jsonBytes = int64(len(encoded))
+	return sizes, nil
+}
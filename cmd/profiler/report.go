@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// reportSchemaVersion is bumped whenever a field of Report is renamed or
+// removed, so archived reports can still be told apart
+const reportSchemaVersion = 1
+
+// Report is the machine-readable result of a profiler run
+type Report struct {
+	SchemaVersion int               `json:"schema_version"`
+	Environment   Environment       `json:"environment"`
+	Symbols       []string          `json:"symbols"`
+	Results       []ProfileResult   `json:"results"`     // per symbol
+	WorstCases    []WorstCase       `json:"worst_cases"` // per contract resolution
+	Load          *LoadReport       `json:"load,omitempty"`
+	API           []APIResult       `json:"api,omitempty"` // end-to-end timings beside the SQL ones
+	WriteBench    *WriteBenchReport `json:"write_bench,omitempty"`
+
+	SampleBy                []SampleByResult         `json:"sample_by,omitempty"`
+	SampleByRecommendations []SampleByRecommendation `json:"sample_by_recommendations,omitempty"`
+}
+
+// Environment describes the database the results were measured against
+type Environment struct {
+	QuestDBVersion string           `json:"questdb_version"`
+	DatabaseHost   string           `json:"database_host"`
+	Hostname       string           `json:"hostname"`
+	Timestamp      time.Time        `json:"timestamp"`
+	RowCounts      map[string]int64 `json:"row_counts"` // by table; tables that couldn't be counted are left out
+}
+
+// csvHeader names the columns written by writeCSV, in ProfileResult order;
+// plans don't fit a cell and are left out
+var csvHeader = []string{
+	"symbol", "table", "resolution", "time_range_hours", "points", "query_time_ms",
+	"points_per_ms", "status", "memory_estimate_mb", "raw_bytes_per_row",
+	"memory_bytes_per_row", "json_bytes_per_row", "failed", "full_scan",
+}
+
+// buildReport collects the environment metadata and the results so far
+func (p *DataProfiler) buildReport(ctx context.Context, databaseURL string) *Report {
+	env := Environment{
+		Timestamp: time.Now().UTC(),
+		RowCounts: make(map[string]int64),
+	}
+	if u, err := url.Parse(databaseURL); err == nil {
+		env.DatabaseHost = u.Host
+	}
+	env.Hostname, _ = os.Hostname()
+
+	if err := p.pool.QueryRow(ctx, "SELECT build()").Scan(&env.QuestDBVersion); err != nil {
+		log.Warn().Err(err).Msg("Failed to read QuestDB version")
+	}
+	for _, result := range p.results {
+		if _, ok := env.RowCounts[result.Table]; ok {
+			continue
+		}
+		var rows int64
+		if err := p.pool.QueryRow(ctx, fmt.Sprintf("SELECT count() FROM %s", result.Table)).Scan(&rows); err != nil {
+			log.Warn().Err(err).Str("table", result.Table).Msg("Failed to count rows")
+			continue
+		}
+		env.RowCounts[result.Table] = rows
+	}
+
+	return &Report{
+		SchemaVersion: reportSchemaVersion,
+		Environment:   env,
+		Symbols:       p.symbols,
+		Results:       p.results,
+		WorstCases:    p.worstCases,
+		Load:          p.load,
+		API:           p.apiResults,
+		WriteBench:    p.writeBench,
+
+		SampleBy:                p.sampleBy,
+		SampleByRecommendations: p.sampleByAdvice,
+	}
+}
+
+// writeReport writes the report to path as json or csv. CSV has no room for
+// the environment, so it holds the results only.
+func writeReport(path, format string, report *Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	defer f.Close()
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	case "csv":
+		err = writeCSV(f, report.Results)
+	default:
+		return fmt.Errorf("unknown report format %q, want json or csv", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return f.Close()
+}
+
+// readReport loads a JSON report written by an earlier run
+func readReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %w", path, err)
+	}
+	if report.SchemaVersion != reportSchemaVersion {
+		return nil, fmt.Errorf("report %s has schema version %d, want %d", path, report.SchemaVersion, reportSchemaVersion)
+	}
+	return &report, nil
+}
+
+// writeCSV writes one row per result under csvHeader
+func writeCSV(f *os.File, results []ProfileResult) error {
+	w := csv.NewWriter(f)
+	if err := w.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, r := range results {
+		record := []string{
+			r.Symbol,
+			r.Table,
+			r.Resolution,
+			strconv.Itoa(r.TimeRangeHours),
+			strconv.Itoa(r.Points),
+			strconv.FormatInt(r.QueryTimeMs, 10),
+			strconv.FormatFloat(r.PointsPerMs, 'f', -1, 64),
+			r.Status,
+			strconv.FormatFloat(r.MemoryEstimateMB, 'f', -1, 64),
+			strconv.FormatFloat(r.RawBytesPerRow, 'f', -1, 64),
+			strconv.FormatFloat(r.MemoryBytesPerRow, 'f', -1, 64),
+			strconv.FormatFloat(r.JSONBytesPerRow, 'f', -1, 64),
+			strconv.FormatBool(r.Failed),
+			strconv.FormatBool(r.FullScan),
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
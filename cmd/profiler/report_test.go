@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// update rewrites the golden files from the current output:
+//
+//	go test ./cmd/profiler -run Report -update
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testReport has every section filled, including a failed result and a
+// plan, which CSV leaves out
+func testReport() *Report {
+	recommended := WriteBenchResult{BatchSize: 1000, Workers: 4, Rows: 100000, DurationMs: 812, RowsPerSec: 123152.71, FlushAvgMs: 7.9, FlushP50Ms: 7.2, FlushP99Ms: 15.4}
+	return &Report{
+		SchemaVersion: reportSchemaVersion,
+		Environment: Environment{
+			QuestDBVersion: "QuestDB 7.3.10",
+			DatabaseHost:   "localhost:8812",
+			Hostname:       "bench-1",
+			Timestamp:      time.Date(2024, 3, 4, 12, 30, 0, 0, time.UTC),
+			RowCounts:      map[string]int64{"ohlc_1h_v2": 52000, "market_data_v2": 48000000},
+		},
+		Symbols: []string{"EURUSD", "GBPUSD"},
+		Results: []ProfileResult{
+			{Symbol: "EURUSD", Table: "ohlc_1h_v2", Resolution: "1h", TimeRangeHours: 720, Points: 720, QueryTimeMs: 12, PointsPerMs: 60, Status: "⚡ Excellent", MemoryEstimateMB: 0.08, RawBytesPerRow: 56, MemoryBytesPerRow: 112.5, JSONBytesPerRow: 131.25},
+			{Symbol: "GBPUSD", Table: "market_data_v2", Resolution: "1m", TimeRangeHours: 24, Points: 1440, QueryTimeMs: 640, PointsPerMs: 2.25, Status: "🐌 Slow", MemoryEstimateMB: 0.16, RawBytesPerRow: 56, MemoryBytesPerRow: 112.5, JSONBytesPerRow: 130, FullScan: true, Plan: "SampleBy\n    DataFrame\n        Row forward scan"},
+			{Symbol: "GBPUSD", Table: "ohlc_1d_v2", Resolution: "1d", TimeRangeHours: 8760, QueryTimeMs: 5000, Status: "❌ Failed", Failed: true},
+		},
+		WorstCases: []WorstCase{
+			{Resolution: "1h", Symbol: "EURUSD", TimeRangeHours: 720, QueryTimeMs: 12, MemoryBytesPerRow: 112.5, JSONBytesPerRow: 131.25},
+		},
+		Load: &LoadReport{
+			Workers:    8,
+			DurationMs: 30000,
+			WarmupMs:   5000,
+			Overall:    LoadResult{Requests: 4000, Errors: 2, ErrorRate: 0.0005, ThroughputRPS: 133.33, P50Ms: 21, P90Ms: 48, P95Ms: 60.5, P99Ms: 110},
+			Cases: []LoadResult{
+				{Table: "ohlc_1h_v2", TimeRangeHours: 720, Requests: 4000, Errors: 2, ErrorRate: 0.0005, ThroughputRPS: 133.33, P50Ms: 21, P90Ms: 48, P95Ms: 60.5, P99Ms: 110},
+			},
+		},
+		API: []APIResult{
+			{Endpoint: "/api/v1/candles", Symbol: "EURUSD", Table: "ohlc_1h_v2", Resolution: "1h", TimeRangeHours: 720, Requests: 5, AvgLatencyMs: 9.4, AvgServerMs: 3.2, CacheHitRate: 0.8, AvgPayloadBytes: 94500, SQLQueryTimeMs: 12},
+		},
+		WriteBench: &WriteBenchReport{
+			Table:       "market_data_bench",
+			Rows:        100000,
+			Results:     []WriteBenchResult{recommended, {BatchSize: 10000, Workers: 1, Error: "connection reset by peer"}},
+			Recommended: &recommended,
+		},
+		SampleBy: []SampleByResult{
+			{Timeframe: "1h", Table: "ohlc_1h_v2", Symbol: "EURUSD", TimeRangeHours: 24, TableMs: 2.5, SampleByMs: 40, Speedup: 16, Bars: 24, Matched: true},
+			{Timeframe: "1h", Table: "ohlc_1h_v2", Symbol: "GBPUSD", TimeRangeHours: 24, TableMs: 2.5, SampleByMs: 35, Speedup: 14, Bars: 24, Mismatch: "2024-03-04T10:00:00Z close 1.2701 vs 1.2702"},
+		},
+		SampleByRecommendations: []SampleByRecommendation{
+			{Timeframe: "1h", Table: "ohlc_1h_v2", AvgSpeedup: 15, Recommendation: "keep: 15x faster, but 1 comparison mismatched"},
+		},
+	}
+}
+
+// checkGolden compares got with testdata/name, or rewrites it with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s changed; if the change is intended, run with -update\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestWriteReportGolden(t *testing.T) {
+	tests := []struct {
+		format string
+		golden string
+	}{
+		{"json", "report.golden.json"},
+		{"csv", "report.golden.csv"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "report."+tt.format)
+		if err := writeReport(path, tt.format, testReport()); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGolden(t, tt.golden, got)
+	}
+}
+
+// Baselines are earlier runs' JSON reports, so they must read back as written
+func TestReadReportRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	want := testReport()
+	if err := writeReport(path, "json", want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read back %+v, want %+v", got, want)
+	}
+}
+
+func TestReadReportRejectsOtherSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	report := testReport()
+	report.SchemaVersion = reportSchemaVersion + 1
+	if err := writeReport(path, "json", report); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readReport(path); err == nil {
+		t.Error("read a report of another schema version, want an error")
+	}
+}
+
+func TestWriteReportUnknownFormat(t *testing.T) {
+	if err := writeReport(filepath.Join(t.TempDir(), "report.xml"), "xml", testReport()); err == nil {
+		t.Error("wrote an xml report, want an error")
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Average speedups of a pre-aggregated table over SAMPLE BY at or above
+// keepSpeedup make it worth maintaining; below dropSpeedup it isn't
+const (
+	keepSpeedup = 2.0
+	dropSpeedup = 1.2
+)
+
+// SampleByResult compares one pre-aggregated table query with the SAMPLE BY
+// over ticks it stands for
+type SampleByResult struct {
+	Timeframe      string  `json:"timeframe"`
+	Table          string  `json:"table"`
+	Symbol         string  `json:"symbol"`
+	TimeRangeHours int     `json:"time_range_hours"`
+	TableMs        float64 `json:"table_ms"`
+	SampleByMs     float64 `json:"sample_by_ms"`
+	Speedup        float64 `json:"speedup"` // SampleByMs / TableMs
+	Bars           int     `json:"bars"`
+	Matched        bool    `json:"matched"`
+	Mismatch       string  `json:"mismatch,omitempty"`
+}
+
+// SampleByRecommendation says whether a timeframe's table still pays off
+type SampleByRecommendation struct {
+	Timeframe      string  `json:"timeframe"`
+	Table          string  `json:"table"`
+	AvgSpeedup     float64 `json:"avg_speedup"`
+	Matched        bool    `json:"matched"` // every comparison matched within tolerance
+	Recommendation string  `json:"recommendation"`
+}
+
+// ohlcBar is one compared OHLC bar
+type ohlcBar struct {
+	timestamp              time.Time
+	open, high, low, close float64
+	volume                 float64
+}
+
+// compareSampleBy runs each configured pre-aggregated table against SAMPLE
+// BY over market_data_v2 at the resolution's min, middle and max range, for
+// every symbol, and recommends per timeframe whether to keep the table.
+// Windows end at the last complete bar so both sides cover whole bars.
+func (p *DataProfiler) compareSampleBy(ctx context.Context, tolerance float64) {
+	log.Info().Float64("tolerance", tolerance).Msg("\n\n⚖️  Comparing SAMPLE BY with pre-aggregated tables")
+
+	for _, table := range p.tables {
+		if table.name == tickTable {
+			continue
+		}
+
+		var speedups float64
+		var results int
+		matched := true
+		for _, hours := range sampleByRanges(table.minHours, table.hours) {
+			for _, symbol := range p.symbols {
+				result := p.compareOne(ctx, table.name, table.resolution, table.bar, symbol, hours, tolerance)
+				p.sampleBy = append(p.sampleBy, result)
+
+				log.Info().
+					Str("timeframe", table.resolution).
+					Str("symbol", symbol).
+					Int("hours", hours).
+					Float64("table_ms", result.TableMs).
+					Float64("sample_by_ms", result.SampleByMs).
+					Float64("speedup", result.Speedup).
+					Bool("matched", result.Matched).
+					Str("mismatch", result.Mismatch).
+					Msg("SAMPLE BY comparison")
+
+				matched = matched && result.Matched
+				if result.Speedup > 0 {
+					speedups += result.Speedup
+					results++
+				}
+			}
+		}
+
+		recommendation := SampleByRecommendation{Timeframe: table.resolution, Table: table.name, Matched: matched}
+		if results > 0 {
+			recommendation.AvgSpeedup = speedups / float64(results)
+		}
+		switch {
+		case !matched:
+			recommendation.Recommendation = "investigate: the table differs from SAMPLE BY over ticks"
+		case results == 0:
+			recommendation.Recommendation = "unknown: no comparison succeeded"
+		case recommendation.AvgSpeedup >= keepSpeedup:
+			recommendation.Recommendation = "keep: the table is clearly faster"
+		case recommendation.AvgSpeedup < dropSpeedup:
+			recommendation.Recommendation = "drop: SAMPLE BY is about as fast"
+		default:
+			recommendation.Recommendation = "marginal: keep only if refresh cost is low"
+		}
+		p.sampleByAdvice = append(p.sampleByAdvice, recommendation)
+
+		log.Info().
+			Str("timeframe", recommendation.Timeframe).
+			Str("table", recommendation.Table).
+			Float64("avg_speedup", recommendation.AvgSpeedup).
+			Bool("matched", recommendation.Matched).
+			Msg(recommendation.Recommendation)
+	}
+	if len(p.sampleByAdvice) == 0 {
+		log.Warn().Msg("Every configured resolution reads ticks, no pre-aggregated table to compare")
+	}
+}
+
+// sampleByRanges returns the min, middle and max hours
+func sampleByRanges(minHours, maxHours int) []int {
+	return []int{minHours, (minHours + maxHours) / 2, maxHours}
+}
+
+// compareOne times and compares a table and its SAMPLE BY equivalent over
+// the hours of whole bars before the current one
+func (p *DataProfiler) compareOne(ctx context.Context, table, timeframe string, interval time.Duration, symbol string, hours int, tolerance float64) SampleByResult {
+	result := SampleByResult{Timeframe: timeframe, Table: table, Symbol: symbol, TimeRangeHours: hours}
+
+	end := time.Now().UTC().Truncate(interval)
+	start := end.Add(-time.Duration(hours) * time.Hour).Truncate(interval)
+
+	tableQuery := fmt.Sprintf(`
+		SELECT timestamp, open, high, low, close, volume
+		FROM %s
+		WHERE symbol = $1
+			AND timestamp >= $2
+			AND timestamp < $3
+		ORDER BY timestamp
+	`, table)
+	sampleByQuery := fmt.Sprintf(`
+		SELECT
+			timestamp,
+			first(bid) as open,
+			max(bid) as high,
+			min(bid) as low,
+			last(bid) as close,
+			sum(volume) as volume
+		FROM %s
+		WHERE symbol = $1
+			AND timestamp >= $2
+			AND timestamp < $3
+		SAMPLE BY %s ALIGN TO CALENDAR
+		ORDER BY timestamp
+	`, tickTable, timeframe)
+
+	tableBars, tableTime, err := p.readBars(ctx, tableQuery, symbol, start, end)
+	if err != nil {
+		result.Mismatch = fmt.Sprintf("table query failed: %v", err)
+		return result
+	}
+	sampleBars, sampleTime, err := p.readBars(ctx, sampleByQuery, symbol, start, end)
+	if err != nil {
+		result.Mismatch = fmt.Sprintf("SAMPLE BY query failed: %v", err)
+		return result
+	}
+
+	result.TableMs = float64(tableTime.Microseconds()) / 1000
+	result.SampleByMs = float64(sampleTime.Microseconds()) / 1000
+	if tableTime > 0 {
+		result.Speedup = float64(sampleTime) / float64(tableTime)
+	}
+	result.Bars = len(tableBars)
+	result.Mismatch = diffBars(tableBars, sampleBars, tolerance)
+	result.Matched = result.Mismatch == ""
+	return result
+}
+
+// readBars runs an OHLC query and returns its bars and how long reading
+// them took
+func (p *DataProfiler) readBars(ctx context.Context, query, symbol string, start, end time.Time) ([]ohlcBar, time.Duration, error) {
+	began := time.Now()
+	rows, err := p.pool.Query(ctx, query, symbol, start, end)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var bars []ohlcBar
+	for rows.Next() {
+		var b ohlcBar
+		if err := rows.Scan(&b.timestamp, &b.open, &b.high, &b.low, &b.close, &b.volume); err != nil {
+			return nil, 0, err
+		}
+		bars = append(bars, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return bars, time.Since(began), nil
+}
+
+// diffBars describes the first difference between the table's bars and
+// SAMPLE BY's, comparing values relative to tolerance, or returns "" when
+// they match
+func diffBars(table, sampleBy []ohlcBar, tolerance float64) string {
+	if len(table) != len(sampleBy) {
+		return fmt.Sprintf("table has %d bars, SAMPLE BY %d", len(table), len(sampleBy))
+	}
+	for i := range table {
+		t, s := table[i], sampleBy[i]
+		if !t.timestamp.Equal(s.timestamp) {
+			return fmt.Sprintf("bar %d is at %s in the table, %s from SAMPLE BY", i, t.timestamp.Format(time.RFC3339), s.timestamp.Format(time.RFC3339))
+		}
+		for _, field := range []struct {
+			name string
+			a, b float64
+		}{
+			{"open", t.open, s.open},
+			{"high", t.high, s.high},
+			{"low", t.low, s.low},
+			{"close", t.close, s.close},
+			{"volume", t.volume, s.volume},
+		} {
+			if !withinTolerance(field.a, field.b, tolerance) {
+				return fmt.Sprintf("%s at %s is %g in the table, %g from SAMPLE BY", field.name, t.timestamp.Format(time.RFC3339), field.a, field.b)
+			}
+		}
+	}
+	return ""
+}
+
+// withinTolerance reports whether a and b differ by at most tolerance
+// relative to the larger of them
+func withinTolerance(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance*math.Max(math.Abs(a), math.Abs(b))
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/db"
+)
+
+// A configuration whose throughput is within recommendFraction of the best
+// is recommended over it if it uses fewer workers or smaller batches
+const recommendFraction = 0.9
+
+// writeBenchOptions configures a write benchmark run
+type writeBenchOptions struct {
+	ilpAddr   string
+	table     string // disposable; dropped before each configuration and after the run
+	rows      int    // per configuration
+	batches   []int
+	workers   []int
+	writePool *db.Pool
+}
+
+// WriteBenchReport holds the ILP write throughput per batch size and worker
+// count, and the configuration recommended for backfills
+type WriteBenchReport struct {
+	Table       string             `json:"table"`
+	Rows        int                `json:"rows"` // per configuration
+	Results     []WriteBenchResult `json:"results"`
+	Recommended *WriteBenchResult  `json:"recommended,omitempty"` // nil when every configuration failed
+}
+
+// WriteBenchResult is one batch size and worker count's throughput. Rows are
+// counted once flushed to the ILP socket, not once committed.
+type WriteBenchResult struct {
+	BatchSize  int     `json:"batch_size"`
+	Workers    int     `json:"workers"`
+	Rows       int     `json:"rows"`
+	DurationMs int64   `json:"duration_ms"`
+	RowsPerSec float64 `json:"rows_per_sec"`
+	FlushAvgMs float64 `json:"flush_avg_ms"`
+	FlushP50Ms float64 `json:"flush_p50_ms"`
+	FlushP99Ms float64 `json:"flush_p99_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// tickWalk generates synthetic ticks for one symbol: a random walk of the
+// bid around the price the ingestion test data centres on, with the same
+// spread and volume ranges, a tick every 50ms to 1s
+type tickWalk struct {
+	rng *rand.Rand
+	bid float64
+	at  time.Time
+}
+
+// newTickWalk starts a walk at start. Walks with the same seed generate the
+// same ticks, so runs are repeatable.
+func newTickWalk(seed int64, start time.Time) *tickWalk {
+	return &tickWalk{rng: rand.New(rand.NewSource(seed)), bid: 1.08825, at: start}
+}
+
+// next advances the walk by one tick
+func (w *tickWalk) next() (at time.Time, bid, ask, volume float64) {
+	w.at = w.at.Add(time.Duration(50+w.rng.Intn(950)) * time.Millisecond)
+	w.bid += w.rng.NormFloat64() * 0.00001
+	spread := 0.00002 + float64(w.rng.Intn(10))*0.000001
+	volume = 1 + float64(w.rng.Intn(5))
+	return w.at, w.bid, w.bid + spread, volume
+}
+
+// benchWrites writes opts.rows synthetic ticks to the benchmark table for
+// every batch size and worker count, from scratch each time, and recommends
+// the setting to use for backfills
+func (p *DataProfiler) benchWrites(ctx context.Context, opts writeBenchOptions) {
+	log.Info().
+		Str("table", opts.table).
+		Int("rows", opts.rows).
+		Ints("batches", opts.batches).
+		Ints("workers", opts.workers).
+		Msg("\n\n✍️  Benchmarking ILP writes")
+
+	report := &WriteBenchReport{Table: opts.table, Rows: opts.rows}
+	defer func() {
+		if err := dropTable(context.WithoutCancel(ctx), opts.writePool, opts.table); err != nil {
+			log.Error().Err(err).Str("table", opts.table).Msg("Failed to drop benchmark table")
+		}
+	}()
+
+	for _, workers := range opts.workers {
+		for _, batch := range opts.batches {
+			if ctx.Err() != nil {
+				break
+			}
+			result := WriteBenchResult{BatchSize: batch, Workers: workers}
+			if err := dropTable(ctx, opts.writePool, opts.table); err != nil {
+				result.Error = err.Error()
+			} else {
+				result = p.benchWrite(ctx, opts, batch, workers)
+			}
+			report.Results = append(report.Results, result)
+
+			log.Info().
+				Int("batch", batch).
+				Int("workers", workers).
+				Int("rows", result.Rows).
+				Float64("rows_per_sec", result.RowsPerSec).
+				Float64("flush_p50_ms", result.FlushP50Ms).
+				Float64("flush_p99_ms", result.FlushP99Ms).
+				Str("error", result.Error).
+				Msg("Write configuration complete")
+		}
+	}
+
+	report.Recommended = recommendWrites(report.Results)
+	if r := report.Recommended; r != nil {
+		log.Info().
+			Int("batch", r.BatchSize).
+			Int("workers", r.Workers).
+			Float64("rows_per_sec", r.RowsPerSec).
+			Msg("Recommended write setting")
+	} else {
+		log.Warn().Msg("Every write configuration failed, nothing to recommend")
+	}
+	p.writeBench = report
+}
+
+// benchWrite has each worker write its share of the rows, taking the symbols
+// in turn, over its own ILP connection, flushing every batch rows
+func (p *DataProfiler) benchWrite(ctx context.Context, opts writeBenchOptions, batch, workers int) WriteBenchResult {
+	result := WriteBenchResult{BatchSize: batch, Workers: workers}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var (
+		mu       sync.Mutex
+		flushes  []time.Duration
+		written  int
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	began := time.Now()
+	for w := 0; w < workers; w++ {
+		rows := opts.rows / workers
+		if w < opts.rows%workers {
+			rows++
+		}
+		wg.Add(1)
+		go func(w, rows int) {
+			defer wg.Done()
+			symbol := p.symbols[w%len(p.symbols)]
+			n, durations, err := writeTicks(ctx, opts.ilpAddr, opts.table, symbol, newTickWalk(int64(w), start), rows, batch)
+
+			mu.Lock()
+			defer mu.Unlock()
+			written += n
+			flushes = append(flushes, durations...)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(w, rows)
+	}
+	wg.Wait()
+	elapsed := time.Since(began)
+
+	result.Rows = written
+	result.DurationMs = elapsed.Milliseconds()
+	if elapsed > 0 {
+		result.RowsPerSec = float64(written) / elapsed.Seconds()
+	}
+	if firstErr != nil {
+		result.Error = firstErr.Error()
+	}
+	if len(flushes) > 0 {
+		var total time.Duration
+		for _, d := range flushes {
+			total += d
+		}
+		result.FlushAvgMs = float64(total.Microseconds()) / 1000 / float64(len(flushes))
+	}
+	sort.Slice(flushes, func(i, j int) bool { return flushes[i] < flushes[j] })
+	result.FlushP50Ms = percentileMs(flushes, 50)
+	result.FlushP99Ms = percentileMs(flushes, 99)
+	return result
+}
+
+// writeTicks sends rows ticks from walk in the market_data_v2 layout,
+// flushing every batch rows and once at the end, and returns the rows
+// flushed and how long each flush took
+func writeTicks(ctx context.Context, ilpAddr, table, symbol string, walk *tickWalk, rows, batch int) (int, []time.Duration, error) {
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(ilpAddr))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to connect to ILP at %s: %w", ilpAddr, err)
+	}
+	defer sender.Close(context.WithoutCancel(ctx))
+
+	var flushed, pending int
+	var flushes []time.Duration
+	flush := func() error {
+		start := time.Now()
+		if err := sender.Flush(ctx); err != nil {
+			return err
+		}
+		flushes = append(flushes, time.Since(start))
+		flushed, pending = flushed+pending, 0
+		return nil
+	}
+
+	for i := 0; i < rows; i++ {
+		at, bid, ask, volume := walk.next()
+		err := sender.
+			Table(table).
+			Symbol("symbol", symbol).
+			Float64Column("bid", bid).
+			Float64Column("ask", ask).
+			Float64Column("price", (bid+ask)/2).
+			Float64Column("spread", ask-bid).
+			Float64Column("volume", volume).
+			Float64Column("bid_volume", volume*0.6).
+			Float64Column("ask_volume", volume*0.4).
+			Int64Column("hour_of_day", int64(at.Hour())).
+			Int64Column("day_of_week", int64(at.Weekday())).
+			StringColumn("trading_session", "LONDON").
+			BoolColumn("market_open", true).
+			At(ctx, at)
+		if err != nil {
+			return flushed, flushes, fmt.Errorf("failed to send tick %d: %w", i, err)
+		}
+		if pending++; pending == batch {
+			if err := flush(); err != nil {
+				return flushed, flushes, fmt.Errorf("failed to flush at tick %d: %w", i+1, err)
+			}
+		}
+	}
+	if pending > 0 {
+		if err := flush(); err != nil {
+			return flushed, flushes, fmt.Errorf("failed to final flush: %w", err)
+		}
+	}
+	return flushed, flushes, nil
+}
+
+// recommendWrites picks the fastest successful configuration, or a cheaper
+// one, with fewer workers and then smaller batches, within
+// recommendFraction of it
+func recommendWrites(results []WriteBenchResult) *WriteBenchResult {
+	var best float64
+	for _, r := range results {
+		if r.Error == "" {
+			best = max(best, r.RowsPerSec)
+		}
+	}
+	var pick *WriteBenchResult
+	for i, r := range results {
+		if r.Error != "" || r.RowsPerSec < best*recommendFraction {
+			continue
+		}
+		if pick == nil || r.Workers < pick.Workers || (r.Workers == pick.Workers && r.BatchSize < pick.BatchSize) {
+			pick = &results[i]
+		}
+	}
+	return pick
+}
+
+// dropTable drops the benchmark table if it exists
+func dropTable(ctx context.Context, pool *db.Pool, table string) error {
+	if _, err := pool.Exec(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", table)); err != nil {
+		return fmt.Errorf("failed to drop %s: %w", table, err)
+	}
+	return nil
+}
+
+// parseCounts parses a comma-separated list of positive counts
+func parseCounts(list string) ([]int, error) {
+	var counts []int
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%q is not a positive count", field)
+		}
+		counts = append(counts, n)
+	}
+	if len(counts) == 0 {
+		return nil, fmt.Errorf("no counts in %q", list)
+	}
+	return counts, nil
+}
@@ -0,0 +1,140 @@
+// Package analytics computes statistics across candle series.
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// Errors correlation returns for series it can't correlate
+var (
+	ErrNoOverlap      = errors.New("series share no bars")
+	ErrWindowTooLarge = errors.New("window larger than the series")
+)
+
+// Aligned holds the closes of two series at the timestamps both have a bar at
+type Aligned struct {
+	Timestamps []time.Time
+	A, B       []float64
+}
+
+// Align pairs the closes of two candle series, each in time order, on equal
+// timestamps, dropping bars missing from either side
+func Align(a, b []models.Candle) Aligned {
+	var aligned Aligned
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch ta, tb := a[i].Timestamp, b[j].Timestamp; {
+		case ta.Before(tb):
+			i++
+		case tb.Before(ta):
+			j++
+		default:
+			aligned.Timestamps = append(aligned.Timestamps, ta)
+			aligned.A = append(aligned.A, a[i].Close)
+			aligned.B = append(aligned.B, b[j].Close)
+			i++
+			j++
+		}
+	}
+	return aligned
+}
+
+// LogReturns returns the log return between each price and the one before
+// it, one fewer than there are prices. Prices must be positive.
+func LogReturns(prices []float64) ([]float64, error) {
+	if len(prices) < 2 {
+		return nil, nil
+	}
+	returns := make([]float64, len(prices)-1)
+	for i := 1; i < len(prices); i++ {
+		if prices[i-1] <= 0 || prices[i] <= 0 {
+			return nil, fmt.Errorf("price %g at %d is not positive", min(prices[i-1], prices[i]), i)
+		}
+		returns[i-1] = math.Log(prices[i] / prices[i-1])
+	}
+	return returns, nil
+}
+
+// Pearson returns the Pearson correlation of x and y, which must be the same
+// length, and false when it is undefined: fewer than two values, or either
+// side constant
+func Pearson(x, y []float64) (float64, bool) {
+	n := len(x)
+	if n < 2 || len(y) != n {
+		return 0, false
+	}
+	var meanX, meanY float64
+	for i := range x {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= float64(n)
+	meanY /= float64(n)
+
+	var cov, varX, varY float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0, false
+	}
+	// Rounding can push a perfect correlation just past ±1
+	return math.Max(-1, math.Min(1, cov/math.Sqrt(varX*varY))), true
+}
+
+// Correlation is the rolling and whole-series correlation of two aligned
+// series' log returns
+type Correlation struct {
+	Series  []models.CorrelationPoint
+	Overall *float64 // over every return; nil where undefined
+	Returns int
+}
+
+// RollingCorrelation correlates the log returns of two aligned series over
+// every window of returns, each point stamped with the bar its last return
+// ends at, and over all of them. A return between two aligned bars spans any
+// bars dropped between them.
+func RollingCorrelation(aligned Aligned, window int) (*Correlation, error) {
+	if window < 2 {
+		return nil, fmt.Errorf("window must be at least 2 returns, got %d", window)
+	}
+	if len(aligned.Timestamps) == 0 {
+		return nil, ErrNoOverlap
+	}
+	returnsA, err := LogReturns(aligned.A)
+	if err != nil {
+		return nil, err
+	}
+	returnsB, err := LogReturns(aligned.B)
+	if err != nil {
+		return nil, err
+	}
+	if window > len(returnsA) {
+		return nil, fmt.Errorf("%w: window of %d returns, but the %d aligned bars give %d",
+			ErrWindowTooLarge, window, len(aligned.Timestamps), len(returnsA))
+	}
+
+	result := &Correlation{
+		Series:  make([]models.CorrelationPoint, 0, len(returnsA)-window+1),
+		Returns: len(returnsA),
+	}
+	for end := window; end <= len(returnsA); end++ {
+		point := models.CorrelationPoint{Timestamp: aligned.Timestamps[end]}
+		if r, ok := Pearson(returnsA[end-window:end], returnsB[end-window:end]); ok {
+			point.Correlation = &r
+		}
+		result.Series = append(result.Series, point)
+	}
+	if r, ok := Pearson(returnsA, returnsB); ok {
+		result.Overall = &r
+	}
+	return result, nil
+}
@@ -0,0 +1,176 @@
+package analytics
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+var t0 = time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+
+func hour(n int) time.Time { return t0.Add(time.Duration(n) * time.Hour) }
+
+// candles builds hourly bars closing at the given prices, skipping the hours
+// in skip
+func candles(closes []float64, skip ...int) []models.Candle {
+	var out []models.Candle
+	for i, c := range closes {
+		if contains(skip, i) {
+			continue
+		}
+		out = append(out, models.Candle{Timestamp: hour(i), Open: c, High: c, Low: c, Close: c})
+	}
+	return out
+}
+
+func contains(xs []int, x int) bool {
+	for _, v := range xs {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
+
+// pricesFrom compounds log returns from a price of 1
+func pricesFrom(returns []float64) []float64 {
+	prices := []float64{1}
+	for _, r := range returns {
+		prices = append(prices, prices[len(prices)-1]*math.Exp(r))
+	}
+	return prices
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestAlignDropsUnmatchedBars(t *testing.T) {
+	a := candles([]float64{1, 2, 3, 4, 5}, 3)
+	b := candles([]float64{10, 20, 30, 40, 50, 60}, 1)
+
+	aligned := Align(a, b)
+	want := Aligned{
+		Timestamps: []time.Time{hour(0), hour(2), hour(4)},
+		A:          []float64{1, 3, 5},
+		B:          []float64{10, 30, 50},
+	}
+	if !reflect.DeepEqual(aligned, want) {
+		t.Errorf("Align = %+v, want %+v", aligned, want)
+	}
+}
+
+func TestLogReturns(t *testing.T) {
+	returns, err := LogReturns([]float64{100, 110, 99})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(returns) != 2 || !near(returns[0], math.Log(1.1)) || !near(returns[1], math.Log(0.9)) {
+		t.Errorf("LogReturns = %v, want [ln 1.1, ln 0.9]", returns)
+	}
+	if _, err := LogReturns([]float64{1, 0, 1}); err == nil {
+		t.Error("LogReturns accepted a zero price")
+	}
+}
+
+func TestPearson(t *testing.T) {
+	tests := []struct {
+		name    string
+		x, y    []float64
+		want    float64
+		defined bool
+	}{
+		{"identical", []float64{1, 2, 3}, []float64{1, 2, 3}, 1, true},
+		{"inverse", []float64{1, 2, 3}, []float64{6, 4, 2}, -1, true},
+		{"partial", []float64{1, 2, 3}, []float64{1, 3, 2}, 0.5, true},
+		{"constant side", []float64{1, 2, 3}, []float64{2, 2, 2}, 0, false},
+		{"single value", []float64{1}, []float64{1}, 0, false},
+		{"length mismatch", []float64{1, 2, 3}, []float64{1, 2}, 0, false},
+	}
+	for _, tt := range tests {
+		r, ok := Pearson(tt.x, tt.y)
+		if ok != tt.defined || !near(r, tt.want) {
+			t.Errorf("%s: Pearson = %g, %v, want %g, %v", tt.name, r, ok, tt.want, tt.defined)
+		}
+	}
+}
+
+func TestRollingCorrelation(t *testing.T) {
+	returnsA := []float64{0.01, 0.02, 0.03, 0.01}
+	returnsB := []float64{0.01, 0.03, 0.02, 0.01}
+
+	// A has a bar at hour 2 that B lacks, and B one at hour 6 A lacks; the
+	// return across hours 1 to 3 spans the dropped bar
+	closesA := pricesFrom(returnsA)
+	closesA = append(closesA[:2], append([]float64{7}, closesA[2:]...)...)
+	closesB := pricesFrom(returnsB)
+	closesB = append(closesB[:2], append([]float64{0}, closesB[2:]...)...)
+	closesB = append(closesB, 9)
+
+	aligned := Align(candles(closesA), candles(closesB, 2))
+	if len(aligned.Timestamps) != 5 {
+		t.Fatalf("aligned %d bars, want 5", len(aligned.Timestamps))
+	}
+
+	corr, err := RollingCorrelation(aligned, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if corr.Returns != 4 {
+		t.Errorf("Returns = %d, want 4", corr.Returns)
+	}
+	wantStamps := []time.Time{hour(4), hour(5)}
+	if len(corr.Series) != len(wantStamps) {
+		t.Fatalf("got %d points, want %d", len(corr.Series), len(wantStamps))
+	}
+	for i, point := range corr.Series {
+		if !point.Timestamp.Equal(wantStamps[i]) {
+			t.Errorf("point %d stamped %s, want %s", i, point.Timestamp, wantStamps[i])
+		}
+		if point.Correlation == nil || !near(*point.Correlation, 0.5) {
+			t.Errorf("point %d correlation = %v, want 0.5", i, point.Correlation)
+		}
+	}
+	if corr.Overall == nil || !near(*corr.Overall, 7.0/11) {
+		t.Errorf("overall correlation = %v, want 7/11", corr.Overall)
+	}
+}
+
+func TestRollingCorrelationUndefinedWindow(t *testing.T) {
+	// B doesn't move over the first window
+	aligned := Aligned{
+		Timestamps: []time.Time{hour(0), hour(1), hour(2), hour(3)},
+		A:          []float64{1, 1.1, 1.2, 1.1},
+		B:          []float64{2, 2, 2, 2.2},
+	}
+	corr, err := RollingCorrelation(aligned, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if corr.Series[0].Correlation != nil {
+		t.Errorf("window with a constant side has correlation %g, want none", *corr.Series[0].Correlation)
+	}
+	if corr.Series[1].Correlation == nil {
+		t.Error("window where both sides move has no correlation")
+	}
+}
+
+func TestRollingCorrelationErrors(t *testing.T) {
+	disjoint := Align(candles([]float64{1, 2, 3}, 1), candles([]float64{1, 2, 3}, 0, 2))
+	if _, err := RollingCorrelation(disjoint, 2); !errors.Is(err, ErrNoOverlap) {
+		t.Errorf("series without shared bars: err = %v, want ErrNoOverlap", err)
+	}
+
+	aligned := Align(candles([]float64{1, 2, 3, 4}), candles([]float64{4, 3, 2, 1}))
+	if _, err := RollingCorrelation(aligned, 4); !errors.Is(err, ErrWindowTooLarge) {
+		t.Errorf("window of 4 over 3 returns: err = %v, want ErrWindowTooLarge", err)
+	}
+	if _, err := RollingCorrelation(aligned, 3); err != nil {
+		t.Errorf("window of every return: %v", err)
+	}
+	if _, err := RollingCorrelation(aligned, 1); err == nil || errors.Is(err, ErrWindowTooLarge) {
+		t.Errorf("window of 1: err = %v, want a window size error", err)
+	}
+}
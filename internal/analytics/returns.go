@@ -0,0 +1,98 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// SimpleReturns returns the simple return between each price and the one
+// before it, one fewer than there are prices. Prices must be positive.
+func SimpleReturns(prices []float64) ([]float64, error) {
+	if len(prices) < 2 {
+		return nil, nil
+	}
+	returns := make([]float64, len(prices)-1)
+	for i := 1; i < len(prices); i++ {
+		if prices[i-1] <= 0 || prices[i] <= 0 {
+			return nil, fmt.Errorf("price %g at %d is not positive", min(prices[i-1], prices[i]), i)
+		}
+		returns[i-1] = prices[i]/prices[i-1] - 1
+	}
+	return returns, nil
+}
+
+// Returns returns the returns of kind, models.ReturnsSimple or
+// models.ReturnsLog, between consecutive prices
+func Returns(prices []float64, kind string) ([]float64, error) {
+	switch kind {
+	case models.ReturnsSimple:
+		return SimpleReturns(prices)
+	case models.ReturnsLog:
+		return LogReturns(prices)
+	default:
+		return nil, fmt.Errorf("unsupported returns type: %s", kind)
+	}
+}
+
+// Mean returns the mean of values, 0 without any
+func Mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// Stdev returns the sample standard deviation of values, 0 with fewer than
+// two
+func Stdev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	mean := Mean(values)
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(squares / float64(len(values)-1))
+}
+
+// MaxDrawdown returns the largest fall of prices from a running peak, as a
+// fraction of the peak, 0 if they never fall
+func MaxDrawdown(prices []float64) float64 {
+	var peak, drawdown float64
+	for _, p := range prices {
+		peak = max(peak, p)
+		if peak > 0 {
+			drawdown = max(drawdown, (peak-p)/peak)
+		}
+	}
+	return drawdown
+}
+
+// Summarize describes returns taken between prices, annualizing volatility
+// by the square root of barsPerYear
+func Summarize(prices, returns []float64, barsPerYear float64) models.ReturnStats {
+	stats := models.ReturnStats{
+		Count:       len(returns),
+		Mean:        Mean(returns),
+		Stdev:       Stdev(returns),
+		BarsPerYear: barsPerYear,
+		MaxDrawdown: MaxDrawdown(prices),
+	}
+	stats.AnnualizedVolatility = stats.Stdev * math.Sqrt(barsPerYear)
+	for i, r := range returns {
+		if i == 0 || r < stats.Min {
+			stats.Min = r
+		}
+		if i == 0 || r > stats.Max {
+			stats.Max = r
+		}
+	}
+	return stats
+}
@@ -0,0 +1,93 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+func TestStdev(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{[]float64{2, 4, 4, 4, 5, 5, 7, 9}, math.Sqrt(32.0 / 7)},
+		{[]float64{1, 3}, math.Sqrt2},
+		{[]float64{5, 5, 5}, 0},
+		{[]float64{5}, 0},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		if got := Stdev(tt.values); !near(got, tt.want) {
+			t.Errorf("Stdev(%v) = %g, want %g", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestMaxDrawdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		prices []float64
+		want   float64
+	}{
+		{"deepest of two falls", []float64{100, 120, 90, 110, 130, 104}, 0.25},
+		{"fall after the last peak", []float64{100, 110, 121, 60.5}, 0.5},
+		{"rising", []float64{1, 2, 3}, 0},
+		{"empty", nil, 0},
+	}
+	for _, tt := range tests {
+		if got := MaxDrawdown(tt.prices); !near(got, tt.want) {
+			t.Errorf("%s: MaxDrawdown = %g, want %g", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	prices := []float64{100, 110, 99, 108.9}
+	returns, err := Returns(prices, models.ReturnsSimple)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := Summarize(prices, returns, 252)
+	stdev := math.Sqrt(0.08 / 6)
+	want := models.ReturnStats{
+		Count:                3,
+		Mean:                 0.1 / 3,
+		Stdev:                stdev,
+		AnnualizedVolatility: stdev * math.Sqrt(252),
+		BarsPerYear:          252,
+		Min:                  -0.1,
+		Max:                  0.1,
+		MaxDrawdown:          0.1,
+	}
+	if stats.Count != want.Count || stats.BarsPerYear != want.BarsPerYear ||
+		!near(stats.Mean, want.Mean) || !near(stats.Stdev, want.Stdev) ||
+		!near(stats.AnnualizedVolatility, want.AnnualizedVolatility) ||
+		!near(stats.Min, want.Min) || !near(stats.Max, want.Max) || !near(stats.MaxDrawdown, want.MaxDrawdown) {
+		t.Errorf("Summarize = %+v, want %+v", stats, want)
+	}
+}
+
+func TestSummarizeWithoutReturns(t *testing.T) {
+	stats := Summarize([]float64{100}, nil, 252)
+	if stats != (models.ReturnStats{BarsPerYear: 252}) {
+		t.Errorf("Summarize of one price = %+v, want zeros", stats)
+	}
+}
+
+func TestReturns(t *testing.T) {
+	prices := []float64{100, 125}
+	simple, err := Returns(prices, models.ReturnsSimple)
+	if err != nil || len(simple) != 1 || !near(simple[0], 0.25) {
+		t.Errorf("simple returns = %v, %v, want [0.25]", simple, err)
+	}
+	logs, err := Returns(prices, models.ReturnsLog)
+	if err != nil || len(logs) != 1 || !near(logs[0], math.Log(1.25)) {
+		t.Errorf("log returns = %v, %v, want [ln 1.25]", logs, err)
+	}
+	if _, err := Returns(prices, "geometric"); err == nil {
+		t.Error("Returns accepted an unknown kind")
+	}
+}
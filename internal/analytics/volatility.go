@@ -0,0 +1,75 @@
+package analytics
+
+import (
+	"math"
+
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// TrueRanges returns each candle's true range: its high to low, stretched to
+// the previous close when price gapped past it. The first candle, having no
+// previous close, uses its high to low alone.
+func TrueRanges(candles []models.Candle) []float64 {
+	ranges := make([]float64, len(candles))
+	for i, c := range candles {
+		ranges[i] = c.High - c.Low
+		if i > 0 {
+			prev := candles[i-1].Close
+			ranges[i] = max(ranges[i], math.Abs(c.High-prev), math.Abs(c.Low-prev))
+		}
+	}
+	return ranges
+}
+
+// WilderATR returns the average true range over period bars with Wilder's
+// smoothing: the first value, at period-1, is the mean of the first period
+// true ranges, and each after it moves 1/period of the way to the next true
+// range. The period-1 warm-up bars before it are nil.
+func WilderATR(trueRanges []float64, period int) []*float64 {
+	atr := make([]*float64, len(trueRanges))
+	if period < 1 || len(trueRanges) < period {
+		return atr
+	}
+	value := Mean(trueRanges[:period])
+	atr[period-1] = ptr(value)
+	for i := period; i < len(trueRanges); i++ {
+		value = (value*float64(period-1) + trueRanges[i]) / float64(period)
+		atr[i] = ptr(value)
+	}
+	return atr
+}
+
+// RealizedVolatility returns the annualized close-to-close volatility at
+// each bar: the sample standard deviation of the period log returns ending
+// at it, scaled by the square root of barsPerYear. The first period bars,
+// with fewer returns before them, are nil. Closes must be positive.
+func RealizedVolatility(closes []float64, period int, barsPerYear float64) ([]*float64, error) {
+	vol := make([]*float64, len(closes))
+	returns, err := LogReturns(closes)
+	if err != nil {
+		return nil, err
+	}
+	if period < 2 {
+		return vol, nil
+	}
+	scale := math.Sqrt(barsPerYear)
+	// returns[i] ends at bar i+1
+	for end := period; end <= len(returns); end++ {
+		vol[end] = ptr(Stdev(returns[end-period:end]) * scale)
+	}
+	return vol, nil
+}
+
+// Last returns the last non-nil value, nil if there is none
+func Last(values []*float64) *float64 {
+	for i := len(values) - 1; i >= 0; i-- {
+		if values[i] != nil {
+			return values[i]
+		}
+	}
+	return nil
+}
+
+func ptr(v float64) *float64 {
+	return &v
+}
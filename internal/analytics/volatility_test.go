@@ -0,0 +1,90 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+func TestTrueRanges(t *testing.T) {
+	bars := []models.Candle{
+		{High: 1.10, Low: 1.08, Close: 1.09},
+		{High: 1.12, Low: 1.11, Close: 1.115}, // gapped up past the close
+		{High: 1.105, Low: 1.10, Close: 1.10}, // gapped down
+		{High: 1.11, Low: 1.09, Close: 1.10},  // inside the previous close
+	}
+	want := []float64{0.02, 0.03, 0.015, 0.02}
+	got := TrueRanges(bars)
+	for i := range want {
+		if !near(got[i], want[i]) {
+			t.Errorf("true ranges = %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestWilderATR(t *testing.T) {
+	atr := WilderATR([]float64{1, 2, 3, 4, 5}, 3)
+	want := []*float64{nil, nil, ptr(2), ptr(8.0 / 3), ptr(31.0 / 9)}
+	assertSeries(t, "ATR", atr, want)
+	if got := Last(atr); got == nil || !near(*got, 31.0/9) {
+		t.Errorf("Last = %v, want 31/9", got)
+	}
+
+	// Warm-up covers the whole series when it is shorter than the period
+	assertSeries(t, "ATR of a short series", WilderATR([]float64{1, 2}, 3), []*float64{nil, nil})
+	if Last(WilderATR([]float64{1, 2}, 3)) != nil {
+		t.Error("Last of an all-nil series is not nil")
+	}
+	assertSeries(t, "ATR of period 1", WilderATR([]float64{4, 2}, 1), []*float64{ptr(4), ptr(2)})
+}
+
+func TestRealizedVolatility(t *testing.T) {
+	closes := pricesFrom([]float64{0.01, 0.03, -0.01})
+
+	daily, err := RealizedVolatility(closes, 2, 252)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*float64{nil, nil, ptr(math.Sqrt(0.0002) * math.Sqrt(252)), ptr(math.Sqrt(0.0008) * math.Sqrt(252))}
+	assertSeries(t, "realized volatility", daily, want)
+
+	// Annualizing hourly crypto bars scales by the root of 365*24 instead
+	hourly, err := RealizedVolatility(closes, 2, 365*24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i < len(closes); i++ {
+		if ratio := *hourly[i] / *daily[i]; !near(ratio, math.Sqrt(365*24.0/252)) {
+			t.Errorf("bar %d: hourly to daily annualization ratio = %g, want %g", i, ratio, math.Sqrt(365*24.0/252))
+		}
+	}
+
+	short, err := RealizedVolatility(closes[:2], 2, 252)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSeries(t, "realized volatility of a short series", short, []*float64{nil, nil})
+
+	if _, err := RealizedVolatility([]float64{1, -1, 1}, 2, 252); err == nil {
+		t.Error("RealizedVolatility accepted a negative close")
+	}
+}
+
+func assertSeries(t *testing.T, name string, got, want []*float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s has %d values, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		switch {
+		case want[i] == nil && got[i] != nil:
+			t.Errorf("%s[%d] = %g, want nil", name, i, *got[i])
+		case want[i] != nil && got[i] == nil:
+			t.Errorf("%s[%d] = nil, want %g", name, i, *want[i])
+		case want[i] != nil && !near(*got[i], *want[i]):
+			t.Errorf("%s[%d] = %g, want %g", name, i, *got[i], *want[i])
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/services"
+)
+
+// GetOHLCRefreshStatus returns the state of the OHLC refresh scheduler
+func (h *Handlers) GetOHLCRefreshStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.ohlcRefresher.GetStatus())
+}
+
+// TriggerOHLCRefresh queues an immediate OHLC refresh run
+func (h *Handlers) TriggerOHLCRefresh(c *gin.Context) {
+	status := h.ohlcRefresher.GetStatus()
+	if !status.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "OHLC refresh scheduler is disabled"})
+		return
+	}
+
+	if !h.ohlcRefresher.Trigger() {
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":  "queued",
+			"message": "A refresh run is already queued",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":     "triggered",
+		"message":    "OHLC refresh initiated in background",
+		"status_url": "/api/v1/admin/ohlc/status",
+	})
+}
+
+// CheckIntegrity scans a table for duplicate bars
+func (h *Handlers) CheckIntegrity(c *gin.Context) {
+	symbol := c.Query("symbol")
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol parameter required"})
+		return
+	}
+
+	table := c.Query("table")
+	if table == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "table parameter required"})
+		return
+	}
+	if !services.IsKnownTable(table) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown table: " + table})
+		return
+	}
+
+	report, err := h.dataService.FindDuplicateBars(c.Request.Context(), table, symbol)
+	if err != nil {
+		respondError(c, "Failed to check integrity", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// StartAudit starts a background audit of an OHLC table against the ticks
+// beneath it
+func (h *Handlers) StartAudit(c *gin.Context) {
+	var request struct {
+		Symbol    string    `json:"symbol" binding:"required"`
+		Timeframe string    `json:"timeframe" binding:"required"`
+		Start     time.Time `json:"start" binding:"required"`
+		End       time.Time `json:"end" binding:"required"`
+		Tolerance float64   `json:"tolerance"` // allowed price difference, default 1e-9
+		Source    string    `json:"source"`    // bid or mid, detected from the table when empty
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.checkSymbol(c, request.Symbol) {
+		return
+	}
+
+	job, err := h.dataManager.StartAudit(services.AuditRequest{
+		Symbol:      request.Symbol,
+		Timeframe:   request.Timeframe,
+		Start:       request.Start,
+		End:         request.End,
+		Tolerance:   request.Tolerance,
+		Source:      request.Source,
+		RequestedBy: requester(c),
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAudit) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respondError(c, "Failed to start audit", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  "started",
+		"job":     job,
+		"job_url": "/api/v1/admin/audit/" + job.ID,
+	})
+}
+
+// GetAudit returns an integrity audit with one page of its findings
+func (h *Handlers) GetAudit(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	job, findings, total, err := h.dataManager.GetAudit(c.Param("id"), offset, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrAuditNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		respondError(c, "Failed to retrieve audit", err)
+		return
+	}
+
+	response := gin.H{
+		"job":      job,
+		"findings": findings,
+		"count":    len(findings),
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	}
+	if offset+limit < total {
+		response["next_offset"] = offset + limit
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ListAudits returns retained integrity audits
+func (h *Handlers) ListAudits(c *gin.Context) {
+	audits := h.dataManager.ListAudits()
+	c.JSON(http.StatusOK, gin.H{
+		"audits": audits,
+		"count":  len(audits),
+	})
+}
+
+// CancelAudit stops a running integrity audit
+func (h *Handlers) CancelAudit(c *gin.Context) {
+	job, err := h.dataManager.CancelAudit(c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAuditNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAuditFinished):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job": job})
+		default:
+			respondError(c, "Failed to cancel audit", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  "cancelling",
+		"message": "Audit will stop after the chunk in progress",
+		"job_url": "/api/v1/admin/audit/" + job.ID,
+	})
+}
+
+// GetTableVerification returns the latest resolution table verification
+// report, re-running it when refresh=true or when none has run yet
+func (h *Handlers) GetTableVerification(c *gin.Context) {
+	report, ok := h.viewportService.LastTableVerification()
+	if !ok || c.Query("refresh") == "true" {
+		report = h.viewportService.VerifyTables(c.Request.Context())
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// InvalidateCache removes cached entries by tag, symbol or resolution
+func (h *Handlers) InvalidateCache(c *gin.Context) {
+	var request struct {
+		Tag        string `json:"tag"`
+		Symbol     string `json:"symbol"`
+		Resolution string `json:"resolution"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tags := make([]string, 0, 3)
+	if request.Tag != "" {
+		tags = append(tags, request.Tag)
+	}
+	if request.Symbol != "" {
+		tags = append(tags, services.SymbolTag(request.Symbol))
+	}
+	if request.Resolution != "" {
+		tags = append(tags, services.ResolutionTag(request.Resolution))
+	}
+	if len(tags) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tag, symbol or resolution required"})
+		return
+	}
+
+	removed := 0
+	for _, tag := range tags {
+		removed += h.cacheService.InvalidateTag(tag)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tags":    tags,
+		"removed": removed,
+	})
+}
+
+// ResetCacheStats zeroes the cache's lifetime counters
+func (h *Handlers) ResetCacheStats(c *gin.Context) {
+	h.cacheService.ResetStats()
+	c.JSON(http.StatusOK, gin.H{"status": "reset"})
+}
+
+// ListCacheKeys lists cache entries, optionally filtered by tag or symbol
+func (h *Handlers) ListCacheKeys(c *gin.Context) {
+	inspector, ok := h.cacheService.(services.CacheInspector)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "cache backend does not support inspection"})
+		return
+	}
+
+	var request struct {
+		Tag    string `form:"tag"`
+		Symbol string `form:"symbol"`
+		Offset int    `form:"offset" binding:"min=0"`
+		Limit  int    `form:"limit" binding:"min=0,max=1000"`
+	}
+
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag := request.Tag
+	if request.Symbol != "" {
+		tag = services.SymbolTag(request.Symbol)
+	}
+	if request.Limit == 0 {
+		request.Limit = 100
+	}
+
+	entries, total := inspector.Entries(tag, request.Offset, request.Limit)
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"total":   total,
+		"offset":  request.Offset,
+		"limit":   request.Limit,
+	})
+}
+
+// GetCacheKey returns the metadata for one cache entry
+func (h *Handlers) GetCacheKey(c *gin.Context) {
+	inspector, ok := h.cacheService.(services.CacheInspector)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "cache backend does not support inspection"})
+		return
+	}
+
+	entry, found := inspector.Entry(c.Param("key"))
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "cache key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// GetCacheWarmStatus returns the cache warmer state
+func (h *Handlers) GetCacheWarmStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.cacheWarmer.GetStatus())
+}
+
+// TriggerCacheWarm queues an immediate cache warm run
+func (h *Handlers) TriggerCacheWarm(c *gin.Context) {
+	status := h.cacheWarmer.GetStatus()
+	if !status.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "cache warmer is disabled"})
+		return
+	}
+
+	if !h.cacheWarmer.Trigger() {
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":  "queued",
+			"message": "A warm run is already queued",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":     "triggered",
+		"message":    "Cache warm initiated in background",
+		"status_url": "/api/v1/admin/cache/warm",
+	})
+}
+
+// GetBackfillStatus returns the catch-up backfill scheduler state
+func (h *Handlers) GetBackfillStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.dataManager.GetBackfillStatus())
+}
+
+// TriggerBackfill queues an immediate catch-up backfill pass
+func (h *Handlers) TriggerBackfill(c *gin.Context) {
+	if !h.dataManager.GetBackfillStatus().Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "backfill scheduler is disabled"})
+		return
+	}
+
+	if !h.dataManager.TriggerBackfill() {
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":  "queued",
+			"message": "A backfill pass is already queued",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":     "triggered",
+		"message":    "Backfill initiated in background",
+		"status_url": "/api/v1/admin/backfill",
+	})
+}
+
+// GetRetentionStatus returns the retention sweeper state
+func (h *Handlers) GetRetentionStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.dataManager.GetRetentionStatus())
+}
+
+// PreviewRetention reports what the next retention sweep would delete
+func (h *Handlers) PreviewRetention(c *gin.Context) {
+	preview, err := h.dataManager.PreviewRetention(c.Request.Context())
+	if err != nil {
+		respondError(c, "Failed to preview retention", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// SetFetchJobPriority changes the queue priority of an unfinished fetch job
+func (h *Handlers) SetFetchJobPriority(c *gin.Context) {
+	var request struct {
+		Priority string `json:"priority" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	priority, err := services.ParsePriority(request.Priority, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.dataManager.SetJobPriority(c.Param("id"), priority)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrJobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrJobFinished):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job": job})
+		default:
+			respondError(c, "Failed to set job priority", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// ReloadConfig re-reads the configuration, applying the settings that can
+// change while running and reporting those that need a restart
+func (h *Handlers) ReloadConfig(c *gin.Context) {
+	reload, err := h.configReloader.Reload()
+	if err != nil {
+		respondError(c, "Failed to reload configuration", err)
+		return
+	}
+	c.JSON(http.StatusOK, reload)
+}
+
+// GetConfig returns the configuration in force, secrets redacted, with the
+// source of every setting, and the resolutions and cache tiers being served
+func (h *Handlers) GetConfig(c *gin.Context) {
+	cfg := h.configReloader.Current()
+	contract := h.viewportService.GetDataContract()
+	c.JSON(http.StatusOK, gin.H{
+		"profile":     cfg.Profile,
+		"settings":    config.Settings(cfg),
+		"resolutions": contract.Resolutions,
+		"cache_tiers": contract.CacheTiers,
+	})
+}
+
+// GetSymbolRegistry returns the symbols requests may name and where they
+// came from
+func (h *Handlers) GetSymbolRegistry(c *gin.Context) {
+	c.JSON(http.StatusOK, h.symbols.GetStatus())
+}
+
+// RefreshSymbols re-reads the symbols in the database, so a newly fetched
+// symbol is accepted without waiting for the next refresh
+func (h *Handlers) RefreshSymbols(c *gin.Context) {
+	status, err := h.symbols.Refresh(c.Request.Context())
+	if err != nil {
+		respondError(c, "Failed to refresh symbols", err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sptrader/sptrader/internal/services"
+)
+
+// CreateAlert registers a price alert for the requesting client
+func (h *Handlers) CreateAlert(c *gin.Context) {
+	var request struct {
+		Symbol    string     `json:"symbol" binding:"required"`
+		Condition string     `json:"condition" binding:"required"` // above, below or crosses
+		Price     float64    `json:"price" binding:"required"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		Repeat    bool       `json:"repeat"`
+
+		CallbackURL string `json:"callback_url"` // receives signed triggers; without one they are only logged
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.checkSymbol(c, request.Symbol) {
+		return
+	}
+
+	alert, err := h.dataManager.CreateAlert(c.Request.Context(), services.PriceAlert{
+		Owner:       requester(c),
+		Symbol:      request.Symbol,
+		Condition:   request.Condition,
+		Price:       request.Price,
+		ExpiresAt:   request.ExpiresAt,
+		Repeat:      request.Repeat,
+		CallbackURL: request.CallbackURL,
+	})
+	if err != nil {
+		respondAlertError(c, "Failed to register alert", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, alert)
+}
+
+// ListAlerts returns the requesting client's price alerts
+func (h *Handlers) ListAlerts(c *gin.Context) {
+	alerts := h.dataManager.ListAlerts(requester(c))
+	c.JSON(http.StatusOK, gin.H{
+		"alerts": alerts,
+		"count":  len(alerts),
+	})
+}
+
+// GetAlert returns one of the requesting client's price alerts with its
+// trigger history
+func (h *Handlers) GetAlert(c *gin.Context) {
+	owner := requester(c)
+	alert, err := h.dataManager.GetAlert(owner, c.Param("id"))
+	if err != nil {
+		respondAlertError(c, "Failed to get alert", err)
+		return
+	}
+	history, err := h.dataManager.AlertHistory(c.Request.Context(), owner, alert.ID)
+	if err != nil {
+		respondAlertError(c, "Failed to get alert history", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"alert":    alert,
+		"triggers": history,
+	})
+}
+
+// DeleteAlert removes one of the requesting client's price alerts
+func (h *Handlers) DeleteAlert(c *gin.Context) {
+	alert, err := h.dataManager.DeleteAlert(c.Request.Context(), requester(c), c.Param("id"))
+	if err != nil {
+		respondAlertError(c, "Failed to delete alert", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, alert)
+}
+
+// respondAlertError writes an alert error: not found, invalid, over quota
+// or disabled, and otherwise as respondError would
+func respondAlertError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrAlertNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidAlert),
+		errors.Is(err, services.ErrWebhooksDisabled),
+		errors.Is(err, services.ErrInvalidCallbackURL):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlertQuota):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlertsDisabled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		respondError(c, message, err)
+	}
+}
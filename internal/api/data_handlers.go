@@ -1,12 +1,15 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sptrader/sptrader/internal/models"
+	"github.com/sptrader/sptrader/internal/services"
 )
 
 // CheckDataAvailability checks what data is available for a symbol/timerange
@@ -16,6 +19,9 @@ func (h *Handlers) CheckDataAvailability(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol parameter required"})
 		return
 	}
+	if !h.checkSymbol(c, symbol) {
+		return
+	}
 
 	// Parse time range
 	start, err := time.Parse(time.RFC3339, c.Query("start"))
@@ -33,7 +39,7 @@ func (h *Handlers) CheckDataAvailability(c *gin.Context) {
 	// Check availability
 	availability, err := h.dataManager.CheckDataAvailability(c.Request.Context(), symbol, start, end)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, "Failed to check data availability", err)
 		return
 	}
 
@@ -46,26 +52,182 @@ func (h *Handlers) EnsureData(c *gin.Context) {
 		Symbol string    `json:"symbol" binding:"required"`
 		Start  time.Time `json:"start" binding:"required"`
 		End    time.Time `json:"end" binding:"required"`
+
+		CallbackURL string `json:"callback_url"` // notified when the job finishes
+		Priority    string `json:"priority"`     // high (default), normal or low
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// Discovered symbols only list what is already stored, and fetching is
+	// how a new symbol gets there
+	if !h.symbols.Discovering() && !h.checkSymbol(c, request.Symbol) {
+		return
+	}
+
+	// Requests here are usually a chart waiting on the data, so they jump
+	// ahead of bulk work unless they say otherwise
+	priority, err := services.ParsePriority(request.Priority, services.PriorityHigh)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Start background fetch. The request context only covers the
+	// availability check; the job runs under its own context.
+	job, err := h.dataManager.EnsureData(c.Request.Context(), request.Symbol, request.Start, request.End, services.EnsureOptions{
+		Priority:    priority,
+		CallbackURL: request.CallbackURL,
+		RequestedBy: requester(c),
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrWebhooksDisabled) || errors.Is(err, services.ErrInvalidCallbackURL) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respondError(c, "Failed to start data fetch", err)
+		return
+	}
+
+	jobURL := "/api/v1/data/jobs/" + job.ID
+	c.Header("Location", jobURL)
+	message := "Data fetch initiated in background"
+	if job.Attached {
+		message = "An identical or covering fetch is already in progress"
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  job.State,
+		"message": message,
+		"job_id":  job.ID,
+		"job_url": jobURL,
+		"job":     job,
+	})
+}
+
+// GetStaleness checks how far each monitored live symbol lags behind now.
+// It responds 503 while any symbol is stale so probes can alert on the status
+// code alone.
+func (h *Handlers) GetStaleness(c *gin.Context) {
+	status := h.dataManager.CheckStaleness(c.Request.Context())
+	if status.Stale > 0 {
+		c.JSON(http.StatusServiceUnavailable, status)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// requester identifies the client behind a request for the fetch audit: the
+// X-Client-ID header when the client sets one, otherwise its address
+func requester(c *gin.Context) string {
+	if id := c.GetHeader("X-Client-ID"); id != "" {
+		return id
+	}
+	return c.ClientIP()
+}
+
+// GetFetchHistory returns the fetch audit, newest first, one page at a time
+func (h *Handlers) GetFetchHistory(c *gin.Context) {
+	to := time.Now().UTC()
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to time"})
+			return
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, -30)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from time"})
+			return
+		}
+		from = parsed
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	records, more, err := h.dataManager.FetchHistory(c.Request.Context(), services.FetchHistoryQuery{
+		Symbol: c.Query("symbol"),
+		From:   from,
+		To:     to,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondError(c, "Failed to retrieve fetch history", err)
+		return
+	}
+
+	response := gin.H{
+		"records": records,
+		"count":   len(records),
+		"from":    from,
+		"to":      to,
+		"limit":   limit,
+		"offset":  offset,
+	}
+	if more {
+		response["next_offset"] = offset + limit
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetFetchJob returns one data fetch job
+func (h *Handlers) GetFetchJob(c *gin.Context) {
+	job, err := h.dataManager.GetJob(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		respondError(c, "Failed to retrieve fetch job", err)
+		return
+	}
 
-	// Start background fetch
-	go func() {
-		ctx := c.Request.Context()
-		if err := h.dataManager.EnsureData(ctx, request.Symbol, request.Start, request.End); err != nil {
-			// Log error (in production, send to monitoring)
-			println("Data fetch error:", err.Error())
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelFetchJob stops a running data fetch job
+func (h *Handlers) CancelFetchJob(c *gin.Context) {
+	job, err := h.dataManager.CancelJob(c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrJobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrJobFinished):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job": job})
+		default:
+			respondError(c, "Failed to cancel fetch job", err)
 		}
-	}()
+		return
+	}
 
 	c.JSON(http.StatusAccepted, gin.H{
-		"status": "fetching",
-		"message": "Data fetch initiated in background",
-		"check_url": "/api/v1/data/status?symbol=" + request.Symbol,
+		"status":  "cancelling",
+		"message": "Job will stop after the hour file in progress",
+		"job_url": "/api/v1/data/jobs/" + job.ID,
+	})
+}
+
+// ListFetchJobs returns retained data fetch jobs, optionally for one symbol
+func (h *Handlers) ListFetchJobs(c *gin.Context) {
+	jobs := h.dataManager.ListJobs(c.Query("symbol"))
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":  jobs,
+		"count": len(jobs),
 	})
 }
 
@@ -73,7 +235,7 @@ func (h *Handlers) EnsureData(c *gin.Context) {
 func (h *Handlers) GetDataStatus(c *gin.Context) {
 	status, err := h.dataManager.GetDataStatus(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, "Failed to retrieve data status", err)
 		return
 	}
 
@@ -87,6 +249,9 @@ func (h *Handlers) GetCandlesWithLazyLoad(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol parameter required"})
 		return
 	}
+	if !h.checkSymbol(c, symbol) {
+		return
+	}
 
 	timeframe := c.Query("tf")
 	if timeframe == "" {
@@ -96,6 +261,16 @@ func (h *Handlers) GetCandlesWithLazyLoad(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "timeframe parameter required"})
 		return
 	}
+	// The timeframe names the table the partial response is read from
+	tf, err := services.ParseTimeframe(timeframe)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+	timeframe = tf.String()
 
 	start, err := time.Parse(time.RFC3339, c.Query("start"))
 	if err != nil {
@@ -111,7 +286,11 @@ func (h *Handlers) GetCandlesWithLazyLoad(c *gin.Context) {
 
 	// Check if we need to fetch data
 	availability, err := h.dataManager.CheckDataAvailability(c.Request.Context(), symbol, start, end)
-	if err == nil && !availability.HasData {
+	if err != nil {
+		respondError(c, "Failed to check data availability", err)
+		return
+	}
+	if !availability.HasData {
 		// No data available, trigger fetch
 		c.JSON(http.StatusAccepted, gin.H{
 			"status": "no_data",
@@ -122,17 +301,18 @@ func (h *Handlers) GetCandlesWithLazyLoad(c *gin.Context) {
 	}
 
 	// If we have partial data, return what we have and indicate gaps
-	if len(availability.Gaps) > 0 {
+	if len(availability.MissingGaps()) > 0 {
 		// Get candles for available data
 		req := models.CandleRequest{
 			Symbol:    symbol,
 			Timeframe: timeframe,
 			Start:     start,
 			End:       end,
+			Include:   c.Query("include"),
 		}
 		// Determine the correct table name based on timeframe
 		tableName := fmt.Sprintf("ohlc_%s_v2", timeframe)
-		candles, err := h.candleService.GetCandles(
+		candles, _, err := h.candleService.GetCandles(
 			c.Request.Context(),
 			req,
 			tableName,
@@ -140,7 +320,7 @@ func (h *Handlers) GetCandlesWithLazyLoad(c *gin.Context) {
 		)
 
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, "Failed to retrieve candles", err)
 			return
 		}
 
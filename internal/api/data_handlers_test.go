@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/services"
+)
+
+// The timeframe is formatted into a table name, so anything that isn't a
+// timeframe is refused before a query is built from it
+func TestGetCandlesWithLazyLoadRejectsTimeframe(t *testing.T) {
+	h := newTestHandlers(&fakeData{}, "EURUSD")
+	for _, tf := range []string{"7x", "1h_v2", "1h; DROP TABLE market_data_v2", "tick"} {
+		target := "/candles/lazy?symbol=EURUSD&start=2024-03-04T00:00:00Z&end=2024-03-05T00:00:00Z&tf=" + url.QueryEscape(tf)
+		if w := serve(h.GetCandlesWithLazyLoad, "/candles/lazy", target); w.Code != http.StatusBadRequest {
+			t.Errorf("tf=%q: status = %d, want 400: %s", tf, w.Code, w.Body)
+		}
+	}
+}
+
+// A failed availability check is reported rather than read as no data
+func TestGetCandlesWithLazyLoadAvailabilityFails(t *testing.T) {
+	pool, err := db.NewReadOnlyPool(config.DatabaseConfig{URL: fakeQuestDB(t), MaxConnections: 2, MaxConnLifetime: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	dm := services.NewDataManager(pool, pool, services.NewCacheService(config.CacheConfig{MaxSize: 10}), nil, config.FetchConfig{})
+	t.Cleanup(dm.Close)
+
+	h := newTestHandlers(&fakeData{}, "EURUSD")
+	h.dataManager = dm
+
+	// A request whose deadline has passed times the availability query out
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet,
+		"/candles/lazy?symbol=EURUSD&tf=1h&start=2024-03-04T00:00:00Z&end=2024-03-05T00:00:00Z", nil).WithContext(ctx)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/candles/lazy", h.GetCandlesWithLazyLoad)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504: %s", w.Code, w.Body)
+	}
+}
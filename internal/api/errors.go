@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/services"
+)
+
+// respondError answers a failed service call in the standard error envelope,
+// with the status its error maps to. Client errors explain themselves in
+// details; server errors are logged in full and answered with at most the
+// kind of failure, never the internal error.
+func respondError(c *gin.Context, message string, err error) {
+	status, details := errorStatus(c, err)
+	if status >= http.StatusInternalServerError {
+		log.Error().Err(err).Str("path", c.FullPath()).Int("status", status).Msg(message)
+	}
+
+	body := gin.H{"error": message}
+	if details != "" {
+		body["details"] = details
+	}
+	c.JSON(status, body)
+}
+
+// errorStatus maps a service error to its response status and the details
+// safe to return: no data is not found, an invalid resolution a bad request,
+// a range too large for the request an entity too large, too little data for
+// the computation asked for an unprocessable entity, a timed out query a
+// gateway timeout, and a database that can't be used unavailable, with a
+// Retry-After when the circuit breaker says when to retry. Anything else is
+// a server error without details.
+func errorStatus(c *gin.Context, err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrNoData):
+		return http.StatusNotFound, err.Error()
+	case errors.Is(err, services.ErrInvalidResolution):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, services.ErrRangeTooLarge):
+		return http.StatusRequestEntityTooLarge, err.Error()
+	case errors.Is(err, services.ErrInsufficientData):
+		return http.StatusUnprocessableEntity, err.Error()
+	case errors.Is(err, services.ErrTimeout):
+		return http.StatusGatewayTimeout, services.ErrTimeout.Error()
+	case errors.Is(err, services.ErrUnavailable):
+		var unavailable *db.UnavailableError
+		if errors.As(err, &unavailable) {
+			retryAfter := max(int(math.Ceil(unavailable.RetryAfter.Seconds())), 1)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+		}
+		return http.StatusServiceUnavailable, services.ErrUnavailable.Error()
+	default:
+		return http.StatusInternalServerError, ""
+	}
+}
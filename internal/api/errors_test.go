@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/services"
+)
+
+// captureLog sends the global logger to a buffer for the rest of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	saved := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = saved })
+	return &buf
+}
+
+func TestRespondError(t *testing.T) {
+	// Internal text that must never reach a client
+	const secret = "dial tcp 10.0.0.7:8812: password authentication failed for admin"
+	internal := errors.New(secret)
+
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		details    string
+		retryAfter string
+		logged     bool
+	}{
+		{"no data", fmt.Errorf("%w for EURUSD", services.ErrNoData), http.StatusNotFound, "no data for EURUSD", "", false},
+		{"invalid resolution", fmt.Errorf("%w: 7x", services.ErrInvalidResolution), http.StatusBadRequest, "invalid resolution: 7x", "", false},
+		{"range too large", fmt.Errorf("%w: 2000000 rows", services.ErrRangeTooLarge), http.StatusRequestEntityTooLarge, "range too large: 2000000 rows", "", false},
+		{"insufficient data", fmt.Errorf("%w: 3 bars", services.ErrInsufficientData), http.StatusUnprocessableEntity, "insufficient data: 3 bars", "", false},
+		{"timeout", fmt.Errorf("%w: %w", services.ErrTimeout, internal), http.StatusGatewayTimeout, "query timed out", "", true},
+		{"unavailable", fmt.Errorf("%w: %w", services.ErrUnavailable, internal), http.StatusServiceUnavailable, "database unavailable", "", true},
+		// Retry-After rounds up to whole seconds, and is at least 1
+		{"unavailable with retry", fmt.Errorf("%w: %w", services.ErrUnavailable, &db.UnavailableError{RetryAfter: 2500 * time.Millisecond}), http.StatusServiceUnavailable, "database unavailable", "3", true},
+		{"unavailable retrying now", fmt.Errorf("%w: %w", services.ErrUnavailable, &db.UnavailableError{}), http.StatusServiceUnavailable, "database unavailable", "1", true},
+		{"anything else", fmt.Errorf("scanning candles: %w", internal), http.StatusInternalServerError, "", "", true},
+	}
+	for _, tt := range tests {
+		logs := captureLog(t)
+		w := serve(func(c *gin.Context) { respondError(c, "Failed to retrieve candles", tt.err) }, "/candles", "/candles")
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+			t.Errorf("%s: Retry-After %q, want %q", tt.name, got, tt.retryAfter)
+		}
+
+		var body map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if body["error"] != "Failed to retrieve candles" {
+			t.Errorf("%s: error %q, want the message", tt.name, body["error"])
+		}
+		if details, ok := body["details"]; details != tt.details || ok != (tt.details != "") {
+			t.Errorf("%s: details %q (present %v), want %q", tt.name, details, ok, tt.details)
+		}
+		if strings.Contains(w.Body.String(), secret) {
+			t.Errorf("%s: response leaks the internal error: %s", tt.name, w.Body)
+		}
+
+		// Server errors are logged in full; client errors aren't logged at all
+		if logged := strings.Contains(logs.String(), tt.err.Error()); logged != tt.logged {
+			t.Errorf("%s: error logged %v, want %v: %s", tt.name, logged, tt.logged, logs)
+		}
+	}
+}
@@ -1,55 +1,110 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sptrader/sptrader/internal/backtest"
+	"github.com/sptrader/sptrader/internal/bars"
+	"github.com/sptrader/sptrader/internal/db"
 	"github.com/sptrader/sptrader/internal/models"
 	"github.com/sptrader/sptrader/internal/services"
 )
 
+// dataSource is the part of DataService the handlers call, so handler tests
+// can stand in for the database
+type dataSource interface {
+	GetSymbols(ctx context.Context) ([]models.Symbol, error)
+	GetDataRange(ctx context.Context, symbol string) (map[string]interface{}, error)
+	GetPriceBars(ctx context.Context, req models.PriceBarRequest, builder bars.Builder) (*models.PriceBarResponse, error)
+	GetAllTableStats(ctx context.Context, bySymbol bool) (map[string]models.TableStats, error)
+	FindDuplicateBars(ctx context.Context, table, symbol string) (*models.IntegrityReport, error)
+}
+
 // Handlers contains all HTTP handlers
 type Handlers struct {
-	dataService     *services.DataService
+	dataService     dataSource
 	viewportService *services.ViewportService
 	candleService   *services.DataService  // alias for backward compatibility
 	dataManager     *services.DataManager
+	ohlcRefresher   *services.OHLCRefresher
+	cacheWarmer     *services.CacheWarmer
+	cacheService    services.Cache
+	configReloader  *services.ConfigReloader
+	symbols         *services.SymbolRegistry
 	startTime       time.Time
 }
 
 // NewHandlers creates new handlers instance
-func NewHandlers(dataService *services.DataService, viewportService *services.ViewportService, dataManager *services.DataManager) *Handlers {
+func NewHandlers(dataService *services.DataService, viewportService *services.ViewportService, dataManager *services.DataManager, ohlcRefresher *services.OHLCRefresher, cacheWarmer *services.CacheWarmer, cacheService services.Cache, configReloader *services.ConfigReloader, symbols *services.SymbolRegistry) *Handlers {
 	return &Handlers{
 		dataService:     dataService,
 		viewportService: viewportService,
 		candleService:   dataService,
 		dataManager:     dataManager,
+		ohlcRefresher:   ohlcRefresher,
+		cacheWarmer:     cacheWarmer,
+		cacheService:    cacheService,
+		configReloader:  configReloader,
+		symbols:         symbols,
 		startTime:       time.Now(),
 	}
 }
 
-// Health handles health check requests
+// Health handles health check requests. With deep=true it also checks the
+// database, its required tables and data freshness, answering 503 and
+// naming the failing components when any check fails.
 func (h *Handlers) Health(c *gin.Context) {
-	// Simple health check for now
-	// TODO: Add database health check using ctx := c.Request.Context()
-	
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"status":  "healthy",
 		"service": "sptrader-api",
 		"version": "1.0.0",
 		"uptime":  time.Since(h.startTime).String(),
+	}
+	if c.Query("deep") != "true" {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	report := h.dataManager.HealthReport(c.Request.Context())
+	response["checks"] = report.Components
+	if !report.Healthy {
+		response["status"] = "unhealthy"
+		response["failing"] = report.Failing
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Ready is the readiness probe: 200 when the database, its required tables
+// and data freshness all check out, 503 naming the failing components
+// otherwise
+func (h *Handlers) Ready(c *gin.Context) {
+	report := h.dataManager.HealthReport(c.Request.Context())
+	if !report.Healthy {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":  "not_ready",
+			"failing": report.Failing,
+			"checks":  report.Components,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ready",
+		"checks": report.Components,
 	})
 }
 
 // GetCandles handles standard candle requests
 func (h *Handlers) GetCandles(c *gin.Context) {
-	var req models.CandleRequest
-	if err := c.ShouldBindQuery(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid request parameters",
-			"details": err.Error(),
-		})
+	req, ok := h.parseCandleOptions(c)
+	if !ok {
 		return
 	}
 
@@ -61,18 +116,110 @@ func (h *Handlers) GetCandles(c *gin.Context) {
 	// Use viewport service to get candles
 	response, err := h.viewportService.GetSmartCandles(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve candles",
-			"details": err.Error(),
-		})
+		respondError(c, "Failed to retrieve candles", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// parseCandleOptions binds a candle request and validates its symbol, extra
+// columns, alignment and sessions, and that its range is allowed for the
+// spread, sessions and timeframe asked for. It answers the request itself
+// when something is wrong and reports whether the request may go on.
+func (h *Handlers) parseCandleOptions(c *gin.Context) (models.CandleRequest, bool) {
+	var req models.CandleRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondInvalid(c, err)
+		return req, false
+	}
+	if !h.checkSymbol(c, req.Symbol) {
+		return req, false
+	}
+
+	// Malformed options are a bad request; a range too long for them is
+	// answered by respondError with its own status
+	extras, err := req.ParseExtras()
+	if err != nil {
+		respondInvalid(c, err)
+		return req, false
+	}
+	if _, err := req.ParseAlignment(); err != nil {
+		respondInvalid(c, err)
+		return req, false
+	}
+	sessions, err := req.ParseSessions()
+	if err != nil {
+		respondInvalid(c, err)
+		return req, false
+	}
+
+	if extras.Spread {
+		if err := services.CheckSpreadRange(req.Start, req.End); err != nil {
+			respondError(c, "Invalid request parameters", err)
+			return req, false
+		}
+	}
+	if len(sessions) > 0 {
+		if err := services.CheckSessionRange(req.Start, req.End); err != nil {
+			respondError(c, "Invalid request parameters", err)
+			return req, false
+		}
+		if err := services.CheckSessionTimeframe(req.Timeframe, sessions); err != nil {
+			respondError(c, "Invalid request parameters", err)
+			return req, false
+		}
+	}
+	if err := services.CheckTimeframeRange(req.Timeframe, req.Start, req.End); err != nil {
+		respondError(c, "Invalid request parameters", err)
+		return req, false
+	}
+	return req, true
+}
+
+// respondInvalid answers 400 for malformed request parameters
+func respondInvalid(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   "Invalid request parameters",
+		"details": err.Error(),
+	})
+}
+
+// checkSymbol answers 404, suggesting close matches, for a symbol the
+// registry doesn't know. It reports whether the request may go on.
+func (h *Handlers) checkSymbol(c *gin.Context, symbol string) bool {
+	err := h.symbols.Check(symbol)
+	var unknown *services.UnknownSymbolError
+	if errors.As(err, &unknown) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":       "Unknown symbol",
+			"details":     err.Error(),
+			"suggestions": unknown.Suggestions,
+		})
+		return false
+	}
+	return true
+}
+
 // GetSmartCandles handles viewport-aware candle requests
 func (h *Handlers) GetSmartCandles(c *gin.Context) {
+	req, ok := h.parseCandleOptions(c)
+	if !ok {
+		return
+	}
+
+	// Let viewport service handle resolution selection
+	response, err := h.viewportService.GetSmartCandles(c.Request.Context(), req)
+	if err != nil {
+		respondError(c, "Failed to retrieve candles", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ExplainQuery explains how a query would be executed
+func (h *Handlers) ExplainQuery(c *gin.Context) {
 	var req models.CandleRequest
 	if err := c.ShouldBindQuery(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -81,23 +228,64 @@ func (h *Handlers) GetSmartCandles(c *gin.Context) {
 		})
 		return
 	}
+	if !h.checkSymbol(c, req.Symbol) {
+		return
+	}
+	if _, err := req.ParseSessions(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	explanation := h.viewportService.ExplainQuery(c.Request.Context(), req)
+	c.JSON(http.StatusOK, explanation)
+}
+
+// GetPriceBars handles Renko brick and, with type=range, range bar requests,
+// answering 413 when the size would build too many bars over the range
+func (h *Handlers) GetPriceBars(c *gin.Context) {
+	var req models.PriceBarRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+	if !h.checkSymbol(c, req.Symbol) {
+		return
+	}
+	if !req.End.After(req.Start) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request parameters",
+			"details": "end must be after start",
+		})
+		return
+	}
 
-	// Let viewport service handle resolution selection
-	response, err := h.viewportService.GetSmartCandles(c.Request.Context(), req)
+	builder, err := bars.New(req.BarSize())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve candles",
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request parameters",
 			"details": err.Error(),
 		})
 		return
 	}
 
+	response, err := h.dataService.GetPriceBars(c.Request.Context(), req, builder)
+	if err != nil {
+		respondError(c, "Failed to build bars", err)
+		return
+	}
+
 	c.JSON(http.StatusOK, response)
 }
 
-// ExplainQuery explains how a query would be executed
-func (h *Handlers) ExplainQuery(c *gin.Context) {
-	var req models.CandleRequest
+// GetCorrelation handles rolling correlation requests for two symbols
+func (h *Handlers) GetCorrelation(c *gin.Context) {
+	var req models.CorrelationRequest
 	if err := c.ShouldBindQuery(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Invalid request parameters",
@@ -105,21 +293,234 @@ func (h *Handlers) ExplainQuery(c *gin.Context) {
 		})
 		return
 	}
+	symbols, err := req.ParseSymbols()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+	for _, symbol := range symbols {
+		if !h.checkSymbol(c, symbol) {
+			return
+		}
+	}
+	if req.Window != 0 && req.Window < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request parameters",
+			"details": "window must be at least 2 returns",
+		})
+		return
+	}
+	if err := services.CheckTimeframeRange(req.Timeframe, req.Start, req.End); err != nil {
+		respondError(c, "Invalid request parameters", err)
+		return
+	}
 
-	explanation := h.viewportService.ExplainQuery(req)
-	c.JSON(http.StatusOK, explanation)
+	response, err := h.viewportService.GetCorrelation(c.Request.Context(), req, symbols)
+	if err != nil {
+		respondError(c, "Failed to compute correlation", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
-// GetSymbols returns available trading symbols
-func (h *Handlers) GetSymbols(c *gin.Context) {
-	symbols, err := h.dataService.GetSymbols(c.Request.Context())
+// GetReturns handles per-bar returns requests
+func (h *Handlers) GetReturns(c *gin.Context) {
+	var req models.ReturnsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+	if !h.checkSymbol(c, req.Symbol) {
+		return
+	}
+	kind, err := req.ParseType()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := services.CheckTimeframeRange(req.Timeframe, req.Start, req.End); err != nil {
+		respondError(c, "Invalid request parameters", err)
+		return
+	}
+
+	response, err := h.viewportService.GetReturns(c.Request.Context(), req, kind)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve symbols",
+		respondError(c, "Failed to compute returns", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetVolatility handles ATR and realized volatility requests
+func (h *Handlers) GetVolatility(c *gin.Context) {
+	var req models.VolatilityRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request parameters",
 			"details": err.Error(),
 		})
 		return
 	}
+	if !h.checkSymbol(c, req.Symbol) {
+		return
+	}
+	if req.ATRPeriod != 0 && req.ATRPeriod < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request parameters",
+			"details": "atr_period must be at least 2 bars",
+		})
+		return
+	}
+	if err := services.CheckTimeframeRange(req.Timeframe, req.Start, req.End); err != nil {
+		respondError(c, "Invalid request parameters", err)
+		return
+	}
+
+	response, err := h.viewportService.GetVolatility(c.Request.Context(), req)
+	if err != nil {
+		respondError(c, "Failed to compute volatility", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RunBacktest handles backtests of a strategy over a symbol's candles
+func (h *Handlers) RunBacktest(c *gin.Context) {
+	var req models.BacktestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.checkSymbol(c, req.Symbol) {
+		return
+	}
+	strategy, err := backtest.Validate(req.Strategy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Strategy = strategy
+	if err := services.CheckTimeframeRange(req.Timeframe, req.Start, req.End); err != nil {
+		respondError(c, "Invalid request parameters", err)
+		return
+	}
+
+	response, err := h.viewportService.RunBacktest(c.Request.Context(), req)
+	if err != nil {
+		respondError(c, "Failed to run backtest", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetQuote returns the latest tick of symbol, or with symbols, a comma
+// separated list, of each one listed
+func (h *Handlers) GetQuote(c *gin.Context) {
+	symbol, list := c.Query("symbol"), c.Query("symbols")
+	if (symbol == "") == (list == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request parameters",
+			"details": "give either symbol or symbols",
+		})
+		return
+	}
+
+	if symbol != "" {
+		if !h.checkSymbol(c, symbol) {
+			return
+		}
+		quotes, err := h.dataManager.GetQuotes(c.Request.Context(), []string{symbol})
+		if err != nil {
+			respondError(c, "Failed to get quote", err)
+			return
+		}
+		if len(quotes) == 0 {
+			respondError(c, "Failed to get quote", fmt.Errorf("%w: %s has no ticks", services.ErrNoData, symbol))
+			return
+		}
+		c.JSON(http.StatusOK, quotes[0])
+		return
+	}
+
+	var symbols []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(list, ",") {
+		if part = strings.TrimSpace(part); part != "" && !seen[part] {
+			seen[part] = true
+			symbols = append(symbols, part)
+		}
+	}
+	if len(symbols) == 0 || len(symbols) > services.MaxQuoteSymbols {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request parameters",
+			"details": fmt.Sprintf("symbols must list between 1 and %d symbols", services.MaxQuoteSymbols),
+		})
+		return
+	}
+	for _, symbol := range symbols {
+		if !h.checkSymbol(c, symbol) {
+			return
+		}
+	}
+
+	quotes, err := h.dataManager.GetQuotes(c.Request.Context(), symbols)
+	if err != nil {
+		respondError(c, "Failed to get quotes", err)
+		return
+	}
+	missing := make([]string, 0)
+	for _, symbol := range symbols {
+		found := false
+		for _, quote := range quotes {
+			found = found || quote.Symbol == symbol
+		}
+		if !found {
+			missing = append(missing, symbol)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"quotes":  quotes,
+		"count":   len(quotes),
+		"missing": missing, // symbols without ticks
+	})
+}
+
+// GetSymbols returns available trading symbols, limited to those the
+// registry knows and, with q, to those containing q
+func (h *Handlers) GetSymbols(c *gin.Context) {
+	symbols, err := h.dataService.GetSymbols(c.Request.Context())
+	if err != nil {
+		respondError(c, "Failed to retrieve symbols", err)
+		return
+	}
+
+	if matches, ok := h.symbols.Search(c.Query("q")); ok {
+		allowed := make(map[string]bool, len(matches))
+		for _, symbol := range matches {
+			allowed[symbol] = true
+		}
+		filtered := symbols[:0]
+		for _, symbol := range symbols {
+			if allowed[symbol.Symbol] {
+				filtered = append(filtered, symbol)
+			}
+		}
+		symbols = filtered
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"count": len(symbols),
@@ -133,13 +534,13 @@ func (h *Handlers) GetDataRange(c *gin.Context) {
 	if symbol == "" {
 		symbol = "EURUSD"
 	}
+	if !h.checkSymbol(c, symbol) {
+		return
+	}
 
 	dataRange, err := h.dataService.GetDataRange(c.Request.Context(), symbol)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve data range",
-			"details": err.Error(),
-		})
+		respondError(c, "Failed to retrieve data range", err)
 		return
 	}
 
@@ -149,6 +550,10 @@ func (h *Handlers) GetDataRange(c *gin.Context) {
 // GetTimeframes returns supported timeframes
 func (h *Handlers) GetTimeframes(c *gin.Context) {
 	timeframes := []gin.H{
+		{"name": "1s", "label": "1 Second", "seconds": 1, "max_range_seconds": 7200},
+		{"name": "5s", "label": "5 Seconds", "seconds": 5, "max_range_seconds": 21600},
+		{"name": "15s", "label": "15 Seconds", "seconds": 15, "max_range_seconds": 43200},
+		{"name": "30s", "label": "30 Seconds", "seconds": 30, "max_range_seconds": 86400},
 		{"name": "1m", "label": "1 Minute", "seconds": 60},
 		{"name": "5m", "label": "5 Minutes", "seconds": 300},
 		{"name": "15m", "label": "15 Minutes", "seconds": 900},
@@ -160,28 +565,147 @@ func (h *Handlers) GetTimeframes(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"timeframes": timeframes,
+		"custom":     "any N followed by m (up to 1440), h (up to 168) or d (up to 31), e.g. 2h or 8h",
 	})
 }
 
 // GetStats returns API statistics
 func (h *Handlers) GetStats(c *gin.Context) {
 	// This would be enhanced with actual metrics
+	pools := h.dataManager.PoolMetrics()
 	stats := models.Stats{
 		Uptime:         time.Since(h.startTime),
 		TotalRequests:  0, // Would track this
 		AverageLatency: 0, // Would calculate this
-		ActiveQueries:  0, // Would track this
+		ActiveQueries:  int(pools["read"].AcquiredConns),
+		DatabasePool:   poolStats(pools["read"]),
+		WritePool:      poolStats(pools["write"]),
+		QueryLatency:   queryLatency(h.dataManager.QueryMetrics()),
+		Integrity:      services.GetIntegrityStats(),
 	}
 
 	c.JSON(http.StatusOK, stats)
 }
 
+// poolStats summarizes a pool's metrics for the stats endpoint
+func poolStats(pool db.PoolMetrics) models.DatabasePoolStats {
+	return models.DatabasePoolStats{
+		TotalConnections:  pool.TotalConns,
+		IdleConnections:   pool.IdleConns,
+		ActiveConnections: pool.AcquiredConns,
+		MaxConnections:    pool.MaxConns,
+		WaitCount:         pool.EmptyAcquires,
+		WaitDuration:      int64(pool.AcquireWait.SumMs),
+		SlowAcquires:      pool.SlowAcquires,
+		SlowQueries:       pool.SlowQueries,
+	}
+}
+
+// ReconnectDatabase drops every pooled database connection so the next
+// queries dial fresh ones
+func (h *Handlers) ReconnectDatabase(c *gin.Context) {
+	if err := h.dataManager.ReconnectDatabase(c.Request.Context()); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "Database reconnect failed",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "reconnected",
+		"pools":  h.dataManager.PoolMetrics(),
+	})
+}
+
+// queryLatency summarizes per-query metrics for the stats endpoint
+func queryLatency(pools map[string][]db.QueryMetric) []models.QueryLatencyStats {
+	latency := []models.QueryLatencyStats{}
+	for _, pool := range []string{"read", "write"} {
+		for _, metric := range pools[pool] {
+			latency = append(latency, models.QueryLatencyStats{
+				Pool:  pool,
+				Query: string(metric.Query),
+				Table: metric.Table,
+				Count: metric.Duration.Count,
+				Rows:  metric.Rows,
+				P50Ms: metric.P50Ms,
+				P95Ms: metric.P95Ms,
+				P99Ms: metric.P99Ms,
+			})
+		}
+	}
+	return latency
+}
+
+// GetDatabaseStats returns acquire wait and query duration histograms for
+// the read and write database pools
+func (h *Handlers) GetDatabaseStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"pools": h.dataManager.PoolMetrics(),
+	})
+}
+
+// GetTableStats returns statistics for every known table
+func (h *Handlers) GetTableStats(c *gin.Context) {
+	bySymbol := c.Query("by_symbol") == "true"
+
+	stats, err := h.dataService.GetAllTableStats(c.Request.Context(), bySymbol)
+	if err != nil {
+		respondError(c, "Failed to retrieve table stats", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":  len(stats),
+		"tables": stats,
+	})
+}
+
 // GetCacheStats returns cache statistics
 func (h *Handlers) GetCacheStats(c *gin.Context) {
-	// This would get actual cache stats from the cache service
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Cache stats endpoint",
-		// Would include actual stats
+	stats := h.cacheService.GetStats()
+
+	hitRate := 0.0
+	if total := stats.Hits + stats.Misses; total > 0 {
+		hitRate = float64(stats.Hits) / float64(total) * 100
+	}
+
+	classes := make(map[string]models.CacheClassStats, len(stats.Classes))
+	for class, classStats := range stats.Classes {
+		classes[class] = models.CacheClassStats{
+			Entries:    classStats.Entries,
+			Bytes:      classStats.Bytes,
+			QuotaBytes: classStats.QuotaBytes,
+		}
+	}
+
+	windows := make(map[string]models.CacheWindowStats, len(stats.Windows))
+	for name, window := range stats.Windows {
+		windows[name] = models.CacheWindowStats{
+			Hits:              window.Hits,
+			Misses:            window.Misses,
+			HitRate:           window.HitRate,
+			Evictions:         window.Evictions,
+			AvgEvictionAgeSec: window.AvgEvictionAge.Seconds(),
+		}
+	}
+
+	c.JSON(http.StatusOK, models.CacheStats{
+		Backend:      stats.Backend,
+		Size:         stats.Size,
+		MaxSize:      stats.MaxSize,
+		Hits:         stats.Hits,
+		Misses:       stats.Misses,
+		HitRate:      hitRate,
+		Evictions:    stats.Evictions,
+		MemoryUsage:  stats.MemoryBytes,
+		NegativeHits: stats.NegativeHits,
+		ReusedKeys:   stats.ReusedKeys,
+		OldestEntryS: stats.OldestEntry.Seconds(),
+		TooLarge:     stats.TooLarge,
+		Classes:      classes,
+		Windows:      windows,
 	})
 }
 
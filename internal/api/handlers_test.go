@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sptrader/sptrader/internal/bars"
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/models"
+	"github.com/sptrader/sptrader/internal/services"
+)
+
+// fakeData stands in for DataService
+type fakeData struct {
+	symbols []models.Symbol
+	err     error
+}
+
+func (f *fakeData) GetSymbols(context.Context) ([]models.Symbol, error) {
+	return f.symbols, f.err
+}
+
+func (f *fakeData) GetDataRange(context.Context, string) (map[string]interface{}, error) {
+	return nil, f.err
+}
+
+func (f *fakeData) GetPriceBars(context.Context, models.PriceBarRequest, bars.Builder) (*models.PriceBarResponse, error) {
+	return nil, f.err
+}
+
+func (f *fakeData) GetAllTableStats(context.Context, bool) (map[string]models.TableStats, error) {
+	return nil, f.err
+}
+
+func (f *fakeData) FindDuplicateBars(context.Context, string, string) (*models.IntegrityReport, error) {
+	return nil, f.err
+}
+
+func newTestHandlers(data *fakeData, symbols ...string) *Handlers {
+	return &Handlers{
+		dataService: data,
+		symbols:     services.NewSymbolRegistry(nil, config.SymbolsConfig{List: symbols}),
+		startTime:   time.Now(),
+	}
+}
+
+// serve runs one request through handler mounted at path
+func serve(handler gin.HandlerFunc, path, target string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET(path, handler)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+var testSymbols = []models.Symbol{
+	{
+		Symbol:               "EURUSD",
+		Description:          "Euro / US Dollar",
+		BaseCurrency:         "EUR",
+		QuoteCurrency:        "USD",
+		MinSize:              0.01,
+		TickSize:             0.00001,
+		FirstTick:            time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+		LastUpdate:           time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC),
+		TickCount:            123456,
+		TickCountApproximate: true,
+		Timeframes:           []string{"1m", "1h", "1d"},
+		MetadataSource:       "symbols_meta",
+	},
+	{
+		Symbol:         "GBPJPY",
+		Description:    "GBP/JPY",
+		BaseCurrency:   "GBP",
+		QuoteCurrency:  "JPY",
+		MinSize:        0.01,
+		TickSize:       0.0001,
+		Timeframes:     []string{},
+		MetadataSource: "default",
+	},
+}
+
+func TestGetSymbolsResponseShape(t *testing.T) {
+	h := newTestHandlers(&fakeData{symbols: append([]models.Symbol{}, testSymbols...)}, "EURUSD", "GBPJPY")
+	w := serve(h.GetSymbols, "/symbols", "/symbols")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+
+	var raw struct {
+		Count   int                      `json:"count"`
+		Symbols []map[string]interface{} `json:"symbols"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw.Count != 2 || len(raw.Symbols) != 2 {
+		t.Fatalf("count %d with %d symbols, want 2", raw.Count, len(raw.Symbols))
+	}
+	for _, field := range []string{
+		"symbol", "description", "base_currency", "quote_currency", "min_size", "tick_size",
+		"last_update", "first_tick", "tick_count", "tick_count_approximate", "timeframes", "metadata_source",
+	} {
+		if _, ok := raw.Symbols[0][field]; !ok {
+			t.Errorf("symbol has no %s field", field)
+		}
+	}
+	// A symbol without OHLC tables lists no timeframes rather than null
+	if tfs, ok := raw.Symbols[1]["timeframes"].([]interface{}); !ok || len(tfs) != 0 {
+		t.Errorf("timeframes of a symbol without OHLC rows = %#v, want []", raw.Symbols[1]["timeframes"])
+	}
+
+	var decoded struct {
+		Symbols []models.Symbol `json:"symbols"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Symbols[0], testSymbols[0]) {
+		t.Errorf("symbol = %+v, want %+v", decoded.Symbols[0], testSymbols[0])
+	}
+}
+
+func TestGetSymbolsFiltersByQuery(t *testing.T) {
+	h := newTestHandlers(&fakeData{symbols: append([]models.Symbol{}, testSymbols...)}, "EURUSD", "GBPJPY")
+	w := serve(h.GetSymbols, "/symbols", "/symbols?q=jpy")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+
+	var body struct {
+		Count   int             `json:"count"`
+		Symbols []models.Symbol `json:"symbols"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Count != 1 || len(body.Symbols) != 1 || body.Symbols[0].Symbol != "GBPJPY" {
+		t.Errorf("q=jpy returned %+v, want only GBPJPY", body.Symbols)
+	}
+}
+
+func TestGetSymbolsUnavailable(t *testing.T) {
+	h := newTestHandlers(&fakeData{err: fmt.Errorf("failed to query symbols: %w", services.ErrUnavailable)})
+	w := serve(h.GetSymbols, "/symbols", "/symbols")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503: %s", w.Code, w.Body)
+	}
+}
+
+// GetCandles and GetSmartCandles validate their options the same way, before
+// any query runs
+func TestCandleOptionsRejected(t *testing.T) {
+	h := newTestHandlers(&fakeData{}, "EURUSD")
+	const day = "&start=2024-03-04T00:00:00Z&end=2024-03-05T00:00:00Z"
+	const year = "&start=2023-03-04T00:00:00Z&end=2024-03-04T00:00:00Z"
+	tests := []struct {
+		name  string
+		query string
+		code  int
+	}{
+		{"no range", "symbol=EURUSD&tf=1h", http.StatusBadRequest},
+		{"unknown symbol", "symbol=EURUSX&tf=1h" + day, http.StatusNotFound},
+		{"unknown extra", "symbol=EURUSD&tf=1h&include=bogus" + day, http.StatusBadRequest},
+		{"unknown alignment", "symbol=EURUSD&tf=1d&alignment=bogus" + day, http.StatusBadRequest},
+		{"unknown session", "symbol=EURUSD&tf=1h&session=MARS" + day, http.StatusBadRequest},
+		{"spread over a year", "symbol=EURUSD&tf=1h&include=spread" + year, http.StatusRequestEntityTooLarge},
+		{"sessions over a year", "symbol=EURUSD&tf=1h&session=LONDON" + year, http.StatusRequestEntityTooLarge},
+		{"seconds over a day", "symbol=EURUSD&tf=1s" + day, http.StatusRequestEntityTooLarge},
+	}
+	handlers := []struct {
+		name    string
+		handler gin.HandlerFunc
+	}{
+		{"GetCandles", h.GetCandles},
+		{"GetSmartCandles", h.GetSmartCandles},
+	}
+	for _, handler := range handlers {
+		for _, tt := range tests {
+			if w := serve(handler.handler, "/candles", "/candles?"+tt.query); w.Code != tt.code {
+				t.Errorf("%s %s: status = %d, want %d: %s", handler.name, tt.name, w.Code, tt.code, w.Body)
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/services"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	spanExporter     *tracetest.InMemoryExporter
+	spanExporterOnce sync.Once
+)
+
+// recordSpans installs a provider exporting every span to memory. The
+// global provider can only be installed once, so tests share the exporter
+// and reset it.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	spanExporterOnce.Do(func() {
+		spanExporter = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter)))
+	})
+	spanExporter.Reset()
+	t.Cleanup(spanExporter.Reset)
+	return spanExporter
+}
+
+// fakeQuestDB accepts PGWire connections, answers pings and fails every
+// other statement with a server error, so queries reach pgx's tracer
+// without a database. It returns the URL to connect to.
+func fakeQuestDB(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeQuestDB(conn)
+		}
+	}()
+	return "postgres://admin:quest@" + listener.Addr().String() + "/qdb?sslmode=disable"
+}
+
+func serveFakeQuestDB(conn net.Conn) {
+	defer conn.Close()
+	backend := pgproto3.NewBackend(conn, conn)
+	if _, err := backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if backend.Flush() != nil {
+		return
+	}
+
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.Query:
+			if msg.String == "-- ping" {
+				backend.Send(&pgproto3.EmptyQueryResponse{})
+			} else {
+				backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "XX000", Message: "fake database"})
+			}
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		case *pgproto3.Sync:
+			backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "XX000", Message: "fake database"})
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		case *pgproto3.Terminate:
+			return
+		default:
+			continue
+		}
+		if backend.Flush() != nil {
+			return
+		}
+	}
+}
+
+// spanAttr returns a span's attribute, or an invalid value if it has none
+func spanAttr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, attr := range span.Attributes {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestCandlesTraceHierarchy(t *testing.T) {
+	exporter := recordSpans(t)
+	pool, err := db.NewReadOnlyPool(config.DatabaseConfig{URL: fakeQuestDB(t), MaxConnections: 2, MaxConnLifetime: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	cfg := config.DataConfig{Resolutions: map[string]config.ResolutionConfig{
+		"1h": {Table: "ohlc_1h_trace_test", MaxRange: 30 * 24 * time.Hour, MaxPoints: 1000},
+	}}
+	h := newTestHandlers(&fakeData{}, "EURUSD")
+	h.viewportService = services.NewViewportService(pool, services.NewCacheService(config.CacheConfig{MaxSize: 10, MaxBytes: 1 << 20}), cfg, config.TTLTiers{{TTL: time.Hour}}, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(TracingMiddleware())
+	router.GET("/api/v1/candles", h.GetCandles)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/api/v1/candles?symbol=EURUSD&tf=1h&start=2024-03-04T00:00:00Z&end=2024-03-05T00:00:00Z", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500 from the failing database: %s", w.Code, w.Body)
+	}
+
+	byName := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		byName[span.Name] = span
+	}
+	server, ok := byName["GET /api/v1/candles"]
+	if !ok {
+		t.Fatalf("no server span in %d spans", len(byName))
+	}
+	get, load, query := byName["cache.get"], byName["cache.load"], byName["SELECT tables"]
+
+	// HTTP -> cache lookup -> cache load -> query, all in one trace
+	chain := []struct {
+		name   string
+		span   tracetest.SpanStub
+		parent tracetest.SpanStub
+	}{
+		{"cache.get", get, server},
+		{"cache.load", load, get},
+		{"SELECT tables", query, load},
+	}
+	for _, link := range chain {
+		if !link.span.SpanContext.IsValid() {
+			t.Errorf("%s: no span recorded", link.name)
+			continue
+		}
+		if link.span.Parent.SpanID() != link.parent.SpanContext.SpanID() {
+			t.Errorf("%s: parent %s, want %s", link.name, link.span.Parent.SpanID(), link.parent.Name)
+		}
+		if link.span.SpanContext.TraceID() != server.SpanContext.TraceID() {
+			t.Errorf("%s: trace %s, want the request's %s", link.name, link.span.SpanContext.TraceID(), server.SpanContext.TraceID())
+		}
+	}
+
+	if server.SpanKind != trace.SpanKindServer || server.Status.Code != codes.Error {
+		t.Errorf("server span: kind %s, status %s, want a server span with an error status", server.SpanKind, server.Status.Code)
+	}
+	serverAttrs := map[attribute.Key]interface{}{
+		"http.request.method":       "GET",
+		"http.route":                "/api/v1/candles",
+		"url.path":                  "/api/v1/candles",
+		"http.response.status_code": int64(http.StatusInternalServerError),
+	}
+	for key, want := range serverAttrs {
+		if got := spanAttr(server, key).AsInterface(); got != want {
+			t.Errorf("server span %s = %v, want %v", key, got, want)
+		}
+	}
+	if got := spanAttr(load, "cache.namespace").AsString(); got != "candles" {
+		t.Errorf("cache.load namespace = %q, want candles", got)
+	}
+
+	if query.SpanKind != trace.SpanKindClient || query.Status.Code != codes.Error {
+		t.Errorf("query span: kind %s, status %s, want a client span with an error status", query.SpanKind, query.Status.Code)
+	}
+	queryAttrs := map[attribute.Key]interface{}{
+		"db.system":          "questdb",
+		"db.operation.name":  "SELECT",
+		"db.collection.name": "tables",
+		"db.query.text":      "SELECT table_name FROM tables() WHERE table_name = $1",
+		"db.read_only_pool":  true,
+	}
+	for key, want := range queryAttrs {
+		if got := spanAttr(query, key).AsInterface(); got != want {
+			t.Errorf("query span %s = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterPprof serves the runtime profiles of net/http/pprof on routes,
+// which should be mounted at /debug
+func RegisterPprof(routes gin.IRoutes) {
+	routes.GET("/pprof/", gin.WrapF(pprof.Index))
+	routes.GET("/pprof/cmdline", gin.WrapF(pprof.Cmdline))
+	routes.GET("/pprof/profile", gin.WrapF(pprof.Profile))
+	routes.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	routes.GET("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	routes.GET("/pprof/trace", gin.WrapF(pprof.Trace))
+	routes.GET("/pprof/:profile", func(c *gin.Context) {
+		pprof.Handler(c.Param("profile")).ServeHTTP(c.Writer, c.Request)
+	})
+}
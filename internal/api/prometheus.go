@@ -0,0 +1,122 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sptrader/sptrader/internal/db"
+)
+
+// Metrics serves database pool and per-query metrics in the Prometheus text
+// exposition format
+func (h *Handlers) Metrics(c *gin.Context) {
+	pools := h.dataManager.PoolMetrics()
+	queries := h.dataManager.QueryMetrics()
+
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+
+	writeFamily(&b, "sptrader_db_query_duration_seconds", "histogram", "Duration of database queries by logical query and table")
+	for _, pool := range names {
+		for _, metric := range queries[pool] {
+			labels := fmt.Sprintf(`pool=%q,query=%q,table=%q`, pool, string(metric.Query), metric.Table)
+			writeHistogram(&b, "sptrader_db_query_duration_seconds", labels, metric.Duration)
+		}
+	}
+
+	writeFamily(&b, "sptrader_db_query_rows_total", "counter", "Rows returned or affected by database queries by logical query and table")
+	for _, pool := range names {
+		for _, metric := range queries[pool] {
+			fmt.Fprintf(&b, "sptrader_db_query_rows_total{pool=%q,query=%q,table=%q} %d\n", pool, string(metric.Query), metric.Table, metric.Rows)
+		}
+	}
+
+	writeFamily(&b, "sptrader_db_acquire_wait_seconds", "histogram", "Time spent waiting for a pooled database connection")
+	for _, pool := range names {
+		writeHistogram(&b, "sptrader_db_acquire_wait_seconds", fmt.Sprintf("pool=%q", pool), pools[pool].AcquireWait)
+	}
+
+	writeFamily(&b, "sptrader_db_pool_connections", "gauge", "Database pool connections by state")
+	for _, pool := range names {
+		metrics := pools[pool]
+		for _, state := range []struct {
+			name  string
+			value int32
+		}{
+			{"total", metrics.TotalConns},
+			{"idle", metrics.IdleConns},
+			{"acquired", metrics.AcquiredConns},
+			{"max", metrics.MaxConns},
+		} {
+			fmt.Fprintf(&b, "sptrader_db_pool_connections{pool=%q,state=%q} %d\n", pool, state.name, state.value)
+		}
+	}
+
+	writeFamily(&b, "sptrader_db_slow_queries_total", "counter", "Queries slower than the slow query threshold")
+	for _, pool := range names {
+		fmt.Fprintf(&b, "sptrader_db_slow_queries_total{pool=%q} %d\n", pool, pools[pool].SlowQueries)
+	}
+
+	writeFamily(&b, "sptrader_db_slow_acquires_total", "counter", "Connection acquires that waited longer than the acquire wait limit")
+	for _, pool := range names {
+		fmt.Fprintf(&b, "sptrader_db_slow_acquires_total{pool=%q} %d\n", pool, pools[pool].SlowAcquires)
+	}
+
+	writeFamily(&b, "sptrader_db_busy_retries_total", "counter", "Retries of reads that found their table busy, by table")
+	for _, pool := range names {
+		tables := make([]string, 0, len(pools[pool].BusyRetries))
+		for table := range pools[pool].BusyRetries {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+		for _, table := range tables {
+			fmt.Fprintf(&b, "sptrader_db_busy_retries_total{pool=%q,table=%q} %d\n", pool, table, pools[pool].BusyRetries[table])
+		}
+	}
+
+	writeFamily(&b, "sptrader_db_breaker_open", "gauge", "Whether the database circuit breaker is failing queries fast")
+	for _, pool := range names {
+		open := 0
+		if pools[pool].Breaker.State != db.BreakerClosed {
+			open = 1
+		}
+		fmt.Fprintf(&b, "sptrader_db_breaker_open{pool=%q} %d\n", pool, open)
+	}
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+// writeFamily writes a metric family's HELP and TYPE lines
+func writeFamily(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeHistogram writes a histogram's cumulative buckets, sum and count in
+// seconds
+func writeHistogram(b *strings.Builder, name, labels string, histogram db.Histogram) {
+	var cumulative int64
+	for _, bucket := range histogram.Buckets {
+		cumulative += bucket.Count
+		le := bucket.LE
+		if le != "+Inf" {
+			bound, err := time.ParseDuration(le)
+			if err != nil {
+				continue
+			}
+			le = strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=%q} %d\n", name, labels, le, cumulative)
+	}
+	fmt.Fprintf(b, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(histogram.SumMs/1000, 'g', -1, 64))
+	fmt.Fprintf(b, "%s_count{%s} %d\n", name, labels, histogram.Count)
+}
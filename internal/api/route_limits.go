@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/config"
+)
+
+// timeoutWriteGrace is how long past a route's request deadline the
+// connection stays writable, so the 504 for a timed out request still gets
+// out
+const timeoutWriteGrace = time.Second
+
+// routeLimiter applies one route's limits; slots is nil when its
+// concurrency is unlimited
+type routeLimiter struct {
+	config.RouteLimits
+	slots chan struct{}
+}
+
+// RouteLimitsMiddleware applies the limits of the longest route prefix
+// matching each request path. A route timeout becomes the request context
+// deadline and, with timeoutWriteGrace added, the connection write deadline,
+// so long-running responses can outlast the server WriteTimeout and probes
+// fail fast.
+func RouteLimitsMiddleware(routes []config.RouteLimits) gin.HandlerFunc {
+	limiters := make([]*routeLimiter, 0, len(routes))
+	for _, route := range routes {
+		limiter := &routeLimiter{RouteLimits: route}
+		if route.MaxConcurrent > 0 {
+			limiter.slots = make(chan struct{}, route.MaxConcurrent)
+		}
+		limiters = append(limiters, limiter)
+	}
+	// Longest prefix first, so the first match is the most specific
+	sort.Slice(limiters, func(i, j int) bool {
+		return len(limiters[i].Prefix) > len(limiters[j].Prefix)
+	})
+
+	return func(c *gin.Context) {
+		limiter := matchRoute(limiters, c.Request.URL.Path)
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		if limiter.slots != nil {
+			select {
+			case limiter.slots <- struct{}{}:
+				defer func() { <-limiter.slots }()
+			default:
+				c.Header("Retry-After", "1")
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Too many concurrent requests"})
+				return
+			}
+		}
+
+		if limiter.MaxBodyBytes > 0 {
+			if c.Request.ContentLength > limiter.MaxBodyBytes {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+				return
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limiter.MaxBodyBytes)
+		}
+
+		if limiter.Timeout > 0 {
+			deadline := time.Now().Add(limiter.Timeout)
+			if err := http.NewResponseController(c.Writer).SetWriteDeadline(deadline.Add(timeoutWriteGrace)); err != nil {
+				log.Debug().Err(err).Str("path", c.Request.URL.Path).Msg("Write deadline not supported")
+			}
+			ctx, cancel := context.WithDeadline(c.Request.Context(), deadline)
+			defer cancel()
+			c.Request = c.Request.WithContext(ctx)
+		}
+
+		c.Next()
+
+		if !c.Writer.Written() && errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) {
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": "Request timed out"})
+		}
+	}
+}
+
+// matchRoute returns the limiter of the longest prefix covering path on a
+// segment boundary, so /api/v1/data doesn't match /api/v1/database
+func matchRoute(limiters []*routeLimiter, path string) *routeLimiter {
+	for _, limiter := range limiters {
+		prefix := limiter.Prefix
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return limiter
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sptrader/sptrader/internal/config"
+)
+
+// slowHandler takes delay to respond unless the request context ends first,
+// reporting the context's deadline and error
+type slowHandler struct {
+	delay       time.Duration
+	hasDeadline chan bool
+	ctxErr      chan error
+}
+
+func newSlowHandler(delay time.Duration) *slowHandler {
+	return &slowHandler{delay: delay, hasDeadline: make(chan bool, 1), ctxErr: make(chan error, 1)}
+}
+
+func (h *slowHandler) handle(c *gin.Context) {
+	_, ok := c.Request.Context().Deadline()
+	h.hasDeadline <- ok
+	select {
+	case <-time.After(h.delay):
+		h.ctxErr <- nil
+		c.JSON(http.StatusOK, gin.H{"status": "done"})
+	case <-c.Request.Context().Done():
+		// Handlers give up on a cancelled context without writing
+		h.ctxErr <- c.Request.Context().Err()
+	}
+}
+
+// limitedServer serves handler on every path under the route limits. It is
+// a real server, so route timeouts set connection write deadlines too.
+func limitedServer(t *testing.T, routes []config.RouteLimits, handler gin.HandlerFunc) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RouteLimitsMiddleware(routes))
+	router.Any("/*path", handler)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRouteLimitsTimeout(t *testing.T) {
+	routes := []config.RouteLimits{
+		{Prefix: "/api/v1/slow", Timeout: 50 * time.Millisecond},
+		{Prefix: "/api/v1/slow/export", Timeout: 2 * time.Second},
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		delay    time.Duration
+		status   int
+		deadline bool
+		ctxErr   error
+	}{
+		{"past the route timeout", "/api/v1/slow/candles", 500 * time.Millisecond, http.StatusGatewayTimeout, true, context.DeadlineExceeded},
+		{"within the route timeout", "/api/v1/slow/candles", 10 * time.Millisecond, http.StatusOK, true, nil},
+		// The longer timeout of the more specific prefix applies
+		{"longest prefix", "/api/v1/slow/export/csv", 200 * time.Millisecond, http.StatusOK, true, nil},
+		// Only whole path segments match a prefix
+		{"no route", "/api/v1/slowness", 100 * time.Millisecond, http.StatusOK, false, nil},
+	}
+	for _, tt := range tests {
+		slow := newSlowHandler(tt.delay)
+		server := limitedServer(t, routes, slow.handle)
+
+		started := time.Now()
+		resp, err := http.Get(server.URL + tt.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		resp.Body.Close()
+		elapsed := time.Since(started)
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if deadline := <-slow.hasDeadline; deadline != tt.deadline {
+			t.Errorf("%s: handler context has deadline %v, want %v", tt.name, deadline, tt.deadline)
+		}
+		if err := <-slow.ctxErr; !errors.Is(err, tt.ctxErr) {
+			t.Errorf("%s: handler saw %v, want %v", tt.name, err, tt.ctxErr)
+		}
+		if tt.status == http.StatusGatewayTimeout && elapsed >= tt.delay {
+			t.Errorf("%s: timed out response took %s, as long as the handler's %s", tt.name, elapsed, tt.delay)
+		}
+	}
+}
+
+func TestRouteLimitsConcurrency(t *testing.T) {
+	release := make(chan struct{})
+	entered := make(chan struct{}, 1)
+	server := limitedServer(t, []config.RouteLimits{{Prefix: "/api/v1/export", MaxConcurrent: 1}}, func(c *gin.Context) {
+		entered <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	first := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(server.URL + "/api/v1/export")
+		if err != nil {
+			first <- 0
+			return
+		}
+		resp.Body.Close()
+		first <- resp.StatusCode
+	}()
+	<-entered
+
+	resp, err := http.Get(server.URL + "/api/v1/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("request over the limit: status %d, Retry-After %q, want 503 with Retry-After", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	close(release)
+	if status := <-first; status != http.StatusOK {
+		t.Errorf("request within the limit: status %d, want 200", status)
+	}
+}
+
+func TestRouteLimitsBody(t *testing.T) {
+	server := limitedServer(t, []config.RouteLimits{{Prefix: "/api/v1/data/ensure", MaxBodyBytes: 16}}, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, tt := range []struct {
+		body   string
+		status int
+	}{
+		{`{"symbol":"X"}`, http.StatusOK},
+		{`{"symbol":"EURUSD","start":"2024-01-01"}`, http.StatusRequestEntityTooLarge},
+	} {
+		resp, err := http.Post(server.URL+"/api/v1/data/ensure", "application/json", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%d byte body: status %d, want %d", len(tt.body), resp.StatusCode, tt.status)
+		}
+	}
+}
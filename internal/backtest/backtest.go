@@ -0,0 +1,241 @@
+// Package backtest runs simple trading strategies over candles. Runs are
+// deterministic: the same candles and strategy always give the same trades.
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// Strategies
+const (
+	StrategySMACross = "sma_cross"
+)
+
+// MaxBars caps the candles one run may take
+const MaxBars = 50000
+
+// checkEvery is how many bars run between checks for cancellation
+const checkEvery = 1024
+
+// Errors for candles a run can't use
+var (
+	ErrTooManyBars   = errors.New("too many bars")
+	ErrNotEnoughBars = errors.New("not enough bars")
+)
+
+// Validate checks a strategy, returning it with its defaults filled in
+func Validate(s models.BacktestStrategy) (models.BacktestStrategy, error) {
+	if s.Type == "" {
+		s.Type = StrategySMACross
+	}
+	if s.Type != StrategySMACross {
+		return s, fmt.Errorf("unknown strategy %q, want %s", s.Type, StrategySMACross)
+	}
+	if s.Fast < 1 || s.Slow <= s.Fast {
+		return s, fmt.Errorf("sma_cross needs 1 <= fast < slow, got fast %d and slow %d", s.Fast, s.Slow)
+	}
+	if s.Spread < 0 || s.Slippage < 0 {
+		return s, fmt.Errorf("spread and slippage can't be negative")
+	}
+	if s.Quantity < 0 {
+		return s, fmt.Errorf("quantity can't be negative")
+	}
+	if s.Quantity == 0 {
+		s.Quantity = 1
+	}
+	return s, nil
+}
+
+// Result is a run's trades, equity curve and stats
+type Result struct {
+	Trades []models.BacktestTrade
+	Equity []models.BacktestEquityPoint
+	Stats  models.BacktestStats
+}
+
+// Run backtests strategy over candles in time order. Signals are taken at a
+// candle's close and filled at the next candle's open, so no trade is
+// decided on prices it couldn't have seen yet. A position still open after
+// the last candle is closed at its close. Run stops with the context's error
+// once it is done.
+func Run(ctx context.Context, candles []models.Candle, strategy models.BacktestStrategy) (*Result, error) {
+	spec, err := Validate(strategy)
+	if err != nil {
+		return nil, err
+	}
+	if len(candles) > MaxBars {
+		return nil, fmt.Errorf("%w: %d candles, at most %d", ErrTooManyBars, len(candles), MaxBars)
+	}
+	if len(candles) <= spec.Slow {
+		return nil, fmt.Errorf("%w: sma_cross with slow %d needs more than %d candles, got %d", ErrNotEnoughBars, spec.Slow, spec.Slow, len(candles))
+	}
+
+	closes := make([]float64, len(candles))
+	for i, c := range candles {
+		closes[i] = c.Close
+	}
+	fast, slow := sma(closes, spec.Fast), sma(closes, spec.Slow)
+
+	b := &book{spec: spec}
+	result := &Result{Trades: []models.BacktestTrade{}, Equity: make([]models.BacktestEquityPoint, 0, len(candles))}
+	target, trend := 0, 0
+	for i, c := range candles {
+		if i%checkEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		if target != b.position {
+			if trade, ok := b.close(c.Timestamp, c.Open, i); ok {
+				result.Trades = append(result.Trades, trade)
+			}
+			b.open(target, c.Timestamp, c.Open, i)
+		}
+		result.Equity = append(result.Equity, models.BacktestEquityPoint{Timestamp: c.Timestamp, Equity: b.equity(c.Close)})
+
+		// A cross of the averages sets the position for the next open
+		if i >= spec.Slow-1 {
+			now := sign(fast[i] - slow[i])
+			if now != 0 && trend != 0 && now != trend {
+				target = now
+				if target < 0 && !spec.AllowShort {
+					target = 0
+				}
+			}
+			if now != 0 {
+				trend = now
+			}
+		}
+	}
+
+	last := len(candles) - 1
+	if trade, ok := b.close(candles[last].Timestamp, candles[last].Close, last); ok {
+		trade.ClosedAtEnd = true
+		result.Trades = append(result.Trades, trade)
+		result.Equity[last].Equity = b.realized
+	}
+	result.Stats = summarize(result.Trades, result.Equity)
+	return result, nil
+}
+
+// book tracks the open position and realized profit
+type book struct {
+	spec       models.BacktestStrategy
+	position   int // 1 long, -1 short, 0 flat
+	entryTime  time.Time
+	entryPrice float64
+	entryBar   int
+	realized   float64
+}
+
+// fill returns the price a buy (side 1) or sell (side -1) at price fills at
+// after costs
+func (b *book) fill(side int, price float64) float64 {
+	return price + float64(side)*(b.spec.Spread/2+b.spec.Slippage)
+}
+
+// open enters a position of side at price, unless side is flat
+func (b *book) open(side int, at time.Time, price float64, bar int) {
+	b.position = side
+	if side == 0 {
+		return
+	}
+	b.entryTime, b.entryPrice, b.entryBar = at, b.fill(side, price), bar
+}
+
+// close exits the open position at price, reporting the trade, or false
+// when flat
+func (b *book) close(at time.Time, price float64, bar int) (models.BacktestTrade, bool) {
+	if b.position == 0 {
+		return models.BacktestTrade{}, false
+	}
+	exit := b.fill(-b.position, price)
+	trade := models.BacktestTrade{
+		Side:       "long",
+		EntryTime:  b.entryTime,
+		EntryPrice: b.entryPrice,
+		ExitTime:   at,
+		ExitPrice:  exit,
+		Bars:       bar - b.entryBar,
+		PnL:        (exit - b.entryPrice) * float64(b.position) * b.spec.Quantity,
+	}
+	if b.position < 0 {
+		trade.Side = "short"
+	}
+	b.realized += trade.PnL
+	b.position = 0
+	return trade, true
+}
+
+// equity returns realized profit plus the open position marked at price
+func (b *book) equity(price float64) float64 {
+	if b.position == 0 {
+		return b.realized
+	}
+	return b.realized + (price-b.entryPrice)*float64(b.position)*b.spec.Quantity
+}
+
+// summarize computes the stats of a run's trades and equity
+func summarize(trades []models.BacktestTrade, equity []models.BacktestEquityPoint) models.BacktestStats {
+	var s models.BacktestStats
+	s.Trades = len(trades)
+	for _, t := range trades {
+		switch {
+		case t.PnL > 0:
+			s.Wins++
+			s.GrossProfit += t.PnL
+		case t.PnL < 0:
+			s.Losses++
+			s.GrossLoss -= t.PnL
+		}
+		s.NetProfit += t.PnL
+	}
+	if s.Trades > 0 {
+		s.WinRate = float64(s.Wins) / float64(s.Trades)
+	}
+	if s.GrossLoss > 0 {
+		factor := s.GrossProfit / s.GrossLoss
+		s.ProfitFactor = &factor
+	}
+
+	var peak float64
+	for _, point := range equity {
+		peak = max(peak, point.Equity)
+		s.MaxDrawdown = max(s.MaxDrawdown, peak-point.Equity)
+	}
+	return s
+}
+
+// sma returns the simple moving average of values over period, valid from
+// index period-1
+func sma(values []float64, period int) []float64 {
+	averages := make([]float64, len(values))
+	var sum float64
+	for i, v := range values {
+		sum += v
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i >= period-1 {
+			averages[i] = sum / float64(period)
+		}
+	}
+	return averages
+}
+
+func sign(v float64) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	default:
+		return 0
+	}
+}
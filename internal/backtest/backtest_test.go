@@ -0,0 +1,188 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+var t0 = time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+
+func bar(i int) time.Time { return t0.Add(time.Duration(i) * time.Hour) }
+
+// With fast 1 and slow 2 the averages cross whenever the close turns, so
+// the fixture goes long after the rise at bar 5, out after the fall at 7 and
+// long again after the rise at 9, held to the end
+var (
+	fixtureOpens  = []float64{10, 10, 11, 12, 11, 10, 11, 13, 10.5, 11, 12}
+	fixtureCloses = []float64{10, 11, 12, 11, 10, 11, 13, 12, 11, 12, 14}
+)
+
+func fixtureCandles() []models.Candle {
+	candles := make([]models.Candle, len(fixtureCloses))
+	for i, c := range fixtureCloses {
+		o := fixtureOpens[i]
+		candles[i] = models.Candle{Timestamp: bar(i), Open: o, High: max(o, c), Low: min(o, c), Close: c}
+	}
+	return candles
+}
+
+// fixtureStrategy pays 0.15 per fill: half the spread plus the slippage
+var fixtureStrategy = models.BacktestStrategy{Fast: 1, Slow: 2, Spread: 0.2, Slippage: 0.05, Quantity: 2}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestRunTrades(t *testing.T) {
+	result, err := Run(context.Background(), fixtureCandles(), fixtureStrategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.BacktestTrade{
+		// Filled at the open after the signal bar, not the signal's close
+		{Side: "long", EntryTime: bar(6), EntryPrice: 11.15, ExitTime: bar(8), ExitPrice: 10.35, Bars: 2, PnL: -1.6},
+		{Side: "long", EntryTime: bar(10), EntryPrice: 12.15, ExitTime: bar(10), ExitPrice: 13.85, Bars: 0, PnL: 3.4, ClosedAtEnd: true},
+	}
+	if len(result.Trades) != len(want) {
+		t.Fatalf("got %d trades, want %d: %+v", len(result.Trades), len(want), result.Trades)
+	}
+	for i, w := range want {
+		got := result.Trades[i]
+		if got.Side != w.Side || !got.EntryTime.Equal(w.EntryTime) || !got.ExitTime.Equal(w.ExitTime) ||
+			got.Bars != w.Bars || got.ClosedAtEnd != w.ClosedAtEnd ||
+			!near(got.EntryPrice, w.EntryPrice) || !near(got.ExitPrice, w.ExitPrice) || !near(got.PnL, w.PnL) {
+			t.Errorf("trade %d = %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestRunEquity(t *testing.T) {
+	result, err := Run(context.Background(), fixtureCandles(), fixtureStrategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Marked at each close while long; the last bar holds the realized total
+	want := []float64{0, 0, 0, 0, 0, 0, 3.7, 1.7, -1.6, -1.6, 1.8}
+	if len(result.Equity) != len(want) {
+		t.Fatalf("got %d equity points, want %d", len(result.Equity), len(want))
+	}
+	for i, point := range result.Equity {
+		if !point.Timestamp.Equal(bar(i)) || !near(point.Equity, want[i]) {
+			t.Errorf("equity %d = %s %g, want %s %g", i, point.Timestamp, point.Equity, bar(i), want[i])
+		}
+	}
+}
+
+func TestRunStats(t *testing.T) {
+	result, err := Run(context.Background(), fixtureCandles(), fixtureStrategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := result.Stats
+	if s.Trades != 2 || s.Wins != 1 || s.Losses != 1 {
+		t.Errorf("%d trades, %d wins, %d losses, want 2, 1 and 1", s.Trades, s.Wins, s.Losses)
+	}
+	if !near(s.WinRate, 0.5) {
+		t.Errorf("win rate = %g, want 0.5", s.WinRate)
+	}
+	if !near(s.GrossProfit, 3.4) || !near(s.GrossLoss, 1.6) || !near(s.NetProfit, 1.8) {
+		t.Errorf("gross profit %g, gross loss %g, net %g, want 3.4, 1.6 and 1.8", s.GrossProfit, s.GrossLoss, s.NetProfit)
+	}
+	if s.ProfitFactor == nil || !near(*s.ProfitFactor, 3.4/1.6) {
+		t.Errorf("profit factor = %v, want %g", s.ProfitFactor, 3.4/1.6)
+	}
+	// From the 3.7 peak at bar 6 to -1.6 at bar 8
+	if !near(s.MaxDrawdown, 5.3) {
+		t.Errorf("max drawdown = %g, want 5.3", s.MaxDrawdown)
+	}
+}
+
+func TestRunShort(t *testing.T) {
+	strategy := fixtureStrategy
+	strategy.AllowShort = true
+	result, err := Run(context.Background(), fixtureCandles(), strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantSides := []string{"short", "long", "short", "long"}
+	if len(result.Trades) != len(wantSides) {
+		t.Fatalf("got %d trades, want %d: %+v", len(result.Trades), len(wantSides), result.Trades)
+	}
+	for i, side := range wantSides {
+		if result.Trades[i].Side != side {
+			t.Errorf("trade %d is %s, want %s", i, result.Trades[i].Side, side)
+		}
+	}
+	// Short from bar 4's open at 11 to bar 6's at 11 loses the costs
+	if first := result.Trades[0]; !near(first.EntryPrice, 10.85) || !near(first.ExitPrice, 11.15) || !near(first.PnL, -0.6) {
+		t.Errorf("first short = %+v, want 10.85 to 11.15 for -0.6", first)
+	}
+}
+
+func TestRunWithoutLosses(t *testing.T) {
+	closes := []float64{10, 11, 12, 13}
+	candles := make([]models.Candle, len(closes))
+	for i, c := range closes {
+		candles[i] = models.Candle{Timestamp: bar(i), Open: c, High: c, Low: c, Close: c}
+	}
+	result, err := Run(context.Background(), candles, models.BacktestStrategy{Fast: 1, Slow: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Stats.Trades != 0 || result.Stats.ProfitFactor != nil || result.Stats.MaxDrawdown != 0 {
+		t.Errorf("stats of a run without trades = %+v, want zeros", result.Stats)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := Run(ctx, fixtureCandles(), fixtureStrategy)
+	if !errors.Is(err, context.Canceled) || result != nil {
+		t.Errorf("Run with a cancelled context = %v, %v, want context.Canceled", result, err)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := Run(ctx, fixtureCandles(), fixtureStrategy); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run past its deadline: err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRunRejectsBars(t *testing.T) {
+	if _, err := Run(context.Background(), fixtureCandles()[:2], fixtureStrategy); !errors.Is(err, ErrNotEnoughBars) {
+		t.Errorf("2 candles for slow 2: err = %v, want ErrNotEnoughBars", err)
+	}
+	if _, err := Run(context.Background(), make([]models.Candle, MaxBars+1), fixtureStrategy); !errors.Is(err, ErrTooManyBars) {
+		t.Errorf("%d candles: err = %v, want ErrTooManyBars", MaxBars+1, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	spec, err := Validate(models.BacktestStrategy{Fast: 5, Slow: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Type != StrategySMACross || spec.Quantity != 1 {
+		t.Errorf("defaults = %s and quantity %g, want %s and 1", spec.Type, spec.Quantity, StrategySMACross)
+	}
+
+	for _, s := range []models.BacktestStrategy{
+		{Type: "rsi", Fast: 5, Slow: 20},
+		{Fast: 0, Slow: 20},
+		{Fast: 20, Slow: 20},
+		{Fast: 5, Slow: 20, Spread: -1},
+		{Fast: 5, Slow: 20, Quantity: -1},
+	} {
+		if _, err := Validate(s); err == nil {
+			t.Errorf("Validate accepted %+v", s)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Package bars builds bars that close on price movement rather than time:
+// Renko bricks and range bars. They depend on the path price took within a
+// candle, so they are built from ticks, one at a time.
+package bars
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Bar types
+const (
+	TypeRenko = "renko"
+	TypeRange = "range"
+)
+
+// Tick is one price observation
+type Tick struct {
+	Timestamp time.Time
+	Price     float64
+	Volume    float64
+}
+
+// Bar is a completed Renko brick or range bar. Bars a single tick jumps
+// through, over a gap, share its timestamps and carry no ticks or volume.
+type Bar struct {
+	Timestamp time.Time `json:"timestamp"`  // first tick in the bar
+	CloseTime time.Time `json:"close_time"` // tick that completed it
+	Open      float64   `json:"open"`
+	High      float64   `json:"high"`
+	Low       float64   `json:"low"`
+	Close     float64   `json:"close"`
+	Volume    float64   `json:"volume"`
+	Ticks     int64     `json:"ticks"`
+}
+
+// Builder turns ticks, in time order, into bars
+type Builder interface {
+	// Add takes the next tick and returns the bars it completed, if any, in
+	// order
+	Add(tick Tick) []Bar
+}
+
+// New returns a builder of barType bars of size
+func New(barType string, size float64) (Builder, error) {
+	if barType != TypeRenko && barType != TypeRange {
+		return nil, fmt.Errorf("unknown bar type %q, want %s or %s", barType, TypeRenko, TypeRange)
+	}
+	if !(size > 0) || math.IsInf(size, 0) {
+		return nil, fmt.Errorf("%s size must be a positive number, got %g", barType, size)
+	}
+	if barType == TypeRange {
+		return NewRange(size), nil
+	}
+	return NewRenko(size), nil
+}
+
+// epsilon is the fraction of a bar size a price may fall short of a boundary
+// and still reach it, so sizes such as 0.0010 that floats can't represent
+// exactly don't miss boundaries the price sits on
+const epsilon = 1e-9
+
+// pending accumulates the ticks of the bar being built
+type pending struct {
+	started time.Time
+	volume  float64
+	ticks   int64
+}
+
+// add counts a tick towards the bar
+func (p *pending) add(tick Tick) {
+	if p.ticks == 0 {
+		p.started = tick.Timestamp
+	}
+	p.volume += tick.Volume
+	p.ticks++
+}
+
+// take returns the accumulated ticks for a bar completed by tick, with the
+// bar's timestamps set, and starts over. Bars completed after the first by
+// the same tick get only its timestamps.
+func (p *pending) take(tick Tick) Bar {
+	bar := Bar{Timestamp: p.started, CloseTime: tick.Timestamp, Volume: p.volume, Ticks: p.ticks}
+	if p.ticks == 0 {
+		bar.Timestamp = tick.Timestamp
+	}
+	*p = pending{}
+	return bar
+}
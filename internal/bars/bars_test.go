@@ -0,0 +1,84 @@
+package bars
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+
+// path turns prices into ticks a second apart, each of volume 1
+func path(prices ...float64) []Tick {
+	ticks := make([]Tick, len(prices))
+	for i, p := range prices {
+		ticks[i] = Tick{Timestamp: at(i), Price: p, Volume: 1}
+	}
+	return ticks
+}
+
+func at(i int) time.Time { return t0.Add(time.Duration(i) * time.Second) }
+
+// build feeds ticks to b, returning every bar and the index of the tick
+// that completed each
+func build(b Builder, ticks []Tick) ([]Bar, []int) {
+	var bars []Bar
+	var closedBy []int
+	for i, tick := range ticks {
+		for _, bar := range b.Add(tick) {
+			bars = append(bars, bar)
+			closedBy = append(closedBy, i)
+		}
+	}
+	return bars, closedBy
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+// checkBars compares bars' prices, timestamps and tick counts
+func checkBars(t *testing.T, got, want []Bar) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d bars, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if !near(g.Open, w.Open) || !near(g.High, w.High) || !near(g.Low, w.Low) || !near(g.Close, w.Close) {
+			t.Errorf("bar %d is %g/%g/%g/%g, want %g/%g/%g/%g", i, g.Open, g.High, g.Low, g.Close, w.Open, w.High, w.Low, w.Close)
+		}
+		if !g.Timestamp.Equal(w.Timestamp) || !g.CloseTime.Equal(w.CloseTime) {
+			t.Errorf("bar %d spans %s to %s, want %s to %s", i, g.Timestamp, g.CloseTime, w.Timestamp, w.CloseTime)
+		}
+		if g.Ticks != w.Ticks || g.Volume != w.Volume {
+			t.Errorf("bar %d has %d ticks and volume %g, want %d and %g", i, g.Ticks, g.Volume, w.Ticks, w.Volume)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if b, err := New(TypeRenko, 0.001); err != nil {
+		t.Errorf("renko: %v", err)
+	} else if _, ok := b.(*Renko); !ok {
+		t.Errorf("renko builder is a %T", b)
+	}
+	if b, err := New(TypeRange, 0.001); err != nil {
+		t.Errorf("range: %v", err)
+	} else if _, ok := b.(*Range); !ok {
+		t.Errorf("range builder is a %T", b)
+	}
+
+	for _, tt := range []struct {
+		barType string
+		size    float64
+	}{
+		{"kagi", 1},
+		{TypeRenko, 0},
+		{TypeRenko, -1},
+		{TypeRange, math.NaN()},
+		{TypeRange, math.Inf(1)},
+	} {
+		if _, err := New(tt.barType, tt.size); err == nil {
+			t.Errorf("New(%q, %g) succeeded", tt.barType, tt.size)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package bars
+
+// Range builds bars whose high and low are a fixed size apart. A bar
+// completes when a tick would stretch it past the size: it closes at the
+// boundary the tick broke, and the next bar opens there. A tick beyond the
+// size from that boundary, over a gap, completes a bar for each size it
+// jumps. The breaking tick counts towards the bar it lands in.
+type Range struct {
+	size    float64
+	started bool
+	open    float64
+	high    float64
+	low     float64
+	pending pending
+}
+
+// NewRange returns a range bar builder of bars of size
+func NewRange(size float64) *Range {
+	return &Range{size: size}
+}
+
+// Add takes the next tick
+func (r *Range) Add(tick Tick) []Bar {
+	if !r.started {
+		r.reopen(tick.Price)
+		r.started = true
+	}
+
+	var bars []Bar
+	limit := r.size * (1 + epsilon)
+	for {
+		var close float64
+		switch {
+		case tick.Price-r.low > limit:
+			close = r.low + r.size
+			r.high = close
+		case r.high-tick.Price > limit:
+			close = r.high - r.size
+			r.low = close
+		default:
+			r.high, r.low = max(r.high, tick.Price), min(r.low, tick.Price)
+			r.pending.add(tick)
+			return bars
+		}
+
+		bar := r.pending.take(tick)
+		bar.Open, bar.High, bar.Low, bar.Close = r.open, r.high, r.low, close
+		bars = append(bars, bar)
+		r.reopen(close)
+	}
+}
+
+// reopen starts a bar at price
+func (r *Range) reopen(price float64) {
+	r.open, r.high, r.low = price, price, price
+}
@@ -0,0 +1,34 @@
+package bars
+
+import "testing"
+
+func TestRange(t *testing.T) {
+	ticks := path(10, 10.6, 9.8, 11.0, 13.5, 11.9)
+	bars, closedBy := build(NewRange(1), ticks)
+
+	checkBars(t, bars, []Bar{
+		// 11.0 breaks the 9.8 low plus the size; the bar closes at 10.8
+		{Timestamp: at(0), CloseTime: at(3), Open: 10, High: 10.8, Low: 9.8, Close: 10.8, Ticks: 3, Volume: 3},
+		// The gap to 13.5 completes two; the breaking tick counted towards
+		// the bar it landed in, not these
+		{Timestamp: at(3), CloseTime: at(4), Open: 10.8, High: 11.8, Low: 10.8, Close: 11.8, Ticks: 1, Volume: 1},
+		{Timestamp: at(4), CloseTime: at(4), Open: 11.8, High: 12.8, Low: 11.8, Close: 12.8},
+		// Down from the 13.5 high
+		{Timestamp: at(4), CloseTime: at(5), Open: 12.8, High: 13.5, Low: 12.5, Close: 12.5, Ticks: 1, Volume: 1},
+	})
+	if want := []int{3, 4, 4, 5}; len(closedBy) == len(want) {
+		for i := range want {
+			if closedBy[i] != want[i] {
+				t.Errorf("bar %d completed by tick %d, want %d", i, closedBy[i], want[i])
+			}
+		}
+	}
+}
+
+func TestRangeWithinSize(t *testing.T) {
+	// Exactly the size apart doesn't complete a bar
+	bars, _ := build(NewRange(0.0010), path(1.1000, 1.1010, 1.1003, 1.1000))
+	if len(bars) != 0 {
+		t.Errorf("ticks within the size completed %d bars: %+v", len(bars), bars)
+	}
+}
@@ -0,0 +1,63 @@
+package bars
+
+import "math"
+
+// Renko builds bricks of a fixed size on a grid of multiples of it. A brick
+// completes when price reaches the next grid level in the trend's direction,
+// or two levels against it, so a reversal brick starts where the last one
+// opened. The first tick anchors the grid at the level at or below it. The
+// completing tick counts towards the first brick it completes; a tick
+// jumping several levels completes a brick for each.
+type Renko struct {
+	size    float64
+	started bool
+	level   int64 // grid level of the last brick's close, or the anchor
+	trend   int   // 1 up, -1 down, 0 before the first brick
+	pending pending
+}
+
+// NewRenko returns a Renko builder of bricks of size
+func NewRenko(size float64) *Renko {
+	return &Renko{size: size}
+}
+
+// Add takes the next tick
+func (r *Renko) Add(tick Tick) []Bar {
+	if !r.started {
+		r.level = int64(math.Floor(tick.Price/r.size + epsilon))
+		r.started = true
+	}
+	r.pending.add(tick)
+
+	var bricks []Bar
+	for {
+		upFrom, downFrom := r.level, r.level
+		if r.trend < 0 {
+			upFrom++
+		}
+		if r.trend > 0 {
+			downFrom--
+		}
+
+		var open, close int64
+		switch {
+		case tick.Price >= r.price(upFrom+1)-epsilon*r.size:
+			open, close, r.trend = upFrom, upFrom+1, 1
+		case tick.Price <= r.price(downFrom-1)+epsilon*r.size:
+			open, close, r.trend = downFrom, downFrom-1, -1
+		default:
+			return bricks
+		}
+		r.level = close
+
+		brick := r.pending.take(tick)
+		brick.Open, brick.Close = r.price(open), r.price(close)
+		brick.High, brick.Low = max(brick.Open, brick.Close), min(brick.Open, brick.Close)
+		bricks = append(bricks, brick)
+	}
+}
+
+// price returns the price of a grid level
+func (r *Renko) price(level int64) float64 {
+	return float64(level) * r.size
+}
@@ -0,0 +1,45 @@
+package bars
+
+import "testing"
+
+func TestRenko(t *testing.T) {
+	ticks := path(10.5, 11.2, 11.8, 14.3, 12.9, 11.9, 13.0, 14.0)
+	bricks, closedBy := build(NewRenko(1), ticks)
+
+	checkBars(t, bricks, []Bar{
+		{Timestamp: at(0), CloseTime: at(1), Open: 10, High: 11, Low: 10, Close: 11, Ticks: 2, Volume: 2},
+		// The gap to 14.3 completes three bricks; only the first holds ticks
+		{Timestamp: at(2), CloseTime: at(3), Open: 11, High: 12, Low: 11, Close: 12, Ticks: 2, Volume: 2},
+		{Timestamp: at(3), CloseTime: at(3), Open: 12, High: 13, Low: 12, Close: 13},
+		{Timestamp: at(3), CloseTime: at(3), Open: 13, High: 14, Low: 13, Close: 14},
+		// 12.9 is only one level back; the reversal needs two and opens at 13
+		{Timestamp: at(4), CloseTime: at(5), Open: 13, High: 13, Low: 12, Close: 12, Ticks: 2, Volume: 2},
+		// Turning up again opens where the down brick did
+		{Timestamp: at(6), CloseTime: at(7), Open: 13, High: 14, Low: 13, Close: 14, Ticks: 2, Volume: 2},
+	})
+	if want := []int{1, 3, 3, 3, 5, 7}; len(closedBy) == len(want) {
+		for i := range want {
+			if closedBy[i] != want[i] {
+				t.Errorf("brick %d completed by tick %d, want %d", i, closedBy[i], want[i])
+			}
+		}
+	}
+}
+
+func TestRenkoGapDown(t *testing.T) {
+	bricks, _ := build(NewRenko(1), path(10.2, 7.0))
+	checkBars(t, bricks, []Bar{
+		{Timestamp: at(0), CloseTime: at(1), Open: 10, High: 10, Low: 9, Close: 9, Ticks: 2, Volume: 2},
+		{Timestamp: at(1), CloseTime: at(1), Open: 9, High: 9, Low: 8, Close: 8},
+		{Timestamp: at(1), CloseTime: at(1), Open: 8, High: 8, Low: 7, Close: 7},
+	})
+}
+
+// Sizes floats can't represent exactly still complete bricks on the level
+func TestRenkoInexactSize(t *testing.T) {
+	bricks, _ := build(NewRenko(0.0010), path(1.1000, 1.1005, 1.1010, 1.1020))
+	checkBars(t, bricks, []Bar{
+		{Timestamp: at(0), CloseTime: at(2), Open: 1.1000, High: 1.1010, Low: 1.1000, Close: 1.1010, Ticks: 3, Volume: 3},
+		{Timestamp: at(3), CloseTime: at(3), Open: 1.1010, High: 1.1020, Low: 1.1010, Close: 1.1020, Ticks: 1, Volume: 1},
+	})
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidTTLTiers is returned for cache TTL tiers that don't cover every
+// data age exactly once
+var ErrInvalidTTLTiers = errors.New("invalid cache TTL tiers")
+
+// CacheTTLTier is the cache TTL of responses whose data ends less than
+// MaxAge ago. A MaxAge of 0 is unbounded and only allowed on the last tier.
+type CacheTTLTier struct {
+	MaxAge time.Duration `yaml:"max_age"`
+	TTL    time.Duration `yaml:"ttl"`
+}
+
+// TTLTiers are cache TTL tiers ordered by increasing MaxAge, the last one
+// unbounded, so recent data, which may still change, expires sooner
+type TTLTiers []CacheTTLTier
+
+// defaultTTLTiers is the built-in policy: recent for data from the last
+// hour, a minute for the rest of the day and historical beyond
+func defaultTTLTiers(recent, historical time.Duration) TTLTiers {
+	return TTLTiers{
+		{MaxAge: time.Hour, TTL: recent},
+		{MaxAge: 24 * time.Hour, TTL: time.Minute},
+		{TTL: historical},
+	}
+}
+
+// TTL returns the TTL of data that ended age ago. Data ending in the future
+// counts as the most recent.
+func (t TTLTiers) TTL(age time.Duration) time.Duration {
+	for _, tier := range t {
+		if tier.MaxAge == 0 || age < tier.MaxAge {
+			return tier.TTL
+		}
+	}
+	return 0
+}
+
+// Validate checks the tiers are ordered, have positive TTLs and end with an
+// unbounded tier
+func (t TTLTiers) Validate() error {
+	if len(t) == 0 {
+		return fmt.Errorf("%w: no tiers", ErrInvalidTTLTiers)
+	}
+	for i, tier := range t {
+		last := i == len(t)-1
+		switch {
+		case tier.TTL <= 0:
+			return fmt.Errorf("%w: tier %d has TTL %s, want positive", ErrInvalidTTLTiers, i+1, tier.TTL)
+		case tier.MaxAge < 0:
+			return fmt.Errorf("%w: tier %d has negative max age %s", ErrInvalidTTLTiers, i+1, tier.MaxAge)
+		case last && tier.MaxAge != 0:
+			return fmt.Errorf("%w: last tier has max age %s, want 0 to cover all older data", ErrInvalidTTLTiers, tier.MaxAge)
+		case !last && tier.MaxAge == 0:
+			return fmt.Errorf("%w: only the last tier can be unbounded, tier %d is", ErrInvalidTTLTiers, i+1)
+		case i > 0 && !last && tier.MaxAge <= t[i-1].MaxAge:
+			return fmt.Errorf("%w: tier %d max age %s isn't above %s", ErrInvalidTTLTiers, i+1, tier.MaxAge, t[i-1].MaxAge)
+		}
+	}
+	return nil
+}
+
+// String formats the tiers as CACHE_TTL_TIERS takes them
+func (t TTLTiers) String() string {
+	parts := make([]string, len(t))
+	for i, tier := range t {
+		maxAge := "*"
+		if tier.MaxAge != 0 {
+			maxAge = tier.MaxAge.String()
+		}
+		parts[i] = maxAge + ":" + tier.TTL.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// getTTLTiers parses a comma-separated list of max_age:ttl tiers, with *
+// as the unbounded max age of the last, e.g. "1h:10s,24h:1m,*:5m". A
+// malformed list is ignored as a whole, since dropping one tier would
+// change the TTL of the ages it covered.
+func (env environment) getTTLTiers(key string, defaultValue TTLTiers) TTLTiers {
+	value := env(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var tiers TTLTiers
+	for _, part := range strings.Split(value, ",") {
+		maxAge, ttl, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			invalidEnv(key, value, fmt.Errorf("tier %q isn't max_age:ttl", part), defaultValue)
+			return defaultValue
+		}
+
+		var tier CacheTTLTier
+		var err error
+		if maxAge != "*" {
+			if tier.MaxAge, err = time.ParseDuration(maxAge); err != nil {
+				invalidEnv(key, value, err, defaultValue)
+				return defaultValue
+			}
+		}
+		if tier.TTL, err = time.ParseDuration(ttl); err != nil {
+			invalidEnv(key, value, err, defaultValue)
+			return defaultValue
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers
+}
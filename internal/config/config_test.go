@@ -0,0 +1,244 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// envOf is an environment holding vars
+func envOf(vars map[string]string) environment {
+	return func(key string) string { return vars[key] }
+}
+
+// getterCase is one value of KEY and what a getter with the case's default
+// should return for it; an empty value is unset
+type getterCase[T any] struct {
+	value string
+	want  T
+}
+
+func checkGetter[T any](t *testing.T, name string, get func(env environment) T, cases []getterCase[T]) {
+	t.Helper()
+	for _, c := range cases {
+		env := envOf(map[string]string{"KEY": c.value})
+		if got := get(env); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s with KEY=%q = %v, want %v", name, c.value, got, c.want)
+		}
+	}
+}
+
+func TestGetEnv(t *testing.T) {
+	checkGetter(t, "getEnv", func(env environment) string { return env.getEnv("KEY", "default") }, []getterCase[string]{
+		{"value", "value"},
+		{"", "default"},
+	})
+}
+
+func TestGetInt(t *testing.T) {
+	checkGetter(t, "getInt", func(env environment) int { return env.getInt("KEY", 7) }, []getterCase[int]{
+		{"42", 42},
+		{"-3", -3},
+		{"0", 0},
+		{"4.5", 7},
+		{"ten", 7},
+		{" 42", 7},
+		{"", 7},
+	})
+}
+
+func TestGetInt64(t *testing.T) {
+	checkGetter(t, "getInt64", func(env environment) int64 { return env.getInt64("KEY", 7) }, []getterCase[int64]{
+		{"9223372036854775807", 9223372036854775807},
+		{"-1", -1},
+		{"9223372036854775808", 7},
+		{"1e3", 7},
+		{"", 7},
+	})
+}
+
+func TestGetInt32(t *testing.T) {
+	checkGetter(t, "getInt32", func(env environment) int32 { return env.getInt32("KEY", 7) }, []getterCase[int32]{
+		{"2147483647", 2147483647},
+		{"-2147483648", -2147483648},
+		{"2147483648", 7}, // overflows rather than wrapping
+		{"many", 7},
+		{"", 7},
+	})
+}
+
+func TestGetFloat(t *testing.T) {
+	checkGetter(t, "getFloat", func(env environment) float64 { return env.getFloat("KEY", 0.5) }, []getterCase[float64]{
+		{"1.25", 1.25},
+		{"-2", -2},
+		{"1e-3", 0.001},
+		{"1,5", 0.5},
+		{"half", 0.5},
+		{"", 0.5},
+	})
+}
+
+func TestGetDuration(t *testing.T) {
+	checkGetter(t, "getDuration", func(env environment) time.Duration { return env.getDuration("KEY", time.Minute) }, []getterCase[time.Duration]{
+		{"30s", 30 * time.Second},
+		{"1h30m", 90 * time.Minute},
+		{"0s", 0},
+		{"30", time.Minute}, // no unit
+		{"soon", time.Minute},
+		{"", time.Minute},
+	})
+}
+
+func TestGetBool(t *testing.T) {
+	checkGetter(t, "getBool", func(env environment) bool { return env.getBool("KEY", true) }, []getterCase[bool]{
+		{"false", false},
+		{"0", false},
+		{"FALSE", false},
+		{"true", true},
+		{"no", true},
+		{"off", true},
+		{"", true},
+	})
+	checkGetter(t, "getBool", func(env environment) bool { return env.getBool("KEY", false) }, []getterCase[bool]{
+		{"1", true},
+		{"T", true},
+		{"yes", false},
+		{"", false},
+	})
+}
+
+func TestGetStringSlice(t *testing.T) {
+	checkGetter(t, "getStringSlice", func(env environment) []string { return env.getStringSlice("KEY", []string{"default"}) }, []getterCase[[]string]{
+		{"a,b", []string{"a", "b"}},
+		{" a , ,b ", []string{"a", "b"}},
+		{",", []string{}},
+		{"", []string{"default"}},
+	})
+}
+
+func TestGetByteQuotas(t *testing.T) {
+	def := map[string]int64{"default": 1}
+	checkGetter(t, "getByteQuotas", func(env environment) map[string]int64 { return env.getByteQuotas("KEY", def) }, []getterCase[map[string]int64]{
+		{"a:100,b:200", map[string]int64{"a": 100, "b": 200}},
+		// Malformed entries are skipped, not the list
+		{"a:100,b,c:x,d:-1,e:0", map[string]int64{"a": 100}},
+		{"", def},
+	})
+}
+
+func TestGetWarmTargets(t *testing.T) {
+	get := func(env environment) []CacheWarmTarget { return env.getWarmTargets("KEY", "EURUSD:1h:24h") }
+	checkGetter(t, "getWarmTargets", get, []getterCase[[]CacheWarmTarget]{
+		{"GBPUSD:1m:2h, USDJPY:1d:720h", []CacheWarmTarget{
+			{Symbol: "GBPUSD", Resolution: "1m", Window: 2 * time.Hour},
+			{Symbol: "USDJPY", Resolution: "1d", Window: 720 * time.Hour},
+		}},
+		{"GBPUSD:1m,USDJPY:1d:soon,EURGBP:1h:-1h,AUDUSD:1h:1h", []CacheWarmTarget{
+			{Symbol: "AUDUSD", Resolution: "1h", Window: time.Hour},
+		}},
+		{"", []CacheWarmTarget{{Symbol: "EURUSD", Resolution: "1h", Window: 24 * time.Hour}}},
+	})
+}
+
+func TestGetProviderChains(t *testing.T) {
+	get := func(env environment) map[string][]string { return env.getProviderChains("KEY", "default:dukascopy") }
+	checkGetter(t, "getProviderChains", get, []getterCase[map[string][]string]{
+		{"default:dukascopy|truefx, crypto: binance ", map[string][]string{
+			"default": {"dukascopy", "truefx"},
+			"crypto":  {"binance"},
+		}},
+		{"nochain,:dukascopy,forex:|oanda|", map[string][]string{"forex": {"oanda"}}},
+		{"", map[string][]string{"default": {"dukascopy"}}},
+	})
+}
+
+func TestGetProviderLimits(t *testing.T) {
+	get := func(env environment) map[string]ProviderLimits {
+		return env.getProviderLimits("KEY", "dukascopy:5:2:1m")
+	}
+	checkGetter(t, "getProviderLimits", get, []getterCase[map[string]ProviderLimits]{
+		{"dukascopy:2.5:4:30s,binance:0:0:0s", map[string]ProviderLimits{
+			"dukascopy": {RequestsPerSecond: 2.5, MaxConcurrent: 4, Cooldown: 30 * time.Second},
+			"binance":   {},
+		}},
+		{"a:1:1,b:x:1:1s,c:1:-1:1s,d:1:1:later,:1:1:1s,e:-1:1:1s,f:1:1:1s", map[string]ProviderLimits{
+			"f": {RequestsPerSecond: 1, MaxConcurrent: 1, Cooldown: time.Second},
+		}},
+		{"", map[string]ProviderLimits{"dukascopy": {RequestsPerSecond: 5, MaxConcurrent: 2, Cooldown: time.Minute}}},
+	})
+}
+
+func TestGetTTLTiers(t *testing.T) {
+	def := defaultTTLTiers(10*time.Second, 5*time.Minute)
+	checkGetter(t, "getTTLTiers", func(env environment) TTLTiers { return env.getTTLTiers("KEY", def) }, []getterCase[TTLTiers]{
+		{"1h:10s, 24h:1m, *:5m", TTLTiers{
+			{MaxAge: time.Hour, TTL: 10 * time.Second},
+			{MaxAge: 24 * time.Hour, TTL: time.Minute},
+			{TTL: 5 * time.Minute},
+		}},
+		// A malformed tier discards the whole list
+		{"1h:10s,24h,*:5m", def},
+		{"1h:10s,day:1m,*:5m", def},
+		{"1h:10s,*:forever", def},
+		{"", def},
+	})
+}
+
+func TestGetRouteLimits(t *testing.T) {
+	def := defaultRouteLimits()
+	checkGetter(t, "getRouteLimits", func(env environment) []RouteLimits { return env.getRouteLimits("KEY", def) }, []getterCase[[]RouteLimits]{
+		{"/api/v1/health:2s:0:0, /api/v1/data/ensure:0s:4096:8", []RouteLimits{
+			{Prefix: "/api/v1/health", Timeout: 2 * time.Second},
+			{Prefix: "/api/v1/data/ensure", MaxBodyBytes: 4096, MaxConcurrent: 8},
+		}},
+		{"/api/v1/health:2s:0", def},
+		{"/api/v1/health:fast:0:0", def},
+		{"/api/v1/health:2s:big:0", def},
+		{"/api/v1/health:2s:0:many", def},
+		{"", def},
+	})
+}
+
+func TestOHLCRefreshConfig(t *testing.T) {
+	tests := []struct {
+		vars  map[string]string
+		valid bool
+	}{
+		// Off unless asked for, whatever the interval
+		{map[string]string{}, true},
+		{map[string]string{"OHLC_REFRESH_INTERVAL": "0s"}, true},
+		{map[string]string{"OHLC_REFRESH_ENABLED": "true"}, true},
+		{map[string]string{"OHLC_REFRESH_ENABLED": "true", "OHLC_REFRESH_INTERVAL": "1m"}, true},
+		{map[string]string{"OHLC_REFRESH_ENABLED": "true", "OHLC_REFRESH_INTERVAL": "0s"}, false},
+		{map[string]string{"OHLC_REFRESH_ENABLED": "true", "OHLC_REFRESH_INTERVAL": "-30s"}, false},
+	}
+	for _, tt := range tests {
+		cfg, err := buildConfig(ProfileDevelopment, defaultConfig(ProfileDevelopment), envOf(tt.vars), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.OHLCRefresh.Enabled != (tt.vars["OHLC_REFRESH_ENABLED"] == "true") {
+			t.Errorf("%v: enabled = %v", tt.vars, cfg.OHLCRefresh.Enabled)
+		}
+		err = cfg.OHLCRefresh.validate()
+		if tt.valid && err != nil {
+			t.Errorf("%v: %v", tt.vars, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidRefreshInterval) {
+			t.Errorf("%v: err = %v, want ErrInvalidRefreshInterval", tt.vars, err)
+		}
+	}
+}
+
+func TestCacheJitterAndStaleGraceOffByDefault(t *testing.T) {
+	for _, profile := range []Profile{ProfileDevelopment, ProfileStaging, ProfileProduction} {
+		cfg, err := buildConfig(profile, defaultConfig(profile), envOf(nil), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Cache.TTLJitter != 0 || cfg.Cache.StaleGrace != 0 {
+			t.Errorf("%s: TTL jitter %g, stale grace %s, want both off", profile, cfg.Cache.TTLJitter, cfg.Cache.StaleGrace)
+		}
+	}
+}
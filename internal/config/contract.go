@@ -0,0 +1,84 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// ErrInvalidContract is returned for data contract files that can't be used
+var ErrInvalidContract = errors.New("invalid data contract")
+
+// LoadContract reads a data contract file: the JSON form of
+// models.DataContract, as the profiler writes it
+func LoadContract(path string) (*models.DataContract, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data contract: %w", err)
+	}
+
+	var contract models.DataContract
+	if err := json.Unmarshal(data, &contract); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidContract, path, err)
+	}
+	if len(contract.Resolutions) == 0 {
+		return nil, fmt.Errorf("%w: %s has no resolutions", ErrInvalidContract, path)
+	}
+	for name, resolution := range contract.Resolutions {
+		switch {
+		case resolution.Resolution != "" && resolution.Resolution != name:
+			return nil, fmt.Errorf("%w: resolution %s is keyed %s", ErrInvalidContract, resolution.Resolution, name)
+		case resolution.Table == "":
+			return nil, fmt.Errorf("%w: resolution %s has no table", ErrInvalidContract, name)
+		case resolution.MaxPoints <= 0 || resolution.MaxRangeMs <= 0:
+			return nil, fmt.Errorf("%w: resolution %s needs a positive max range and points", ErrInvalidContract, name)
+		case resolution.MinRangeMs < 0 || resolution.MinRangeMs > resolution.MaxRangeMs:
+			return nil, fmt.Errorf("%w: resolution %s has a min range outside [0, max range]", ErrInvalidContract, name)
+		}
+		resolution.Resolution = name
+		contract.Resolutions[name] = resolution
+	}
+	return &contract, nil
+}
+
+// WriteContract writes contract to path as indented JSON, replacing any
+// existing file in one step so the API never reads half a contract
+func WriteContract(path string, contract *models.DataContract) error {
+	data, err := json.MarshalIndent(contract, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode data contract: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create data contract directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write data contract: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace data contract: %w", err)
+	}
+	return nil
+}
+
+// ContractResolutions returns the resolution settings a contract describes
+func ContractResolutions(contract *models.DataContract) map[string]ResolutionConfig {
+	resolutions := make(map[string]ResolutionConfig, len(contract.Resolutions))
+	for name, resolution := range contract.Resolutions {
+		resolutions[name] = ResolutionConfig{
+			Table:       resolution.Table,
+			MinRange:    time.Duration(resolution.MinRangeMs) * time.Millisecond,
+			MaxRange:    time.Duration(resolution.MaxRangeMs) * time.Millisecond,
+			MaxPoints:   resolution.MaxPoints,
+			Description: resolution.Description,
+		}
+	}
+	return resolutions
+}
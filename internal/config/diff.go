@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Change is one setting that differs between two configurations. Setting is
+// the dotted field path, such as Data.Resolutions.1m.MaxPoints; secrets are
+// shown redacted.
+type Change struct {
+	Setting string `json:"setting"`
+	Old     string `json:"old"`
+	New     string `json:"new"`
+}
+
+// Diff returns the settings that differ between old and new, ordered by
+// setting
+func Diff(old, new *Config) []Change {
+	d := differ{}
+	d.walk("",
+		reflect.ValueOf(*old), reflect.ValueOf(*new),
+		reflect.ValueOf(old.Redacted()), reflect.ValueOf(new.Redacted()))
+	sort.Slice(d.changes, func(i, j int) bool {
+		return d.changes[i].Setting < d.changes[j].Setting
+	})
+	return d.changes
+}
+
+// differ walks two configurations and their redacted copies side by side,
+// comparing the raw values and reporting the redacted ones
+type differ struct {
+	changes []Change
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (d *differ) walk(path string, a, b, ra, rb reflect.Value) {
+	switch {
+	case a.Kind() == reflect.Struct && a.Type() != timeType:
+		for i := 0; i < a.NumField(); i++ {
+			if !a.Type().Field(i).IsExported() {
+				continue
+			}
+			d.walk(join(path, a.Type().Field(i).Name), a.Field(i), b.Field(i), ra.Field(i), rb.Field(i))
+		}
+	case a.Kind() == reflect.Pointer && a.Type().Elem().Kind() == reflect.Struct && !a.IsNil() && !b.IsNil():
+		d.walk(path, a.Elem(), b.Elem(), ra.Elem(), rb.Elem())
+	case a.Kind() == reflect.Map:
+		for _, key := range mapKeys(a, b) {
+			name := join(path, fmt.Sprint(key.Interface()))
+			av, bv := a.MapIndex(key), b.MapIndex(key)
+			switch {
+			case av.IsValid() && bv.IsValid():
+				d.walk(name, av, bv, ra.MapIndex(key), rb.MapIndex(key))
+			case av.IsValid():
+				d.add(name, display(ra.MapIndex(key)), "none")
+			default:
+				d.add(name, "none", display(rb.MapIndex(key)))
+			}
+		}
+	case !reflect.DeepEqual(a.Interface(), b.Interface()):
+		d.add(path, display(ra), display(rb))
+	}
+}
+
+func (d *differ) add(setting, old, new string) {
+	d.changes = append(d.changes, Change{Setting: setting, Old: old, New: new})
+}
+
+// mapKeys returns the keys of either map, sorted by their printed form
+func mapKeys(a, b reflect.Value) []reflect.Value {
+	seen := make(map[interface{}]bool)
+	var keys []reflect.Value
+	for _, m := range []reflect.Value{a, b} {
+		for _, key := range m.MapKeys() {
+			if !seen[key.Interface()] {
+				seen[key.Interface()] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	return keys
+}
+
+// display formats a setting's value for a Change
+func display(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "none"
+		}
+		return "set"
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%+v", v.Interface())
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// Setting is one configuration value, named by its dotted field path as in
+// Change, and where it came from
+type Setting struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source Source `json:"source,omitempty"`
+}
+
+// Settings lists every setting of cfg, secrets redacted, ordered by name
+func Settings(cfg *Config) []Setting {
+	settings := flatten(reflect.ValueOf(cfg.Redacted()))
+	for i := range settings {
+		settings[i].Source = cfg.Source(settings[i].Name)
+	}
+	return settings
+}
+
+// flatten lists the settings in v, a Config, ordered by name
+func flatten(v reflect.Value) []Setting {
+	var settings []Setting
+	var walk func(path string, v reflect.Value)
+	walk = func(path string, v reflect.Value) {
+		switch {
+		case v.Kind() == reflect.Struct && v.Type() != timeType:
+			for i := 0; i < v.NumField(); i++ {
+				if v.Type().Field(i).IsExported() {
+					walk(join(path, v.Type().Field(i).Name), v.Field(i))
+				}
+			}
+		case v.Kind() == reflect.Pointer && v.Type().Elem().Kind() == reflect.Struct && !v.IsNil():
+			walk(path, v.Elem())
+		case v.Kind() == reflect.Map:
+			for _, key := range mapKeys(v, v) {
+				walk(join(path, fmt.Sprint(key.Interface())), v.MapIndex(key))
+			}
+		default:
+			settings = append(settings, Setting{Name: path, Value: display(v)})
+		}
+	}
+	walk("", v)
+
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Name < settings[j].Name
+	})
+	return settings
+}
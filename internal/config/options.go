@@ -0,0 +1,25 @@
+package config
+
+// Option changes how Load builds the configuration, for settings given on
+// the command line, which take precedence over every other source
+type Option func(*loadOptions)
+
+type loadOptions struct {
+	profile   string          // overrides SPTRADER_ENV when set
+	overrides []func(*Config) // applied in order after the environment
+}
+
+// WithProfile selects the profile instead of SPTRADER_ENV
+func WithProfile(name string) Option {
+	return func(o *loadOptions) {
+		o.profile = name
+	}
+}
+
+// WithOverride has Load call fn on the configuration once the defaults,
+// file and environment are applied, before it is validated
+func WithOverride(fn func(*Config)) Option {
+	return func(o *loadOptions) {
+		o.overrides = append(o.overrides, fn)
+	}
+}
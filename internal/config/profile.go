@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Profile names the environment the server runs in, which picks the
+// defaults of its logging, CORS, debug endpoint and admin auth settings.
+// Each setting can still be set explicitly.
+type Profile string
+
+// Profiles
+const (
+	ProfileDevelopment Profile = "development"
+	ProfileStaging     Profile = "staging"
+	ProfileProduction  Profile = "production"
+)
+
+// ErrUnknownProfile is returned for a SPTRADER_ENV that names no profile
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// ErrAdminTokenRequired is returned when admin auth is mandatory but no
+// admin token is configured
+var ErrAdminTokenRequired = errors.New("admin auth required but no admin token set")
+
+// ParseProfile returns the profile called name; empty is development
+func ParseProfile(name string) (Profile, error) {
+	switch profile := Profile(name); profile {
+	case "":
+		return ProfileDevelopment, nil
+	case ProfileDevelopment, ProfileStaging, ProfileProduction:
+		return profile, nil
+	default:
+		return "", fmt.Errorf("%w: %q, want development, staging or production", ErrUnknownProfile, name)
+	}
+}
+
+// applyDefaults sets the profile's defaults on server. Development logs
+// everything readably, allows any origin and serves pprof without auth;
+// staging and production log JSON, allow no cross-origin requests and
+// require an admin token. Staging keeps pprof, behind the token.
+func (p Profile) applyDefaults(server *ServerConfig) {
+	switch p {
+	case ProfileStaging, ProfileProduction:
+		server.Mode = "production"
+		server.LogLevel = "info"
+		server.LogFormat = "json"
+		server.CORSOrigins = nil
+		server.Pprof = p == ProfileStaging
+		server.AuthRequired = true
+	default:
+		server.Mode = "debug"
+		server.LogLevel = "debug"
+		server.LogFormat = "console"
+		server.CORSOrigins = []string{"*"}
+		server.Pprof = true
+		server.AuthRequired = false
+	}
+}
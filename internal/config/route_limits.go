@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRouteLimits is returned for per-route server limits that can't
+// be applied as written
+var ErrInvalidRouteLimits = errors.New("invalid route limits")
+
+// RouteLimits override the server limits for the requests whose path starts
+// with Prefix; the longest matching prefix applies. Zero leaves a limit as
+// the server has it.
+type RouteLimits struct {
+	Prefix        string        `yaml:"prefix"`
+	Timeout       time.Duration `yaml:"timeout"`        // request deadline, which may exceed the server write timeout
+	MaxBodyBytes  int64         `yaml:"max_body_bytes"` // larger request bodies are refused with 413
+	MaxConcurrent int           `yaml:"max_concurrent"` // requests past this are refused with 503
+}
+
+// defaultRouteLimits keeps probes quick and fetch requests small
+func defaultRouteLimits() []RouteLimits {
+	return []RouteLimits{
+		{Prefix: "/api/v1/health", Timeout: 2 * time.Second},
+		{Prefix: "/api/v1/ready", Timeout: 5 * time.Second},
+		{Prefix: "/api/v1/data/ensure", MaxBodyBytes: 8 << 10},
+	}
+}
+
+// validateLimits checks the server timeouts aren't negative and every route
+// names an absolute path once and sets at least one limit, none negative
+func (s ServerConfig) validateLimits() error {
+	if s.ReadTimeout < 0 || s.WriteTimeout < 0 {
+		return fmt.Errorf("%w: server timeouts can't be negative", ErrInvalidRouteLimits)
+	}
+
+	seen := make(map[string]bool, len(s.Routes))
+	for _, route := range s.Routes {
+		switch {
+		case !strings.HasPrefix(route.Prefix, "/"):
+			return fmt.Errorf("%w: prefix %q must start with /", ErrInvalidRouteLimits, route.Prefix)
+		case seen[route.Prefix]:
+			return fmt.Errorf("%w: %s is limited twice", ErrInvalidRouteLimits, route.Prefix)
+		case route.Timeout < 0:
+			return fmt.Errorf("%w: %s has negative timeout %s", ErrInvalidRouteLimits, route.Prefix, route.Timeout)
+		case route.MaxBodyBytes < 0:
+			return fmt.Errorf("%w: %s has negative max body bytes %d", ErrInvalidRouteLimits, route.Prefix, route.MaxBodyBytes)
+		case route.MaxConcurrent < 0:
+			return fmt.Errorf("%w: %s has negative max concurrent %d", ErrInvalidRouteLimits, route.Prefix, route.MaxConcurrent)
+		case route.Timeout == 0 && route.MaxBodyBytes == 0 && route.MaxConcurrent == 0:
+			return fmt.Errorf("%w: %s sets no limits", ErrInvalidRouteLimits, route.Prefix)
+		}
+		seen[route.Prefix] = true
+	}
+	return nil
+}
+
+// getRouteLimits parses a comma-separated list of
+// prefix:timeout:max_body_bytes:max_concurrent routes, e.g.
+// "/api/v1/health:2s:0:0". Like the cache tiers, a malformed list is ignored
+// as a whole.
+func (env environment) getRouteLimits(key string, defaultValue []RouteLimits) []RouteLimits {
+	value := env(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var routes []RouteLimits
+	for _, part := range strings.Split(value, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) != 4 {
+			invalidEnv(key, value, fmt.Errorf("route %q isn't prefix:timeout:max_body_bytes:max_concurrent", part), defaultValue)
+			return defaultValue
+		}
+
+		route := RouteLimits{Prefix: fields[0]}
+		var err error
+		if route.Timeout, err = time.ParseDuration(fields[1]); err != nil {
+			invalidEnv(key, value, err, defaultValue)
+			return defaultValue
+		}
+		if route.MaxBodyBytes, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+			invalidEnv(key, value, err, defaultValue)
+			return defaultValue
+		}
+		if route.MaxConcurrent, err = strconv.Atoi(fields[3]); err != nil {
+			invalidEnv(key, value, err, defaultValue)
+			return defaultValue
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
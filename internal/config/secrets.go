@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// secretReader reads settings that may be mounted as files, keeping the
+// first failure so a run of reads can be checked once
+type secretReader struct {
+	env environment
+	err error
+}
+
+// get returns the contents of the file named by key_FILE, without trailing
+// newlines, or else the value of key. The file takes precedence so a
+// secret never has to be in the environment.
+func (s *secretReader) get(key, defaultValue string) string {
+	path := s.env(key + "_FILE")
+	if path == "" {
+		return s.env.getEnv(key, defaultValue)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if s.err == nil {
+			s.err = fmt.Errorf("failed to read %s_FILE: %w", key, err)
+		}
+		return ""
+	}
+	return strings.TrimRight(string(data), "\r\n")
+}
+
+// databaseURL returns the shared database URL: DATABASE_URL or
+// DATABASE_URL_FILE, else defaultValue, with any of DB_USER, DB_PASSWORD
+// (or DB_PASSWORD_FILE), DB_HOST, DB_PORT and DB_NAME replacing that part
+// of it. Components are escaped as the URL needs.
+func (s *secretReader) databaseURL(defaultValue string) string {
+	raw := s.get("DATABASE_URL", defaultValue)
+	user := s.env("DB_USER")
+	password := s.get("DB_PASSWORD", "")
+	host := s.env("DB_HOST")
+	port := s.env("DB_PORT")
+	name := s.env("DB_NAME")
+	if user == "" && password == "" && host == "" && port == "" && name == "" {
+		return raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		// url.Parse quotes the URL in its error, so it isn't wrapped
+		if s.err == nil {
+			s.err = fmt.Errorf("failed to parse database URL %s to apply DB_ settings", redactURL(raw))
+		}
+		return raw
+	}
+
+	if user != "" || password != "" {
+		if user == "" {
+			user = u.User.Username()
+		}
+		if password == "" {
+			password, _ = u.User.Password()
+		}
+		u.User = url.UserPassword(user, password)
+	}
+	if host != "" || port != "" {
+		if host == "" {
+			host = u.Hostname()
+		}
+		if port == "" {
+			port = u.Port()
+		}
+		u.Host = host
+		if port != "" {
+			u.Host = net.JoinHostPort(host, port)
+		}
+	}
+	if name != "" {
+		u.Path = "/" + name
+		u.RawPath = ""
+	}
+	return u.String()
+}
+
+// ScrubURL replaces rawURL, and the password in it, wherever they appear in
+// message with their redacted forms. Connection errors may quote the URL
+// they failed on.
+func ScrubURL(message, rawURL string) string {
+	if rawURL == "" {
+		return message
+	}
+	message = strings.ReplaceAll(message, rawURL, redactURL(rawURL))
+	if u, err := url.Parse(rawURL); err == nil {
+		if password, ok := u.User.Password(); ok && password != "" {
+			message = strings.ReplaceAll(message, password, redacted)
+		}
+	}
+	return message
+}
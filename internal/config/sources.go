@@ -0,0 +1,60 @@
+package config
+
+import "reflect"
+
+// Source is where a setting's value came from
+type Source string
+
+// Sources, from lowest to highest precedence
+const (
+	SourceDefault  Source = "default"
+	SourceFile     Source = "file"
+	SourceContract Source = "contract"
+	SourceEnv      Source = "env"
+	SourceFlag     Source = "flag"
+)
+
+// Source returns where the setting named as in Settings came from
+func (c *Config) Source(setting string) Source {
+	if source, ok := c.sources[setting]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// CopySources takes the sources of the changed settings from other, the
+// configuration their new values came from
+func (c *Config) CopySources(other *Config, changes []Change) {
+	sources := make(map[string]Source, len(c.sources))
+	for setting, source := range c.sources {
+		sources[setting] = source
+	}
+	for _, change := range changes {
+		sources[change.Setting] = other.Source(change.Setting)
+	}
+	c.sources = sources
+}
+
+// sourceTracker attributes each setting to the last layer of the
+// configuration that changed its value
+type sourceTracker struct {
+	values  map[string]string
+	sources map[string]Source
+}
+
+// record compares cfg, built with one more layer applied, with the last
+// one recorded
+func (t *sourceTracker) record(source Source, cfg *Config) {
+	values := make(map[string]string)
+	sources := make(map[string]Source)
+	for _, setting := range flatten(reflect.ValueOf(*cfg)) {
+		values[setting.Name] = setting.Value
+		if previous, ok := t.values[setting.Name]; ok && previous == setting.Value {
+			sources[setting.Name] = t.sources[setting.Name]
+		} else {
+			sources[setting.Name] = source
+		}
+	}
+	t.values = values
+	t.sources = sources
+}
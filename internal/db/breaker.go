@@ -0,0 +1,256 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrDatabaseUnavailable is returned without touching the database while the
+// circuit breaker is open
+var ErrDatabaseUnavailable = errors.New("database unavailable")
+
+// UnavailableError is a query failed fast by the open circuit breaker
+type UnavailableError struct {
+	RetryAfter time.Duration // until the breaker next lets a probe through
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%v, retry in %s", ErrDatabaseUnavailable, e.RetryAfter.Round(time.Second))
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return ErrDatabaseUnavailable
+}
+
+// Breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// BreakerStatus reports a circuit breaker's settings and current state
+type BreakerStatus struct {
+	Enabled             bool       `json:"enabled"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	FailureThreshold    int        `json:"failure_threshold"`
+	Cooldown            string     `json:"cooldown"`
+	OpenUntil           *time.Time `json:"open_until,omitempty"`
+	Opens               int64      `json:"opens"`    // closed or half-open to open since startup
+	Closes              int64      `json:"closes"`   // half-open to closed since startup
+	Rejected            int64      `json:"rejected"` // queries failed fast since startup
+}
+
+// breaker stops sending queries to a database that keeps failing to connect.
+// After threshold consecutive connection failures it opens for cooldown,
+// failing queries fast; then it lets up to probes queries through, closing
+// on the first success and reopening on the first failure.
+type breaker struct {
+	threshold int // 0 disables the breaker
+	cooldown  time.Duration
+	probes    int
+	readOnly  bool
+	now       func() time.Time // replaceable in tests
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openUntil time.Time
+	inFlight  int // half-open probes running
+	opens     int64
+	closes    int64
+	rejected  int64
+}
+
+func newBreaker(threshold int, cooldown time.Duration, probes int, readOnly bool) *breaker {
+	if probes < 1 {
+		probes = 1
+	}
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		probes:    probes,
+		readOnly:  readOnly,
+		now:       time.Now,
+		state:     BreakerClosed,
+	}
+}
+
+// allow reports whether a query may run. A query that is allowed must be
+// followed by exactly one done call with its connection outcome.
+func (b *breaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if b.state == BreakerOpen {
+		if now.Before(b.openUntil) {
+			b.rejected++
+			return &UnavailableError{RetryAfter: b.openUntil.Sub(now)}
+		}
+		b.transition(BreakerHalfOpen, nil)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.inFlight >= b.probes {
+			b.rejected++
+			return &UnavailableError{RetryAfter: b.cooldown}
+		}
+		b.inFlight++
+	}
+	return nil
+}
+
+// done records the outcome of an allowed query. Only connection failures
+// count against the database; a query the server rejected still proves it
+// is up.
+func (b *breaker) done(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := isConnectionError(err)
+	switch b.state {
+	case BreakerHalfOpen:
+		if b.inFlight > 0 {
+			b.inFlight--
+		}
+		switch {
+		case failed:
+			b.open(err)
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			// The caller gave up; the probe proved nothing
+		default:
+			b.failures = 0
+			b.transition(BreakerClosed, nil)
+		}
+	case BreakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open(err)
+		}
+	}
+}
+
+// fail records a connection failure seen after the query was allowed, such
+// as the connection dropping mid-query
+func (b *breaker) fail(err error) {
+	if b.threshold <= 0 || !isConnectionError(err) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != BreakerClosed {
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.open(err)
+	}
+}
+
+// open starts a cool-down; b.mu must be held
+func (b *breaker) open(err error) {
+	b.openUntil = b.now().Add(b.cooldown)
+	b.opens++
+	b.transition(BreakerOpen, err)
+}
+
+// transition moves to state and logs the change; b.mu must be held
+func (b *breaker) transition(state string, err error) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+
+	switch state {
+	case BreakerOpen:
+		log.Error().
+			Err(err).
+			Str("from", from).
+			Int("consecutive_failures", b.failures).
+			Dur("cooldown", b.cooldown).
+			Bool("read_only", b.readOnly).
+			Msg("Database circuit breaker opened, failing queries fast")
+	case BreakerHalfOpen:
+		log.Warn().
+			Bool("read_only", b.readOnly).
+			Msg("Database circuit breaker half-open, probing recovery")
+	case BreakerClosed:
+		b.closes++
+		log.Info().
+			Str("from", from).
+			Bool("read_only", b.readOnly).
+			Msg("Database circuit breaker closed, database recovered")
+	}
+}
+
+// status returns the breaker's settings and current state
+func (b *breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		Enabled:             b.threshold > 0,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		FailureThreshold:    b.threshold,
+		Cooldown:            b.cooldown.String(),
+		Opens:               b.opens,
+		Closes:              b.closes,
+		Rejected:            b.rejected,
+	}
+	if b.state == BreakerOpen {
+		until := b.openUntil
+		status.OpenUntil = &until
+	}
+	return status
+}
+
+// IsUnavailable reports whether err means the database couldn't be used at
+// all: the circuit breaker failed the query fast, or the database couldn't
+// be reached
+func IsUnavailable(err error) bool {
+	return errors.Is(err, ErrDatabaseUnavailable) || isConnectionError(err)
+}
+
+// isConnectionError reports whether err means the database couldn't be
+// reached, as opposed to the server rejecting a query or the caller giving up
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// Dial failures unwrap to net errors; a PgError means the server answered
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return false
+	}
+	if isStaleConnection(err) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
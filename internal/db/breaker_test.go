@@ -0,0 +1,164 @@
+package db
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeClock is a breaker clock moved by hand
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// fakeDialer connects the way acquire does, through the breaker, failing
+// with err while it's set
+type fakeDialer struct {
+	err   error
+	dials int
+}
+
+func (d *fakeDialer) connect(b *breaker) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	d.dials++
+	b.done(d.err)
+	return d.err
+}
+
+var errRefused = &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+func newTestBreaker(threshold int, cooldown time.Duration, probes int) (*breaker, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)}
+	b := newBreaker(threshold, cooldown, probes, true)
+	b.now = clock.now
+	return b, clock
+}
+
+// checkRejected asserts the connection failed fast, retrying after retryAfter
+func checkRejected(t *testing.T, step string, err error, retryAfter time.Duration) {
+	t.Helper()
+	var unavailable *UnavailableError
+	if !errors.Is(err, ErrDatabaseUnavailable) || !errors.As(err, &unavailable) {
+		t.Fatalf("%s: err = %v, want ErrDatabaseUnavailable", step, err)
+	}
+	if unavailable.RetryAfter != retryAfter {
+		t.Errorf("%s: retry after %s, want %s", step, unavailable.RetryAfter, retryAfter)
+	}
+}
+
+func TestBreakerCycle(t *testing.T) {
+	b, clock := newTestBreaker(3, 30*time.Second, 1)
+	dialer := &fakeDialer{err: errRefused}
+
+	// Closed: failures below the threshold still reach the database
+	for i := 0; i < 2; i++ {
+		if err := dialer.connect(b); !errors.Is(err, syscall.ECONNREFUSED) {
+			t.Fatalf("failure %d: err = %v, want the dial error", i+1, err)
+		}
+	}
+	if status := b.status(); status.State != BreakerClosed || status.ConsecutiveFailures != 2 {
+		t.Fatalf("after 2 failures: %s with %d failures, want closed with 2", status.State, status.ConsecutiveFailures)
+	}
+
+	// The threshold'th failure opens it
+	dialer.connect(b)
+	if status := b.status(); status.State != BreakerOpen || status.Opens != 1 {
+		t.Fatalf("after 3 failures: %s with %d opens, want open once", status.State, status.Opens)
+	}
+
+	// Open: queries fail fast without dialing, until the cool-down ends
+	checkRejected(t, "open", dialer.connect(b), 30*time.Second)
+	clock.advance(20 * time.Second)
+	checkRejected(t, "open 20s later", dialer.connect(b), 10*time.Second)
+	if dialer.dials != 3 {
+		t.Errorf("%d dials, want none while open", dialer.dials)
+	}
+
+	// Half-open: a probe that fails reopens it for another cool-down
+	clock.advance(10 * time.Second)
+	if err := dialer.connect(b); !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Fatalf("failed probe: err = %v, want the dial error", err)
+	}
+	if status := b.status(); status.State != BreakerOpen || status.Opens != 2 || dialer.dials != 4 {
+		t.Fatalf("after a failed probe: %s with %d opens and %d dials, want open twice after 4", status.State, status.Opens, dialer.dials)
+	}
+	checkRejected(t, "reopened", dialer.connect(b), 30*time.Second)
+
+	// Half-open: no more queries than probes go through at once
+	clock.advance(30 * time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if status := b.status(); status.State != BreakerHalfOpen {
+		t.Fatalf("probing: %s, want half_open", status.State)
+	}
+	checkRejected(t, "second query while probing", b.allow(), 30*time.Second)
+
+	// A successful probe closes it
+	dialer.err = nil
+	b.done(nil)
+	if status := b.status(); status.State != BreakerClosed || status.Closes != 1 || status.ConsecutiveFailures != 0 {
+		t.Fatalf("after the probe succeeded: %s with %d closes and %d failures, want closed once with none", status.State, status.Closes, status.ConsecutiveFailures)
+	}
+	for i := 0; i < 5; i++ {
+		if err := dialer.connect(b); err != nil {
+			t.Fatalf("closed again: %v", err)
+		}
+	}
+	if status := b.status(); status.Rejected != 4 {
+		t.Errorf("%d queries rejected, want 4", status.Rejected)
+	}
+}
+
+func TestBreakerCountsOnlyConnectionFailures(t *testing.T) {
+	b, _ := newTestBreaker(2, time.Minute, 1)
+
+	// The server answering, even with an error, proves it is up
+	dialer := &fakeDialer{err: &pgconn.PgError{Code: "42P01", Message: "table does not exist"}}
+	for i := 0; i < 5; i++ {
+		dialer.connect(b)
+	}
+	if status := b.status(); status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Fatalf("after server errors: %s with %d failures, want closed with none", status.State, status.ConsecutiveFailures)
+	}
+
+	// A success in between resets the count
+	dialer.err = errRefused
+	dialer.connect(b)
+	dialer.err = nil
+	dialer.connect(b)
+	dialer.err = errRefused
+	dialer.connect(b)
+	if status := b.status(); status.State != BreakerClosed {
+		t.Fatalf("after interrupted failures: %s, want closed", status.State)
+	}
+
+	// A connection dropped mid-query counts too
+	b.fail(errRefused)
+	if status := b.status(); status.State != BreakerOpen {
+		t.Errorf("after a dropped connection: %s, want open", status.State)
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b, _ := newTestBreaker(0, time.Minute, 1)
+	dialer := &fakeDialer{err: errRefused}
+	for i := 0; i < 10; i++ {
+		if err := dialer.connect(b); errors.Is(err, ErrDatabaseUnavailable) {
+			t.Fatalf("disabled breaker failed query %d fast", i+1)
+		}
+	}
+	if dialer.dials != 10 {
+		t.Errorf("%d dials, want every query to dial", dialer.dials)
+	}
+}
@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog/log"
+)
+
+// HealthStatus reports the pool's background health checks
+type HealthStatus struct {
+	Healthy     bool       `json:"healthy"`
+	LastCheck   *time.Time `json:"last_check,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	Reconnects  int64      `json:"reconnects"`   // pool resets since startup
+	StaleErrors int64      `json:"stale_errors"` // queries retried after a stale connection
+}
+
+// poolHealth tracks the health loop's results
+type poolHealth struct {
+	mu          sync.Mutex
+	healthy     bool
+	lastCheck   time.Time
+	lastError   error
+	reconnects  int64
+	staleErrors int64
+}
+
+// healthLoop pings the database every period until the pool is closed. A
+// failed ping resets the pool so stale connections left behind by a
+// database restart are dropped and the next acquire dials fresh.
+func (p *Pool) healthLoop(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := p.Pool.Ping(ctx)
+		cancel()
+
+		p.health.mu.Lock()
+		wasHealthy := p.health.healthy
+		p.health.healthy = err == nil
+		p.health.lastCheck = time.Now()
+		p.health.lastError = err
+		p.health.mu.Unlock()
+
+		if err == nil {
+			if !wasHealthy {
+				log.Info().Bool("read_only", p.readOnly).Msg("Database reachable again")
+			}
+			continue
+		}
+
+		if wasHealthy {
+			log.Warn().
+				Err(err).
+				Bool("read_only", p.readOnly).
+				Msg("Database health check failed, recycling pool connections")
+		}
+		p.reset()
+	}
+}
+
+// Reconnect drops every pooled connection and checks that a fresh one can
+// be dialed. Connections in use are closed when they are released.
+func (p *Pool) Reconnect(ctx context.Context) error {
+	p.reset()
+	log.Info().Bool("read_only", p.readOnly).Msg("Database pool reconnecting")
+
+	err := p.Pool.Ping(ctx)
+	p.health.mu.Lock()
+	p.health.healthy = err == nil
+	p.health.lastCheck = time.Now()
+	p.health.lastError = err
+	p.health.mu.Unlock()
+	return err
+}
+
+// reset closes the pool's connections so the next acquire dials fresh
+func (p *Pool) reset() {
+	p.Pool.Reset()
+
+	p.health.mu.Lock()
+	p.health.reconnects++
+	p.health.mu.Unlock()
+}
+
+// Close stops the health loop and closes the pool
+func (p *Pool) Close() {
+	p.closeOnce.Do(func() { close(p.stop) })
+	p.Pool.Close()
+}
+
+// healthStatus returns the health loop's latest results
+func (p *Pool) healthStatus() HealthStatus {
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+
+	status := HealthStatus{
+		Healthy:     p.health.healthy,
+		Reconnects:  p.health.reconnects,
+		StaleErrors: p.health.staleErrors,
+	}
+	if !p.health.lastCheck.IsZero() {
+		lastCheck := p.health.lastCheck
+		status.LastCheck = &lastCheck
+	}
+	if p.health.lastError != nil {
+		status.LastError = p.health.lastError.Error()
+	}
+	return status
+}
+
+// retryable reports whether a statement that failed with err should be
+// retried once on a fresh connection: the connection it ran on had gone
+// stale, the caller is still waiting, and rerunning can't apply a write
+// twice
+func (p *Pool) retryable(ctx context.Context, sql string, err error) bool {
+	if !isStaleConnection(err) || ctx.Err() != nil {
+		return false
+	}
+	if !IsReadStatement(sql) && !pgconn.SafeToRetry(err) {
+		return false
+	}
+
+	p.health.mu.Lock()
+	p.health.staleErrors++
+	p.health.mu.Unlock()
+
+	log.Warn().
+		Err(err).
+		Str("sql", truncateSQL(sql)).
+		Bool("read_only", p.readOnly).
+		Msg("Stale database connection, retrying on a fresh one")
+	return true
+}
+
+// isStaleConnection reports whether err means the connection was cut under
+// the query, as happens to pooled connections when the database restarts
+func isStaleConnection(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// HealthComponent is the result of one part of a deep health check
+type HealthComponent struct {
+	Name      string     `json:"name"` // "database", "table:<name>" or "freshness:<table>"
+	Healthy   bool       `json:"healthy"`
+	LatencyMs float64    `json:"latency_ms"`
+	Error     string     `json:"error,omitempty"`
+	Newest    *time.Time `json:"newest,omitempty"` // newest timestamp, for freshness checks
+}
+
+// HealthReport is the result of a deep health check
+type HealthReport struct {
+	Healthy    bool              `json:"healthy"`
+	CheckedAt  time.Time         `json:"checked_at"`
+	Components []HealthComponent `json:"components"`
+	Failing    []string          `json:"failing,omitempty"` // names of the failing components
+}
+
+// Add records a component's result in the report
+func (r *HealthReport) Add(component HealthComponent) {
+	r.Components = append(r.Components, component)
+	if !component.Healthy {
+		r.Healthy = false
+		r.Failing = append(r.Failing, component.Name)
+	}
+}
+
+// DeepHealthCheck checks that the database answers, that each configured
+// health table answers a cheap query and, when a freshness window is set,
+// that the newest timestamp in the freshness table falls inside it. Every
+// check runs even after one fails, so the report names each failing part.
+func (p *Pool) DeepHealthCheck(ctx context.Context) HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	report := HealthReport{Healthy: true, CheckedAt: time.Now()}
+
+	start := time.Now()
+	err := p.HealthCheck(ctx)
+	report.Add(healthComponent("database", start, err))
+	if err != nil {
+		return report
+	}
+
+	for _, table := range p.config.HealthTables {
+		start := time.Now()
+		err := p.checkTable(WithQueryLabel(ctx, QueryHealth, table), table)
+		report.Add(healthComponent("table:"+table, start, err))
+	}
+
+	if p.config.HealthFreshness > 0 {
+		report.Add(p.checkFreshness(ctx, p.config.HealthFreshnessTable, p.config.HealthFreshness))
+	}
+	return report
+}
+
+// checkTable runs a query against table that reads at most one row
+func (p *Pool) checkTable(ctx context.Context, table string) error {
+	rows, err := p.Query(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT 1", table))
+	if err != nil {
+		return err
+	}
+	rows.Close()
+	return rows.Err()
+}
+
+// checkFreshness checks that table's newest timestamp is no older than window
+func (p *Pool) checkFreshness(ctx context.Context, table string, window time.Duration) HealthComponent {
+	start := time.Now()
+	var newest *time.Time
+	err := p.QueryRow(WithQueryLabel(ctx, QueryHealth, table),
+		fmt.Sprintf("SELECT max(timestamp) FROM %s", table)).Scan(&newest)
+	if err == nil {
+		switch {
+		case newest == nil:
+			err = fmt.Errorf("%s has no data", table)
+		case time.Since(*newest) > window:
+			err = fmt.Errorf("newest data in %s is %s old, older than %s", table, time.Since(*newest).Round(time.Second), window)
+		}
+	}
+
+	component := healthComponent("freshness:"+table, start, err)
+	component.Newest = newest
+	return component
+}
+
+func healthComponent(name string, start time.Time, err error) HealthComponent {
+	component := HealthComponent{
+		Name:      name,
+		Healthy:   err == nil,
+		LatencyMs: durationMs(time.Since(start)),
+	}
+	if err != nil {
+		component.Error = err.Error()
+	}
+	return component
+}
@@ -0,0 +1,439 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/config"
+)
+
+// ErrHTTPExecDisabled is returned by HTTP statements when no /exec URL is
+// configured
+var ErrHTTPExecDisabled = errors.New("QuestDB HTTP exec not configured")
+
+// ExecError is a statement QuestDB's /exec endpoint rejected
+type ExecError struct {
+	Query    string
+	Message  string
+	Position int
+}
+
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("exec failed at position %d: %s", e.Position, e.Message)
+}
+
+// ExecColumn is one column of an /exec result
+type ExecColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ExecResult is an /exec response. Dataset values are converted to the Go
+// types pgx returns: int64, float64, bool, string, time.Time or nil.
+type ExecResult struct {
+	Columns []ExecColumn
+	Dataset [][]interface{}
+	DDL     string // "OK" for schema statements, which return no columns
+}
+
+// HTTPExecClient runs statements through QuestDB's HTTP /exec endpoint
+type HTTPExecClient struct {
+	baseURL  string
+	user     string
+	password string
+	token    string
+	client   *http.Client
+}
+
+// NewHTTPExecClient creates a client for cfg, or returns nil when no URL is
+// configured
+func NewHTTPExecClient(cfg config.HTTPExecConfig) *HTTPExecClient {
+	if cfg.URL == "" {
+		return nil
+	}
+	return &HTTPExecClient{
+		baseURL:  strings.TrimSuffix(cfg.URL, "/"),
+		user:     cfg.User,
+		password: cfg.Password,
+		token:    cfg.Token,
+		client:   &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// execResponse is the JSON body /exec answers with
+type execResponse struct {
+	Columns  []ExecColumn    `json:"columns"`
+	Dataset  [][]interface{} `json:"dataset"`
+	DDL      string          `json:"ddl"`
+	Error    string          `json:"error"`
+	Position int             `json:"position"`
+}
+
+// Exec runs sql with args inlined as literals, since /exec has no bind
+// parameters
+func (c *HTTPExecClient) Exec(ctx context.Context, sql string, args ...interface{}) (*ExecResult, error) {
+	if c == nil {
+		return nil, ErrHTTPExecDisabled
+	}
+
+	query, err := inlineArgs(sql, args)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := c.baseURL + "/exec?" + url.Values{"query": {query}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("exec request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return parseExecResponse(resp.StatusCode, resp.Body, query)
+}
+
+// parseExecResponse decodes an /exec response body
+func parseExecResponse(status int, body io.Reader, query string) (*ExecResult, error) {
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+
+	var parsed execResponse
+	if err := decoder.Decode(&parsed); err != nil {
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("exec returned status %d", status)
+		}
+		return nil, fmt.Errorf("failed to decode exec response: %w", err)
+	}
+	if parsed.Error != "" {
+		return nil, &ExecError{Query: query, Message: parsed.Error, Position: parsed.Position}
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("exec returned status %d", status)
+	}
+
+	result := &ExecResult{Columns: parsed.Columns, DDL: parsed.DDL}
+	result.Dataset = make([][]interface{}, len(parsed.Dataset))
+	for i, row := range parsed.Dataset {
+		if len(row) != len(parsed.Columns) {
+			return nil, fmt.Errorf("exec row %d has %d values for %d columns", i, len(row), len(parsed.Columns))
+		}
+		values := make([]interface{}, len(row))
+		for j, raw := range row {
+			value, err := execValue(parsed.Columns[j].Type, raw)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", parsed.Columns[j].Name, err)
+			}
+			values[j] = value
+		}
+		result.Dataset[i] = values
+	}
+	return result, nil
+}
+
+// execValue converts one JSON value of a QuestDB column type to the Go type
+// pgx would scan it as
+func execValue(columnType string, raw interface{}) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	switch strings.ToUpper(columnType) {
+	case "BOOLEAN":
+		if b, ok := raw.(bool); ok {
+			return b, nil
+		}
+	case "BYTE", "SHORT", "INT", "LONG":
+		if n, ok := raw.(json.Number); ok {
+			return n.Int64()
+		}
+	case "FLOAT", "DOUBLE":
+		if n, ok := raw.(json.Number); ok {
+			return n.Float64()
+		}
+	case "TIMESTAMP", "DATE":
+		if s, ok := raw.(string); ok {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+	default:
+		if n, ok := raw.(json.Number); ok {
+			return n.String(), nil
+		}
+		if s, ok := raw.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprint(raw), nil
+	}
+	return nil, fmt.Errorf("unexpected %s value %v", columnType, raw)
+}
+
+// placeholder matches PGWire bind parameters
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// inlineArgs replaces $N placeholders with args rendered as SQL literals
+func inlineArgs(sql string, args []interface{}) (string, error) {
+	if len(args) == 0 {
+		return sql, nil
+	}
+
+	literals := make([]string, len(args))
+	for i, arg := range args {
+		literal, err := sqlLiteral(arg)
+		if err != nil {
+			return "", fmt.Errorf("argument $%d: %w", i+1, err)
+		}
+		literals[i] = literal
+	}
+
+	var err error
+	inlined := placeholder.ReplaceAllStringFunc(sql, func(match string) string {
+		n, _ := strconv.Atoi(match[1:])
+		if n < 1 || n > len(literals) {
+			err = fmt.Errorf("placeholder %s has no argument", match)
+			return match
+		}
+		return literals[n-1]
+	})
+	return inlined, err
+}
+
+// sqlLiteral renders an argument as a QuestDB literal
+func sqlLiteral(arg interface{}) (string, error) {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+	case time.Time:
+		return "'" + v.UTC().Format("2006-01-02T15:04:05.000000Z") + "'", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	default:
+		return "", fmt.Errorf("unsupported type %T", arg)
+	}
+}
+
+// Rows returns the result as pgx.Rows
+func (r *ExecResult) Rows() pgx.Rows {
+	return &execRows{result: r, index: -1}
+}
+
+// execRows is a pgx.Rows over an /exec result
+type execRows struct {
+	result *ExecResult
+	index  int
+	closed bool
+	err    error
+}
+
+func (r *execRows) Close() {
+	r.closed = true
+}
+
+func (r *execRows) Err() error {
+	return r.err
+}
+
+func (r *execRows) CommandTag() pgconn.CommandTag {
+	return pgconn.NewCommandTag(fmt.Sprintf("SELECT %d", len(r.result.Dataset)))
+}
+
+func (r *execRows) FieldDescriptions() []pgconn.FieldDescription {
+	fields := make([]pgconn.FieldDescription, len(r.result.Columns))
+	for i, column := range r.result.Columns {
+		fields[i] = pgconn.FieldDescription{Name: column.Name}
+	}
+	return fields
+}
+
+func (r *execRows) Next() bool {
+	if r.closed || r.err != nil || r.index+1 >= len(r.result.Dataset) {
+		r.closed = true
+		return false
+	}
+	r.index++
+	return true
+}
+
+func (r *execRows) Scan(dest ...interface{}) error {
+	if r.index < 0 || r.index >= len(r.result.Dataset) {
+		return errors.New("scan called without a current row")
+	}
+	row := r.result.Dataset[r.index]
+	if len(dest) != len(row) {
+		r.err = fmt.Errorf("number of field descriptions must equal number of destinations, got %d and %d", len(row), len(dest))
+		return r.err
+	}
+	for i, value := range row {
+		if err := assignValue(dest[i], value); err != nil {
+			r.err = fmt.Errorf("can't scan column %s: %w", r.result.Columns[i].Name, err)
+			return r.err
+		}
+	}
+	return nil
+}
+
+func (r *execRows) Values() ([]interface{}, error) {
+	if r.index < 0 || r.index >= len(r.result.Dataset) {
+		return nil, errors.New("values called without a current row")
+	}
+	return r.result.Dataset[r.index], nil
+}
+
+func (r *execRows) RawValues() [][]byte {
+	return nil
+}
+
+func (r *execRows) Conn() *pgx.Conn {
+	return nil
+}
+
+// assignValue stores a converted /exec value into a Scan destination
+func assignValue(dest, value interface{}) error {
+	if dest == nil {
+		return nil
+	}
+	if scanner, ok := dest.(sql.Scanner); ok {
+		return scanner.Scan(value)
+	}
+
+	target := reflect.ValueOf(dest)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("destination %T is not a pointer", dest)
+	}
+	target = target.Elem()
+
+	if value == nil {
+		switch target.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			target.Set(reflect.Zero(target.Type()))
+			return nil
+		}
+		return fmt.Errorf("cannot scan NULL into %T", dest)
+	}
+
+	// Nullable destinations such as **time.Time get a fresh value
+	if target.Kind() == reflect.Ptr {
+		fresh := reflect.New(target.Type().Elem())
+		if err := assignValue(fresh.Interface(), value); err != nil {
+			return err
+		}
+		target.Set(fresh)
+		return nil
+	}
+
+	source := reflect.ValueOf(value)
+	switch {
+	case source.Type().AssignableTo(target.Type()):
+		target.Set(source)
+	case isNumber(source.Kind()) && isNumber(target.Kind()):
+		target.Set(source.Convert(target.Type()))
+	case source.Kind() == reflect.String && target.Kind() == reflect.String:
+		target.SetString(source.String())
+	default:
+		return fmt.Errorf("cannot scan %T into %T", value, dest)
+	}
+	return nil
+}
+
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// execRow is a pgx.Row over the first row of an /exec result
+type execRow struct {
+	rows pgx.Rows
+}
+
+func (r execRow) Scan(dest ...interface{}) error {
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	return r.rows.Scan(dest...)
+}
+
+// HTTPEnabled reports whether the pool can run statements over HTTP /exec
+func (p *Pool) HTTPEnabled() bool {
+	return p.http != nil
+}
+
+// ExecHTTP runs a statement through QuestDB's HTTP /exec endpoint, rejecting
+// writes on a read-only pool. It returns ErrHTTPExecDisabled when no /exec
+// URL is configured.
+func (p *Pool) ExecHTTP(ctx context.Context, sql string, args ...interface{}) (*ExecResult, error) {
+	if err := p.checkStatement(sql); err != nil {
+		return nil, err
+	}
+	return p.http.Exec(ctx, sql, args...)
+}
+
+// ExecSchema runs a schema statement such as CREATE TABLE over HTTP /exec
+// when it is configured, falling back to PGWire if HTTP fails
+func (p *Pool) ExecSchema(ctx context.Context, sql string, args ...interface{}) error {
+	if p.http != nil {
+		_, err := p.ExecHTTP(ctx, sql, args...)
+		if err == nil {
+			return nil
+		}
+		var execErr *ExecError
+		if errors.As(err, &execErr) {
+			return err
+		}
+		log.Warn().Err(err).Str("sql", truncateSQL(sql)).Msg("HTTP schema statement failed, retrying over PGWire")
+	}
+	_, err := p.Exec(ctx, sql, args...)
+	return err
+}
+
+// httpFallback reruns a read query over HTTP /exec when the circuit breaker
+// failed it fast and fallback is enabled. Any other failure is returned as is.
+func (p *Pool) httpFallback(ctx context.Context, sql string, args []interface{}, err error) (pgx.Rows, error) {
+	if p.http == nil || !p.config.HTTP.Fallback || !errors.Is(err, ErrDatabaseUnavailable) || !IsReadStatement(sql) {
+		return nil, err
+	}
+
+	log.Debug().Str("sql", truncateSQL(sql)).Msg("Database circuit open, querying over HTTP")
+	result, httpErr := p.http.Exec(ctx, sql, args...)
+	if httpErr != nil {
+		return nil, fmt.Errorf("%w (HTTP fallback failed: %v)", err, httpErr)
+	}
+	return result.Rows(), nil
+}
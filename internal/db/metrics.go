@@ -0,0 +1,371 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// histogramBounds are the upper bounds of the pool-wide duration histogram
+// buckets
+var histogramBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// HistogramBucket counts observations up to LE, not including those counted
+// by earlier buckets
+type HistogramBucket struct {
+	LE    string `json:"le"` // upper bound, or "+Inf"
+	Count int64  `json:"count"`
+}
+
+// Histogram summarizes observed durations
+type Histogram struct {
+	Count   int64             `json:"count"`
+	SumMs   float64           `json:"sum_ms"`
+	MaxMs   float64           `json:"max_ms"`
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+// PoolMetrics reports connection acquire waits and query durations since
+// startup, with the pool's current saturation
+type PoolMetrics struct {
+	ReadOnly           bool      `json:"read_only"`
+	AcquireWait        Histogram `json:"acquire_wait"`
+	QueryDuration      Histogram `json:"query_duration"`
+	SlowAcquires       int64     `json:"slow_acquires"` // acquire waits over AcquireWaitLimit
+	SlowQueries        int64     `json:"slow_queries"`  // queries over SlowQueryThreshold
+	AcquireWaitLimit   string    `json:"acquire_wait_limit"`
+	SlowQueryThreshold string    `json:"slow_query_threshold"`
+
+	TotalConns    int32 `json:"total_connections"`
+	IdleConns     int32 `json:"idle_connections"`
+	AcquiredConns int32 `json:"acquired_connections"`
+	MaxConns      int32 `json:"max_connections"`
+	EmptyAcquires int64 `json:"empty_acquires"` // acquires that had to wait for a connection
+
+	Breaker     BreakerStatus    `json:"breaker"`
+	Health      HealthStatus     `json:"health"`
+	BusyRetries map[string]int64 `json:"busy_retries"` // retries of reads that found their table busy, by table
+}
+
+// histogram accumulates durations into buckets with fixed upper bounds;
+// durations above the last bound fall in a final unbounded bucket
+type histogram struct {
+	bounds []time.Duration
+	counts []int64
+	count  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func newHistogram(bounds []time.Duration) *histogram {
+	return &histogram{bounds: bounds, counts: make([]int64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(h.bounds) && d > h.bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// quantile estimates the q-th quantile by interpolating within the bucket
+// it falls in, as Prometheus' histogram_quantile does. The unbounded bucket
+// interpolates up to the largest duration seen.
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := q * float64(h.count)
+	var cumulative int64
+	for i, count := range h.counts {
+		if count == 0 || float64(cumulative+count) < rank {
+			cumulative += count
+			continue
+		}
+
+		var lower time.Duration
+		if i > 0 {
+			lower = h.bounds[i-1]
+		}
+		upper := h.max
+		if i < len(h.bounds) && h.bounds[i] < upper {
+			upper = h.bounds[i]
+		}
+		if upper < lower {
+			return upper
+		}
+		fraction := (rank - float64(cumulative)) / float64(count)
+		return lower + time.Duration(fraction*float64(upper-lower))
+	}
+	return h.max
+}
+
+func (h *histogram) snapshot() Histogram {
+	snapshot := Histogram{
+		Count:   h.count,
+		SumMs:   float64(h.sum) / float64(time.Millisecond),
+		MaxMs:   float64(h.max) / float64(time.Millisecond),
+		Buckets: make([]HistogramBucket, len(h.counts)),
+	}
+	for i, count := range h.counts {
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = h.bounds[i].String()
+		}
+		snapshot.Buckets[i] = HistogramBucket{LE: le, Count: count}
+	}
+	return snapshot
+}
+
+// poolMetrics collects a pool's acquire waits and query durations
+type poolMetrics struct {
+	mu           sync.Mutex
+	acquireWait  *histogram
+	queries      *histogram
+	slowAcquires int64
+	slowQueries  int64
+	byLabel      map[queryLabel]*labeledQueries
+	busyRetries  map[string]int64 // by table
+
+	acquireWaitLimit time.Duration // 0 disables slow acquire warnings
+	slowQuery        time.Duration // 0 disables slow query warnings
+}
+
+func newPoolMetrics(acquireWaitLimit, slowQuery time.Duration) *poolMetrics {
+	return &poolMetrics{
+		acquireWait:      newHistogram(histogramBounds),
+		queries:          newHistogram(histogramBounds),
+		byLabel:          make(map[queryLabel]*labeledQueries),
+		busyRetries:      make(map[string]int64),
+		acquireWaitLimit: acquireWaitLimit,
+		slowQuery:        slowQuery,
+	}
+}
+
+// setThresholds replaces the slow acquire and slow query thresholds
+func (m *poolMetrics) setThresholds(acquireWaitLimit, slowQuery time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.acquireWaitLimit = acquireWaitLimit
+	m.slowQuery = slowQuery
+}
+
+// observeAcquire records one acquire wait, reporting whether it was over the
+// limit, which it returns
+func (m *poolMetrics) observeAcquire(wait time.Duration) (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.acquireWait.observe(wait)
+	slow := m.acquireWaitLimit > 0 && wait > m.acquireWaitLimit
+	if slow {
+		m.slowAcquires++
+	}
+	return m.acquireWaitLimit, slow
+}
+
+// observeQuery records one query's duration and rows under its label,
+// reporting whether it was over the slow query threshold, which it returns
+func (m *poolMetrics) observeQuery(d time.Duration, label queryLabel, rows int64) (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.queries.observe(d)
+	m.observeLabeled(d, label, rows)
+	slow := m.slowQuery > 0 && d > m.slowQuery
+	if slow {
+		m.slowQueries++
+	}
+	return m.slowQuery, slow
+}
+
+// observeBusy counts a retry of a query that found table busy
+func (m *poolMetrics) observeBusy(table string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.busyRetries[table]; !ok && len(m.busyRetries) >= maxQueryLabels {
+		table = ""
+	}
+	m.busyRetries[table]++
+}
+
+// queryStartKey carries a query's start in the context between tracer calls
+type queryStartKey struct{}
+
+// queryTrace is what the tracer remembers about a running query
+type queryTrace struct {
+	start time.Time
+	sql   string
+	label queryLabel
+	span  trace.Span // nil when the query isn't part of a recorded trace
+}
+
+// queryTracer times every query run on the pool's connections, and adds a
+// span for queries made within a recorded trace
+type queryTracer struct {
+	metrics  *poolMetrics
+	readOnly bool
+}
+
+func (t *queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	qt := queryTrace{start: time.Now(), sql: data.SQL, label: queryLabelFrom(ctx)}
+
+	// Only queries under a sampled parent get spans, so untraced requests
+	// don't pay for parsing the statement
+	if trace.SpanFromContext(ctx).IsRecording() {
+		operation, table := describeSQL(data.SQL)
+		name := operation
+		if table != "" {
+			name += " " + table
+		}
+		ctx, qt.span = tracing.StartKind(ctx, name, trace.SpanKindClient,
+			attribute.String("db.system", "questdb"),
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.collection.name", table),
+			attribute.String("db.query.text", truncateSQL(data.SQL)),
+			attribute.Bool("db.read_only_pool", t.readOnly),
+		)
+	}
+	return context.WithValue(ctx, queryStartKey{}, qt)
+}
+
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	qt, ok := ctx.Value(queryStartKey{}).(queryTrace)
+	if !ok {
+		return
+	}
+	if qt.span != nil {
+		qt.span.SetAttributes(attribute.Int64("db.rows", data.CommandTag.RowsAffected()))
+		tracing.End(qt.span, data.Err)
+	}
+
+	elapsed := time.Since(qt.start)
+	threshold, slow := t.metrics.observeQuery(elapsed, qt.label, data.CommandTag.RowsAffected())
+	if !slow {
+		return
+	}
+
+	event := log.Warn().
+		Dur("duration", elapsed).
+		Dur("threshold", threshold).
+		Str("sql", truncateSQL(qt.sql))
+	if data.Err != nil {
+		event = event.Err(data.Err)
+	}
+	event.Msg("Slow query")
+}
+
+// tablePattern finds the table a statement reads or writes
+var tablePattern = regexp.MustCompile(`(?i)\b(?:FROM|INTO|UPDATE|TABLE)\s+([A-Za-z_][\w.]*)`)
+
+// describeSQL returns a statement's operation, such as SELECT, and the first
+// table it names, if any
+func describeSQL(sql string) (operation, table string) {
+	fields := strings.Fields(sql)
+	if len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	if match := tablePattern.FindStringSubmatch(sql); match != nil {
+		table = match[1]
+	}
+	return operation, table
+}
+
+// truncateSQL shortens a statement to one line for logging
+func truncateSQL(sql string) string {
+	sql = strings.Join(strings.Fields(sql), " ")
+	if len(sql) > 200 {
+		return sql[:200] + "..."
+	}
+	return sql
+}
+
+// acquire takes a connection from the pool, timing the wait and warning
+// with the pool's saturation when it runs over the limit. It fails fast with
+// ErrDatabaseUnavailable while the circuit breaker is open.
+func (p *Pool) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	if err := p.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	conn, err := p.Pool.Acquire(ctx)
+	wait := time.Since(start)
+	p.breaker.done(err)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit, slow := p.metrics.observeAcquire(wait); slow {
+		stat := p.Pool.Stat()
+		log.Warn().
+			Dur("wait", wait).
+			Dur("limit", limit).
+			Int32("acquired", stat.AcquiredConns()).
+			Int32("idle", stat.IdleConns()).
+			Int32("total", stat.TotalConns()).
+			Int32("max", stat.MaxConns()).
+			Int64("empty_acquires", stat.EmptyAcquireCount()).
+			Bool("read_only", p.readOnly).
+			Msg("Slow database connection acquire, pool may be saturated")
+	}
+	return conn, nil
+}
+
+// PoolMetrics returns the pool's acquire wait and query duration metrics
+// with its current saturation
+func (p *Pool) PoolMetrics() PoolMetrics {
+	p.metrics.mu.Lock()
+	metrics := PoolMetrics{
+		ReadOnly:           p.readOnly,
+		AcquireWait:        p.metrics.acquireWait.snapshot(),
+		QueryDuration:      p.metrics.queries.snapshot(),
+		SlowAcquires:       p.metrics.slowAcquires,
+		SlowQueries:        p.metrics.slowQueries,
+		AcquireWaitLimit:   p.metrics.acquireWaitLimit.String(),
+		SlowQueryThreshold: p.metrics.slowQuery.String(),
+		BusyRetries:        make(map[string]int64, len(p.metrics.busyRetries)),
+	}
+	for table, count := range p.metrics.busyRetries {
+		metrics.BusyRetries[table] = count
+	}
+	p.metrics.mu.Unlock()
+
+	stat := p.Pool.Stat()
+	metrics.TotalConns = stat.TotalConns()
+	metrics.IdleConns = stat.IdleConns()
+	metrics.AcquiredConns = stat.AcquiredConns()
+	metrics.MaxConns = stat.MaxConns()
+	metrics.EmptyAcquires = stat.EmptyAcquireCount()
+	metrics.Breaker = p.breaker.status()
+	metrics.Health = p.healthStatus()
+	return metrics
+}
@@ -2,26 +2,61 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 	"github.com/sptrader/sptrader/internal/config"
 )
 
+// ErrWriteOnReadOnly is returned when a non-read statement is sent through a read-only pool
+var ErrWriteOnReadOnly = errors.New("write statement rejected on read-only pool")
+
+// ErrQueryTimeout is returned when a query runs past its timeout
+var ErrQueryTimeout = errors.New("query timed out")
+
 // Pool wraps pgxpool with additional functionality
 type Pool struct {
 	*pgxpool.Pool
-	config config.DatabaseConfig
+	config   config.DatabaseConfig
+	readOnly bool
+	metrics  *poolMetrics
+	breaker  *breaker
+	health   poolHealth
+	http     *HTTPExecClient // nil when HTTP /exec isn't configured
+
+	stop      chan struct{} // closed to stop the health loop
+	closeOnce sync.Once
 }
 
-// NewPool creates a new database connection pool
+// NewPool creates a new writable database connection pool. It should only be
+// handed to admin paths that legitimately write.
 func NewPool(cfg config.DatabaseConfig) (*Pool, error) {
+	return newPool(cfg, false)
+}
+
+// NewReadOnlyPool creates a pool for query paths. Sessions are opened
+// read-only where the server honors it, and every statement is checked to be
+// a read before it is sent.
+func NewReadOnlyPool(cfg config.DatabaseConfig) (*Pool, error) {
+	return newPool(cfg, true)
+}
+
+func newPool(cfg config.DatabaseConfig, readOnly bool) (*Pool, error) {
 	poolConfig, err := pgxpool.ParseConfig(cfg.URL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse database URL: %w", err)
+		// The parse error can quote the URL, password and all
+		return nil, fmt.Errorf("failed to parse database URL: %s", config.ScrubURL(err.Error(), cfg.URL))
+	}
+
+	if readOnly {
+		poolConfig.ConnConfig.RuntimeParams["default_transaction_read_only"] = "on"
 	}
 
 	// Configure pool
@@ -30,6 +65,9 @@ func NewPool(cfg config.DatabaseConfig) (*Pool, error) {
 	poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
 	poolConfig.HealthCheckPeriod = 30 * time.Second
 
+	metrics := newPoolMetrics(cfg.AcquireWaitLimit, cfg.SlowQueryThreshold)
+	poolConfig.ConnConfig.Tracer = &queryTracer{metrics: metrics, readOnly: readOnly}
+
 	// Set up hooks for logging
 	poolConfig.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
 		log.Debug().Msg("Acquiring database connection")
@@ -59,12 +97,181 @@ func NewPool(cfg config.DatabaseConfig) (*Pool, error) {
 	log.Info().
 		Int32("max_connections", cfg.MaxConnections).
 		Int32("min_connections", cfg.MinConnections).
+		Bool("read_only", readOnly).
 		Msg("Database pool initialized")
 
-	return &Pool{
-		Pool:   pool,
-		config: cfg,
-	}, nil
+	p := &Pool{
+		Pool:     pool,
+		config:   cfg,
+		readOnly: readOnly,
+		metrics:  metrics,
+		breaker:  newBreaker(cfg.BreakerFailures, cfg.BreakerCooldown, cfg.BreakerHalfOpenProbes, readOnly),
+		health:   poolHealth{healthy: true},
+		http:     NewHTTPExecClient(cfg.HTTP),
+		stop:     make(chan struct{}),
+	}
+	go p.healthLoop(poolConfig.HealthCheckPeriod)
+
+	return p, nil
+}
+
+// WarmUp opens the pool's minimum connections up front so the first
+// requests don't pay for dialing. It returns how many connections it held
+// at once.
+func (p *Pool) WarmUp(ctx context.Context) (int, error) {
+	conns := make([]*pgxpool.Conn, 0, p.config.MinConnections)
+	defer func() {
+		for _, conn := range conns {
+			conn.Release()
+		}
+	}()
+
+	for int32(len(conns)) < p.config.MinConnections {
+		conn, err := p.Pool.Acquire(ctx)
+		if err != nil {
+			return len(conns), fmt.Errorf("failed to warm up connection %d of %d: %w", len(conns)+1, p.config.MinConnections, err)
+		}
+		conns = append(conns, conn)
+	}
+	return len(conns), nil
+}
+
+// ReadOnly reports whether the pool rejects write statements
+func (p *Pool) ReadOnly() bool {
+	return p.readOnly
+}
+
+// Query executes a query, rejecting writes on a read-only pool. The
+// connection is returned to the pool when the rows are closed. A query cut
+// off by a stale connection is retried once on a fresh one, and one that
+// finds its table busy a few times with backoff.
+func (p *Pool) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if err := p.checkStatement(sql); err != nil {
+		return nil, err
+	}
+
+	return withRetries(ctx, p, sql, func() (pgx.Rows, error) {
+		return p.query(ctx, sql, args...)
+	})
+}
+
+// query runs one attempt of Query
+func (p *Pool) query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return p.httpFallback(ctx, sql, args, err)
+	}
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		conn.Release()
+		p.breaker.fail(err)
+		return nil, err
+	}
+	return &releasingRows{Rows: rows, conn: conn}, nil
+}
+
+// QueryRow executes a single-row query, rejecting writes on a read-only
+// pool. It is retried like Query.
+func (p *Pool) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if err := p.checkStatement(sql); err != nil {
+		return errRow{err: err}
+	}
+	return &retryingRow{pool: p, ctx: ctx, sql: sql, args: args}
+}
+
+// queryRow runs one attempt of QueryRow
+func (p *Pool) queryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		rows, err := p.httpFallback(ctx, sql, args, err)
+		if err != nil {
+			return errRow{err: err}
+		}
+		return execRow{rows: rows}
+	}
+	return &releasingRow{row: conn.QueryRow(ctx, sql, args...), conn: conn, breaker: p.breaker}
+}
+
+// Exec executes a statement, rejecting writes on a read-only pool. A
+// statement cut off by a stale connection before it was sent is retried
+// once on a fresh one; reads that find their table busy are retried like
+// Query.
+func (p *Pool) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if err := p.checkStatement(sql); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	return withRetries(ctx, p, sql, func() (pgconn.CommandTag, error) {
+		return p.exec(ctx, sql, args...)
+	})
+}
+
+// exec runs one attempt of Exec
+func (p *Pool) exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer conn.Release()
+	tag, err := conn.Exec(ctx, sql, args...)
+	p.breaker.fail(err)
+	return tag, err
+}
+
+// checkStatement allows only single SELECT/SHOW statements on read-only pools
+func (p *Pool) checkStatement(sql string) error {
+	if !p.readOnly {
+		return nil
+	}
+	if !IsReadStatement(sql) {
+		return fmt.Errorf("%w: %.60s", ErrWriteOnReadOnly, strings.TrimSpace(sql))
+	}
+	return nil
+}
+
+// IsReadStatement reports whether sql is a single statement that only reads.
+// EXPLAIN of a read counts as one; EXPLAIN ANALYZE, which runs the
+// statement, doesn't.
+func IsReadStatement(sql string) bool {
+	trimmed := strings.TrimSpace(sql)
+
+	// Skip leading line comments
+	for strings.HasPrefix(trimmed, "--") {
+		if idx := strings.Index(trimmed, "\n"); idx >= 0 {
+			trimmed = strings.TrimSpace(trimmed[idx+1:])
+		} else {
+			return false
+		}
+	}
+
+	// A trailing semicolon is fine, a second statement is not
+	trimmed = strings.TrimSuffix(trimmed, ";")
+	if strings.Contains(trimmed, ";") {
+		return false
+	}
+
+	fields := strings.Fields(trimmed)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "SHOW", "WITH":
+		return true
+	case "EXPLAIN":
+		return IsReadStatement(trimmed[len(fields[0]):])
+	default:
+		return false
+	}
+}
+
+// errRow is a pgx.Row that only reports an error
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
 }
 
 // Stats returns current pool statistics
@@ -90,9 +297,195 @@ func (p *Pool) HealthCheck(ctx context.Context) error {
 	return nil
 }
 
+// SetSlowThresholds changes the acquire wait and query duration over which
+// the pool warns; 0 disables either warning
+func (p *Pool) SetSlowThresholds(acquireWaitLimit, slowQuery time.Duration) {
+	p.metrics.setThresholds(acquireWaitLimit, slowQuery)
+}
+
+// QueryTimeout returns the configured timeout for interactive queries
+func (p *Pool) QueryTimeout() time.Duration {
+	return p.config.QueryTimeout
+}
+
+// ScanTimeout returns the configured timeout for queries that scan whole
+// tables, such as statistics and maintenance
+func (p *Pool) ScanTimeout() time.Duration {
+	return p.config.ScanTimeout
+}
+
+// QueryWithTimeout executes a query under a deadline of timeout from now.
+// The deadline stays in force while the rows are read and is released when
+// they are closed. A query cut off by the deadline fails with
+// ErrQueryTimeout. A timeout of zero or less adds no deadline.
+func (p *Pool) QueryWithTimeout(ctx context.Context, timeout time.Duration, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, cancel := withQueryTimeout(ctx, timeout)
+	rows, err := p.Query(ctx, sql, args...)
+	if err != nil {
+		cancel()
+		return nil, timeoutError(ctx, timeout, err)
+	}
+	return &timeoutRows{Rows: rows, ctx: ctx, cancel: cancel, timeout: timeout}, nil
+}
+
+// QueryRowWithTimeout executes a single-row query under a deadline of
+// timeout from now, released once the row is scanned. A query cut off by the
+// deadline fails with ErrQueryTimeout.
+func (p *Pool) QueryRowWithTimeout(ctx context.Context, timeout time.Duration, sql string, args ...interface{}) pgx.Row {
+	ctx, cancel := withQueryTimeout(ctx, timeout)
+	return &timeoutRow{row: p.QueryRow(ctx, sql, args...), ctx: ctx, cancel: cancel, timeout: timeout}
+}
+
+// QueryPreparedWithTimeout is QueryPrepared under a deadline of timeout from
+// now, released when the rows are closed
+func (p *Pool) QueryPreparedWithTimeout(ctx context.Context, timeout time.Duration, name, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, cancel := withQueryTimeout(ctx, timeout)
+	rows, err := p.QueryPrepared(ctx, name, sql, args...)
+	if err != nil {
+		cancel()
+		return nil, timeoutError(ctx, timeout, err)
+	}
+	return &timeoutRows{Rows: rows, ctx: ctx, cancel: cancel, timeout: timeout}, nil
+}
+
+// withQueryTimeout derives the context a timed query runs under
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutError reports a query cut off by its deadline as ErrQueryTimeout,
+// keeping the driver's error in the chain
+func timeoutError(ctx context.Context, timeout time.Duration, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s: %w", ErrQueryTimeout, timeout, err)
+	}
+	return err
+}
+
+// timeoutRows releases its query deadline when closed
+type timeoutRows struct {
+	pgx.Rows
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+}
+
+func (r *timeoutRows) Close() {
+	r.Rows.Close()
+	r.cancel()
+}
+
+func (r *timeoutRows) Err() error {
+	return timeoutError(r.ctx, r.timeout, r.Rows.Err())
+}
+
+// timeoutRow releases its query deadline once scanned
+type timeoutRow struct {
+	row     pgx.Row
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+}
+
+func (r *timeoutRow) Scan(dest ...interface{}) error {
+	defer r.cancel()
+	return timeoutError(r.ctx, r.timeout, r.row.Scan(dest...))
+}
+
 // WithTimeout executes a function with a timeout
 func (p *Pool) WithTimeout(timeout time.Duration, fn func(context.Context) error) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	return fn(ctx)
-}
\ No newline at end of file
+}
+
+// QueryPrepared executes a named prepared statement. The statement is
+// prepared on the acquired connection the first time that connection sees
+// it; later calls reuse the parsed statement. The connection is returned to
+// the pool when the rows are closed. It is retried like Query.
+func (p *Pool) QueryPrepared(ctx context.Context, name, sql string, args ...interface{}) (pgx.Rows, error) {
+	if err := p.checkStatement(sql); err != nil {
+		return nil, err
+	}
+
+	return withRetries(ctx, p, sql, func() (pgx.Rows, error) {
+		return p.queryPrepared(ctx, name, sql, args...)
+	})
+}
+
+// queryPrepared runs one attempt of QueryPrepared
+func (p *Pool) queryPrepared(ctx context.Context, name, sql string, args ...interface{}) (pgx.Rows, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		if rows, fallbackErr := p.httpFallback(ctx, sql, args, err); fallbackErr == nil {
+			return rows, nil
+		}
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	// Prepare is a no-op when the name is already prepared with the same SQL
+	if _, err := conn.Conn().Prepare(ctx, name, sql); err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("failed to prepare statement %s: %w", name, err)
+	}
+
+	rows, err := conn.Query(ctx, name, args...)
+	if err != nil {
+		conn.Release()
+		p.breaker.fail(err)
+		return nil, err
+	}
+
+	return &releasingRows{Rows: rows, conn: conn}, nil
+}
+
+// releasingRows releases its pool connection when closed
+type releasingRows struct {
+	pgx.Rows
+	conn     *pgxpool.Conn
+	released bool
+}
+
+func (r *releasingRows) Close() {
+	r.Rows.Close()
+	if !r.released {
+		r.released = true
+		r.conn.Release()
+	}
+}
+
+// releasingRow releases its pool connection once scanned
+type releasingRow struct {
+	row     pgx.Row
+	conn    *pgxpool.Conn
+	breaker *breaker
+}
+
+func (r *releasingRow) Scan(dest ...interface{}) error {
+	defer r.conn.Release()
+	err := r.row.Scan(dest...)
+	r.breaker.fail(err)
+	return err
+}
+
+// retryingRow runs its query when scanned, retrying once if the connection
+// it ran on had gone stale and a few times while its table is busy
+type retryingRow struct {
+	pool *Pool
+	ctx  context.Context
+	sql  string
+	args []interface{}
+}
+
+func (r *retryingRow) Scan(dest ...interface{}) error {
+	_, err := withRetries(r.ctx, r.pool, r.sql, func() (struct{}, error) {
+		return struct{}{}, r.pool.queryRow(r.ctx, r.sql, r.args...).Scan(dest...)
+	})
+	return err
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// QueryName is the logical name queries are labeled with in metrics. Names
+// come from this fixed set, never from SQL, to keep label cardinality bounded.
+type QueryName string
+
+// Query names
+const (
+	QueryOther        QueryName = "other" // queries made without a label
+	QueryCandles      QueryName = "candles"
+	QueryTicks        QueryName = "ticks"
+	QuerySpread       QueryName = "spread"
+	QueryTableColumns QueryName = "table_columns"
+	QuerySymbols      QueryName = "symbols"
+	QueryDataRange    QueryName = "data_range"
+	QueryTableStats   QueryName = "table_stats"
+	QueryEstimate     QueryName = "estimate_points"
+	QueryTableExists  QueryName = "table_exists"
+	QueryIntegrity    QueryName = "integrity"
+	QueryAvailability QueryName = "availability"
+	QueryLatestTick   QueryName = "latest_tick"
+	QueryDataQuality  QueryName = "data_quality"
+	QueryFetchAudit   QueryName = "fetch_audit"
+	QueryPriceAlerts  QueryName = "price_alerts"
+	QueryPurge        QueryName = "purge"
+	QueryOHLCRefresh  QueryName = "ohlc_refresh"
+	QueryHealth       QueryName = "health"
+)
+
+// maxQueryLabels caps the query and table pairs tracked per pool; later
+// pairs are counted under QueryOther with no table
+const maxQueryLabels = 256
+
+// queryBounds are the upper bounds of the per-query duration histograms,
+// finer than the pool-wide ones so percentiles stay meaningful
+var queryBounds = []time.Duration{
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// queryLabel identifies the queries one set of metrics covers
+type queryLabel struct {
+	query QueryName
+	table string
+}
+
+// queryLabelKey carries a query label in the context
+type queryLabelKey struct{}
+
+// WithQueryLabel labels the queries made with ctx by logical name and target
+// table for the per-query metrics
+func WithQueryLabel(ctx context.Context, query QueryName, table string) context.Context {
+	return context.WithValue(ctx, queryLabelKey{}, queryLabel{query: query, table: table})
+}
+
+// queryLabelFrom returns ctx's query label, or QueryOther
+func queryLabelFrom(ctx context.Context) queryLabel {
+	if label, ok := ctx.Value(queryLabelKey{}).(queryLabel); ok {
+		return label
+	}
+	return queryLabel{query: QueryOther}
+}
+
+// labeledQueries accumulates the queries under one label
+type labeledQueries struct {
+	durations *histogram
+	rows      int64
+}
+
+// observeLabeled records a query under its label; m.mu must be held
+func (m *poolMetrics) observeLabeled(d time.Duration, label queryLabel, rows int64) {
+	stats, ok := m.byLabel[label]
+	if !ok {
+		if len(m.byLabel) >= maxQueryLabels {
+			label = queryLabel{query: QueryOther}
+			stats = m.byLabel[label]
+		}
+		if stats == nil {
+			stats = &labeledQueries{durations: newHistogram(queryBounds)}
+			m.byLabel[label] = stats
+		}
+	}
+	stats.durations.observe(d)
+	stats.rows += rows
+}
+
+// QueryMetric is the duration histogram, row count and latency percentiles
+// of one labeled query against one table
+type QueryMetric struct {
+	Query    QueryName `json:"query"`
+	Table    string    `json:"table"`
+	Duration Histogram `json:"duration"`
+	Rows     int64     `json:"rows"`
+	P50Ms    float64   `json:"p50_ms"`
+	P95Ms    float64   `json:"p95_ms"`
+	P99Ms    float64   `json:"p99_ms"`
+}
+
+// QueryMetrics returns the pool's per-query metrics, ordered by query name
+// and table
+func (p *Pool) QueryMetrics() []QueryMetric {
+	p.metrics.mu.Lock()
+	defer p.metrics.mu.Unlock()
+
+	metrics := make([]QueryMetric, 0, len(p.metrics.byLabel))
+	for label, stats := range p.metrics.byLabel {
+		metrics = append(metrics, QueryMetric{
+			Query:    label.query,
+			Table:    label.table,
+			Duration: stats.durations.snapshot(),
+			Rows:     stats.rows,
+			P50Ms:    durationMs(stats.durations.quantile(0.50)),
+			P95Ms:    durationMs(stats.durations.quantile(0.95)),
+			P99Ms:    durationMs(stats.durations.quantile(0.99)),
+		})
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].Query != metrics[j].Query {
+			return metrics[i].Query < metrics[j].Query
+		}
+		return metrics[i].Table < metrics[j].Table
+	})
+	return metrics
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
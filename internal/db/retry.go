@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// busyAttempts is how many times a read that hit a busy table is tried in
+// all, and busyBackoff the wait before the first retry, doubling after
+const (
+	busyAttempts = 3
+	busyBackoff  = 20 * time.Millisecond
+)
+
+// busyMessages are fragments of the transient errors QuestDB returns to
+// readers while a table is being written to, lower-cased
+var busyMessages = []string{
+	"table busy",
+	"table is busy",
+	"writer busy",
+	"could not lock",
+	"cannot lock",
+	"o3 commit",
+	"out of order commit",
+	"out-of-order commit",
+}
+
+// IsTableBusy reports whether err is a transient QuestDB error an immediate
+// retry usually gets past, such as "table busy [reason=insert]" during heavy
+// ingestion
+func IsTableBusy(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	for _, fragment := range busyMessages {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetries runs one statement attempt, retrying once on a fresh
+// connection if the first went stale and a few times with backoff while a
+// read finds its table busy. Other errors are returned unchanged.
+func withRetries[T any](ctx context.Context, p *Pool, sql string, attempt func() (T, error)) (T, error) {
+	result, err := attempt()
+	if p.retryable(ctx, sql, err) {
+		result, err = attempt()
+	}
+
+	backoff := busyBackoff
+	for tries := 1; tries < busyAttempts && IsTableBusy(err) && IsReadStatement(sql); tries++ {
+		table := queryLabelFrom(ctx).table
+		if table == "" {
+			_, table = describeSQL(sql)
+		}
+		p.metrics.observeBusy(table)
+		log.Debug().Err(err).Str("table", table).Int("attempt", tries+1).Msg("Table busy, retrying query")
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+		backoff *= 2
+
+		result, err = attempt()
+	}
+	return result, err
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog/log"
+)
+
+// txAttempts is how many times a transaction that failed to serialize is run
+// in all, and txBackoff the wait before the first rerun, doubling after
+const (
+	txAttempts = 3
+	txBackoff  = 20 * time.Millisecond
+)
+
+// Execer runs statements; *Pool and pgx.Tx both are, so statement helpers
+// can run inside or outside a transaction
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// WithTx runs fn in a read committed transaction, committing when fn returns
+// nil and rolling back when it returns an error or panics; the panic is
+// raised again after the rollback. Transactions that fail to serialize or
+// find a table busy are rerun from the start, so fn must not keep state
+// between calls. On a read-only pool the transaction is read-only.
+//
+// QuestDB applies DDL such as ALTER TABLE ... DROP PARTITION as soon as it
+// runs, whatever the transaction, so only row inserts and deletes are
+// undone by a rollback.
+func (p *Pool) WithTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	options := pgx.TxOptions{IsoLevel: pgx.ReadCommitted}
+	if p.readOnly {
+		options.AccessMode = pgx.ReadOnly
+	}
+	return p.WithTxOptions(ctx, options, fn)
+}
+
+// WithTxOptions is WithTx with explicit transaction options
+func (p *Pool) WithTxOptions(ctx context.Context, options pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	backoff := txBackoff
+	for attempt := 1; ; attempt++ {
+		err := p.runTx(ctx, options, fn)
+		if attempt >= txAttempts || !retryableTx(err) || ctx.Err() != nil {
+			return err
+		}
+
+		log.Debug().Err(err).Int("attempt", attempt+1).Bool("read_only", p.readOnly).Msg("Transaction conflict, retrying")
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// runTx runs fn once in a transaction on a connection of its own
+func (p *Pool) runTx(ctx context.Context, options pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.BeginTx(ctx, options)
+	if err != nil {
+		p.breaker.fail(err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	err = finishTx(ctx, tx, fn)
+	p.breaker.fail(err)
+	return err
+}
+
+// finishTx runs fn in tx and commits, or rolls back if fn fails or panics.
+// Rollbacks ignore ctx's cancelation, since a canceled caller is one of the
+// reasons to roll back.
+func finishTx(ctx context.Context, tx pgx.Tx, fn func(tx pgx.Tx) error) (err error) {
+	rollbackCtx := context.WithoutCancel(ctx)
+	defer func() {
+		if r := recover(); r != nil {
+			rollback(rollbackCtx, tx)
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		rollback(rollbackCtx, tx)
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// rollback rolls tx back, logging rather than returning a failure so the
+// error that caused it is the one reported
+func rollback(ctx context.Context, tx pgx.Tx) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+		log.Warn().Err(err).Msg("Failed to roll back transaction")
+	}
+}
+
+// retryableTx reports whether a transaction failed in a way rerunning it
+// may get past: a serialization failure or deadlock, or a busy table
+func retryableTx(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01") {
+		return true
+	}
+	return IsTableBusy(err)
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeTx records how a transaction was finished. Methods it doesn't
+// override panic through the nil embedded Tx.
+type fakeTx struct {
+	pgx.Tx
+	commitErr   error
+	committed   bool
+	rolledBack  bool
+	rollbackErr error // the rollback context's error when it was sent
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.committed = true
+	return tx.commitErr
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	tx.rolledBack = true
+	tx.rollbackErr = ctx.Err()
+	return nil
+}
+
+func TestFinishTxCommits(t *testing.T) {
+	tx := &fakeTx{}
+	if err := finishTx(context.Background(), tx, func(pgx.Tx) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if !tx.committed || tx.rolledBack {
+		t.Errorf("committed %v, rolled back %v, want only committed", tx.committed, tx.rolledBack)
+	}
+}
+
+func TestFinishTxRollsBackOnError(t *testing.T) {
+	tx := &fakeTx{}
+	failed := errors.New("delete failed")
+	if err := finishTx(context.Background(), tx, func(pgx.Tx) error { return failed }); !errors.Is(err, failed) {
+		t.Errorf("err = %v, want fn's error", err)
+	}
+	if tx.committed || !tx.rolledBack {
+		t.Errorf("committed %v, rolled back %v, want only rolled back", tx.committed, tx.rolledBack)
+	}
+}
+
+func TestFinishTxRollsBackOnPanic(t *testing.T) {
+	tx := &fakeTx{}
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("recovered %v, want the panic raised again", r)
+		}
+		if tx.committed || !tx.rolledBack {
+			t.Errorf("committed %v, rolled back %v, want only rolled back", tx.committed, tx.rolledBack)
+		}
+	}()
+	finishTx(context.Background(), tx, func(pgx.Tx) error { panic("boom") })
+	t.Error("finishTx returned from a panicking fn")
+}
+
+func TestFinishTxCommitFailure(t *testing.T) {
+	tx := &fakeTx{commitErr: pgx.ErrTxCommitRollback}
+	if err := finishTx(context.Background(), tx, func(pgx.Tx) error { return nil }); !errors.Is(err, pgx.ErrTxCommitRollback) {
+		t.Errorf("err = %v, want the commit error", err)
+	}
+}
+
+// A caller that gave up is one of the reasons to roll back, so the rollback
+// must still be sent
+func TestFinishTxRollsBackCanceledCaller(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	tx := &fakeTx{}
+	finishTx(ctx, tx, func(pgx.Tx) error {
+		cancel()
+		return ctx.Err()
+	})
+	if !tx.rolledBack || tx.rollbackErr != nil {
+		t.Errorf("rolled back %v under a context with err %v, want a live context", tx.rolledBack, tx.rollbackErr)
+	}
+}
+
+func TestRetryableTx(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, true},
+		{"constraint violation", &pgconn.PgError{Code: "23505"}, false},
+		{"other error", errors.New("boom"), false},
+		{"success", nil, false},
+	}
+	for _, tt := range tests {
+		if got := retryableTx(tt.err); got != tt.want {
+			t.Errorf("%s: retryableTx = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Package market models when instruments trade, so hours the market was
+// closed can be told apart from hours missing data.
+package market
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/config"
+)
+
+// AssetClass groups symbols that share trading hours
+type AssetClass string
+
+const (
+	Forex  AssetClass = "forex" // currencies and spot metals, closed over the weekend
+	Crypto AssetClass = "crypto"
+)
+
+// cryptoBases are the base currencies of symbols that trade around the clock
+var cryptoBases = []string{"BTC", "ETH", "LTC", "XRP", "BCH", "SOL"}
+
+// ClassOf returns the asset class of a symbol
+func ClassOf(symbol string) AssetClass {
+	symbol = strings.ToUpper(symbol)
+	for _, base := range cryptoBases {
+		if strings.HasPrefix(symbol, base) {
+			return Crypto
+		}
+	}
+	return Forex
+}
+
+// weekMinute is a point in the week, in minutes since Sunday 00:00 UTC
+type weekMinute int
+
+const minutesPerWeek = 7 * 24 * 60
+
+func weekMinuteOf(t time.Time) weekMinute {
+	t = t.UTC()
+	return weekMinute(int(t.Weekday())*24*60 + t.Hour()*60 + t.Minute())
+}
+
+// parseWeekMinute parses a weekday and time such as "Fri 22:00"
+func parseWeekMinute(value string) (weekMinute, error) {
+	day, clock, ok := strings.Cut(strings.TrimSpace(value), " ")
+	if !ok {
+		return 0, fmt.Errorf("invalid week time %q, want e.g. \"Fri 22:00\"", value)
+	}
+	weekday := -1
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(day, d.String()[:3]) || strings.EqualFold(day, d.String()) {
+			weekday = int(d)
+		}
+	}
+	if weekday < 0 {
+		return 0, fmt.Errorf("invalid weekday in %q", value)
+	}
+	at, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time in %q: %w", value, err)
+	}
+	return weekMinute(weekday*24*60 + at.Hour()*60 + at.Minute()), nil
+}
+
+// Calendar decides whether a symbol's market is open at a given time
+type Calendar struct {
+	weeklyOpen  weekMinute
+	weeklyClose weekMinute
+	annual      map[string]bool // MM-DD closed every year
+	dated       map[string]bool // YYYY-MM-DD closed once
+	goodFriday  bool
+}
+
+// GoodFriday is the holiday entry for the Friday before Easter, whose date
+// moves every year
+const GoodFriday = "good-friday"
+
+// easter returns Easter Sunday of a year in the Gregorian calendar
+func easter(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// NewCalendar builds a calendar from the configured session boundaries and
+// holidays
+func NewCalendar(cfg config.MarketConfig) (*Calendar, error) {
+	openAt, err := parseWeekMinute(cfg.WeeklyOpen)
+	if err != nil {
+		return nil, fmt.Errorf("weekly open: %w", err)
+	}
+	closeAt, err := parseWeekMinute(cfg.WeeklyClose)
+	if err != nil {
+		return nil, fmt.Errorf("weekly close: %w", err)
+	}
+
+	c := &Calendar{
+		weeklyOpen:  openAt,
+		weeklyClose: closeAt,
+		annual:      make(map[string]bool),
+		dated:       make(map[string]bool),
+	}
+	for _, holiday := range cfg.Holidays {
+		if strings.EqualFold(holiday, GoodFriday) {
+			c.goodFriday = true
+		} else if _, err := time.Parse("2006-01-02", holiday); err == nil {
+			c.dated[holiday] = true
+		} else if _, err := time.Parse("01-02", holiday); err == nil {
+			c.annual[holiday] = true
+		} else {
+			return nil, fmt.Errorf("invalid holiday %q, want MM-DD, YYYY-MM-DD or %s", holiday, GoodFriday)
+		}
+	}
+	return c, nil
+}
+
+// Open reports whether the symbol's market is open at t
+func (c *Calendar) Open(symbol string, t time.Time) bool {
+	if ClassOf(symbol) == Crypto {
+		return true
+	}
+
+	t = t.UTC()
+	if c.Holiday(t) {
+		return false
+	}
+
+	m := weekMinuteOf(t)
+	if c.weeklyOpen < c.weeklyClose {
+		return m >= c.weeklyOpen && m < c.weeklyClose
+	}
+	// The trading week wraps past Saturday, as forex does from Sunday evening
+	return m >= c.weeklyOpen || m < c.weeklyClose
+}
+
+// Holiday reports whether t falls on a configured holiday
+func (c *Calendar) Holiday(t time.Time) bool {
+	t = t.UTC()
+	if c.annual[t.Format("01-02")] || c.dated[t.Format("2006-01-02")] {
+		return true
+	}
+	if c.goodFriday && t.Month() >= time.March && t.Month() <= time.April {
+		friday := easter(t.Year()).AddDate(0, 0, -2)
+		return t.Year() == friday.Year() && t.YearDay() == friday.YearDay()
+	}
+	return false
+}
+
+// OpenDuring reports whether the symbol's market is open at any point in
+// the hour starting at hour
+func (c *Calendar) OpenDuring(symbol string, hour time.Time) bool {
+	return c.OpenWithin(symbol, hour, time.Hour)
+}
+
+// OpenWithin reports whether the symbol's market is open at any point in the
+// span of d from start. The market only opens at the weekly open or at
+// midnight as a holiday ends, so those are the times checked after start.
+func (c *Calendar) OpenWithin(symbol string, start time.Time, d time.Duration) bool {
+	if c.Open(symbol, start) {
+		return true
+	}
+	start = start.UTC()
+	end := start.Add(d)
+
+	// Weekly opens within the span, one per week of it
+	offset := time.Duration((c.weeklyOpen-weekMinuteOf(start)+minutesPerWeek)%minutesPerWeek) * time.Minute
+	for at := start.Truncate(time.Minute).Add(offset); at.Before(end); at = at.Add(7 * 24 * time.Hour) {
+		if !at.Before(start) && c.Open(symbol, at) {
+			return true
+		}
+	}
+	// Midnights within the span, when a holiday may end
+	for at := time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, time.UTC); at.Before(end); at = at.AddDate(0, 0, 1) {
+		if c.Open(symbol, at) {
+			return true
+		}
+	}
+	return false
+}
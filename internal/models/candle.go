@@ -1,7 +1,11 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/sptrader/sptrader/internal/bars"
 )
 
 // Candle represents OHLC data
@@ -12,6 +16,19 @@ type Candle struct {
 	Low       float64   `json:"low"`
 	Close     float64   `json:"close"`
 	Volume    float64   `json:"volume"`
+	VWAP      *float64  `json:"vwap,omitempty"`
+	TickCount *int64    `json:"tick_count,omitempty"`
+	AvgSpread *float64  `json:"avg_spread,omitempty"`
+	MinSpread *float64  `json:"min_spread,omitempty"`
+	MaxSpread *float64  `json:"max_spread,omitempty"`
+	TWASpread *float64  `json:"twa_spread,omitempty"` // time-weighted average spread
+	// Order flow: ask volume as buys, bid volume as sells
+	BuyVolume       *float64 `json:"buy_volume,omitempty"`
+	SellVolume      *float64 `json:"sell_volume,omitempty"`
+	Delta           *float64 `json:"delta,omitempty"`            // buy less sell volume
+	CumulativeDelta *float64 `json:"cumulative_delta,omitempty"` // running delta from the response's first candle
+	// Position in a continuous series, see ContinuousMapping
+	Index *int64 `json:"index,omitempty"`
 }
 
 // CandleRequest represents a request for candle data
@@ -21,7 +38,86 @@ type CandleRequest struct {
 	Start      time.Time `form:"start" binding:"required" time_format:"2006-01-02T15:04:05Z"`
 	End        time.Time `form:"end" binding:"required" time_format:"2006-01-02T15:04:05Z"`
 	Resolution string    `form:"resolution"`
-	Source     string    `form:"source"` // "v1" or "v2", default "v2"
+	Source     string    `form:"source"`     // "v1" or "v2", default "v2"
+	Include    string    `form:"include"`    // comma-separated extras, e.g. "vwap,tick_count"
+	Alignment  string    `form:"alignment"`  // AlignUTC (default) or AlignNYClose; 1d and 1w only
+	Continuous bool      `form:"continuous"` // index candles skipping closed-market periods
+	Session    string    `form:"session"`    // comma-separated sessions to keep bars of, e.g. "LONDON,NEWYORK"
+}
+
+// Day boundaries of 1d and 1w bars
+const (
+	AlignUTC     = "utc"      // days start at midnight UTC
+	AlignNYClose = "ny_close" // days start at the 17:00 New York forex close, weeks on Sunday's
+)
+
+// ParseAlignment returns the requested alignment, AlignUTC when none is
+func (r CandleRequest) ParseAlignment() (string, error) {
+	switch r.Alignment {
+	case "", AlignUTC:
+		return AlignUTC, nil
+	case AlignNYClose:
+		return AlignNYClose, nil
+	default:
+		return "", fmt.Errorf("unsupported alignment: %s, want %s or %s", r.Alignment, AlignUTC, AlignNYClose)
+	}
+}
+
+// CandleExtras flags the optional per-bar columns requested via include
+type CandleExtras struct {
+	VWAP      bool
+	TickCount bool
+	Spread    bool
+	Delta     bool
+}
+
+// Any reports whether any extra column was requested
+func (e CandleExtras) Any() bool {
+	return e.VWAP || e.TickCount || e.Spread || e.Delta
+}
+
+// Key returns a stable representation of the extras for cache keys
+func (e CandleExtras) Key() string {
+	parts := make([]string, 0, 4)
+	if e.Delta {
+		parts = append(parts, "delta")
+	}
+	if e.Spread {
+		parts = append(parts, "spread")
+	}
+	if e.TickCount {
+		parts = append(parts, "tick_count")
+	}
+	if e.VWAP {
+		parts = append(parts, "vwap")
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseExtras parses the include parameter
+func (r CandleRequest) ParseExtras() (CandleExtras, error) {
+	var extras CandleExtras
+	if r.Include == "" {
+		return extras, nil
+	}
+
+	for _, part := range strings.Split(r.Include, ",") {
+		switch strings.TrimSpace(part) {
+		case "vwap":
+			extras.VWAP = true
+		case "tick_count":
+			extras.TickCount = true
+		case "spread":
+			extras.Spread = true
+		case "delta":
+			extras.Delta = true
+		case "":
+		default:
+			return extras, fmt.Errorf("unsupported include value: %s", part)
+		}
+	}
+
+	return extras, nil
 }
 
 // CandleResponse represents the response containing candles
@@ -36,18 +132,311 @@ type CandleResponse struct {
 	Metadata   Metadata  `json:"metadata"`
 }
 
+// IsEmpty reports whether the response holds no candles
+func (r *CandleResponse) IsEmpty() bool {
+	return r == nil || len(r.Candles) == 0
+}
+
 // Metadata provides additional information about the query
 type Metadata struct {
-	TableUsed      string        `json:"table_used"`
-	QueryTimeMs    int64         `json:"query_time_ms"`
-	CacheHit       bool          `json:"cache_hit"`
-	PointsReturned int           `json:"points_returned"`
-	MaxPoints      int           `json:"max_points"`
-	DataComplete   bool          `json:"data_complete"`
-	NextURL        string        `json:"next_url,omitempty"`
-	DataSource     string        `json:"data_source"`
-	ServerTime     time.Time     `json:"server_time"`
-	TimeRange      time.Duration `json:"time_range"`
+	TableUsed      string             `json:"table_used"`
+	QueryTimeMs    int64              `json:"query_time_ms"`
+	CacheHit       bool               `json:"cache_hit"`
+	PointsReturned int                `json:"points_returned"`
+	MaxPoints      int                `json:"max_points"`
+	DataComplete   bool               `json:"data_complete"`
+	NextURL        string             `json:"next_url,omitempty"`
+	DataSource     string             `json:"data_source"`
+	ServerTime     time.Time          `json:"server_time"`
+	TimeRange      time.Duration      `json:"time_range"`
+	Notes          []string           `json:"notes,omitempty"`
+	DeltaSource    string             `json:"delta_source,omitempty"` // DeltaFromTable or DeltaFromTicks, with include=delta
+	Continuous     *ContinuousMapping `json:"continuous,omitempty"`   // with continuous=true
+}
+
+// ContinuousMapping relates candle indexes in a continuous series to time.
+// Time is cut into bar slots of BarSeconds from Origin, and the slots the
+// market is closed for throughout are skipped: index i is the i-th slot left,
+// so its timestamp is Origin plus i bars plus the bars of every closed period
+// before it. A candle's index is that of the slot holding its timestamp;
+// slots open but without data keep their index, leaving a gap in the indexes.
+type ContinuousMapping struct {
+	Origin        time.Time      `json:"origin"`
+	BarSeconds    int64          `json:"bar_seconds"`
+	ClosedPeriods []ClosedPeriod `json:"closed_periods"` // between Origin and the last candle
+}
+
+// ClosedPeriod is a run of skipped slots, from Start up to End
+type ClosedPeriod struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Bars  int64     `json:"bars"`
+}
+
+// Paths delta is computed on
+const (
+	DeltaFromTable = "pre_aggregated" // the table's buy and sell volume columns
+	DeltaFromTicks = "ticks"          // summed from tick bid and ask volume
+)
+
+// PriceBarRequest requests Renko bricks or range bars built from ticks
+type PriceBarRequest struct {
+	Symbol string    `form:"symbol" binding:"required"`
+	Start  time.Time `form:"start" binding:"required" time_format:"2006-01-02T15:04:05Z"`
+	End    time.Time `form:"end" binding:"required" time_format:"2006-01-02T15:04:05Z"`
+	Type   string    `form:"type"`  // bars.TypeRenko (default) or bars.TypeRange
+	Brick  float64   `form:"brick"` // Renko brick size, in price
+	Range  float64   `form:"range"` // range bar size, in price
+}
+
+// BarSize returns the requested bar type, Renko when none is, and the size
+// given for it
+func (r PriceBarRequest) BarSize() (string, float64) {
+	switch r.Type {
+	case "", bars.TypeRenko:
+		return bars.TypeRenko, r.Brick
+	case bars.TypeRange:
+		return bars.TypeRange, r.Range
+	default:
+		return r.Type, 0
+	}
+}
+
+// PriceBarResponse holds the bars completed over the requested range; the
+// one still forming at its end is left out
+type PriceBarResponse struct {
+	Symbol      string     `json:"symbol"`
+	Type        string     `json:"type"`
+	Size        float64    `json:"size"`
+	Start       time.Time  `json:"start"`
+	End         time.Time  `json:"end"`
+	Count       int        `json:"count"`
+	Bars        []bars.Bar `json:"bars"`
+	TicksRead   int64      `json:"ticks_read"`
+	MaxBars     int        `json:"max_bars"`
+	QueryTimeMs int64      `json:"query_time_ms"`
+}
+
+// CorrelationRequest requests the rolling correlation of two symbols
+type CorrelationRequest struct {
+	Symbols   string    `form:"symbols" binding:"required"` // two, comma-separated
+	Timeframe string    `form:"tf"`
+	Start     time.Time `form:"start" binding:"required" time_format:"2006-01-02T15:04:05Z"`
+	End       time.Time `form:"end" binding:"required" time_format:"2006-01-02T15:04:05Z"`
+	Window    int       `form:"window"` // returns per correlation, default 24
+}
+
+// ParseSymbols returns the two requested symbols
+func (r CorrelationRequest) ParseSymbols() ([2]string, error) {
+	parts := strings.Split(r.Symbols, ",")
+	if len(parts) != 2 {
+		return [2]string{}, fmt.Errorf("symbols must name two symbols, got %q", r.Symbols)
+	}
+	symbols := [2]string{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])}
+	if symbols[0] == "" || symbols[1] == "" || symbols[0] == symbols[1] {
+		return [2]string{}, fmt.Errorf("symbols must name two different symbols, got %q", r.Symbols)
+	}
+	return symbols, nil
+}
+
+// CorrelationResponse holds the rolling correlation of two symbols' log
+// returns and the correlation over the whole range
+type CorrelationResponse struct {
+	Symbols     []string           `json:"symbols"`
+	Resolution  string             `json:"resolution"`
+	Start       time.Time          `json:"start"`
+	End         time.Time          `json:"end"`
+	Window      int                `json:"window"`
+	Bars        map[string]int     `json:"bars"` // per symbol, before alignment
+	AlignedBars int                `json:"aligned_bars"`
+	Correlation *float64           `json:"correlation"` // over every return; null if a side never moved
+	Count       int                `json:"count"`
+	Series      []CorrelationPoint `json:"series"`
+	QueryTimeMs int64              `json:"query_time_ms"`
+	Notes       []string           `json:"notes,omitempty"`
+}
+
+// CorrelationPoint is the correlation over the window of returns ending at
+// Timestamp; nil where it is undefined because a side didn't move
+type CorrelationPoint struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Correlation *float64  `json:"correlation"`
+}
+
+// ReturnsRequest requests per-bar returns of a symbol's candles
+type ReturnsRequest struct {
+	Symbol    string    `form:"symbol" binding:"required"`
+	Timeframe string    `form:"tf"`
+	Start     time.Time `form:"start" binding:"required" time_format:"2006-01-02T15:04:05Z"`
+	End       time.Time `form:"end" binding:"required" time_format:"2006-01-02T15:04:05Z"`
+	Type      string    `form:"type"` // ReturnsSimple (default) or ReturnsLog
+}
+
+// Kinds of returns
+const (
+	ReturnsSimple = "simple" // close over previous close, less one
+	ReturnsLog    = "log"    // log of close over previous close
+)
+
+// ParseType returns the requested kind of returns, ReturnsSimple when none is
+func (r ReturnsRequest) ParseType() (string, error) {
+	switch r.Type {
+	case "", ReturnsSimple:
+		return ReturnsSimple, nil
+	case ReturnsLog:
+		return ReturnsLog, nil
+	default:
+		return "", fmt.Errorf("unsupported returns type: %s, want %s or %s", r.Type, ReturnsSimple, ReturnsLog)
+	}
+}
+
+// ReturnsResponse holds the return into each candle from the one before it,
+// stamped with the candle's timestamp, so the first candle has none
+type ReturnsResponse struct {
+	Symbol     string        `json:"symbol"`
+	Resolution string        `json:"resolution"`
+	Type       string        `json:"type"`
+	Start      time.Time     `json:"start"`
+	End        time.Time     `json:"end"`
+	Count      int           `json:"count"`
+	Returns    []ReturnPoint `json:"returns"`
+	Stats      ReturnStats   `json:"stats"`
+	Metadata   Metadata      `json:"metadata"`
+}
+
+// ReturnPoint is the return into the bar at Timestamp
+type ReturnPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Return    float64   `json:"return"`
+}
+
+// ReturnStats summarizes a returns series
+type ReturnStats struct {
+	Count                int     `json:"count"`
+	Mean                 float64 `json:"mean"`
+	Stdev                float64 `json:"stdev"`                 // sample standard deviation
+	AnnualizedVolatility float64 `json:"annualized_volatility"` // stdev scaled by the root of bars per year
+	BarsPerYear          float64 `json:"bars_per_year"`
+	Min                  float64 `json:"min"`
+	Max                  float64 `json:"max"`
+	MaxDrawdown          float64 `json:"max_drawdown"` // largest fall of the close from its peak, as a fraction of it
+}
+
+// VolatilityRequest requests ATR and realized volatility of a symbol's
+// candles
+type VolatilityRequest struct {
+	Symbol    string    `form:"symbol" binding:"required"`
+	Timeframe string    `form:"tf"`
+	Start     time.Time `form:"start" binding:"required" time_format:"2006-01-02T15:04:05Z"`
+	End       time.Time `form:"end" binding:"required" time_format:"2006-01-02T15:04:05Z"`
+	ATRPeriod int       `form:"atr_period"` // bars, default 14; also the realized volatility window
+}
+
+// VolatilityResponse holds ATR and realized volatility per candle, null
+// through each one's warm-up, and their latest values
+type VolatilityResponse struct {
+	Symbol            string            `json:"symbol"`
+	Resolution        string            `json:"resolution"`
+	Start             time.Time         `json:"start"`
+	End               time.Time         `json:"end"`
+	ATRPeriod         int               `json:"atr_period"`
+	BarsPerYear       float64           `json:"bars_per_year"` // realized volatility is annualized by its square root
+	Count             int               `json:"count"`
+	Series            []VolatilityPoint `json:"series"`
+	LatestATR         *float64          `json:"latest_atr"`
+	LatestRealizedVol *float64          `json:"latest_realized_vol"`
+	RealizedVol       *float64          `json:"realized_vol"` // over every return in the range
+	Metadata          Metadata          `json:"metadata"`
+}
+
+// VolatilityPoint is one candle's true range, ATR and realized volatility.
+// ATR is null for the first period-1 candles, realized volatility for the
+// first period.
+type VolatilityPoint struct {
+	Timestamp   time.Time `json:"timestamp"`
+	TrueRange   float64   `json:"true_range"`
+	ATR         *float64  `json:"atr"`
+	RealizedVol *float64  `json:"realized_vol"`
+}
+
+// Quote is a symbol's most recent tick
+type Quote struct {
+	Symbol    string    `json:"symbol"`
+	Bid       float64   `json:"bid"`
+	Ask       float64   `json:"ask"`
+	Mid       float64   `json:"mid"`
+	Spread    float64   `json:"spread"`
+	Timestamp time.Time `json:"timestamp"`
+	AgeMs     int64     `json:"age_ms"` // since the tick, when the quote was served
+	Stale     bool      `json:"stale"`  // older than the staleness monitor allows for the market's state
+}
+
+// BacktestRequest runs a strategy over a symbol's candles
+type BacktestRequest struct {
+	Symbol    string           `json:"symbol" binding:"required"`
+	Timeframe string           `json:"tf"`
+	Start     time.Time        `json:"start" binding:"required"`
+	End       time.Time        `json:"end" binding:"required"`
+	Strategy  BacktestStrategy `json:"strategy"`
+}
+
+// BacktestStrategy describes a strategy and the costs it trades at. Costs
+// are in price units: half the spread and the slippage are paid on every
+// fill.
+type BacktestStrategy struct {
+	Type       string  `json:"type"` // "sma_cross", the default
+	Fast       int     `json:"fast"` // fast moving average period, in bars
+	Slow       int     `json:"slow"` // slow moving average period, in bars
+	Spread     float64 `json:"spread"`
+	Slippage   float64 `json:"slippage"`
+	Quantity   float64 `json:"quantity"`    // units per trade, default 1
+	AllowShort bool    `json:"allow_short"` // go short on a downward cross instead of flat
+}
+
+// BacktestResponse holds a backtest's trades, equity curve and stats
+type BacktestResponse struct {
+	Symbol     string                `json:"symbol"`
+	Resolution string                `json:"resolution"`
+	Start      time.Time             `json:"start"`
+	End        time.Time             `json:"end"`
+	Strategy   BacktestStrategy      `json:"strategy"` // with defaults filled in
+	Bars       int                   `json:"bars"`
+	Trades     []BacktestTrade       `json:"trades"`
+	Equity     []BacktestEquityPoint `json:"equity"`
+	Stats      BacktestStats         `json:"stats"`
+	Metadata   Metadata              `json:"metadata"`
+}
+
+// BacktestTrade is one round trip, its prices after costs
+type BacktestTrade struct {
+	Side        string    `json:"side"` // "long" or "short"
+	EntryTime   time.Time `json:"entry_time"`
+	EntryPrice  float64   `json:"entry_price"`
+	ExitTime    time.Time `json:"exit_time"`
+	ExitPrice   float64   `json:"exit_price"`
+	Bars        int       `json:"bars"` // held for
+	PnL         float64   `json:"pnl"`
+	ClosedAtEnd bool      `json:"closed_at_end,omitempty"` // still open after the last candle, closed at its close
+}
+
+// BacktestEquityPoint is the running profit at a candle's close, with any
+// open position marked at the close
+type BacktestEquityPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Equity    float64   `json:"equity"`
+}
+
+// BacktestStats describes a backtest's trades
+type BacktestStats struct {
+	Trades       int      `json:"trades"`
+	Wins         int      `json:"wins"`
+	Losses       int      `json:"losses"`
+	WinRate      float64  `json:"win_rate"`
+	GrossProfit  float64  `json:"gross_profit"`
+	GrossLoss    float64  `json:"gross_loss"`    // as a positive amount
+	ProfitFactor *float64 `json:"profit_factor"` // gross profit over gross loss, null without losses
+	NetProfit    float64  `json:"net_profit"`
+	MaxDrawdown  float64  `json:"max_drawdown"` // largest fall of equity from its peak, in price units
 }
 
 // ExplainResponse explains query planning
@@ -57,6 +446,8 @@ type ExplainResponse struct {
 	Resolution   string                 `json:"resolution"`
 	TableUsed    string                 `json:"table_used"`
 	EstimatedPoints int                 `json:"estimated_points"`
+	SourceRows   int                    `json:"source_rows,omitempty"`
+	SourceRowsExact bool                `json:"source_rows_exact"`
 	MaxAllowed   int                    `json:"max_allowed"`
 	Reason       string                 `json:"reason"`
 	Alternatives []ResolutionAlternative `json:"alternatives"`
@@ -71,13 +462,18 @@ type ResolutionAlternative struct {
 
 // Symbol represents a trading pair
 type Symbol struct {
-	Symbol      string    `json:"symbol"`
-	Description string    `json:"description"`
-	BaseCurrency string   `json:"base_currency"`
-	QuoteCurrency string  `json:"quote_currency"`
-	MinSize     float64   `json:"min_size"`
-	TickSize    float64   `json:"tick_size"`
-	LastUpdate  time.Time `json:"last_update"`
+	Symbol               string    `json:"symbol"`
+	Description          string    `json:"description"`
+	BaseCurrency         string    `json:"base_currency"`
+	QuoteCurrency        string    `json:"quote_currency"`
+	MinSize              float64   `json:"min_size"`
+	TickSize             float64   `json:"tick_size"`
+	LastUpdate           time.Time `json:"last_update"`
+	FirstTick            time.Time `json:"first_tick"`
+	TickCount            int64     `json:"tick_count"`
+	TickCountApproximate bool      `json:"tick_count_approximate"`
+	Timeframes           []string  `json:"timeframes"`
+	MetadataSource       string    `json:"metadata_source"` // "symbols_meta" or "default"
 }
 
 // DataContract represents the performance contract
@@ -85,19 +481,31 @@ type DataContract struct {
 	MaxPointsPerRequest int                          `json:"max_points_per_request"`
 	Resolutions         map[string]ResolutionContract `json:"resolutions"`
 	PerformanceTargets  PerformanceTargets           `json:"performance_targets"`
+	CacheTiers          []CacheTierContract          `json:"cache_tiers,omitempty"` // server cache policy, not profiled
 	Version             string                       `json:"version"`
 	Generated           time.Time                    `json:"generated"`
 }
 
+// CacheTierContract is how long candles are cached when their data ends
+// less than MaxAgeMs ago; 0 is any older data
+type CacheTierContract struct {
+	MaxAgeMs int64 `json:"max_age_ms"`
+	TTLMs    int64 `json:"ttl_ms"`
+}
+
 // ResolutionContract defines limits for a specific resolution
 type ResolutionContract struct {
-	Resolution   string `json:"resolution"`
-	MinRangeMs   int64  `json:"min_range_ms"`
-	MaxRangeMs   int64  `json:"max_range_ms"`
-	MaxPoints    int    `json:"max_points"`
-	Table        string `json:"table"`
-	Description  string `json:"description"`
-	Recommended  string `json:"recommended_for"`
+	Resolution        string   `json:"resolution"`
+	MinRangeMs        int64    `json:"min_range_ms"`
+	MaxRangeMs        int64    `json:"max_range_ms"`
+	MaxPoints         int      `json:"max_points"`
+	TypicalQueryMs    int64    `json:"typical_query_ms,omitempty"`     // slowest profiled query at the widest acceptable range
+	BytesPerPoint     int      `json:"bytes_per_point,omitempty"`      // measured heap per decoded candle
+	JSONBytesPerPoint int      `json:"json_bytes_per_point,omitempty"` // measured JSON per served candle
+	Alignments        []string `json:"alignments,omitempty"`           // day boundaries offered, the default first
+	Table             string   `json:"table"`
+	Description       string   `json:"description"`
+	Recommended       string   `json:"recommended_for"`
 }
 
 // PerformanceTargets defines performance goals
@@ -109,13 +517,69 @@ type PerformanceTargets struct {
 
 // Stats represents API statistics
 type Stats struct {
-	Uptime          time.Duration     `json:"uptime"`
-	TotalRequests   int64             `json:"total_requests"`
-	AverageLatency  float64           `json:"average_latency_ms"`
-	ActiveQueries   int               `json:"active_queries"`
-	DatabasePool    DatabasePoolStats `json:"database_pool"`
-	Cache           CacheStats        `json:"cache"`
-	LastError       *ErrorInfo        `json:"last_error,omitempty"`
+	Uptime         time.Duration       `json:"uptime"`
+	TotalRequests  int64               `json:"total_requests"`
+	AverageLatency float64             `json:"average_latency_ms"`
+	ActiveQueries  int                 `json:"active_queries"`
+	DatabasePool   DatabasePoolStats   `json:"database_pool"`
+	WritePool      DatabasePoolStats   `json:"write_database_pool"`
+	QueryLatency   []QueryLatencyStats `json:"query_latency"`
+	Cache          CacheStats          `json:"cache"`
+	LastError      *ErrorInfo          `json:"last_error,omitempty"`
+	Integrity      IntegrityStats      `json:"integrity"`
+}
+
+// TableStats summarizes the contents of one table
+type TableStats struct {
+	Table          string                 `json:"table"`
+	Exists         bool                   `json:"exists"`
+	RowCount       int64                  `json:"row_count"`
+	FirstTimestamp *time.Time             `json:"first_timestamp,omitempty"`
+	LastTimestamp  *time.Time             `json:"last_timestamp,omitempty"`
+	Symbols        map[string]SymbolStats `json:"symbols,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+}
+
+// SymbolStats is the per-symbol breakdown within a table
+type SymbolStats struct {
+	RowCount       int64     `json:"row_count"`
+	FirstTimestamp time.Time `json:"first_timestamp"`
+	LastTimestamp  time.Time `json:"last_timestamp"`
+}
+
+// IntegrityStats counts bar problems corrected while serving candles
+type IntegrityStats struct {
+	DuplicateBars  int64 `json:"duplicate_bars"`
+	OutOfOrderBars int64 `json:"out_of_order_bars"`
+}
+
+// IntegrityReport lists duplicate (symbol, timestamp) pairs found in a table
+type IntegrityReport struct {
+	Symbol          string           `json:"symbol"`
+	Table           string           `json:"table"`
+	DuplicateRows   int64            `json:"duplicate_rows"`
+	DuplicateRanges []DuplicateRange `json:"duplicate_ranges"`
+	ScannedAt       time.Time        `json:"scanned_at"`
+}
+
+// DuplicateRange is a contiguous span of timestamps holding duplicate rows
+type DuplicateRange struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Timestamps int       `json:"timestamps"`
+	ExtraRows  int64     `json:"extra_rows"`
+}
+
+// QueryLatencyStats summarizes one labeled query's latency against one table
+type QueryLatencyStats struct {
+	Pool  string  `json:"pool"`
+	Query string  `json:"query"`
+	Table string  `json:"table"`
+	Count int64   `json:"count"`
+	Rows  int64   `json:"rows"`
+	P50Ms float64 `json:"p50_ms"`
+	P95Ms float64 `json:"p95_ms"`
+	P99Ms float64 `json:"p99_ms"`
 }
 
 // DatabasePoolStats shows database connection pool status
@@ -126,17 +590,43 @@ type DatabasePoolStats struct {
 	MaxConnections     int32 `json:"max_connections"`
 	WaitCount          int64 `json:"wait_count"`
 	WaitDuration       int64 `json:"wait_duration_ms"`
+	SlowAcquires       int64 `json:"slow_acquires"`
+	SlowQueries        int64 `json:"slow_queries"`
 }
 
 // CacheStats shows cache performance
 type CacheStats struct {
-	Size        int     `json:"size"`
-	MaxSize     int     `json:"max_size"`
-	Hits        int64   `json:"hits"`
-	Misses      int64   `json:"misses"`
-	HitRate     float64 `json:"hit_rate"`
-	Evictions   int64   `json:"evictions"`
-	MemoryUsage int64   `json:"memory_bytes"`
+	Backend      string  `json:"backend"`
+	Size         int     `json:"size"`
+	MaxSize      int     `json:"max_size"`
+	Hits         int64   `json:"hits"`
+	Misses       int64   `json:"misses"`
+	HitRate      float64 `json:"hit_rate"`
+	Evictions    int64   `json:"evictions"`
+	MemoryUsage  int64   `json:"memory_bytes"`
+	NegativeHits int64   `json:"negative_hits"`
+	ReusedKeys   int     `json:"reused_keys"`
+	OldestEntryS float64 `json:"oldest_entry_seconds"`
+	TooLarge     int64   `json:"too_large"`
+
+	Classes map[string]CacheClassStats  `json:"classes,omitempty"`
+	Windows map[string]CacheWindowStats `json:"windows"`
+}
+
+// CacheWindowStats shows cache activity over a trailing window
+type CacheWindowStats struct {
+	Hits              int64   `json:"hits"`
+	Misses            int64   `json:"misses"`
+	HitRate           float64 `json:"hit_rate"`
+	Evictions         int64   `json:"evictions"`
+	AvgEvictionAgeSec float64 `json:"avg_eviction_age_seconds"`
+}
+
+// CacheClassStats shows occupancy of one resolution quota class
+type CacheClassStats struct {
+	Entries    int   `json:"entries"`
+	Bytes      int64 `json:"bytes"`
+	QuotaBytes int64 `json:"quota_bytes"`
 }
 
 // ErrorInfo provides error details
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var extraFields = []string{
+	"vwap", "tick_count", "avg_spread", "min_spread", "max_spread", "twa_spread",
+	"buy_volume", "sell_volume", "delta", "cumulative_delta", "index",
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestCandleJSONWithoutExtras(t *testing.T) {
+	candle := Candle{
+		Timestamp: time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC),
+		Open:      1.0850,
+		High:      1.0862,
+		Low:       1.0841,
+		Close:     1.0855,
+		Volume:    1234.5,
+	}
+	data, err := json.Marshal(candle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"timestamp", "open", "high", "low", "close", "volume"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("candle has no %s field: %s", field, data)
+		}
+	}
+	// Extras that weren't requested are left out rather than sent as null
+	for _, field := range extraFields {
+		if _, ok := fields[field]; ok {
+			t.Errorf("candle without extras has a %s field: %s", field, data)
+		}
+	}
+
+	var decoded Candle
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, candle) {
+		t.Errorf("round trip = %+v, want %+v", decoded, candle)
+	}
+}
+
+func TestCandleJSONWithExtras(t *testing.T) {
+	candle := Candle{
+		Timestamp:       time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC),
+		Open:            1.0850,
+		High:            1.0862,
+		Low:             1.0841,
+		Close:           1.0855,
+		Volume:          1234.5,
+		VWAP:            ptr(1.0853),
+		TickCount:       ptr(int64(812)),
+		AvgSpread:       ptr(0.00012),
+		MinSpread:       ptr(0.00008),
+		MaxSpread:       ptr(0.00031),
+		TWASpread:       ptr(0.00011),
+		BuyVolume:       ptr(700.25),
+		SellVolume:      ptr(534.25),
+		Delta:           ptr(166.0),
+		CumulativeDelta: ptr(-42.5),
+		Index:           ptr(int64(17)),
+	}
+	data, err := json.Marshal(candle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range extraFields {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("candle has no %s field: %s", field, data)
+		}
+	}
+
+	var decoded Candle
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, candle) {
+		t.Errorf("round trip = %s, want %s", mustJSON(t, decoded), data)
+	}
+}
+
+// Zero values of requested extras are sent, not dropped as unset
+func TestCandleJSONKeepsZeroExtras(t *testing.T) {
+	candle := Candle{Timestamp: time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC), TickCount: ptr(int64(0)), Delta: ptr(0.0)}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(mustJSON(t, candle), &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["tick_count"] != 0.0 || fields["delta"] != 0.0 {
+		t.Errorf("zero extras = tick_count %v, delta %v, want 0 and 0", fields["tick_count"], fields["delta"])
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TradingSession is a forex session as a window of UTC hours. Close is
+// exclusive and may be before Open for sessions spanning midnight.
+type TradingSession struct {
+	Name  string
+	Open  int
+	Close int
+}
+
+// TradingSessions are the sessions candle requests can filter on, with the
+// hours the feeds use for them
+var TradingSessions = []TradingSession{
+	{Name: "SYDNEY", Open: 21, Close: 6},
+	{Name: "TOKYO", Open: 0, Close: 9},
+	{Name: "LONDON", Open: 8, Close: 17},
+	{Name: "NEWYORK", Open: 13, Close: 22},
+}
+
+// Hours returns the UTC hours the session is open in
+func (s TradingSession) Hours() []int {
+	var hours []int
+	for h := s.Open; h != s.Close; h = (h + 1) % 24 {
+		hours = append(hours, h)
+	}
+	return hours
+}
+
+// SessionFilter is the union of the sessions requested via session
+type SessionFilter []TradingSession
+
+// Hours returns the UTC hours any of the sessions is open in, in order
+func (f SessionFilter) Hours() []int {
+	var open [24]bool
+	for _, s := range f {
+		for _, h := range s.Hours() {
+			open[h] = true
+		}
+	}
+	var hours []int
+	for h, ok := range open {
+		if ok {
+			hours = append(hours, h)
+		}
+	}
+	return hours
+}
+
+// SpansMidnight reports whether the sessions' hours run through midnight
+// UTC, so that one session falls on two UTC days
+func (f SessionFilter) SpansMidnight() bool {
+	hours := f.Hours()
+	return len(hours) > 0 && hours[0] == 0 && hours[len(hours)-1] == 23
+}
+
+// Fraction returns the share of the day the sessions cover, 1 without any
+func (f SessionFilter) Fraction() float64 {
+	if len(f) == 0 {
+		return 1
+	}
+	return float64(len(f.Hours())) / 24
+}
+
+// Key returns a stable representation of the filter for cache keys
+func (f SessionFilter) Key() string {
+	if len(f) == 0 {
+		return ""
+	}
+	names := make([]string, len(f))
+	for i, s := range f {
+		names[i] = s.Name
+	}
+	sort.Strings(names)
+	return "session=" + strings.Join(names, ",")
+}
+
+// ParseSessions parses the session parameter, a comma-separated list of
+// session names. "NEW_YORK" is accepted for NEWYORK.
+func (r CandleRequest) ParseSessions() (SessionFilter, error) {
+	var filter SessionFilter
+	if r.Session == "" {
+		return filter, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(r.Session, ",") {
+		name := strings.ReplaceAll(strings.ToUpper(strings.TrimSpace(part)), "_", "")
+		if name == "" || seen[name] {
+			continue
+		}
+		session, ok := tradingSession(name)
+		if !ok {
+			return nil, fmt.Errorf("unsupported session: %s, want LONDON, NEWYORK, TOKYO or SYDNEY", part)
+		}
+		seen[name] = true
+		filter = append(filter, session)
+	}
+
+	return filter, nil
+}
+
+func tradingSession(name string) (TradingSession, bool) {
+	for _, s := range TradingSessions {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return TradingSession{}, false
+}
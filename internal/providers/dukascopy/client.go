@@ -0,0 +1,175 @@
+// Package dukascopy downloads historical tick data from the Dukascopy
+// datafeed.
+package dukascopy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/providers"
+)
+
+// DefaultBaseURL is the public Dukascopy datafeed
+const DefaultBaseURL = "https://datafeed.dukascopy.com/datafeed"
+
+// Name identifies the provider in configuration and fetch job results
+const Name = "dukascopy"
+
+// ErrNoData means Dukascopy has not published ticks for the requested hour,
+// either because the market was closed or the hour isn't available yet
+var ErrNoData = fmt.Errorf("%w: no data published for hour", providers.ErrNoData)
+
+// FetchError is a failure to download an hour, as opposed to the hour
+// having no data
+type FetchError struct {
+	URL        string
+	StatusCode int // zero for transport errors
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("fetch %s: unexpected status %d", e.URL, e.StatusCode)
+	}
+	return fmt.Sprintf("fetch %s: %v", e.URL, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Client downloads and decodes hourly tick files
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	limiter    *providers.Limiter
+}
+
+// NewClient creates a client for the datafeed at baseURL whose downloads
+// stay within limits
+func NewClient(baseURL string, timeout time.Duration, limits providers.Limits) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		httpClient: &http.Client{Timeout: timeout},
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		limiter:    providers.NewLimiter(limits),
+	}
+}
+
+// hourURL builds the URL of an hour's tick file. Dukascopy months are zero-based.
+func (c *Client) hourURL(symbol string, hour time.Time) string {
+	return fmt.Sprintf("%s/%s/%04d/%02d/%02d/%02dh_ticks.bi5",
+		c.baseURL, strings.ToUpper(symbol),
+		hour.Year(), int(hour.Month())-1, hour.Day(), hour.Hour())
+}
+
+// FetchHour downloads and decodes the ticks for one UTC hour. It returns
+// ErrNoData when the hour has no published ticks and a *FetchError when the
+// download itself fails. A 429 or 403 response starts the limiter's
+// cool-down and is returned as a *providers.ThrottledError.
+func (c *Client) FetchHour(ctx context.Context, symbol string, hour time.Time) ([]Tick, error) {
+	hour = hour.UTC().Truncate(time.Hour)
+	url := c.hourURL(symbol, hour)
+
+	release, err := c.limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &FetchError{URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNoData
+	case http.StatusTooManyRequests, http.StatusForbidden:
+		return nil, &providers.ThrottledError{
+			Provider: Name,
+			Until:    c.limiter.Throttle(),
+			Err:      &FetchError{URL: url, StatusCode: resp.StatusCode},
+		}
+	default:
+		return nil, &FetchError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &FetchError{URL: url, Err: err}
+	}
+
+	ticks, err := decodeHour(data, hour, pointValue(symbol))
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", url, err)
+	}
+	if len(ticks) == 0 {
+		return nil, ErrNoData
+	}
+	return ticks, nil
+}
+
+// Name returns the provider name
+func (c *Client) Name() string {
+	return Name
+}
+
+// LimiterStatus reports the client's rate limiting state
+func (c *Client) LimiterStatus() providers.LimiterStatus {
+	return c.limiter.Status()
+}
+
+// SetLimits changes the client's rate limits
+func (c *Client) SetLimits(limits providers.Limits) {
+	c.limiter.SetLimits(limits)
+}
+
+// Capabilities reports that Dukascopy serves ticks for any symbol; symbols
+// it doesn't carry simply have no data
+func (c *Client) Capabilities() providers.Capabilities {
+	return providers.Capabilities{Granularity: providers.GranularityTick}
+}
+
+// FetchTicks downloads every hour in [start, end) and emits its ticks. Hours
+// without data are skipped; ErrNoData is returned only if none had any.
+func (c *Client) FetchTicks(ctx context.Context, symbol string, start, end time.Time, emit func(providers.Tick) error) error {
+	found := false
+	for hour := start.UTC().Truncate(time.Hour); hour.Before(end); hour = hour.Add(time.Hour) {
+		ticks, err := c.FetchHour(ctx, symbol, hour)
+		if errors.Is(err, ErrNoData) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, tick := range ticks {
+			if tick.Timestamp.Before(start) || !tick.Timestamp.Before(end) {
+				continue
+			}
+			found = true
+			if err := emit(tick); err != nil {
+				return err
+			}
+		}
+	}
+	if !found {
+		return ErrNoData
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package dukascopy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/providers"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// recordSize is the length of one tick record in a decompressed .bi5 file
+const recordSize = 20
+
+// Tick is one decoded Dukascopy quote
+type Tick = providers.Tick
+
+// decodeHour decompresses a .bi5 file and decodes its tick records. Each
+// record is big-endian: milliseconds into the hour, ask and bid as integer
+// points, then ask and bid volume as float32.
+func decodeHour(data []byte, hour time.Time, pointValue float64) ([]Tick, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	r, err := lzma.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lzma stream: %w", err)
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	if len(raw)%recordSize != 0 {
+		return nil, fmt.Errorf("truncated tick data: %d bytes", len(raw))
+	}
+
+	ticks := make([]Tick, 0, len(raw)/recordSize)
+	for off := 0; off < len(raw); off += recordSize {
+		rec := raw[off : off+recordSize]
+		ms := binary.BigEndian.Uint32(rec[0:4])
+		ask := binary.BigEndian.Uint32(rec[4:8])
+		bid := binary.BigEndian.Uint32(rec[8:12])
+		askVol := math.Float32frombits(binary.BigEndian.Uint32(rec[12:16]))
+		bidVol := math.Float32frombits(binary.BigEndian.Uint32(rec[16:20]))
+
+		ticks = append(ticks, Tick{
+			Timestamp: hour.Add(time.Duration(ms) * time.Millisecond),
+			Bid:       float64(bid) / pointValue,
+			Ask:       float64(ask) / pointValue,
+			BidVolume: float64(bidVol),
+			AskVolume: float64(askVol),
+		})
+	}
+	return ticks, nil
+}
+
+// pointValue returns the integer scale Dukascopy uses for a symbol's prices
+func pointValue(symbol string) float64 {
+	switch {
+	case strings.HasSuffix(symbol, "JPY"), strings.HasPrefix(symbol, "XAU"), strings.HasPrefix(symbol, "XAG"):
+		return 1e3
+	default:
+		return 1e5
+	}
+}
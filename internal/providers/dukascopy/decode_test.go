@@ -0,0 +1,116 @@
+package dukascopy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/providers"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// fixtureHour is the hour testdata/12h_ticks.bi5 holds EURUSD ticks for
+var fixtureHour = time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+
+// fixtureTicks are the records in testdata/12h_ticks.bi5, the first and last
+// a millisecond-offset apart from the hour's edges
+var fixtureTicks = []Tick{
+	{Timestamp: fixtureHour.Add(1500 * time.Millisecond), Bid: 1.08651, Ask: 1.08654, BidVolume: 0.75, AskVolume: 1.5},
+	{Timestamp: fixtureHour.Add(60250 * time.Millisecond), Bid: 1.08655, Ask: 1.0866, BidVolume: 3, AskVolume: 2.25},
+	{Timestamp: fixtureHour.Add(time.Hour - time.Millisecond), Bid: 1.08668, Ask: 1.0867, BidVolume: 1.25, AskVolume: 0.5},
+}
+
+func readFixture(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/12h_ticks.bi5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeHour(t *testing.T) {
+	ticks, err := decodeHour(readFixture(t), fixtureHour, pointValue("EURUSD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ticks, fixtureTicks) {
+		t.Errorf("decoded %+v, want %+v", ticks, fixtureTicks)
+	}
+
+	// JPY pairs and metals are quoted in thousandths
+	ticks, err = decodeHour(readFixture(t), fixtureHour, pointValue("USDJPY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticks[0].Bid != 108.651 || ticks[0].Ask != 108.654 {
+		t.Errorf("USDJPY first tick %v/%v, want 108.651/108.654", ticks[0].Bid, ticks[0].Ask)
+	}
+}
+
+func TestDecodeHourEmpty(t *testing.T) {
+	ticks, err := decodeHour(nil, fixtureHour, 1e5)
+	if err != nil || ticks != nil {
+		t.Errorf("decoded %v, %v from an empty file, want no ticks and no error", ticks, err)
+	}
+}
+
+func TestDecodeHourRejectsBadData(t *testing.T) {
+	var truncated bytes.Buffer
+	w, err := lzma.NewWriter(&truncated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(make([]byte, recordSize+3))
+	w.Close()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not lzma", []byte("<html>not found</html>")},
+		{"partial record", truncated.Bytes()},
+	}
+	for _, tt := range tests {
+		if ticks, err := decodeHour(tt.data, fixtureHour, 1e5); err == nil {
+			t.Errorf("%s: decoded %d ticks, want an error", tt.name, len(ticks))
+		}
+	}
+}
+
+func TestFetchHour(t *testing.T) {
+	fixture := readFixture(t)
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path != "/EURUSD/2024/02/04/12h_ticks.bi5" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(fixture)
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, time.Second, providers.Limits{})
+
+	// Dukascopy months are zero-based, so March is 02
+	ticks, err := client.FetchHour(context.Background(), "eurusd", fixtureHour.Add(25*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ticks, fixtureTicks) {
+		t.Errorf("fetched %+v, want %+v", ticks, fixtureTicks)
+	}
+
+	if _, err := client.FetchHour(context.Background(), "EURUSD", fixtureHour.Add(time.Hour)); !errors.Is(err, ErrNoData) || !errors.Is(err, providers.ErrNoData) {
+		t.Errorf("missing hour: err = %v, want ErrNoData", err)
+	}
+	if want := []string{"/EURUSD/2024/02/04/12h_ticks.bi5", "/EURUSD/2024/02/04/13h_ticks.bi5"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("requested %q, want %q", paths, want)
+	}
+}
@@ -0,0 +1,168 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/market"
+)
+
+// tickTable is the QuestDB table ticks are written to
+const tickTable = "market_data_v2"
+
+// HourResult is the outcome of importing one hour
+type HourResult struct {
+	Hour     time.Time `json:"hour"`
+	Ticks    int       `json:"ticks"`
+	NoData   bool      `json:"no_data,omitempty"`
+	Provider string    `json:"provider,omitempty"` // provider that filled the hour
+}
+
+// Importer fetches hours from a chain of providers and writes them to QuestDB
+type Importer struct {
+	ilpAddr  string
+	calendar *market.Calendar // fills the market_open column
+}
+
+// NewImporter creates an importer writing to the ILP endpoint at ilpAddr
+func NewImporter(ilpAddr string, calendar *market.Calendar) *Importer {
+	return &Importer{ilpAddr: ilpAddr, calendar: calendar}
+}
+
+// Import fetches every hour in [start, end) for symbol and writes the ticks.
+// Each hour is taken from the first provider in chain that has data for it.
+// Hours no provider has data for are reported rather than treated as errors;
+// any other failure stops the import and returns the hours completed so far.
+// progress, if set, is called after each hour. Cancelling ctx stops the
+// import between hours; an hour whose ticks are being written always
+// finishes so no partial hour is left behind.
+func (im *Importer) Import(ctx context.Context, chain []Provider, symbol string, start, end time.Time, progress func(HourResult)) ([]HourResult, error) {
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(im.ilpAddr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ILP at %s: %w", im.ilpAddr, err)
+	}
+	// Writes must not be interrupted mid-batch, so they ignore cancellation
+	writeCtx := context.WithoutCancel(ctx)
+	defer sender.Close(writeCtx)
+
+	results := make([]HourResult, 0, int(end.Sub(start).Hours())+1)
+	for hour := start.UTC().Truncate(time.Hour); hour.Before(end); hour = hour.Add(time.Hour) {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		ticks, provider, err := fetchHour(ctx, chain, symbol, hour)
+		if errors.Is(err, ErrNoData) {
+			result := HourResult{Hour: hour, NoData: true}
+			results = append(results, result)
+			if progress != nil {
+				progress(result)
+			}
+			continue
+		}
+		if err != nil {
+			return results, err
+		}
+
+		if err := im.writeTicks(writeCtx, sender, symbol, ticks); err != nil {
+			return results, fmt.Errorf("failed to write %s %s: %w", symbol, hour.Format(time.RFC3339), err)
+		}
+		result := HourResult{Hour: hour, Ticks: len(ticks), Provider: provider}
+		results = append(results, result)
+		if progress != nil {
+			progress(result)
+		}
+
+		log.Debug().
+			Str("symbol", symbol).
+			Str("provider", provider).
+			Time("hour", hour).
+			Int("ticks", len(ticks)).
+			Msg("Imported hour")
+	}
+
+	return results, nil
+}
+
+// fetchHour takes one hour from the first provider in the chain with data
+// for it. A provider that fails is passed over for the next; if none has the
+// hour, the first failure is returned so the hour is retried rather than
+// recorded as empty.
+func fetchHour(ctx context.Context, chain []Provider, symbol string, hour time.Time) ([]Tick, string, error) {
+	var firstErr error
+	for _, provider := range chain {
+		var ticks []Tick
+		err := provider.FetchTicks(ctx, symbol, hour, hour.Add(time.Hour), func(tick Tick) error {
+			ticks = append(ticks, tick)
+			return nil
+		})
+		if err == nil {
+			return ticks, provider.Name(), nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", err
+		}
+		if errors.Is(err, ErrNoData) {
+			continue
+		}
+
+		log.Warn().
+			Err(err).
+			Str("provider", provider.Name()).
+			Str("symbol", symbol).
+			Time("hour", hour).
+			Msg("Provider failed, trying the next one")
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if firstErr != nil {
+		return nil, "", firstErr
+	}
+	return nil, "", ErrNoData
+}
+
+// writeTicks sends one hour of ticks in the market_data_v2 layout and flushes
+func (im *Importer) writeTicks(ctx context.Context, sender qdb.LineSender, symbol string, ticks []Tick) error {
+	for _, tick := range ticks {
+		ts := tick.Timestamp
+		err := sender.
+			Table(tickTable).
+			Symbol("symbol", symbol).
+			Float64Column("bid", tick.Bid).
+			Float64Column("ask", tick.Ask).
+			Float64Column("price", (tick.Bid+tick.Ask)/2).
+			Float64Column("spread", tick.Ask-tick.Bid).
+			Float64Column("volume", tick.BidVolume+tick.AskVolume).
+			Float64Column("bid_volume", tick.BidVolume).
+			Float64Column("ask_volume", tick.AskVolume).
+			Int64Column("hour_of_day", int64(ts.Hour())).
+			Int64Column("day_of_week", int64(ts.Weekday())).
+			StringColumn("trading_session", tradingSession(ts)).
+			BoolColumn("market_open", im.calendar.Open(symbol, ts)).
+			At(ctx, ts)
+		if err != nil {
+			return err
+		}
+	}
+	return sender.Flush(ctx)
+}
+
+// tradingSession names the main forex session active at a UTC time
+func tradingSession(ts time.Time) string {
+	switch h := ts.Hour(); {
+	case h >= 7 && h < 12:
+		return "LONDON"
+	case h >= 12 && h < 16:
+		return "LONDON_NY_OVERLAP"
+	case h >= 16 && h < 21:
+		return "NEW_YORK"
+	default:
+		return "ASIAN"
+	}
+}
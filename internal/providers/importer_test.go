@@ -0,0 +1,234 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/market"
+)
+
+// update rewrites the golden files from the current output:
+//
+//	go test ./internal/providers -run Import -update
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// fakeProvider serves fixed ticks by hour, fails the hours in errs and
+// records the hours asked for
+type fakeProvider struct {
+	name  string
+	ticks map[time.Time][]Tick
+	errs  map[time.Time]error
+	calls []time.Time
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeProvider) Capabilities() Capabilities {
+	return Capabilities{Granularity: GranularityTick}
+}
+
+func (p *fakeProvider) FetchTicks(ctx context.Context, symbol string, start, end time.Time, emit func(Tick) error) error {
+	p.calls = append(p.calls, start)
+	if err := p.errs[start]; err != nil {
+		return err
+	}
+	ticks := p.ticks[start]
+	if len(ticks) == 0 {
+		return ErrNoData
+	}
+	for _, tick := range ticks {
+		if err := emit(tick); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ilpCapture accepts one ILP connection and returns everything written to it
+// once the sender closes
+func ilpCapture(t *testing.T) (string, <-chan []byte) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+	return listener.Addr().String(), received
+}
+
+func testCalendar(t *testing.T) *market.Calendar {
+	calendar, err := market.NewCalendar(config.MarketConfig{WeeklyClose: "Fri 22:00", WeeklyOpen: "Sun 22:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return calendar
+}
+
+// The ILP lines are what lands in market_data_v2, so they're pinned by a
+// golden file
+func TestImportWritesILP(t *testing.T) {
+	addr, received := ilpCapture(t)
+	hour := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	provider := &fakeProvider{name: "fake", ticks: map[time.Time][]Tick{
+		hour: {
+			{Timestamp: hour.Add(1500 * time.Millisecond), Bid: 1.08651, Ask: 1.08654, BidVolume: 0.75, AskVolume: 1.5},
+			{Timestamp: hour.Add(time.Hour - time.Millisecond), Bid: 1.08668, Ask: 1.0867, BidVolume: 1.25, AskVolume: 0.5},
+		},
+	}}
+
+	results, err := NewImporter(addr, testCalendar(t)).Import(context.Background(), []Provider{provider}, "EURUSD", hour, hour.Add(2*time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HourResult{
+		{Hour: hour, Ticks: 2, Provider: "fake"},
+		{Hour: hour.Add(time.Hour), NoData: true},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results %+v, want %+v", results, want)
+	}
+
+	select {
+	case got := <-received:
+		checkGolden(t, "import.golden.ilp", got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no ILP connection closed")
+	}
+}
+
+// checkGolden compares got with testdata/name, or rewrites it with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s changed; if the change is intended, run with -update\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestFetchHourFallsBack(t *testing.T) {
+	hour := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	tick := Tick{Timestamp: hour, Bid: 1.0865, Ask: 1.0866}
+	down := errors.New("connection refused")
+	throttled := &ThrottledError{Provider: "failing", Err: down}
+
+	hasData := func(name string) *fakeProvider {
+		return &fakeProvider{name: name, ticks: map[time.Time][]Tick{hour: {tick}}}
+	}
+	noData := func(name string) *fakeProvider {
+		return &fakeProvider{name: name}
+	}
+	failing := func(name string, err error) *fakeProvider {
+		return &fakeProvider{name: name, errs: map[time.Time]error{hour: err}}
+	}
+
+	tests := []struct {
+		name     string
+		chain    []*fakeProvider
+		provider string // provider that should fill the hour
+		err      error
+		asked    int // providers asked, in chain order
+	}{
+		{"first with data wins", []*fakeProvider{hasData("a"), hasData("b")}, "a", nil, 1},
+		{"no data passes to the next", []*fakeProvider{noData("a"), hasData("b")}, "b", nil, 2},
+		{"failure passes to the next", []*fakeProvider{failing("a", down), noData("b"), hasData("c")}, "c", nil, 3},
+		{"throttling passes to the next", []*fakeProvider{failing("a", throttled), hasData("b")}, "b", nil, 2},
+		{"no provider has data", []*fakeProvider{noData("a"), noData("b")}, "", ErrNoData, 2},
+		// A failure means the hour may have data, so it's retried rather
+		// than recorded as empty
+		{"failure outranks no data", []*fakeProvider{noData("a"), failing("b", down), failing("c", throttled)}, "", down, 3},
+		{"empty chain", nil, "", ErrNoData, 0},
+	}
+	for _, tt := range tests {
+		chain := make([]Provider, len(tt.chain))
+		for i, p := range tt.chain {
+			chain[i] = p
+		}
+
+		ticks, provider, err := fetchHour(context.Background(), chain, "EURUSD", hour)
+		if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+		}
+		if provider != tt.provider {
+			t.Errorf("%s: filled by %q, want %q", tt.name, provider, tt.provider)
+		}
+		if tt.provider != "" && !reflect.DeepEqual(ticks, []Tick{tick}) {
+			t.Errorf("%s: ticks %+v, want the provider's", tt.name, ticks)
+		}
+		for i, p := range tt.chain {
+			if asked := len(p.calls) > 0; asked != (i < tt.asked) {
+				t.Errorf("%s: %s asked %t, want only the first %d asked", tt.name, p.name, asked, tt.asked)
+			}
+		}
+	}
+}
+
+// A canceled import stops at the provider that saw the cancellation
+func TestFetchHourStopsWhenCanceled(t *testing.T) {
+	hour := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	first := &fakeProvider{name: "a", errs: map[time.Time]error{hour: context.Canceled}}
+	second := &fakeProvider{name: "b", ticks: map[time.Time][]Tick{hour: {{Timestamp: hour}}}}
+
+	if _, _, err := fetchHour(ctx, []Provider{first, second}, "EURUSD", hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want the cancellation", err)
+	}
+	if len(second.calls) != 0 {
+		t.Error("fell back to the next provider after cancellation")
+	}
+}
+
+func TestTradingSession(t *testing.T) {
+	tests := []struct {
+		hour int
+		want string
+	}{
+		{0, "ASIAN"},
+		{6, "ASIAN"},
+		{7, "LONDON"},
+		{11, "LONDON"},
+		{12, "LONDON_NY_OVERLAP"},
+		{15, "LONDON_NY_OVERLAP"},
+		{16, "NEW_YORK"},
+		{20, "NEW_YORK"},
+		{21, "ASIAN"},
+	}
+	for _, tt := range tests {
+		if got := tradingSession(time.Date(2024, 3, 4, tt.hour, 30, 0, 0, time.UTC)); got != tt.want {
+			t.Errorf("%02d:30: session %s, want %s", tt.hour, got, tt.want)
+		}
+	}
+}
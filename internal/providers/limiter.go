@@ -0,0 +1,167 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrThrottled means a provider refused requests for being hit too hard
+var ErrThrottled = errors.New("provider throttled requests")
+
+// ThrottledError is a request the provider refused for rate limiting. The
+// provider's limiter holds further requests until Until.
+type ThrottledError struct {
+	Provider string
+	Until    time.Time
+	Err      error
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s throttled requests, cooling down until %s: %v", e.Provider, e.Until.Format(time.RFC3339), e.Err)
+}
+
+func (e *ThrottledError) Unwrap() []error {
+	return []error{ErrThrottled, e.Err}
+}
+
+// Limits bound how hard a provider is hit
+type Limits struct {
+	RequestsPerSecond float64       // 0 disables the rate limit
+	MaxConcurrent     int           // downloads in flight at once; 0 is unlimited
+	Cooldown          time.Duration // pause after the provider signals throttling
+}
+
+// LimiterStatus reports a limiter's settings and current state
+type LimiterStatus struct {
+	RequestsPerSecond float64    `json:"requests_per_second"`
+	MaxConcurrent     int        `json:"max_concurrent"`
+	Cooldown          string     `json:"cooldown"`
+	InFlight          int        `json:"in_flight"`
+	Throttles         int64      `json:"throttles"` // cool-downs since startup
+	ThrottledUntil    *time.Time `json:"throttled_until,omitempty"`
+}
+
+// Limited is implemented by providers that rate limit their requests
+type Limited interface {
+	LimiterStatus() LimiterStatus
+	SetLimits(limits Limits)
+}
+
+// Limiter spaces a provider's requests, caps how many run at once and holds
+// them all during a cool-down after the provider throttles us
+type Limiter struct {
+	mu        sync.Mutex
+	limits    Limits
+	interval  time.Duration // minimum spacing between request starts
+	slots     chan struct{} // nil when concurrency is unlimited
+	next      time.Time     // earliest start of the next request
+	coolUntil time.Time
+	throttles int64
+}
+
+// NewLimiter creates a limiter enforcing limits
+func NewLimiter(limits Limits) *Limiter {
+	l := &Limiter{}
+	l.SetLimits(limits)
+	return l
+}
+
+// SetLimits replaces the limits. Requests already in flight finish under
+// the old concurrency cap and aren't counted against the new one.
+func (l *Limiter) SetLimits(limits Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limits = limits
+	l.interval = 0
+	if limits.RequestsPerSecond > 0 {
+		l.interval = time.Duration(float64(time.Second) / limits.RequestsPerSecond)
+	}
+	l.slots = nil
+	if limits.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+}
+
+// Acquire waits until a request may start and returns the function that
+// ends it. It returns ctx's error if ctx ends first.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	l.mu.Lock()
+	slots := l.slots
+	l.mu.Unlock()
+
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if slots != nil {
+			<-slots
+		}
+	}
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		start := now
+		if l.next.After(start) {
+			start = l.next
+		}
+		if l.coolUntil.After(start) {
+			start = l.coolUntil
+		}
+		if !start.After(now) {
+			l.next = now.Add(l.interval)
+			l.mu.Unlock()
+			return release, nil
+		}
+		l.mu.Unlock()
+
+		// A cool-down may begin while waiting, so check again afterwards
+		timer := time.NewTimer(start.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Throttle starts a cool-down and returns when it ends
+func (l *Limiter) Throttle() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(l.limits.Cooldown)
+	if until.After(l.coolUntil) {
+		l.coolUntil = until
+	}
+	l.throttles++
+	return l.coolUntil
+}
+
+// Status returns the limiter's settings and current state
+func (l *Limiter) Status() LimiterStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status := LimiterStatus{
+		RequestsPerSecond: l.limits.RequestsPerSecond,
+		MaxConcurrent:     l.limits.MaxConcurrent,
+		Cooldown:          l.limits.Cooldown.String(),
+		InFlight:          len(l.slots),
+		Throttles:         l.throttles,
+	}
+	if until := l.coolUntil; until.After(time.Now()) {
+		status.ThrottledUntil = &until
+	}
+	return status
+}
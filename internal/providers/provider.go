@@ -0,0 +1,73 @@
+// Package providers defines the historical data sources ticks are fetched
+// from and imports their ticks into QuestDB over ILP.
+package providers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/market"
+)
+
+// ErrNoData means a provider has no ticks for the requested range, either
+// because the market was closed or the provider doesn't carry it
+var ErrNoData = errors.New("provider has no data for range")
+
+// Granularities a provider can deliver
+const (
+	GranularityTick   = "tick"
+	GranularityMinute = "1m"
+)
+
+// Tick is one quote from a provider
+type Tick struct {
+	Timestamp time.Time
+	Bid       float64
+	Ask       float64
+	BidVolume float64
+	AskVolume float64
+}
+
+// Capabilities describe what a provider can serve
+type Capabilities struct {
+	Granularity  string              `json:"granularity"`
+	Symbols      []string            `json:"symbols,omitempty"`       // symbols served; empty means any
+	AssetClasses []market.AssetClass `json:"asset_classes,omitempty"` // asset classes served; empty means any
+}
+
+// Supports reports whether the provider serves a symbol
+func (c Capabilities) Supports(symbol string) bool {
+	if len(c.AssetClasses) > 0 {
+		class := market.ClassOf(symbol)
+		found := false
+		for _, served := range c.AssetClasses {
+			if served == class {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(c.Symbols) == 0 {
+		return true
+	}
+	for _, served := range c.Symbols {
+		if strings.EqualFold(served, symbol) {
+			return true
+		}
+	}
+	return false
+}
+
+// Provider is a historical data source. FetchTicks calls emit for each tick
+// in [start, end) in time order and returns ErrNoData when the range has
+// none. An error from emit stops the fetch and is returned.
+type Provider interface {
+	Name() string
+	Capabilities() Capabilities
+	FetchTicks(ctx context.Context, symbol string, start, end time.Time, emit func(Tick) error) error
+}
@@ -0,0 +1,91 @@
+// Package quality scores how completely a trading day's ticks were captured
+package quality
+
+import (
+	"math"
+	"time"
+)
+
+// SparseHourTicks is the tick count below which a covered hour counts as
+// sparse. A liquid forex hour has thousands of ticks; a handful usually means
+// the download was cut short.
+const SparseHourTicks = 60
+
+// sparsePenalty is the most a day's score loses when every covered hour is
+// sparse
+const sparsePenalty = 20
+
+// Hour is the tick count of one hour of a day
+type Hour struct {
+	Start time.Time
+	Ticks int64
+	First time.Time // earliest tick in the hour
+	Last  time.Time // latest tick in the hour
+}
+
+// Day is the quality of one symbol's ticks on one UTC day
+type Day struct {
+	Date          time.Time  `json:"date"`
+	TickCount     int64      `json:"tick_count"`
+	FirstTick     *time.Time `json:"first_tick"`
+	LastTick      *time.Time `json:"last_tick"`
+	ExpectedHours int        `json:"expected_hours"` // trading hours in the day
+	CoveredHours  int        `json:"covered_hours"`  // trading hours with at least one tick
+	SparseHours   int        `json:"sparse_hours"`   // covered hours under SparseHourTicks
+	Coverage      float64    `json:"coverage"`       // CoveredHours / ExpectedHours
+	Score         int        `json:"score"`          // 0 to 100
+	Complete      bool       `json:"is_complete"`
+}
+
+// Assess scores a day from its expected trading hours and the hours that
+// had ticks. Ticks outside the expected hours count towards the totals but
+// not the coverage. A day without trading hours scores 100 and is complete.
+func Assess(date time.Time, expected []time.Time, hours []Hour) Day {
+	day := Day{Date: date.UTC().Truncate(24 * time.Hour), ExpectedHours: len(expected)}
+
+	byStart := make(map[time.Time]Hour, len(hours))
+	for _, hour := range hours {
+		if hour.Ticks <= 0 {
+			continue
+		}
+		byStart[hour.Start.UTC()] = hour
+		day.TickCount += hour.Ticks
+
+		first, last := hour.First, hour.Last
+		if day.FirstTick == nil || first.Before(*day.FirstTick) {
+			day.FirstTick = &first
+		}
+		if day.LastTick == nil || last.After(*day.LastTick) {
+			day.LastTick = &last
+		}
+	}
+
+	for _, start := range expected {
+		hour, ok := byStart[start.UTC()]
+		if !ok {
+			continue
+		}
+		day.CoveredHours++
+		if hour.Ticks < SparseHourTicks {
+			day.SparseHours++
+		}
+	}
+
+	if day.ExpectedHours == 0 {
+		day.Coverage, day.Score, day.Complete = 1, 100, true
+		return day
+	}
+
+	day.Coverage = float64(day.CoveredHours) / float64(day.ExpectedHours)
+	day.Complete = day.CoveredHours == day.ExpectedHours
+	day.Score = Score(day.Coverage, float64(day.SparseHours)/float64(day.ExpectedHours))
+	return day
+}
+
+// Score combines the fraction of trading hours covered and the fraction that
+// were sparse into a 0 to 100 score: coverage sets the score and sparse hours
+// take up to sparsePenalty points off it
+func Score(coverage, sparse float64) int {
+	score := 100*coverage - sparsePenalty*sparse
+	return int(math.Round(math.Max(0, math.Min(100, score))))
+}
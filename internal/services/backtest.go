@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/backtest"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// backtestTimeout bounds fetching a backtest's candles and running it
+const backtestTimeout = 10 * time.Second
+
+// RunBacktest runs the request's strategy over the symbol's candles, fetched
+// and cached as /candles does. Every candle in the range must fit in one
+// response, so a range past the resolution's max points fails with
+// ErrRangeTooLarge rather than testing part of it; too few candles for the
+// strategy fail with ErrInsufficientData and a run past backtestTimeout with
+// ErrTimeout. The strategy must already have passed backtest.Validate.
+func (v *ViewportService) RunBacktest(ctx context.Context, req models.BacktestRequest) (*models.BacktestResponse, error) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, backtestTimeout)
+	defer cancel()
+
+	candles, err := v.GetSmartCandles(ctx, models.CandleRequest{
+		Symbol:    req.Symbol,
+		Timeframe: req.Timeframe,
+		Start:     req.Start,
+		End:       req.End,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !candles.Metadata.DataComplete {
+		return nil, fmt.Errorf("%w: backtests need every candle in the range, %s is limited to %d, narrow the range or use a longer timeframe",
+			ErrRangeTooLarge, candles.Resolution, candles.Metadata.MaxPoints)
+	}
+
+	result, err := backtest.Run(ctx, candles.Candles, req.Strategy)
+	switch {
+	case errors.Is(err, backtest.ErrNotEnoughBars):
+		return nil, fmt.Errorf("%w: %w, %s has %d at %s between %s and %s", ErrInsufficientData, err,
+			req.Symbol, len(candles.Candles), candles.Resolution,
+			req.Start.Format(time.RFC3339), req.End.Format(time.RFC3339))
+	case errors.Is(err, backtest.ErrTooManyBars):
+		return nil, fmt.Errorf("%w: %w", ErrRangeTooLarge, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return nil, fmt.Errorf("%w: backtest ran past %s", ErrTimeout, backtestTimeout)
+	case err != nil:
+		return nil, err
+	}
+
+	response := &models.BacktestResponse{
+		Symbol:     req.Symbol,
+		Resolution: candles.Resolution,
+		Start:      req.Start,
+		End:        req.End,
+		Strategy:   req.Strategy,
+		Bars:       len(candles.Candles),
+		Trades:     result.Trades,
+		Equity:     result.Equity,
+		Stats:      result.Stats,
+		Metadata:   candles.Metadata,
+	}
+	response.Metadata.QueryTimeMs = time.Since(start).Milliseconds()
+	response.Metadata.NextURL = ""
+	return response, nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/config"
+)
+
+// Cache is implemented by the in-memory CacheService and the Redis-backed
+// RedisCache. Backends that serialize values return them from Get as raw
+// JSON ([]byte); TypedCache decodes those into the concrete type.
+type Cache interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, data interface{}, ttl time.Duration, tags ...string)
+	Delete(key string)
+	InvalidatePrefix(prefix string) int
+	InvalidateTag(tag string) int
+	GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func() (interface{}, error), tags ...string) (interface{}, bool, error)
+	GetStats() CacheStats
+	ResetStats()
+}
+
+// Reconfigurable is implemented by caches whose budgets and TTL settings
+// can change while running
+type Reconfigurable interface {
+	Reconfigure(cfg config.CacheConfig)
+}
+
+// SymbolTag is the tag attached to every entry derived from a symbol's data
+func SymbolTag(symbol string) string {
+	return "symbol:" + symbol
+}
+
+// ResolutionTag is the tag attached to every entry at a resolution
+func ResolutionTag(resolution string) string {
+	return "resolution:" + resolution
+}
+
+// NewCache creates the cache backend selected by CacheConfig.Backend
+func NewCache(cfg config.CacheConfig) (Cache, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		cache := NewCacheService(cfg)
+		cache.StartCleanupRoutine()
+		return cache, nil
+	case "redis":
+		return NewRedisCache(cfg)
+	default:
+		return nil, fmt.Errorf("unknown cache backend: %s", cfg.Backend)
+	}
+}
+
+// GenerateCacheKey creates a cache key from parameters. Extras distinguish
+// requests for the same range that return different columns.
+func GenerateCacheKey(symbol, resolution string, start, end time.Time, extras ...string) string {
+	key := fmt.Sprintf("%s:%s:%d:%d", symbol, resolution, start.Unix(), end.Unix())
+	for _, extra := range extras {
+		if extra != "" {
+			key += ":" + extra
+		}
+	}
+	hash := md5.Sum([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// loadGroup deduplicates concurrent loads of the same key
+type loadGroup struct {
+	mu       sync.Mutex
+	inflight map[string]*inflightLoad
+}
+
+// inflightLoad tracks a loader running for a key so concurrent callers can wait on it
+type inflightLoad struct {
+	done chan struct{}
+	data interface{}
+	err  error
+}
+
+// getOrLoad consults get, then runs loader once per key across concurrent
+// callers, storing successful non-nil results with set. Waiters give up when
+// ctx is done. It reports whether get found the value; callers that waited
+// on another's load did not.
+func (g *loadGroup) getOrLoad(
+	ctx context.Context,
+	key string,
+	get func(string) (interface{}, bool),
+	set func(string, interface{}),
+	loader func() (interface{}, error),
+) (interface{}, bool, error) {
+	if data, found := get(key); found {
+		return data, true, nil
+	}
+
+	g.mu.Lock()
+	if g.inflight == nil {
+		g.inflight = make(map[string]*inflightLoad)
+	}
+	if call, running := g.inflight[key]; running {
+		g.mu.Unlock()
+
+		select {
+		case <-call.done:
+			return call.data, false, call.err
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+
+	call := &inflightLoad{done: make(chan struct{})}
+	g.inflight[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.inflight, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.data, call.err = loader()
+	if call.err == nil && call.data != nil {
+		set(key, call.data)
+	}
+
+	return call.data, false, call.err
+}
+
+// negativeTag marks cached empty results
+const negativeTag = "negative"
+
+// emptyResult is implemented by cached values that can represent "no data"
+type emptyResult interface {
+	IsEmpty() bool
+}
+
+// isNegative reports whether data is an empty result
+func isNegative(data interface{}) bool {
+	e, ok := data.(emptyResult)
+	return ok && e.IsEmpty()
+}
+
+// negativeEntry adjusts ttl and tags for an empty result so it expires on the
+// short negative TTL and can be counted on later hits
+func negativeEntry(ttl, negativeTTL time.Duration, tags []string) (time.Duration, []string) {
+	if negativeTTL > 0 && negativeTTL < ttl {
+		ttl = negativeTTL
+	}
+	return ttl, append(tags[:len(tags):len(tags)], negativeTag)
+}
+
+// jitterTTL randomizes ttl by up to ±fraction so keys written together don't
+// all expire in the same instant
+func jitterTTL(ttl time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || ttl <= 0 {
+		return ttl
+	}
+	offset := (rand.Float64()*2 - 1) * fraction * float64(ttl)
+	return ttl + time.Duration(offset)
+}
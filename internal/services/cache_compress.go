@@ -0,0 +1,49 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// compressedValue is a cached value stored as gzipped JSON. It is inflated
+// back to raw JSON on read, which TypedCache decodes into its value type.
+type compressedValue struct {
+	data []byte
+}
+
+// compressValue gzips the JSON encoding of data
+func compressValue(data interface{}) (compressedValue, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return compressedValue{}, fmt.Errorf("failed to encode cache value: %w", err)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(payload); err != nil {
+		return compressedValue{}, fmt.Errorf("failed to compress cache value: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return compressedValue{}, fmt.Errorf("failed to compress cache value: %w", err)
+	}
+
+	return compressedValue{data: buf.Bytes()}, nil
+}
+
+// inflate returns the raw JSON held by a compressed value
+func (v compressedValue) inflate() ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(v.data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress cache value: %w", err)
+	}
+	defer zr.Close()
+
+	payload, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress cache value: %w", err)
+	}
+	return payload, nil
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"sort"
+	"time"
+)
+
+// CacheInspector is implemented by cache backends that can list their
+// entries for debugging. Only the in-memory cache supports it.
+type CacheInspector interface {
+	Entries(tag string, offset, limit int) ([]CacheEntryInfo, int)
+	Entry(key string) (CacheEntryInfo, bool)
+}
+
+// CacheEntryInfo describes a cached entry without its payload
+type CacheEntryInfo struct {
+	Key        string    `json:"key"`
+	Tags       []string  `json:"tags"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastAccess time.Time `json:"last_access"`
+	SizeBytes  int64     `json:"size_bytes"`
+	Hits       int64     `json:"hits"`
+	Negative   bool      `json:"negative"`
+	Expired    bool      `json:"expired"`
+}
+
+// Entries lists entries sorted by key, optionally restricted to a tag, and
+// returns one page along with the total number of matches. Shards are
+// snapshotted one at a time, so the listing is not a single point in time.
+func (c *CacheService) Entries(tag string, offset, limit int) ([]CacheEntryInfo, int) {
+	now := c.now()
+	all := make([]CacheEntryInfo, 0)
+	for _, s := range c.shards {
+		s.mu.Lock()
+		if tag != "" {
+			for key := range s.tagIndex[tag] {
+				if elem, ok := s.items[key]; ok {
+					all = append(all, entryInfo(elem.Value.(*CacheEntry), now))
+				}
+			}
+		} else {
+			for _, elem := range s.items {
+				all = append(all, entryInfo(elem.Value.(*CacheEntry), now))
+			}
+		}
+		s.mu.Unlock()
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Key < all[j].Key
+	})
+
+	total := len(all)
+	if offset >= total {
+		return []CacheEntryInfo{}, total
+	}
+	all = all[offset:]
+	if limit > 0 && limit < len(all) {
+		all = all[:limit]
+	}
+	return all, total
+}
+
+// Entry returns the metadata for one key
+func (c *CacheService) Entry(key string) (CacheEntryInfo, bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		return CacheEntryInfo{}, false
+	}
+	return entryInfo(elem.Value.(*CacheEntry), c.now()), true
+}
+
+// entryInfo copies an entry's metadata. Must be called with the lock held.
+func entryInfo(entry *CacheEntry, now time.Time) CacheEntryInfo {
+	return CacheEntryInfo{
+		Key:        entry.Key,
+		Tags:       append([]string(nil), entry.Tags...),
+		CreatedAt:  entry.CreatedAt,
+		ExpiresAt:  entry.ExpiresAt,
+		LastAccess: entry.LastAccess,
+		SizeBytes:  entry.Size,
+		Hits:       entry.Hits,
+		Negative:   entry.Negative,
+		Expired:    now.After(entry.ExpiresAt),
+	}
+}
@@ -1,91 +1,356 @@
 package services
 
 import (
-	"crypto/md5"
-	"encoding/hex"
-	"fmt"
+	"container/list"
+	"context"
+	"hash/fnv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/sptrader/sptrader/internal/config"
 )
 
+// defaultCacheShards is used when CacheConfig.Shards is unset
+const defaultCacheShards = 16
+
+// defaultLowWatermark is used when CacheConfig.LowWatermark is unset
+const defaultLowWatermark = 0.9
+
 // CacheEntry represents a cached item
 type CacheEntry struct {
-	Data      interface{}
-	ExpiresAt time.Time
-	Size      int64
+	Key        string
+	Data       interface{}
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastAccess time.Time
+	Hits       int64
+	Size       int64
+	Tags       []string
+	Negative   bool   // empty result cached with the negative TTL
+	Class      string // resolution class the entry is budgeted under
 }
 
-// CacheService provides in-memory caching
+// CacheService provides in-memory caching. Keys are spread over independent
+// shards by hash, each with its own lock, LRU lists, tag index and share of
+// the size budget, so concurrent requests rarely contend on the same lock.
+// Resolutions with a quota in CacheConfig.ResolutionQuotas form their own
+// class and evict within it before the global budget applies.
 type CacheService struct {
-	mu          sync.RWMutex
-	items       map[string]*CacheEntry
-	maxSize     int
-	currentSize int
-	stats       CacheStats
-	config      config.CacheConfig
+	shards []*cacheShard
+	config atomic.Pointer[config.CacheConfig] // replaced whole by Reconfigure
+	loads  loadGroup
+	now    func() time.Time // replaceable clock
+
+	hits         atomic.Int64
+	misses       atomic.Int64
+	negativeHits atomic.Int64
+	evictions    atomic.Int64
+	tooLarge     atomic.Int64
+	windows      windowCounters
+}
+
+// cacheShard is one independently locked segment of the cache
+type cacheShard struct {
+	mu         sync.Mutex
+	items      map[string]*list.Element // values are *CacheEntry
+	lrus       map[string]*list.List    // per class; front is most recently used
+	tagIndex   map[string]map[string]struct{}
+	bytes      int64
+	classBytes map[string]int64
+	classQuota map[string]int64
+	maxSize    int
+	maxBytes   int64
+	lowSize    int   // entry count to trim down to once maxSize is hit
+	lowBytes   int64 // byte count to trim down to once maxBytes is hit
+	onEvict    func(*CacheEntry)
+}
+
+// CacheClassStats reports occupancy of one resolution class
+type CacheClassStats struct {
+	Entries    int
+	Bytes      int64
+	QuotaBytes int64
 }
 
 // CacheStats tracks cache performance
 type CacheStats struct {
-	Hits      int64
-	Misses    int64
-	Evictions int64
-	Size      int
+	Backend      string
+	MaxSize      int
+	Hits         int64
+	Misses       int64
+	NegativeHits int64 // hits on cached empty results, also counted in Hits
+	Evictions    int64
+	TooLarge     int64 // values over MaxEntryBytes that were not cached
+	Size         int
+	MemoryBytes  int64
+	ReusedKeys   int           // entries hit at least once since being stored
+	OldestEntry  time.Duration // age of the oldest entry
+	Classes      map[string]CacheClassStats
+	Windows      map[string]CacheWindowStats
 }
 
 // NewCacheService creates a new cache service
 func NewCacheService(cfg config.CacheConfig) *CacheService {
-	return &CacheService{
-		items:   make(map[string]*CacheEntry),
-		maxSize: cfg.MaxSize,
-		config:  cfg,
+	n := cfg.Shards
+	if n <= 0 {
+		n = defaultCacheShards
+	}
+
+	shards := make([]*cacheShard, n)
+	for i := range shards {
+		s := &cacheShard{
+			items:      make(map[string]*list.Element),
+			lrus:       make(map[string]*list.List),
+			tagIndex:   make(map[string]map[string]struct{}),
+			classBytes: make(map[string]int64),
+		}
+		s.setBudgets(cfg, n)
+		shards[i] = s
 	}
+
+	c := &CacheService{
+		shards: shards,
+		now:    time.Now,
+	}
+	c.config.Store(&cfg)
+	for _, s := range shards {
+		s.onEvict = c.recordEviction
+	}
+	return c
 }
 
-// Get retrieves an item from cache
-func (c *CacheService) Get(key string) (interface{}, bool) {
-	c.mu.RLock()
-	entry, exists := c.items[key]
-	c.mu.RUnlock()
+// settings returns the cache's current configuration
+func (c *CacheService) settings() *config.CacheConfig {
+	return c.config.Load()
+}
 
-	if !exists {
-		c.incrementMisses()
+// Reconfigure applies changed TTL, size, compression and budget settings to
+// the running cache, trimming shards that are over their new budgets. The
+// backend and shard count are fixed when the cache is created. Entries keep
+// the quota class they were stored under until they leave the cache.
+func (c *CacheService) Reconfigure(cfg config.CacheConfig) {
+	cfg.Backend = c.settings().Backend
+	cfg.Shards = c.settings().Shards
+	c.config.Store(&cfg)
+
+	evicted := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		s.setBudgets(cfg, len(c.shards))
+		for class := range s.classQuota {
+			for s.overQuota(class, 0) && s.evictLRU(class) {
+				evicted++
+			}
+		}
+		if s.overBudget(0) {
+			evicted += s.trim(0)
+		}
+		s.mu.Unlock()
+	}
+	log.Info().
+		Int("max_size", cfg.MaxSize).
+		Int64("max_bytes", cfg.MaxBytes).
+		Int("evicted", evicted).
+		Msg("Cache reconfigured")
+}
+
+// setBudgets splits the cache's budgets evenly over n shards, rounding up so
+// every shard can hold something. Must be called with the lock held once
+// the shard is in use.
+func (s *cacheShard) setBudgets(cfg config.CacheConfig, n int) {
+	low := cfg.LowWatermark
+	if low <= 0 || low > 1 {
+		low = defaultLowWatermark
+	}
+
+	s.classQuota = make(map[string]int64, len(cfg.ResolutionQuotas))
+	for resolution, quota := range cfg.ResolutionQuotas {
+		s.classQuota[resolution] = (quota + int64(n) - 1) / int64(n)
+	}
+	s.maxSize = (cfg.MaxSize + n - 1) / n
+	s.maxBytes = (cfg.MaxBytes + int64(n) - 1) / int64(n)
+	s.lowSize = int(float64(s.maxSize) * low)
+	s.lowBytes = int64(float64(s.maxBytes) * low)
+}
+
+// recordEviction counts an entry evicted for space
+func (c *CacheService) recordEviction(entry *CacheEntry) {
+	now := c.now()
+	c.evictions.Add(1)
+	c.windows.recordEviction(now, now.Sub(entry.CreatedAt))
+}
+
+// shard returns the shard owning key
+func (c *CacheService) shard(key string) *cacheShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return c.shards[h.Sum32()%uint32(len(c.shards))]
+}
+
+// classOf returns the quota class for an entry's tags: its resolution when
+// that resolution has a quota, otherwise the shared unquoted class
+func (c *CacheService) classOf(tags []string) string {
+	for _, tag := range tags {
+		resolution, ok := strings.CutPrefix(tag, ResolutionTag(""))
+		if !ok {
+			continue
+		}
+		if _, quoted := c.settings().ResolutionQuotas[resolution]; quoted {
+			return resolution
+		}
+	}
+	return ""
+}
+
+// Get retrieves an item from cache and marks it most recently used
+func (c *CacheService) Get(key string) (interface{}, bool) {
+	data, stale, found := c.lookup(key)
+	if !found || stale {
 		return nil, false
 	}
+	return c.inflate(key, data)
+}
+
+// inflate decompresses a compressed entry into raw JSON. An entry that fails
+// to decompress is dropped and reported as a miss.
+func (c *CacheService) inflate(key string, data interface{}) (interface{}, bool) {
+	compressed, ok := data.(compressedValue)
+	if !ok {
+		return data, true
+	}
 
-	// Check expiration
-	if time.Now().After(entry.ExpiresAt) {
+	payload, err := compressed.inflate()
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Dropping unreadable cache entry")
 		c.Delete(key)
-		c.incrementMisses()
 		return nil, false
 	}
+	return payload, true
+}
+
+// lookup returns the entry for key, reporting whether it is past expiry but
+// still inside the stale grace window. Stale lookups count as misses.
+func (c *CacheService) lookup(key string) (interface{}, bool, bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, exists := s.items[key]
+	if !exists {
+		c.misses.Add(1)
+		c.windows.recordMiss(c.now())
+		return nil, false, false
+	}
+
+	// Check expiration
+	entry := elem.Value.(*CacheEntry)
+	now := c.now()
+	if now.After(entry.ExpiresAt) {
+		c.misses.Add(1)
+		c.windows.recordMiss(now)
+		if now.After(entry.ExpiresAt.Add(c.settings().StaleGrace)) {
+			s.remove(elem)
+			return nil, false, false
+		}
+		return entry.Data, true, true
+	}
 
-	c.incrementHits()
-	return entry.Data, true
+	entry.LastAccess = now
+	entry.Hits++
+	s.lrus[entry.Class].MoveToFront(elem)
+	c.hits.Add(1)
+	c.windows.recordHit(now)
+	if entry.Negative {
+		c.negativeHits.Add(1)
+	}
+	return entry.Data, false, true
 }
 
-// Set adds an item to cache
-func (c *CacheService) Set(key string, data interface{}, ttl time.Duration) {
+// Set adds an item to cache, indexing it under any tags. Empty results are
+// kept for CacheConfig.NegativeTTL, and the TTL is jittered when
+// CacheConfig.TTLJitter is set. Values over CacheConfig.MaxEntryBytes are
+// skipped so one huge response can't flush the cache. With compression on,
+// large values are stored gzipped and charged at their compressed size.
+func (c *CacheService) Set(key string, data interface{}, ttl time.Duration, tags ...string) {
+	cfg := c.settings()
+	negative := isNegative(data)
+	if negative {
+		ttl, tags = negativeEntry(ttl, cfg.NegativeTTL, tags)
+	}
+
+	size := estimateSize(data)
+	if cfg.Compress && size >= cfg.CompressMinBytes {
+		compressed, err := compressValue(data)
+		if err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("Caching value uncompressed")
+		} else {
+			data = compressed
+			size = estimateSize(compressed)
+		}
+	}
+
+	if cfg.MaxEntryBytes > 0 && size > cfg.MaxEntryBytes {
+		c.tooLarge.Add(1)
+		log.Warn().
+			Str("key", key).
+			Int64("size_bytes", size).
+			Int64("max_entry_bytes", cfg.MaxEntryBytes).
+			Msg("Value too large to cache")
+		return
+	}
+
+	now := c.now()
 	entry := &CacheEntry{
-		Data:      data,
-		ExpiresAt: time.Now().Add(ttl),
-		Size:      1, // Simplified size calculation
+		Key:        key,
+		Data:       data,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(jitterTTL(ttl, cfg.TTLJitter)),
+		LastAccess: now,
+		Size:       size,
+		Tags:       tags,
+		Negative:   negative,
+		Class:      c.classOf(tags),
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// Check if we need to evict items
-	if len(c.items) >= c.maxSize {
-		c.evictOldest()
+	// Replacing a key frees its old bytes first
+	if old, exists := s.items[key]; exists {
+		s.remove(old)
 	}
 
-	c.items[key] = entry
-	c.currentSize = len(c.items)
-	c.stats.Size = c.currentSize
+	// Evict within the entry's class until it fits the class quota. Crossing
+	// the shard's byte budget or entry cap trims the shard down to its low
+	// watermark in one pass, so inserts at capacity don't each pay for an
+	// eviction.
+	for s.overQuota(entry.Class, entry.Size) {
+		if !s.evictLRU(entry.Class) {
+			break
+		}
+	}
+	if s.overBudget(entry.Size) {
+		s.trim(entry.Size)
+	}
+
+	lru := s.lrus[entry.Class]
+	if lru == nil {
+		lru = list.New()
+		s.lrus[entry.Class] = lru
+	}
+	s.items[key] = lru.PushFront(entry)
+	s.bytes += entry.Size
+	s.classBytes[entry.Class] += entry.Size
+	for _, tag := range tags {
+		if s.tagIndex[tag] == nil {
+			s.tagIndex[tag] = make(map[string]struct{})
+		}
+		s.tagIndex[tag][key] = struct{}{}
+	}
 
 	log.Debug().
 		Str("key", key).
@@ -93,41 +358,196 @@ func (c *CacheService) Set(key string, data interface{}, ttl time.Duration) {
 		Msg("Added item to cache")
 }
 
+// GetOrLoad returns the cached value for key, or runs loader to produce it.
+// Concurrent callers for the same key share a single loader run; waiters give
+// up when ctx is done. Errors and nil results are returned but never cached.
+// With a stale grace configured, an entry just past expiry is returned
+// immediately while the loader refreshes it in the background. It reports
+// whether the caller's lookup hit; a stale entry counts as a miss, as it
+// does in the stats.
+func (c *CacheService) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func() (interface{}, error), tags ...string) (interface{}, bool, error) {
+	set := func(key string, data interface{}) {
+		c.Set(key, data, ttl, tags...)
+	}
+
+	// The caller's lookup is counted once here; the load group only peeks
+	// for a value stored since
+	data, stale, found := c.lookup(key)
+	if found {
+		data, found = c.inflate(key, data)
+	}
+	if found {
+		if stale {
+			go func() {
+				_, _, err := c.loads.getOrLoad(context.Background(), key, c.peek, set, loader)
+				if err != nil {
+					log.Warn().Err(err).Str("key", key).Msg("Stale cache refresh failed")
+				}
+			}()
+		}
+		return data, !stale, nil
+	}
+
+	data, _, err := c.loads.getOrLoad(ctx, key, c.peek, set, loader)
+	return data, false, err
+}
+
+// peek returns a fresh entry for key without counting a hit or miss
+func (c *CacheService) peek(key string) (interface{}, bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	elem, exists := s.items[key]
+	var data interface{}
+	if exists {
+		entry := elem.Value.(*CacheEntry)
+		exists = !c.now().After(entry.ExpiresAt)
+		data = entry.Data
+	}
+	s.mu.Unlock()
+
+	if !exists {
+		return nil, false
+	}
+	return c.inflate(key, data)
+}
+
+// lockAll locks every shard, always in shard order so concurrent callers
+// can't deadlock. Everything else holds one shard lock at a time.
+func (c *CacheService) lockAll() {
+	for _, s := range c.shards {
+		s.mu.Lock()
+	}
+}
+
+// unlockAll releases the locks taken by lockAll
+func (c *CacheService) unlockAll() {
+	for _, s := range c.shards {
+		s.mu.Unlock()
+	}
+}
+
+// InvalidateTag removes every entry carrying tag. Every shard is locked for
+// the duration, so no reader sees the tag gone from one shard while its
+// entries are still served from another.
+func (c *CacheService) InvalidateTag(tag string) int {
+	c.lockAll()
+	defer c.unlockAll()
+
+	removed := 0
+	for _, s := range c.shards {
+		for key := range s.tagIndex[tag] {
+			if elem, exists := s.items[key]; exists {
+				s.remove(elem)
+				removed++
+			}
+		}
+		delete(s.tagIndex, tag)
+	}
+	return removed
+}
+
+// InvalidatePrefix removes every entry whose key starts with prefix, with
+// every shard locked as InvalidateTag does
+func (c *CacheService) InvalidatePrefix(prefix string) int {
+	c.lockAll()
+	defer c.unlockAll()
+
+	removed := 0
+	for _, s := range c.shards {
+		for key, elem := range s.items {
+			if strings.HasPrefix(key, prefix) {
+				s.remove(elem)
+				removed++
+			}
+		}
+	}
+	return removed
+}
+
 // Delete removes an item from cache
 func (c *CacheService) Delete(key string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	delete(c.items, key)
-	c.currentSize = len(c.items)
-	c.stats.Size = c.currentSize
+	if elem, exists := s.items[key]; exists {
+		s.remove(elem)
+	}
 }
 
 // Clear removes all items from cache
 func (c *CacheService) Clear() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	c.items = make(map[string]*CacheEntry)
-	c.currentSize = 0
-	c.stats.Size = 0
+	c.lockAll()
+	defer c.unlockAll()
+
+	for _, s := range c.shards {
+		s.items = make(map[string]*list.Element)
+		s.lrus = make(map[string]*list.List)
+		s.tagIndex = make(map[string]map[string]struct{})
+		s.classBytes = make(map[string]int64)
+		s.bytes = 0
+	}
 }
 
 // GenerateKey creates a cache key from parameters
-func (c *CacheService) GenerateKey(symbol, resolution string, start, end time.Time) string {
-	key := fmt.Sprintf("%s:%s:%d:%d", symbol, resolution, start.Unix(), end.Unix())
-	hash := md5.Sum([]byte(key))
-	return hex.EncodeToString(hash[:])
+func (c *CacheService) GenerateKey(symbol, resolution string, start, end time.Time, extras ...string) string {
+	return GenerateCacheKey(symbol, resolution, start, end, extras...)
+}
+
+// ResetStats zeroes the lifetime counters. Rolling windows are left to age
+// out on their own.
+func (c *CacheService) ResetStats() {
+	c.hits.Store(0)
+	c.misses.Store(0)
+	c.negativeHits.Store(0)
+	c.evictions.Store(0)
+	c.tooLarge.Store(0)
 }
 
 // GetStats returns cache statistics
 func (c *CacheService) GetStats() CacheStats {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	cfg := c.settings()
+	stats := CacheStats{
+		Backend:      "memory",
+		MaxSize:      cfg.MaxSize,
+		Hits:         c.hits.Load(),
+		Misses:       c.misses.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Evictions:    c.evictions.Load(),
+		TooLarge:     c.tooLarge.Load(),
+		Windows:      c.windows.snapshot(c.now()),
+		Classes:      make(map[string]CacheClassStats, len(cfg.ResolutionQuotas)),
+	}
+	for resolution, quota := range cfg.ResolutionQuotas {
+		stats.Classes[resolution] = CacheClassStats{QuotaBytes: quota}
+	}
+
+	now := c.now()
+	for _, s := range c.shards {
+		s.mu.Lock()
+		stats.Size += len(s.items)
+		stats.MemoryBytes += s.bytes
+		for _, elem := range s.items {
+			entry := elem.Value.(*CacheEntry)
+			if entry.Hits > 0 {
+				stats.ReusedKeys++
+			}
+			if age := now.Sub(entry.CreatedAt); age > stats.OldestEntry {
+				stats.OldestEntry = age
+			}
+		}
+		for class, lru := range s.lrus {
+			if class == "" {
+				continue
+			}
+			classStats := stats.Classes[class]
+			classStats.Entries += lru.Len()
+			classStats.Bytes += s.classBytes[class]
+			stats.Classes[class] = classStats
+		}
+		s.mu.Unlock()
+	}
 
-	stats := c.stats
-	stats.Size = len(c.items)
-	
 	// Calculate hit rate
 	total := stats.Hits + stats.Misses
 	if total > 0 {
@@ -142,69 +562,136 @@ func (c *CacheService) GetStats() CacheStats {
 	return stats
 }
 
-// evictOldest removes the oldest cache entry
-func (c *CacheService) evictOldest() {
-	var oldestKey string
-	var oldestTime time.Time
+// CleanupExpired removes expired entries
+func (c *CacheService) CleanupExpired() {
+	// Entries inside the stale grace window are kept for revalidation
+	cutoff := c.now().Add(-c.settings().StaleGrace)
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for key, elem := range s.items {
+			if cutoff.After(elem.Value.(*CacheEntry).ExpiresAt) {
+				s.remove(elem)
+				log.Debug().
+					Str("key", key).
+					Msg("Removed expired cache entry")
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// StartCleanupRoutine starts a background cleanup goroutine
+func (c *CacheService) StartCleanupRoutine() {
+	go func() {
+		ticker := time.NewTicker(1 * time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			c.CleanupExpired()
+		}
+	}()
+}
+
+// overBudget reports whether adding an entry of the given size would exceed
+// the shard's byte budget or entry cap. Must be called with the lock held.
+func (s *cacheShard) overBudget(size int64) bool {
+	if s.maxBytes > 0 && s.bytes+size > s.maxBytes {
+		return true
+	}
+	return s.maxSize > 0 && len(s.items) >= s.maxSize
+}
 
-	// Find oldest entry
-	for key, entry := range c.items {
-		if oldestKey == "" || entry.ExpiresAt.Before(oldestTime) {
-			oldestKey = key
-			oldestTime = entry.ExpiresAt
+// trim evicts least recently used entries across classes until the shard,
+// plus an incoming entry of the given size, is under its low watermarks.
+// Returns the number of entries evicted. Must be called with the lock held.
+func (s *cacheShard) trim(size int64) int {
+	evicted := 0
+	for len(s.items) > 0 {
+		overBytes := s.maxBytes > 0 && s.bytes+size > s.lowBytes
+		overSize := s.maxSize > 0 && len(s.items)+1 > s.lowSize
+		if !overBytes && !overSize {
+			break
+		}
+		if !s.evictLRU(s.oldestClass()) {
+			break
 		}
+		evicted++
 	}
 
-	if oldestKey != "" {
-		delete(c.items, oldestKey)
-		c.stats.Evictions++
+	if evicted > 0 {
 		log.Debug().
-			Str("key", oldestKey).
-			Msg("Evicted cache entry")
+			Int("evicted", evicted).
+			Int("entries", len(s.items)).
+			Int64("bytes", s.bytes).
+			Msg("Trimmed cache shard to low watermark")
 	}
+	return evicted
 }
 
-// incrementHits safely increments hit counter
-func (c *CacheService) incrementHits() {
-	c.mu.Lock()
-	c.stats.Hits++
-	c.mu.Unlock()
+// overQuota reports whether adding an entry of the given size would exceed
+// its class quota. Must be called with the lock held.
+func (s *cacheShard) overQuota(class string, size int64) bool {
+	quota, ok := s.classQuota[class]
+	return ok && quota > 0 && s.classBytes[class]+size > quota
 }
 
-// incrementMisses safely increments miss counter
-func (c *CacheService) incrementMisses() {
-	c.mu.Lock()
-	c.stats.Misses++
-	c.mu.Unlock()
+// oldestClass returns the class holding the least recently used entry in
+// the shard. Must be called with the lock held.
+func (s *cacheShard) oldestClass() string {
+	oldest := ""
+	var oldestAccess time.Time
+	found := false
+	for class, lru := range s.lrus {
+		back := lru.Back()
+		if back == nil {
+			continue
+		}
+		access := back.Value.(*CacheEntry).LastAccess
+		if !found || access.Before(oldestAccess) {
+			oldest, oldestAccess, found = class, access, true
+		}
+	}
+	return oldest
 }
 
-// CleanupExpired removes expired entries
-func (c *CacheService) CleanupExpired() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	now := time.Now()
-	for key, entry := range c.items {
-		if now.After(entry.ExpiresAt) {
-			delete(c.items, key)
-			log.Debug().
-				Str("key", key).
-				Msg("Removed expired cache entry")
-		}
+// evictLRU removes the least recently used entry in a class, reporting
+// whether anything was evicted. Expiry is handled separately by
+// CleanupExpired. Must be called with the lock held.
+func (s *cacheShard) evictLRU(class string) bool {
+	lru := s.lrus[class]
+	if lru == nil || lru.Len() == 0 {
+		return false
 	}
 
-	c.currentSize = len(c.items)
-	c.stats.Size = c.currentSize
+	elem := lru.Back()
+	entry := elem.Value.(*CacheEntry)
+	s.remove(elem)
+	if s.onEvict != nil {
+		s.onEvict(entry)
+	}
+	log.Debug().
+		Str("key", entry.Key).
+		Str("class", class).
+		Msg("Evicted cache entry")
+	return true
 }
 
-// StartCleanupRoutine starts a background cleanup goroutine
-func (c *CacheService) StartCleanupRoutine() {
-	go func() {
-		ticker := time.NewTicker(1 * time.Minute)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			c.CleanupExpired()
+// remove unlinks an entry from the map, LRU list and tag index. Must be
+// called with the lock held.
+func (s *cacheShard) remove(elem *list.Element) {
+	entry := elem.Value.(*CacheEntry)
+	s.lrus[entry.Class].Remove(elem)
+	delete(s.items, entry.Key)
+	s.bytes -= entry.Size
+	s.classBytes[entry.Class] -= entry.Size
+
+	// Drop the key from its tags so the index doesn't outlive the entries
+	for _, tag := range entry.Tags {
+		if keys, ok := s.tagIndex[tag]; ok {
+			delete(keys, entry.Key)
+			if len(keys) == 0 {
+				delete(s.tagIndex, tag)
+			}
 		}
-	}()
-}
\ No newline at end of file
+	}
+}
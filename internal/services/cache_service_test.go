@@ -0,0 +1,551 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// quietLogs silences the per-entry debug logging for the rest of a test or
+// benchmark, so it measures the cache rather than the logger
+func quietLogs(tb testing.TB) {
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	tb.Cleanup(func() { zerolog.SetGlobalLevel(level) })
+}
+
+// testCandles returns an hourly candle response of n bars
+func testCandles(n int) *models.CandleResponse {
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	candles := make([]models.Candle, n)
+	for i := range candles {
+		price := 1.08 + float64(i%50)*0.0001
+		candles[i] = models.Candle{
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+			Open:      price,
+			High:      price + 0.0007,
+			Low:       price - 0.0005,
+			Close:     price + 0.0002,
+			Volume:    float64(1000 + i),
+		}
+	}
+	return &models.CandleResponse{Symbol: "EURUSD", Resolution: "1h", Count: n, Candles: candles}
+}
+
+// BenchmarkCacheCompression stores and reads back candle responses through a
+// TypedCache, raw and gzipped, reporting the bytes each entry is charged
+func BenchmarkCacheCompression(b *testing.B) {
+	quietLogs(b)
+	for _, bars := range []int{100, 1000, 10000} {
+		response := testCandles(bars)
+		for _, compress := range []bool{false, true} {
+			name := fmt.Sprintf("bars=%d/raw", bars)
+			if compress {
+				name = fmt.Sprintf("bars=%d/gzip", bars)
+			}
+			b.Run(name, func(b *testing.B) {
+				cache := NewCacheService(config.CacheConfig{MaxSize: 100, MaxBytes: 1 << 30, Compress: compress})
+				candles := NewTypedCache[*models.CandleResponse](cache, "candles")
+
+				b.Run("set", func(b *testing.B) {
+					b.ReportAllocs()
+					for i := 0; i < b.N; i++ {
+						candles.Set("key", response, time.Hour)
+					}
+					b.ReportMetric(float64(cache.GetStats().MemoryBytes), "bytes/entry")
+				})
+				b.Run("get", func(b *testing.B) {
+					candles.Set("key", response, time.Hour)
+					b.ReportAllocs()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						if _, ok := candles.Get("key"); !ok {
+							b.Fatal("cache miss")
+						}
+					}
+				})
+			})
+		}
+	}
+}
+
+// BenchmarkCacheContention runs a read-heavy mix of gets and sets over many
+// keys from parallel goroutines, against one shard, which serializes every
+// call on a single lock, and against the default shard count
+func BenchmarkCacheContention(b *testing.B) {
+	quietLogs(b)
+	const keys = 1024
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = fmt.Sprintf("candles:EURUSD:1h:%d", i)
+	}
+	response := testCandles(10)
+
+	for _, shards := range []int{1, defaultCacheShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			cache := NewCacheService(config.CacheConfig{MaxSize: keys * 2, MaxBytes: 1 << 30, Shards: shards})
+			for _, key := range names {
+				cache.Set(key, response, time.Hour)
+			}
+			var seed atomic.Int64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(seed.Add(7919))
+				for pb.Next() {
+					key := names[i%keys]
+					// One write in ten, as a warm cache sees
+					if i%10 == 0 {
+						cache.Set(key, response, time.Hour)
+					} else {
+						cache.Get(key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkCacheEviction inserts new keys into a full cache. A low watermark
+// of 1 trims back to the cap itself, evicting one entry per insert; lower
+// watermarks evict in batches that leave room for the inserts after. Either
+// way each insert costs one eviction in the long run; batches save the trim
+// passes in between.
+func BenchmarkCacheEviction(b *testing.B) {
+	quietLogs(b)
+	const capacity = 4096
+	response := testCandles(10)
+
+	for _, low := range []float64{1, defaultLowWatermark, 0.75} {
+		b.Run(fmt.Sprintf("low_watermark=%g", low), func(b *testing.B) {
+			cache := NewCacheService(config.CacheConfig{MaxSize: capacity, LowWatermark: low})
+			for i := 0; i < capacity; i++ {
+				cache.Set(fmt.Sprintf("warm:%d", i), response, time.Hour)
+			}
+			keys := make([]string, b.N)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("key:%d", i)
+			}
+			evicted := cache.GetStats().Evictions
+			b.ReportAllocs()
+			b.ResetTimer()
+			for _, key := range keys {
+				cache.Set(key, response, time.Hour)
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(cache.GetStats().Evictions-evicted)/float64(b.N), "evictions/op")
+		})
+	}
+}
+
+// testClock is a cache clock moved by hand
+type testClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *testClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// newClockedCache returns a cache reading the time from a testClock
+func newClockedCache(cfg config.CacheConfig) (*CacheService, *testClock) {
+	clock := &testClock{t: time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)}
+	cache := NewCacheService(cfg)
+	cache.now = clock.now
+	return cache, clock
+}
+
+// expiresIn returns how long after now the entry for key expires
+func expiresIn(c *CacheService, key string) time.Duration {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.items[key].Value.(*CacheEntry).ExpiresAt.Sub(c.now())
+}
+
+func TestCacheTTLJitter(t *testing.T) {
+	const ttl = 10 * time.Minute
+	cache, _ := newClockedCache(config.CacheConfig{MaxSize: 1000, TTLJitter: 0.15})
+	low, high := ttl-ttl*15/100, ttl+ttl*15/100
+
+	spread := make(map[time.Duration]bool)
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		cache.Set(key, "value", ttl)
+		got := expiresIn(cache, key)
+		if got < low || got > high {
+			t.Fatalf("TTL %s jittered to %s, want within [%s, %s]", ttl, got, low, high)
+		}
+		spread[got] = true
+	}
+	if len(spread) < 100 {
+		t.Errorf("%d distinct TTLs over 500 keys, want them spread out", len(spread))
+	}
+}
+
+// Jitter and stale serving change what callers see, so both are opt-in
+func TestCacheJitterAndStaleGraceOffByDefault(t *testing.T) {
+	cache, clock := newClockedCache(config.CacheConfig{MaxSize: 100})
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		cache.Set(key, "value", time.Minute)
+		if got := expiresIn(cache, key); got != time.Minute {
+			t.Fatalf("TTL of a minute became %s without jitter configured", got)
+		}
+	}
+
+	clock.advance(time.Minute + time.Second)
+	var loads int
+	value, hit, err := cache.GetOrLoad(context.Background(), "key:0", time.Minute, func() (interface{}, error) {
+		loads++
+		return "fresh", nil
+	})
+	if err != nil || value != "fresh" || hit || loads != 1 {
+		t.Errorf("expired GetOrLoad = %v, %v, %v after %d loads, want the fresh value loaded in the call", value, hit, err, loads)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	cache, clock := newClockedCache(config.CacheConfig{MaxSize: 100, StaleGrace: time.Minute})
+	cache.Set("key", "old", time.Minute)
+	clock.advance(time.Minute + 30*time.Second)
+
+	release := make(chan struct{})
+	var loads atomic.Int32
+	loader := func() (interface{}, error) {
+		loads.Add(1)
+		<-release
+		return "new", nil
+	}
+
+	// Every caller inside the grace window gets the stale value at once,
+	// and they share the one refresh started in the background
+	for i := 0; i < 5; i++ {
+		value, hit, err := cache.GetOrLoad(context.Background(), "key", time.Minute, loader)
+		if err != nil || value != "old" || hit {
+			t.Fatalf("stale GetOrLoad %d = %v, %v, %v, want the stale value as a miss", i+1, value, hit, err)
+		}
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if value, ok := cache.peek("key"); ok && value == "new" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stale entry was never refreshed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("%d refreshes, want exactly one", n)
+	}
+	if value, hit, _ := cache.GetOrLoad(context.Background(), "key", time.Minute, loader); value != "new" || !hit {
+		t.Errorf("after the refresh GetOrLoad = %v, %v, want a hit on the new value", value, hit)
+	}
+
+	// Past the grace window the entry is gone and the caller waits for the load
+	clock.advance(3 * time.Minute)
+	value, hit, err := cache.GetOrLoad(context.Background(), "key", time.Minute, func() (interface{}, error) {
+		return "newer", nil
+	})
+	if err != nil || value != "newer" || hit {
+		t.Errorf("GetOrLoad past the grace window = %v, %v, %v, want the value loaded in the call", value, hit, err)
+	}
+}
+
+// sizedValue returns a string the cache charges exactly size bytes for
+func sizedValue(size int64) string {
+	return strings.Repeat("x", int(size-envelopeBytes))
+}
+
+// cacheKeys returns which of keys are still cached, without touching them
+func cacheKeys(c *CacheService, keys ...string) []string {
+	var present []string
+	for _, key := range keys {
+		s := c.shard(key)
+		s.mu.Lock()
+		if _, ok := s.items[key]; ok {
+			present = append(present, key)
+		}
+		s.mu.Unlock()
+	}
+	return present
+}
+
+func TestCacheByteBudget(t *testing.T) {
+	// One shard and a watermark of 1 evict exactly as much as is needed
+	cache, _ := newClockedCache(config.CacheConfig{MaxBytes: 5000, Shards: 1, LowWatermark: 1})
+	for i := 0; i < 5; i++ {
+		cache.Set(fmt.Sprintf("key:%d", i), sizedValue(1000), time.Hour)
+	}
+	if stats := cache.GetStats(); stats.MemoryBytes != 5000 || stats.Evictions != 0 {
+		t.Fatalf("full cache: %d bytes after %d evictions, want 5000 after none", stats.MemoryBytes, stats.Evictions)
+	}
+
+	// A large entry evicts as many old ones as it needs room for
+	cache.Set("large", sizedValue(2500), time.Hour)
+	stats := cache.GetStats()
+	if stats.MemoryBytes > 5000 || stats.Evictions != 3 {
+		t.Errorf("after a 2500 byte entry: %d bytes after %d evictions, want at most 5000 after 3", stats.MemoryBytes, stats.Evictions)
+	}
+	if got := cacheKeys(cache, "key:0", "key:1", "key:2", "key:3", "key:4", "large"); !reflect.DeepEqual(got, []string{"key:3", "key:4", "large"}) {
+		t.Errorf("cached %v, want the oldest entries evicted", got)
+	}
+
+	// Replacing a key frees its old bytes rather than evicting another
+	cache.Set("large", sizedValue(1500), time.Hour)
+	if stats := cache.GetStats(); stats.MemoryBytes != 3500 || stats.Evictions != 3 {
+		t.Errorf("after replacing an entry: %d bytes after %d evictions, want 3500 after 3", stats.MemoryBytes, stats.Evictions)
+	}
+}
+
+func TestCacheByteBudgetTrimsToLowWatermark(t *testing.T) {
+	cache, _ := newClockedCache(config.CacheConfig{MaxBytes: 10000, Shards: 1, LowWatermark: 0.5})
+	for i := 0; i < 10; i++ {
+		cache.Set(fmt.Sprintf("key:%d", i), sizedValue(1000), time.Hour)
+	}
+	cache.Set("over", sizedValue(1000), time.Hour)
+
+	// Crossing the budget trims to half of it, the new entry included
+	if stats := cache.GetStats(); stats.MemoryBytes != 5000 || stats.Evictions != 6 {
+		t.Errorf("after crossing the budget: %d bytes after %d evictions, want 5000 after 6", stats.MemoryBytes, stats.Evictions)
+	}
+}
+
+func TestCacheSkipsEntriesOverMaxEntryBytes(t *testing.T) {
+	cache, _ := newClockedCache(config.CacheConfig{MaxBytes: 10000, MaxEntryBytes: 2000, Shards: 1})
+	cache.Set("small", sizedValue(1000), time.Hour)
+	cache.Set("huge", sizedValue(3000), time.Hour)
+
+	stats := cache.GetStats()
+	if stats.TooLarge != 1 || stats.Evictions != 0 || stats.MemoryBytes != 1000 {
+		t.Errorf("%d too large, %d evictions, %d bytes, want the huge value skipped without evicting", stats.TooLarge, stats.Evictions, stats.MemoryBytes)
+	}
+	if _, ok := cache.Get("huge"); ok {
+		t.Error("huge value was cached")
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, clock := newClockedCache(config.CacheConfig{MaxSize: 3, Shards: 1, LowWatermark: 1})
+	set := func(key string) {
+		clock.advance(time.Second)
+		cache.Set(key, "value", time.Hour)
+	}
+	get := func(key string) {
+		clock.advance(time.Second)
+		if _, ok := cache.Get(key); !ok {
+			t.Fatalf("%s missing", key)
+		}
+	}
+	all := []string{"a", "b", "c", "d", "e", "f"}
+
+	set("a")
+	set("b")
+	set("c")
+	get("a") // b is now the least recently used, though a is older
+	set("d")
+	if got := cacheKeys(cache, all...); !reflect.DeepEqual(got, []string{"a", "c", "d"}) {
+		t.Fatalf("cached %v after reading a, want b evicted", got)
+	}
+
+	get("c")
+	set("e")
+	if got := cacheKeys(cache, all...); !reflect.DeepEqual(got, []string{"c", "d", "e"}) {
+		t.Fatalf("cached %v after reading c, want a evicted", got)
+	}
+
+	// Rewriting a key makes it the most recently used too
+	set("d")
+	set("f")
+	if got := cacheKeys(cache, all...); !reflect.DeepEqual(got, []string{"d", "e", "f"}) {
+		t.Errorf("cached %v after rewriting d, want c evicted", got)
+	}
+	if stats := cache.GetStats(); stats.Evictions != 3 {
+		t.Errorf("%d evictions, want 3", stats.Evictions)
+	}
+}
+
+// Expired entries leave through CleanupExpired, not eviction, and don't
+// count as evictions
+func TestCacheCleanupExpiredIsSeparateFromEviction(t *testing.T) {
+	cache, clock := newClockedCache(config.CacheConfig{MaxSize: 10, Shards: 1})
+	cache.Set("short", "value", time.Minute)
+	cache.Set("long", "value", time.Hour)
+	clock.advance(2 * time.Minute)
+
+	if got := cacheKeys(cache, "short", "long"); len(got) != 2 {
+		t.Fatalf("cached %v before cleanup, want expired entries left for it", got)
+	}
+	cache.CleanupExpired()
+	if got := cacheKeys(cache, "short", "long"); !reflect.DeepEqual(got, []string{"long"}) {
+		t.Errorf("cached %v after cleanup, want only the live entry", got)
+	}
+	if stats := cache.GetStats(); stats.Evictions != 0 || stats.Size != 1 {
+		t.Errorf("%d evictions, %d entries, want cleanup not counted as eviction", stats.Evictions, stats.Size)
+	}
+}
+
+// Rolling windows drop activity as the clock moves past them, and survive
+// ResetStats, which only zeroes the lifetime counters
+func TestCacheStatWindows(t *testing.T) {
+	quietLogs(t)
+	cache, clock := newClockedCache(config.CacheConfig{MaxSize: 1, Shards: 1, LowWatermark: 1})
+	cache.Set("a", "value", time.Hour)
+	cache.Get("a")
+	cache.Get("missing")
+	clock.advance(30 * time.Second)
+	cache.Set("b", "value", time.Hour) // evicts a, 30s old
+
+	recent := CacheWindowStats{Hits: 1, Misses: 1, HitRate: 50, Evictions: 1, AvgEvictionAge: 30 * time.Second}
+	checkWindows := func(when string, want map[string]CacheWindowStats) {
+		t.Helper()
+		if got := cache.GetStats().Windows; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: windows %+v, want %+v", when, got, want)
+		}
+	}
+	checkWindows("at once", map[string]CacheWindowStats{"1m": recent, "5m": recent, "1h": recent})
+
+	clock.advance(2 * time.Minute)
+	cache.Get("b")
+	cache.Get("b")
+	later := CacheWindowStats{Hits: 3, Misses: 1, HitRate: 75, Evictions: 1, AvgEvictionAge: 30 * time.Second}
+	checkWindows("2m on", map[string]CacheWindowStats{
+		"1m": {Hits: 2, HitRate: 100},
+		"5m": later,
+		"1h": later,
+	})
+
+	cache.ResetStats()
+	if stats := cache.GetStats(); stats.Hits != 0 || stats.Misses != 0 || stats.Evictions != 0 {
+		t.Errorf("after reset: %d hits, %d misses, %d evictions, want lifetime counters zeroed", stats.Hits, stats.Misses, stats.Evictions)
+	}
+	checkWindows("after reset", map[string]CacheWindowStats{
+		"1m": {Hits: 2, HitRate: 100},
+		"5m": later,
+		"1h": later,
+	})
+
+	clock.advance(time.Hour)
+	checkWindows("an hour on", map[string]CacheWindowStats{"1m": {}, "5m": {}, "1h": {}})
+}
+
+// shardKeys returns a key stored in each shard, in shard order
+func shardKeys(c *CacheService) []string {
+	keys := make([]string, len(c.shards))
+	for i, found := 0, 0; found < len(keys); i++ {
+		key := fmt.Sprintf("key:%d", i)
+		for j, s := range c.shards {
+			if c.shard(key) == s && keys[j] == "" {
+				keys[j] = key
+				found++
+			}
+		}
+	}
+	return keys
+}
+
+// While InvalidateTag waits on the last shard, the tag's entries in the
+// first must still be in place: it removes from every shard at once, not
+// shard by shard
+func TestCacheInvalidateTagIsAtomic(t *testing.T) {
+	quietLogs(t)
+	cache := NewCacheService(config.CacheConfig{MaxSize: 1000, Shards: 8})
+	keys := shardKeys(cache)
+	for _, key := range keys {
+		cache.Set(key, "value", time.Hour, "symbol:EURUSD")
+	}
+
+	first, last := cache.shards[0], cache.shards[len(cache.shards)-1]
+	last.mu.Lock()
+	held := true
+	release := func() {
+		if held {
+			held = false
+			last.mu.Unlock()
+		}
+	}
+	defer release()
+
+	removed := make(chan int, 1)
+	go func() { removed <- cache.InvalidateTag("symbol:EURUSD") }()
+
+	// Wait for the invalidation to take the first shard. Until it does, the
+	// first shard's entry must be untouched.
+	deadline := time.Now().Add(5 * time.Second)
+	for first.mu.TryLock() {
+		_, present := first.items[keys[0]]
+		first.mu.Unlock()
+		if !present {
+			t.Fatal("first shard invalidated while the last was still locked")
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("InvalidateTag never locked the first shard")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	release()
+	if n := <-removed; n != len(keys) {
+		t.Errorf("removed %d entries, want %d", n, len(keys))
+	}
+	if got := cacheKeys(cache, keys...); len(got) != 0 {
+		t.Errorf("cached %v after invalidation, want none", got)
+	}
+}
+
+// Concurrent writers, readers and invalidations leave the shards' indexes
+// and byte counts consistent with their entries
+func TestCacheInvalidateTagConcurrent(t *testing.T) {
+	quietLogs(t)
+	cache := NewCacheService(config.CacheConfig{MaxSize: 10000, Shards: 8})
+	symbols := []string{"EURUSD", "GBPUSD", "USDJPY"}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				symbol := symbols[i%len(symbols)]
+				key := fmt.Sprintf("%s:%d:%d", symbol, w, i%50)
+				cache.Set(key, "value", time.Hour, SymbolTag(symbol), "all")
+				cache.Get(key)
+				if i%25 == 0 {
+					cache.InvalidateTag(SymbolTag(symbols[(i+w)%len(symbols)]))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	cache.InvalidateTag("all")
+	for i, s := range cache.shards {
+		s.mu.Lock()
+		if len(s.items) != 0 || len(s.tagIndex) != 0 || s.bytes != 0 {
+			t.Errorf("shard %d: %d entries, %d tags, %d bytes left, want an empty shard", i, len(s.items), len(s.tagIndex), s.bytes)
+		}
+		s.mu.Unlock()
+	}
+}
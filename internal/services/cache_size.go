@@ -0,0 +1,47 @@
+package services
+
+import (
+	"unsafe"
+
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// Approximate heap costs used to size cache entries
+const (
+	// candleBytes covers the Candle struct plus its optional field allocations
+	candleBytes = int64(unsafe.Sizeof(models.Candle{})) + 8*8
+	// envelopeBytes covers response headers, metadata and map bookkeeping
+	envelopeBytes = 512
+	// defaultEntryBytes is charged for values the estimator doesn't recognize
+	defaultEntryBytes = 1024
+)
+
+// estimateSize approximates how much heap a cached value holds
+func estimateSize(data interface{}) int64 {
+	switch v := data.(type) {
+	case *models.CandleResponse:
+		if v == nil {
+			return envelopeBytes
+		}
+		size := int64(envelopeBytes) + int64(len(v.Candles))*candleBytes
+		for _, note := range v.Metadata.Notes {
+			size += int64(len(note))
+		}
+		return size
+	case []models.Candle:
+		return envelopeBytes + int64(len(v))*candleBytes
+	case *models.ExplainResponse:
+		if v == nil {
+			return envelopeBytes
+		}
+		return envelopeBytes + int64(len(v.Alternatives))*64
+	case string:
+		return envelopeBytes + int64(len(v))
+	case []byte:
+		return envelopeBytes + int64(len(v))
+	case compressedValue:
+		return envelopeBytes + int64(len(v.data))
+	default:
+		return defaultEntryBytes
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testStore is the get and set a loadGroup consults, counting lookups
+type testStore struct {
+	mu      sync.Mutex
+	data    map[string]interface{}
+	lookups atomic.Int32
+}
+
+func (s *testStore) get(key string) (interface{}, bool) {
+	s.lookups.Add(1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.data[key]
+	return data, ok
+}
+
+func (s *testStore) set(key string, data interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		s.data = make(map[string]interface{})
+	}
+	s.data[key] = data
+}
+
+type loadResult struct {
+	data interface{}
+	hit  bool
+	err  error
+}
+
+// loadConcurrently calls getOrLoad on one key from n goroutines, releasing
+// the loader once every caller has looked the key up and is waiting
+func loadConcurrently(t *testing.T, n int, loaded interface{}, loadErr error) ([]loadResult, int32) {
+	t.Helper()
+	var group loadGroup
+	store := &testStore{}
+	release := make(chan struct{})
+	var loads atomic.Int32
+	loader := func() (interface{}, error) {
+		loads.Add(1)
+		<-release
+		return loaded, loadErr
+	}
+
+	results := make([]loadResult, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, hit, err := group.getOrLoad(context.Background(), "key", store.get, store.set, loader)
+			results[i] = loadResult{data, hit, err}
+		}()
+	}
+	for store.lookups.Load() < int32(n) {
+		time.Sleep(time.Millisecond)
+	}
+	// Give the last callers time to find the running load and wait on it
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	return results, loads.Load()
+}
+
+func TestLoadGroupRunsLoaderOnce(t *testing.T) {
+	const callers = 32
+	results, loads := loadConcurrently(t, callers, "loaded", nil)
+	if loads != 1 {
+		t.Errorf("loader ran %d times for %d callers, want 1", loads, callers)
+	}
+	for i, r := range results {
+		if r.err != nil || r.data != "loaded" || r.hit {
+			t.Errorf("caller %d got %v, %v, %v, want the loaded value as a miss", i, r.data, r.hit, r.err)
+		}
+	}
+}
+
+func TestLoadGroupSharesLoaderError(t *testing.T) {
+	const callers = 32
+	loadErr := errors.New("query failed")
+	results, loads := loadConcurrently(t, callers, nil, loadErr)
+	if loads != 1 {
+		t.Errorf("loader ran %d times for %d callers, want 1", loads, callers)
+	}
+	for i, r := range results {
+		if !errors.Is(r.err, loadErr) || r.data != nil {
+			t.Errorf("caller %d got %v, %v, want the loader's error", i, r.data, r.err)
+		}
+	}
+}
+
+func TestLoadGroupHitAfterLoad(t *testing.T) {
+	var group loadGroup
+	store := &testStore{}
+	loads := 0
+	loader := func() (interface{}, error) {
+		loads++
+		return "loaded", nil
+	}
+
+	if _, hit, _ := group.getOrLoad(context.Background(), "key", store.get, store.set, loader); hit {
+		t.Error("first call reported a hit")
+	}
+	data, hit, err := group.getOrLoad(context.Background(), "key", store.get, store.set, loader)
+	if err != nil || data != "loaded" || !hit {
+		t.Errorf("second call = %v, %v, %v, want the stored value as a hit", data, hit, err)
+	}
+	if loads != 1 {
+		t.Errorf("loader ran %d times, want 1", loads)
+	}
+}
+
+func TestLoadGroupWaiterGivesUpWithContext(t *testing.T) {
+	var group loadGroup
+	store := &testStore{}
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	go group.getOrLoad(context.Background(), "key", store.get, store.set, func() (interface{}, error) {
+		close(started)
+		<-release
+		return "loaded", nil
+	})
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := group.getOrLoad(ctx, "key", store.get, store.set, func() (interface{}, error) {
+		t.Error("a waiter ran the loader while another load was running")
+		return nil, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("waiter with a cancelled context got %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// warmTimeout bounds the load of a single warm target
+const warmTimeout = 30 * time.Second
+
+// CacheWarmer keeps frequently viewed ranges in the cache by requesting them
+// through ViewportService on a schedule. Targets are loaded one at a time so
+// warming never holds more than one database connection.
+type CacheWarmer struct {
+	viewport *ViewportService
+	config   config.CacheWarmConfig
+	mu       sync.RWMutex
+	status   CacheWarmStatus
+	trigger  chan struct{}
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// CacheWarmStatus reports the warmer state and the outcome of the last run
+type CacheWarmStatus struct {
+	Enabled  bool               `json:"enabled"`
+	Running  bool               `json:"running"`
+	Interval string             `json:"interval"`
+	Runs     int64              `json:"runs"`
+	LastRun  time.Time          `json:"last_run"`
+	Failures int                `json:"failures"`
+	Targets  []WarmTargetResult `json:"targets"`
+}
+
+// WarmTargetResult is the last warm result for one target
+type WarmTargetResult struct {
+	Symbol     string    `json:"symbol"`
+	Resolution string    `json:"resolution"`
+	Window     string    `json:"window"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Candles    int       `json:"candles"`
+	CacheHit   bool      `json:"cache_hit"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// NewCacheWarmer creates a new cache warmer
+func NewCacheWarmer(viewport *ViewportService, cfg config.CacheWarmConfig) *CacheWarmer {
+	return &CacheWarmer{
+		viewport: viewport,
+		config:   cfg,
+		trigger:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		status: CacheWarmStatus{
+			Enabled:  cfg.Enabled,
+			Interval: cfg.Interval.String(),
+			Targets:  make([]WarmTargetResult, 0),
+		},
+	}
+}
+
+// Start warms the cache immediately and then on every interval
+func (w *CacheWarmer) Start() {
+	if !w.config.Enabled {
+		log.Info().Msg("Cache warmer disabled")
+		return
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.config.Interval)
+		defer ticker.Stop()
+
+		log.Info().
+			Dur("interval", w.config.Interval).
+			Int("targets", len(w.config.Targets)).
+			Msg("Cache warmer started")
+
+		w.runOnce()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.runOnce()
+			case <-w.trigger:
+				w.runOnce()
+			}
+		}
+	}()
+}
+
+// Stop halts the warmer and waits for an in-flight run to finish
+func (w *CacheWarmer) Stop() {
+	select {
+	case <-w.stop:
+		return
+	default:
+		close(w.stop)
+	}
+	w.wg.Wait()
+	log.Info().Msg("Cache warmer stopped")
+}
+
+// Trigger requests an immediate warm. It returns false if a run is already queued.
+func (w *CacheWarmer) Trigger() bool {
+	select {
+	case w.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// GetStatus returns a snapshot of the warmer state
+func (w *CacheWarmer) GetStatus() CacheWarmStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	status := w.status
+	status.Targets = append([]WarmTargetResult(nil), w.status.Targets...)
+	return status
+}
+
+// runOnce warms every configured target. Failures are recorded and logged
+// but never stop the run.
+func (w *CacheWarmer) runOnce() {
+	w.mu.Lock()
+	w.status.Running = true
+	w.mu.Unlock()
+
+	results := make([]WarmTargetResult, 0, len(w.config.Targets))
+	failures := 0
+	for _, target := range w.config.Targets {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		result := w.warmTarget(target)
+		if result.Error != "" {
+			failures++
+		}
+		results = append(results, result)
+	}
+
+	w.mu.Lock()
+	w.status.Running = false
+	w.status.Runs++
+	w.status.LastRun = time.Now().UTC()
+	w.status.Failures = failures
+	w.status.Targets = results
+	w.mu.Unlock()
+}
+
+// warmTarget loads one target through the normal GetSmartCandles path. The
+// window end is truncated to the minute so repeated runs share a cache key.
+func (w *CacheWarmer) warmTarget(target config.CacheWarmTarget) WarmTargetResult {
+	started := time.Now()
+	end := started.UTC().Truncate(time.Minute)
+	result := WarmTargetResult{
+		Symbol:     target.Symbol,
+		Resolution: target.Resolution,
+		Window:     target.Window.String(),
+		Start:      end.Add(-target.Window),
+		End:        end,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), warmTimeout)
+	defer cancel()
+
+	response, err := w.viewport.GetSmartCandles(ctx, models.CandleRequest{
+		Symbol:     target.Symbol,
+		Resolution: target.Resolution,
+		Start:      result.Start,
+		End:        result.End,
+	})
+	result.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		log.Warn().
+			Err(err).
+			Str("symbol", target.Symbol).
+			Str("resolution", target.Resolution).
+			Msg("Cache warm failed")
+		return result
+	}
+
+	result.Candles = response.Count
+	result.CacheHit = response.Metadata.CacheHit
+	return result
+}
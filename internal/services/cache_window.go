@@ -0,0 +1,115 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// Rolling cache statistics are kept in a ring of fixed-width buckets covering
+// the longest reported window
+const (
+	cacheWindowBucket  = 10 * time.Second
+	cacheWindowBuckets = int(time.Hour / cacheWindowBucket)
+)
+
+// cacheWindows are the rolling windows reported by GetStats
+var cacheWindows = []struct {
+	name   string
+	length time.Duration
+}{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+}
+
+// CacheWindowStats summarizes cache activity over a trailing window
+type CacheWindowStats struct {
+	Hits           int64
+	Misses         int64
+	HitRate        float64
+	Evictions      int64
+	AvgEvictionAge time.Duration // mean age of entries when evicted
+}
+
+// windowBucket holds the counters for one bucket interval
+type windowBucket struct {
+	epoch     int64 // bucket index since the Unix epoch; stale buckets are reset on use
+	hits      int64
+	misses    int64
+	evictions int64
+	evictAge  time.Duration
+}
+
+// windowCounters records per-bucket counters in a ring buffer
+type windowCounters struct {
+	mu      sync.Mutex
+	buckets [cacheWindowBuckets]windowBucket
+}
+
+// bucket returns the bucket for now, resetting it if it last held an older
+// interval. Must be called with the lock held.
+func (w *windowCounters) bucket(now time.Time) *windowBucket {
+	epoch := now.UnixNano() / int64(cacheWindowBucket)
+	b := &w.buckets[epoch%int64(cacheWindowBuckets)]
+	if b.epoch != epoch {
+		*b = windowBucket{epoch: epoch}
+	}
+	return b
+}
+
+// recordHit counts a hit at now
+func (w *windowCounters) recordHit(now time.Time) {
+	w.mu.Lock()
+	w.bucket(now).hits++
+	w.mu.Unlock()
+}
+
+// recordMiss counts a miss at now
+func (w *windowCounters) recordMiss(now time.Time) {
+	w.mu.Lock()
+	w.bucket(now).misses++
+	w.mu.Unlock()
+}
+
+// recordEviction counts an eviction at now of an entry with the given age
+func (w *windowCounters) recordEviction(now time.Time, age time.Duration) {
+	w.mu.Lock()
+	b := w.bucket(now)
+	b.evictions++
+	b.evictAge += age
+	w.mu.Unlock()
+}
+
+// snapshot sums the buckets inside each reported window ending at now
+func (w *windowCounters) snapshot(now time.Time) map[string]CacheWindowStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	current := now.UnixNano() / int64(cacheWindowBucket)
+	result := make(map[string]CacheWindowStats, len(cacheWindows))
+	for _, window := range cacheWindows {
+		n := int64(window.length / cacheWindowBucket)
+
+		var stats CacheWindowStats
+		var evictAge time.Duration
+		for i := range w.buckets {
+			b := &w.buckets[i]
+			if b.epoch > current || b.epoch <= current-n {
+				continue
+			}
+			stats.Hits += b.hits
+			stats.Misses += b.misses
+			stats.Evictions += b.evictions
+			evictAge += b.evictAge
+		}
+
+		if total := stats.Hits + stats.Misses; total > 0 {
+			stats.HitRate = float64(stats.Hits) / float64(total) * 100
+		}
+		if stats.Evictions > 0 {
+			stats.AvgEvictionAge = evictAge / time.Duration(stats.Evictions)
+		}
+		result[window.name] = stats
+	}
+	return result
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// Counters for bar problems corrected in candle results. They are package
+// level because DataService instances are created per request.
+var (
+	duplicateBarsTotal  atomic.Int64
+	outOfOrderBarsTotal atomic.Int64
+)
+
+// GetIntegrityStats returns the running totals of corrected bars
+func GetIntegrityStats() models.IntegrityStats {
+	return models.IntegrityStats{
+		DuplicateBars:  duplicateBarsTotal.Load(),
+		OutOfOrderBars: outOfOrderBarsTotal.Load(),
+	}
+}
+
+// checkCandleIntegrity detects out-of-order and duplicate bars. When either is
+// found the candles are sorted and deduplicated, keeping the last occurrence
+// of each timestamp, and a warning note is returned.
+func checkCandleIntegrity(candles []models.Candle) ([]models.Candle, []string) {
+	var duplicates, outOfOrder int
+	for i := 1; i < len(candles); i++ {
+		switch {
+		case candles[i].Timestamp.Equal(candles[i-1].Timestamp):
+			duplicates++
+		case candles[i].Timestamp.Before(candles[i-1].Timestamp):
+			outOfOrder++
+		}
+	}
+
+	if duplicates == 0 && outOfOrder == 0 {
+		return candles, nil
+	}
+
+	if outOfOrder > 0 {
+		sort.SliceStable(candles, func(i, j int) bool {
+			return candles[i].Timestamp.Before(candles[j].Timestamp)
+		})
+	}
+
+	// Stable sort keeps original order within a timestamp, so the last one wins
+	deduped := candles[:0]
+	removed := 0
+	for i := range candles {
+		if len(deduped) > 0 && deduped[len(deduped)-1].Timestamp.Equal(candles[i].Timestamp) {
+			deduped[len(deduped)-1] = candles[i]
+			removed++
+			continue
+		}
+		deduped = append(deduped, candles[i])
+	}
+
+	duplicateBarsTotal.Add(int64(removed))
+	outOfOrderBarsTotal.Add(int64(outOfOrder))
+
+	log.Warn().
+		Int("duplicates_removed", removed).
+		Int("out_of_order", outOfOrder).
+		Msg("Corrected candle integrity problems")
+
+	notes := make([]string, 0, 2)
+	if removed > 0 {
+		notes = append(notes, fmt.Sprintf("integrity: removed %d duplicate bars", removed))
+	}
+	if outOfOrder > 0 {
+		notes = append(notes, fmt.Sprintf("integrity: reordered %d out-of-order bars", outOfOrder))
+	}
+
+	return deduped, notes
+}
+
+// IsKnownTable reports whether table is one of the market data tables the API serves
+func IsKnownTable(table string) bool {
+	for _, known := range KnownTables() {
+		if table == known {
+			return true
+		}
+	}
+	return false
+}
+
+// FindDuplicateBars scans a table for duplicate (symbol, timestamp) pairs
+// and groups them into contiguous ranges
+func (s *DataService) FindDuplicateBars(ctx context.Context, table, symbol string) (*models.IntegrityReport, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryIntegrity, table)
+
+	if !IsKnownTable(table) {
+		return nil, fmt.Errorf("unknown table: %s", table)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT timestamp, row_count
+		FROM (
+			SELECT timestamp, count() as row_count
+			FROM %s
+			WHERE symbol = $1
+		)
+		WHERE row_count > 1
+		ORDER BY timestamp
+	`, table)
+
+	rows, err := s.pool.QueryWithTimeout(ctx, s.pool.ScanTimeout(), query, symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for duplicates: %w", err)
+	}
+	defer rows.Close()
+
+	// Duplicates within one bar of each other belong to the same range
+	maxGap := time.Minute
+	for _, tf := range ohlcTimeframes {
+		if table == fmt.Sprintf("ohlc_%s_v2", tf) {
+			maxGap, _ = timeframeDuration(tf)
+		}
+	}
+
+	report := &models.IntegrityReport{
+		Symbol:          symbol,
+		Table:           table,
+		DuplicateRanges: make([]models.DuplicateRange, 0),
+		ScannedAt:       time.Now().UTC(),
+	}
+
+	for rows.Next() {
+		var ts time.Time
+		var count int64
+		if err := rows.Scan(&ts, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan duplicate row: %w", err)
+		}
+
+		extra := count - 1
+		report.DuplicateRows += extra
+
+		n := len(report.DuplicateRanges)
+		if n > 0 && ts.Sub(report.DuplicateRanges[n-1].End) <= maxGap {
+			last := &report.DuplicateRanges[n-1]
+			last.End = ts
+			last.Timestamps++
+			last.ExtraRows += extra
+			continue
+		}
+
+		report.DuplicateRanges = append(report.DuplicateRanges, models.DuplicateRange{
+			Start:      ts,
+			End:        ts,
+			Timestamps: 1,
+			ExtraRows:  extra,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating duplicates: %w", err)
+	}
+
+	return report, nil
+}
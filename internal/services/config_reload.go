@@ -0,0 +1,140 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/config"
+)
+
+// ConfigReload reports one configuration reload: the changed settings now
+// in force, and those left as they were because they need a restart
+type ConfigReload struct {
+	ReloadedAt time.Time       `json:"reloaded_at"`
+	Applied    []config.Change `json:"applied"`
+	Rejected   []config.Change `json:"rejected"`
+}
+
+// ConfigReloader re-reads the configuration and applies the settings that
+// are safe to change while running: cache budgets and TTLs, provider rate
+// limits, slow query and acquire thresholds, and resolution point limits.
+// Everything else, such as database URLs and the server address, keeps its
+// startup value until a restart.
+type ConfigReloader struct {
+	path        string
+	options     []config.Option // command-line overrides, kept across reloads
+	cache       Cache
+	viewport    *ViewportService
+	dataManager *DataManager
+
+	mu      sync.Mutex
+	current *config.Config // the settings in force
+}
+
+// NewConfigReloader creates a reloader loading the configuration as
+// config.Load(path, options...) does, over the running configuration current
+func NewConfigReloader(path string, current *config.Config, cache Cache, viewport *ViewportService, dataManager *DataManager, options ...config.Option) *ConfigReloader {
+	return &ConfigReloader{
+		path:        path,
+		options:     options,
+		cache:       cache,
+		viewport:    viewport,
+		dataManager: dataManager,
+		current:     current,
+	}
+}
+
+// Current returns the configuration in force, which callers must not modify
+func (r *ConfigReloader) Current() *config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reload loads the configuration again and applies what changed. The
+// process environment is the one it started with, so reloads pick up edits
+// to the config file and the data contract file. A configuration that fails
+// to load changes nothing.
+func (r *ConfigReloader) Reload() (ConfigReload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	loaded, err := config.Load(r.path, r.options...)
+	if err != nil {
+		return ConfigReload{}, fmt.Errorf("failed to reload config: %w", err)
+	}
+
+	applied := r.apply(loaded)
+	reload := ConfigReload{
+		ReloadedAt: time.Now().UTC(),
+		Applied:    config.Diff(r.current, applied),
+		Rejected:   config.Diff(applied, loaded),
+	}
+	applied.CopySources(loaded, reload.Applied)
+	r.current = applied
+
+	for _, change := range reload.Applied {
+		log.Info().Str("setting", change.Setting).Str("old", change.Old).Str("new", change.New).Msg("Configuration setting reloaded")
+	}
+	for _, change := range reload.Rejected {
+		log.Warn().Str("setting", change.Setting).Str("old", change.Old).Str("new", change.New).Msg("Configuration setting changed but needs a restart to apply")
+	}
+	log.Info().Int("applied", len(reload.Applied)).Int("rejected", len(reload.Rejected)).Msg("Configuration reloaded")
+	return reload, nil
+}
+
+// apply hands the live settings of loaded to the services and returns the
+// configuration now in force: the current one with those settings replaced
+func (r *ConfigReloader) apply(loaded *config.Config) *config.Config {
+	next := *r.current
+
+	cache := loaded.Cache
+	cache.Backend = next.Cache.Backend
+	cache.RedisURL = next.Cache.RedisURL
+	cache.RedisPrefix = next.Cache.RedisPrefix
+	cache.Shards = next.Cache.Shards
+	if reconfigurable, ok := r.cache.(Reconfigurable); ok && !reflect.DeepEqual(next.Cache, cache) {
+		reconfigurable.Reconfigure(cache)
+		r.viewport.SetCacheTiers(cache.TTLTiers)
+		next.Cache = cache
+	}
+
+	if !reflect.DeepEqual(next.Fetch.ProviderLimits, loaded.Fetch.ProviderLimits) {
+		next.Fetch.ProviderLimits = loaded.Fetch.ProviderLimits
+		r.dataManager.SetProviderLimits(next.Fetch.ProviderLimits)
+	}
+
+	if next.Database.AcquireWaitLimit != loaded.Database.AcquireWaitLimit || next.Database.SlowQueryThreshold != loaded.Database.SlowQueryThreshold {
+		next.Database.AcquireWaitLimit = loaded.Database.AcquireWaitLimit
+		next.Database.SlowQueryThreshold = loaded.Database.SlowQueryThreshold
+		r.dataManager.SetSlowThresholds(next.Database.AcquireWaitLimit, next.Database.SlowQueryThreshold)
+	}
+
+	next.Data = applyData(next.Data, loaded.Data)
+	r.viewport.SetDataConfig(next.Data)
+	return &next
+}
+
+// applyData returns current with the request and per-resolution point
+// limits of loaded. The loaded data contract comes along only when the rest
+// of the resolution table is unchanged, so it describes the one in force.
+func applyData(current, loaded config.DataConfig) config.DataConfig {
+	next := current
+	next.MaxPointsPerRequest = loaded.MaxPointsPerRequest
+
+	next.Resolutions = make(map[string]config.ResolutionConfig, len(current.Resolutions))
+	for name, resolution := range current.Resolutions {
+		if reloaded, ok := loaded.Resolutions[name]; ok {
+			resolution.MaxPoints = reloaded.MaxPoints
+		}
+		next.Resolutions[name] = resolution
+	}
+
+	if reflect.DeepEqual(next.Resolutions, loaded.Resolutions) && next.ContractPath == loaded.ContractPath {
+		next.Contract = loaded.Contract
+	}
+	return next
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// indexContinuous sets each candle's index in the continuous series of bar
+// slots from origin that skips the symbol's closed-market slots, and returns
+// the mapping that converts indexes back to time. Candles must be in time
+// order and at or after origin.
+func (v *ViewportService) indexContinuous(symbol, resolution string, origin time.Time, candles []models.Candle) (*models.ContinuousMapping, error) {
+	bar, err := timeframeDuration(resolution)
+	if err != nil {
+		return nil, fmt.Errorf("%w: continuous series need a fixed bar length: %w", ErrInvalidResolution, err)
+	}
+	mapping := &models.ContinuousMapping{
+		Origin:        origin,
+		BarSeconds:    int64(bar / time.Second),
+		ClosedPeriods: []models.ClosedPeriod{},
+	}
+
+	var index int64
+	slot := origin
+	for i := range candles {
+		// Count the slots before the one holding the candle
+		for !slot.Add(bar).After(candles[i].Timestamp) {
+			if v.calendar.OpenWithin(symbol, slot, bar) {
+				index++
+			} else {
+				mapping.ClosedPeriods = skipSlot(mapping.ClosedPeriods, slot, bar)
+			}
+			slot = slot.Add(bar)
+		}
+		candles[i].Index = addInt64(nil, index)
+		index++
+		slot = slot.Add(bar)
+	}
+	return mapping, nil
+}
+
+// skipSlot records the closed slot at slot, extending the last closed
+// period when it ends there
+func skipSlot(periods []models.ClosedPeriod, slot time.Time, bar time.Duration) []models.ClosedPeriod {
+	if n := len(periods); n > 0 && periods[n-1].End.Equal(slot) {
+		periods[n-1].End = slot.Add(bar)
+		periods[n-1].Bars++
+		return periods
+	}
+	return append(periods, models.ClosedPeriod{Start: slot, End: slot.Add(bar), Bars: 1})
+}
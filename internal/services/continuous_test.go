@@ -0,0 +1,106 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/market"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+func TestIndexContinuousSkipsWeekendsAndHolidays(t *testing.T) {
+	calendar, err := market.NewCalendar(config.MarketConfig{
+		WeeklyClose: "Fri 22:00",
+		WeeklyOpen:  "Sun 22:00",
+		Holidays:    []string{"12-25"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &ViewportService{calendar: calendar}
+
+	at := func(day, hour int) time.Time { return time.Date(2024, 12, day, hour, 0, 0, 0, time.UTC) }
+	// Friday the 20th to Monday the 30th: two weekends with Christmas, a
+	// Wednesday, between them. Open hours without a candle still take an
+	// index.
+	want := []struct {
+		at    time.Time
+		index int64
+	}{
+		{at(20, 20), 0},
+		{at(20, 21), 1},
+		{at(22, 22), 2},  // first hour after the weekend
+		{at(24, 23), 51}, // Sunday's 2 hours, Monday's 24 and Tuesday's 23 before it
+		{at(26, 0), 52},  // Christmas skipped
+		{at(27, 21), 97},
+		{at(29, 22), 98},
+		{at(30, 1), 101},
+	}
+	candles := make([]models.Candle, len(want))
+	for i, w := range want {
+		candles[i] = models.Candle{Timestamp: w.at, Close: 1}
+	}
+
+	mapping, err := v.indexContinuous("EURUSD", "1h", at(20, 20), candles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, w := range want {
+		if candles[i].Index == nil || *candles[i].Index != w.index {
+			t.Errorf("candle at %s has index %v, want %d", w.at.Format("Mon 02 15:04"), candles[i].Index, w.index)
+		}
+	}
+
+	wantClosed := []models.ClosedPeriod{
+		{Start: at(20, 22), End: at(22, 22), Bars: 48},
+		{Start: at(25, 0), End: at(26, 0), Bars: 24},
+		{Start: at(27, 22), End: at(29, 22), Bars: 48},
+	}
+	if !reflect.DeepEqual(mapping.ClosedPeriods, wantClosed) {
+		t.Errorf("closed periods = %+v, want %+v", mapping.ClosedPeriods, wantClosed)
+	}
+	if mapping.BarSeconds != 3600 || !mapping.Origin.Equal(at(20, 20)) {
+		t.Errorf("mapping origin %s with %ds bars, want %s with 3600s", mapping.Origin, mapping.BarSeconds, at(20, 20))
+	}
+
+	// Index i's time is the origin plus i bars and every closed period before it
+	for i, w := range want {
+		ts := mapping.Origin.Add(time.Duration(w.index*mapping.BarSeconds) * time.Second)
+		for _, closed := range mapping.ClosedPeriods {
+			if !closed.Start.After(ts) {
+				ts = ts.Add(time.Duration(closed.Bars*mapping.BarSeconds) * time.Second)
+			}
+		}
+		if !ts.Equal(w.at) {
+			t.Errorf("index %d maps back to %s, want %s", *candles[i].Index, ts, w.at)
+		}
+	}
+}
+
+func TestIndexContinuousCryptoHasNoClosedPeriods(t *testing.T) {
+	calendar, err := market.NewCalendar(config.MarketConfig{WeeklyClose: "Fri 22:00", WeeklyOpen: "Sun 22:00", Holidays: []string{"12-25"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &ViewportService{calendar: calendar}
+
+	origin := time.Date(2024, 12, 20, 20, 0, 0, 0, time.UTC)
+	candles := []models.Candle{{Timestamp: origin.Add(100 * time.Hour)}}
+	mapping, err := v.indexContinuous("BTCUSD", "1h", origin, candles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mapping.ClosedPeriods) != 0 || *candles[0].Index != 100 {
+		t.Errorf("crypto candle index %d with closed periods %+v, want 100 and none", *candles[0].Index, mapping.ClosedPeriods)
+	}
+}
+
+func TestIndexContinuousNeedsFixedBars(t *testing.T) {
+	v := &ViewportService{}
+	if _, err := v.indexContinuous("EURUSD", "tick", time.Now(), nil); !errors.Is(err, ErrInvalidResolution) {
+		t.Errorf("continuous ticks: err = %v, want ErrInvalidResolution", err)
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/analytics"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// DefaultCorrelationWindow is the returns per correlation when the request
+// doesn't say
+const DefaultCorrelationWindow = 24
+
+// GetCorrelation correlates the log returns of two symbols' candles over the
+// request's window, rolling across the range, with the candles fetched as
+// /candles would. Bars only one symbol has are dropped; series that share
+// no bars, or too few for the window, fail with ErrInsufficientData.
+func (v *ViewportService) GetCorrelation(ctx context.Context, req models.CorrelationRequest, symbols [2]string) (*models.CorrelationResponse, error) {
+	start := time.Now()
+	window := req.Window
+	if window == 0 {
+		window = DefaultCorrelationWindow
+	}
+
+	var series [2]*models.CandleResponse
+	for i, symbol := range symbols {
+		response, err := v.GetSmartCandles(ctx, models.CandleRequest{
+			Symbol:    symbol,
+			Timeframe: req.Timeframe,
+			Start:     req.Start,
+			End:       req.End,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s candles: %w", symbol, err)
+		}
+		if response.IsEmpty() {
+			return nil, fmt.Errorf("%w: no %s candles between %s and %s", ErrNoData, symbol,
+				req.Start.Format(time.RFC3339), req.End.Format(time.RFC3339))
+		}
+		series[i] = response
+	}
+
+	a, b := series[0].Candles, series[1].Candles
+	aligned := analytics.Align(a, b)
+	if len(aligned.Timestamps) == 0 {
+		return nil, fmt.Errorf("%w: %s has bars from %s to %s and %s from %s to %s, none at the same time",
+			ErrInsufficientData,
+			symbols[0], a[0].Timestamp.Format(time.RFC3339), a[len(a)-1].Timestamp.Format(time.RFC3339),
+			symbols[1], b[0].Timestamp.Format(time.RFC3339), b[len(b)-1].Timestamp.Format(time.RFC3339))
+	}
+
+	correlation, err := analytics.RollingCorrelation(aligned, window)
+	if errors.Is(err, analytics.ErrWindowTooLarge) {
+		return nil, fmt.Errorf("%w: %w", ErrInsufficientData, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var notes []string
+	if dropA, dropB := len(a)-len(aligned.Timestamps), len(b)-len(aligned.Timestamps); dropA > 0 || dropB > 0 {
+		notes = append(notes, fmt.Sprintf("dropped %d %s and %d %s bars the other symbol has no bar at", dropA, symbols[0], dropB, symbols[1]))
+	}
+	for i, response := range series {
+		if !response.Metadata.DataComplete {
+			notes = append(notes, fmt.Sprintf("%s stopped at %d bars, short of the range end", symbols[i], response.Metadata.MaxPoints))
+		}
+	}
+
+	return &models.CorrelationResponse{
+		Symbols:    symbols[:],
+		Resolution: series[0].Resolution,
+		Start:      req.Start,
+		End:        req.End,
+		Window:     window,
+		Bars: map[string]int{
+			symbols[0]: len(a),
+			symbols[1]: len(b),
+		},
+		AlignedBars: len(aligned.Timestamps),
+		Correlation: correlation.Overall,
+		Count:       len(correlation.Series),
+		Series:      correlation.Series,
+		QueryTimeMs: time.Since(start).Milliseconds(),
+		Notes:       notes,
+	}, nil
+}
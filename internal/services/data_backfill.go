@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/db"
+)
+
+// backfillCheckTimeout bounds the availability checks of one backfill pass
+const backfillCheckTimeout = time.Minute
+
+// backfiller holds the catch-up scheduler's settings and state
+type backfiller struct {
+	config  config.FetchConfig
+	trigger chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	status  BackfillStatus
+}
+
+// BackfillStatus reports the catch-up scheduler state and its last pass
+type BackfillStatus struct {
+	Enabled     bool                   `json:"enabled"`
+	Interval    string                 `json:"interval"`
+	Lag         string                 `json:"lag"`
+	Symbols     []string               `json:"symbols"`
+	Runs        int64                  `json:"runs"`
+	JobsStarted int64                  `json:"jobs_started"`
+	LastRun     time.Time              `json:"last_run"`
+	Results     []BackfillSymbolResult `json:"results"`
+}
+
+// BackfillSymbolResult is the outcome of one symbol in the last pass
+type BackfillSymbolResult struct {
+	Symbol     string    `json:"symbol"`
+	LatestTick time.Time `json:"latest_tick,omitempty"`
+	Start      time.Time `json:"start,omitempty"`
+	End        time.Time `json:"end,omitempty"`
+	JobID      string    `json:"job_id,omitempty"`
+	Skipped    string    `json:"skipped,omitempty"` // why no job was started
+	Error      string    `json:"error,omitempty"`
+}
+
+// newBackfiller creates the scheduler state from the fetch config
+func newBackfiller(cfg config.FetchConfig) *backfiller {
+	return &backfiller{
+		config:  cfg,
+		trigger: make(chan struct{}, 1),
+		status: BackfillStatus{
+			Enabled:  cfg.BackfillEnabled,
+			Interval: cfg.BackfillInterval.String(),
+			Lag:      cfg.BackfillLag.String(),
+			Symbols:  cfg.BackfillSymbols,
+			Results:  make([]BackfillSymbolResult, 0),
+		},
+	}
+}
+
+// StartBackfill launches the catch-up scheduler, which periodically fetches
+// the hours between each configured symbol's newest tick and the provider's
+// publishing lag. Its jobs go through the same queue as requested ones.
+func (dm *DataManager) StartBackfill() {
+	cfg := dm.backfill.config
+	if !cfg.BackfillEnabled {
+		log.Info().Msg("Backfill scheduler disabled")
+		return
+	}
+
+	dm.backfill.wg.Add(1)
+	go func() {
+		defer dm.backfill.wg.Done()
+
+		ticker := time.NewTicker(cfg.BackfillInterval)
+		defer ticker.Stop()
+
+		log.Info().
+			Dur("interval", cfg.BackfillInterval).
+			Strs("symbols", cfg.BackfillSymbols).
+			Msg("Backfill scheduler started")
+
+		// Catch up on whatever was missed while the API was down
+		dm.runBackfill()
+		for {
+			select {
+			case <-dm.rootCtx.Done():
+				return
+			case <-ticker.C:
+				dm.runBackfill()
+			case <-dm.backfill.trigger:
+				dm.runBackfill()
+			}
+		}
+	}()
+}
+
+// TriggerBackfill requests an immediate backfill pass. It returns false if
+// the scheduler is disabled or a pass is already queued.
+func (dm *DataManager) TriggerBackfill() bool {
+	if !dm.backfill.config.BackfillEnabled {
+		return false
+	}
+	select {
+	case dm.backfill.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// GetBackfillStatus returns a snapshot of the backfill scheduler state
+func (dm *DataManager) GetBackfillStatus() BackfillStatus {
+	dm.backfill.mu.RLock()
+	defer dm.backfill.mu.RUnlock()
+
+	status := dm.backfill.status
+	status.Results = append([]BackfillSymbolResult(nil), dm.backfill.status.Results...)
+	return status
+}
+
+// runBackfill checks every configured symbol once
+func (dm *DataManager) runBackfill() {
+	ctx, cancel := context.WithTimeout(dm.rootCtx, backfillCheckTimeout)
+	defer cancel()
+
+	results := make([]BackfillSymbolResult, 0, len(dm.backfill.config.BackfillSymbols))
+	started := int64(0)
+	for _, symbol := range dm.backfill.config.BackfillSymbols {
+		result := dm.backfillSymbol(ctx, symbol, time.Now().UTC())
+		if result.JobID != "" {
+			started++
+		}
+		results = append(results, result)
+	}
+
+	dm.backfill.mu.Lock()
+	dm.backfill.status.Runs++
+	dm.backfill.status.JobsStarted += started
+	dm.backfill.status.LastRun = time.Now().UTC()
+	dm.backfill.status.Results = results
+	dm.backfill.mu.Unlock()
+}
+
+// backfillSymbol starts a job for the symbol's trailing gap, if it has one
+func (dm *DataManager) backfillSymbol(ctx context.Context, symbol string, now time.Time) BackfillSymbolResult {
+	ctx = db.WithQueryLabel(ctx, db.QueryLatestTick, "market_data_v2")
+
+	cfg := dm.backfill.config
+	result := BackfillSymbolResult{Symbol: symbol}
+
+	var latest *time.Time
+	err := dm.pool.QueryRowWithTimeout(ctx, dm.pool.QueryTimeout(), "SELECT max(timestamp) FROM market_data_v2 WHERE symbol = $1", symbol).Scan(&latest)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to read latest tick: %v", err)
+		log.Error().Err(err).Str("symbol", symbol).Msg("Backfill failed to read latest tick")
+		return result
+	}
+
+	// Hours later than the lag may not be published yet
+	end := now.Add(-cfg.BackfillLag).Truncate(time.Hour)
+	start := end.Add(-cfg.BackfillLookback)
+	if latest != nil {
+		result.LatestTick = *latest
+		// The hour holding the newest tick is already imported
+		if next := latest.UTC().Truncate(time.Hour).Add(time.Hour); next.After(start) {
+			start = next
+		}
+	}
+	result.Start, result.End = start, end
+
+	if !start.Before(end) {
+		result.Skipped = "up to date"
+		return result
+	}
+	if !dm.marketOpenBetween(symbol, start, end) {
+		result.Skipped = "market closed"
+		return result
+	}
+	if id := dm.pendingJob(symbol, start); id != "" {
+		result.Skipped = "job " + id + " already covers the range"
+		return result
+	}
+
+	job, err := dm.startJob(ctx, symbol, start, end, EnsureOptions{Priority: PriorityLow}, JobSourceBackfill)
+	if err != nil {
+		result.Error = err.Error()
+		log.Error().Err(err).Str("symbol", symbol).Msg("Backfill failed to start job")
+		return result
+	}
+	if job.done() {
+		result.Skipped = "no missing hours"
+		return result
+	}
+
+	result.JobID = job.ID
+	log.Info().
+		Str("job", job.ID).
+		Str("symbol", symbol).
+		Time("start", start).
+		Time("end", end).
+		Int("gaps", len(job.Gaps)).
+		Msg("Backfill triggered job")
+	return result
+}
+
+// marketOpenBetween reports whether the symbol's market is open during any
+// hour of [start, end)
+func (dm *DataManager) marketOpenBetween(symbol string, start, end time.Time) bool {
+	for hour := start.Truncate(time.Hour); hour.Before(end); hour = hour.Add(time.Hour) {
+		if dm.calendar.OpenDuring(symbol, hour) {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingJob returns the ID of an unfinished job for the symbol that reaches
+// past from, so a slow catch-up isn't queued twice
+func (dm *DataManager) pendingJob(symbol string, from time.Time) string {
+	dm.jobsMu.Lock()
+	defer dm.jobsMu.Unlock()
+
+	for _, job := range dm.jobs {
+		if job.Symbol == symbol && !job.done() && job.End.After(from) {
+			return job.ID
+		}
+	}
+	return ""
+}
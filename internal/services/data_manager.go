@@ -2,52 +2,213 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/config"
 	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/market"
+	"github.com/sptrader/sptrader/internal/models"
+	"github.com/sptrader/sptrader/internal/providers"
+	"github.com/sptrader/sptrader/internal/providers/dukascopy"
 )
 
 // DataManager handles on-demand data fetching and caching
 type DataManager struct {
 	pool         *db.Pool
-	mu           sync.RWMutex
-	fetching     map[string]bool // Track ongoing fetches to prevent duplicates
-	pythonScript string          // Path to dukascopy_to_ilp.py
+	writePool    *db.Pool // rebuilds OHLC bars over fetched ranges
+	cache        Cache
+	quotes       *TypedCache[models.Quote]
+	gapPolicy    GapPolicy
+	calendar     *market.Calendar // hours outside trading hours are never gaps
+	queue        *fetchQueue      // every gap fetch runs through this worker pool
+	rootCtx      context.Context  // parent of every job's context
+	stopJobs     context.CancelFunc
+	jobsMu       sync.Mutex
+	jobs         map[string]*FetchJob
+	jobRetention time.Duration  // how long finished jobs stay listable
+	store        *jobStore      // nil when job persistence is disabled
+	webhooks     *webhookSender // nil when job webhooks are disabled
+	retry        retryPolicy
+	gapFailures  map[string]int // jobs each gap has failed in after retries, guarded by jobsMu
+	backfill     *backfiller
+	retention    *retentionSweeper
+	staleness    *stalenessMonitor
+	alerts       *alertBook  // nil until StartAlerts configures it
+	purgeAudit   *purgeAudit // nil until StartRetention configures it
+	importer     *providers.Importer
+	registry     map[string]providers.Provider // providers by name
+	chains       map[string][]string           // provider names by symbol, asset class or "default"
+	useScript    bool
+	pythonScript string // Path to dukascopy_to_ilp.py, used only when useScript is set
+
+	audits     map[string]*AuditJob // integrity audits, guarded by jobsMu
+	auditLog   string               // integrity audit findings file; empty when disabled
+	auditLogMu sync.Mutex
+
+	// The database and provider calls fetch jobs make, replaceable in tests
+	checkAvailability func(ctx context.Context, symbol string, start, end time.Time) (*DataAvailability, error)
+	fetchRange        func(ctx context.Context, symbol string, start, end time.Time, onHour func(providers.HourResult)) (int64, []OHLCRebuild, error)
+	recordJob         func(job *FetchJob)
+
+	// The write pool calls purges make, replaceable in tests
+	purgeExec db.Execer
+	purgeTx   func(ctx context.Context, fn func(tx pgx.Tx) error) error
 }
 
 // DataAvailability represents what data we have for a symbol
 type DataAvailability struct {
-	Symbol      string    `json:"symbol"`
-	FirstTick   time.Time `json:"first_tick"`
-	LastTick    time.Time `json:"last_tick"`
-	TickCount   int64     `json:"tick_count"`
-	HasData     bool      `json:"has_data"`
-	Gaps        []Gap     `json:"gaps,omitempty"`
+	Symbol    string    `json:"symbol"`
+	FirstTick time.Time `json:"first_tick"`
+	LastTick  time.Time `json:"last_tick"`
+	TickCount int64     `json:"tick_count"`
+	HasData   bool      `json:"has_data"`
+	Gaps      []Gap     `json:"gaps,omitempty"` // missing ranges and market closures, in order
+	GapPolicy GapPolicy `json:"gap_policy"`
 }
 
-// Gap represents a missing data range
+// Gap types
+const (
+	GapMissing      = "missing"         // the market was open but no ticks are stored
+	GapMarketClosed = "market_closed"   // no ticks exist to fetch
+	GapIgnored      = "below_threshold" // missing, but too small to be worth a fetch
+)
+
+// Gap represents a range without data
 type Gap struct {
 	Start time.Time `json:"start"`
 	End   time.Time `json:"end"`
 	Hours int       `json:"hours"`
+	Type  string    `json:"type"`
+}
+
+// MissingGaps returns the gaps that can be fetched, leaving out closures
+func (a *DataAvailability) MissingGaps() []Gap {
+	var missing []Gap
+	for _, gap := range a.Gaps {
+		if gap.Type == GapMissing {
+			missing = append(missing, gap)
+		}
+	}
+	return missing
 }
 
 // NewDataManager creates a new data manager
-func NewDataManager(pool *db.Pool) *DataManager {
-	return &DataManager{
+func NewDataManager(pool, writePool *db.Pool, cache Cache, calendar *market.Calendar, cfg config.FetchConfig) *DataManager {
+	client := dukascopy.NewClient(cfg.DukascopyURL, cfg.Timeout, providerLimits(cfg.ProviderLimits[dukascopy.Name]))
+	rootCtx, stopJobs := context.WithCancel(context.Background())
+	dm := &DataManager{
+		rootCtx:      rootCtx,
+		stopJobs:     stopJobs,
 		pool:         pool,
-		fetching:     make(map[string]bool),
+		writePool:    writePool,
+		cache:        cache,
+		quotes:       NewTypedCache[models.Quote](cache, "quotes"),
+		calendar:     calendar,
+		gapPolicy:    newGapPolicy(cfg.MinGap, cfg.GapBridge),
+		backfill:     newBackfiller(cfg),
+		queue:        newFetchQueue(cfg.Workers, cfg.QueueAging),
+		jobs:         make(map[string]*FetchJob),
+		audits:       make(map[string]*AuditJob),
+		jobRetention: cfg.JobRetention,
+		retry: retryPolicy{
+			attempts: cfg.RetryAttempts,
+			base:     cfg.RetryBackoff,
+			max:      cfg.RetryMaxBackoff,
+		},
+		gapFailures:  make(map[string]int),
+		importer:     providers.NewImporter(cfg.ILPAddress, calendar),
+		registry:     map[string]providers.Provider{client.Name(): client},
+		chains:       cfg.Providers,
+		useScript:    cfg.UseScript,
 		pythonScript: os.Getenv("SPTRADER_HOME") + "/data_feeds/dukascopy_to_ilp.py",
 	}
+	dm.checkAvailability = dm.CheckDataAvailability
+	dm.fetchRange = dm.fetchDataRange
+	dm.recordJob = dm.recordFetch
+	dm.purgeExec = writePool
+	dm.purgeTx = writePool.WithTx
+
+	for key, chain := range dm.chains {
+		for _, name := range chain {
+			if _, ok := dm.registry[name]; !ok {
+				log.Warn().Str("provider", name).Str("chain", key).Msg("Unknown data provider in chain, skipping it")
+			}
+		}
+	}
+
+	switch {
+	case !cfg.WebhooksEnabled:
+	case cfg.WebhookSecret == "":
+		log.Warn().Msg("Job webhooks disabled: FETCH_WEBHOOK_SECRET is not set")
+	default:
+		dm.webhooks = &webhookSender{
+			client: &http.Client{Timeout: cfg.WebhookTimeout},
+			secret: []byte(cfg.WebhookSecret),
+			retry: retryPolicy{
+				attempts: cfg.WebhookAttempts,
+				base:     time.Second,
+				max:      time.Minute,
+			},
+		}
+	}
+
+	if cfg.AuditLog != "none" {
+		dm.auditLog = cfg.AuditLog
+	}
+
+	if cfg.JobStorePath != "" && cfg.JobStorePath != "none" {
+		dm.store = &jobStore{path: cfg.JobStorePath}
+		dm.restoreJobs(cfg.ResumeJobs)
+	}
+	return dm
 }
 
-// CheckDataAvailability checks what data we have for a symbol and time range
+// EnsureTables creates the fetch audit and data quality tables if they
+// don't exist yet. It runs once at startup; without the tables fetches
+// still work but leave no history or quality rows.
+func (dm *DataManager) EnsureTables(ctx context.Context) error {
+	var errs []error
+	if err := dm.ensureAuditTable(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to create %s: %w", fetchAuditTable, err))
+	}
+	if err := dm.ensureQualityTable(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to create %s: %w", dataQualityTable, err))
+	}
+	return errors.Join(errs...)
+}
+
+// jobContext creates the context a job runs under
+func (dm *DataManager) jobContext() (context.Context, context.CancelFunc) {
+	return context.WithCancel(dm.rootCtx)
+}
+
+// CheckDataAvailability checks what data we have for a symbol and time range.
+// Missing gaps close together are merged and ones too small to be worth a
+// fetch are reported as below_threshold, per the gap policy.
 func (dm *DataManager) CheckDataAvailability(ctx context.Context, symbol string, start, end time.Time) (*DataAvailability, error) {
+	availability, err := dm.hourlyAvailability(ctx, symbol, start, end)
+	if err != nil {
+		return nil, err
+	}
+	availability.Gaps = dm.gapPolicy.apply(availability.Gaps, end)
+	availability.GapPolicy = dm.gapPolicy
+	return availability, nil
+}
+
+// hourlyAvailability checks availability hour by hour, without the gap
+// policy applied
+func (dm *DataManager) hourlyAvailability(ctx context.Context, symbol string, start, end time.Time) (*DataAvailability, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryAvailability, "market_data_v2")
+
 	query := `
 		SELECT 
 			MIN(timestamp) as first_tick,
@@ -62,20 +223,21 @@ func (dm *DataManager) CheckDataAvailability(ctx context.Context, symbol string,
 	var availability DataAvailability
 	availability.Symbol = symbol
 
-	err := dm.pool.QueryRow(ctx, query, symbol, start, end).Scan(
+	err := dm.pool.QueryRowWithTimeout(ctx, dm.pool.QueryTimeout(), query, symbol, start, end).Scan(
 		&availability.FirstTick,
 		&availability.LastTick,
 		&availability.TickCount,
 	)
 
+	// A range without ticks fails to scan its NULL first and last tick, and
+	// is reported as missing; a database that can't answer is an error
+	if err = queryError(err); errors.Is(err, ErrTimeout) || errors.Is(err, ErrUnavailable) {
+		return nil, err
+	}
 	if err != nil || availability.TickCount == 0 {
 		availability.HasData = false
-		// If no data, the entire range is a gap
-		availability.Gaps = []Gap{{
-			Start: start,
-			End:   end,
-			Hours: int(end.Sub(start).Hours()),
-		}}
+		// If no data, every trading hour in the range is missing
+		availability.Gaps = dm.coverageGaps(symbol, start, end, nil)
 		return &availability, nil
 	}
 
@@ -90,6 +252,8 @@ func (dm *DataManager) CheckDataAvailability(ctx context.Context, symbol string,
 
 // findDataGaps identifies missing data ranges
 func (dm *DataManager) findDataGaps(ctx context.Context, symbol string, start, end time.Time) []Gap {
+	ctx = db.WithQueryLabel(ctx, db.QueryAvailability, "market_data_v2")
+
 	// Query to find hourly data coverage
 	query := `
 		SELECT 
@@ -103,9 +267,9 @@ func (dm *DataManager) findDataGaps(ctx context.Context, symbol string, start, e
 		ORDER BY hour
 	`
 
-	rows, err := dm.pool.Query(ctx, query, symbol, start, end)
+	rows, err := dm.pool.QueryWithTimeout(ctx, dm.pool.QueryTimeout(), query, symbol, start, end)
 	if err != nil {
-		log.Printf("Error finding gaps: %v", err)
+		log.Error().Err(err).Str("symbol", symbol).Msg("Error finding gaps")
 		return nil
 	}
 	defer rows.Close()
@@ -116,97 +280,345 @@ func (dm *DataManager) findDataGaps(ctx context.Context, symbol string, start, e
 		var hour time.Time
 		var count int
 		if err := rows.Scan(&hour, &count); err == nil && count > 0 {
-			hoursWithData[hour] = true
+			hoursWithData[hour.UTC()] = true
 		}
 	}
 
-	// Find gaps
-	var gaps []Gap
-	current := start.Truncate(time.Hour)
-	gapStart := time.Time{}
-
-	for current.Before(end) {
-		// Skip weekends (forex market closed)
-		if current.Weekday() == time.Saturday || current.Weekday() == time.Sunday {
-			current = current.Add(time.Hour)
-			continue
-		}
+	return dm.coverageGaps(symbol, start, end, hoursWithData)
+}
 
-		if !hoursWithData[current] {
-			if gapStart.IsZero() {
-				gapStart = current
-			}
-		} else if !gapStart.IsZero() {
-			// End of gap
+// coverageGaps returns the runs of hours in [start, end) without data,
+// typed as missing when the symbol's market was open and market_closed when
+// it wasn't. The two never merge, so a missing gap never spans a weekend.
+func (dm *DataManager) coverageGaps(symbol string, start, end time.Time, hoursWithData map[time.Time]bool) []Gap {
+	var gaps []Gap
+	var gapStart time.Time
+	gapType := ""
+	closeGap := func(at time.Time) {
+		if gapType != "" {
 			gaps = append(gaps, Gap{
 				Start: gapStart,
-				End:   current,
-				Hours: int(current.Sub(gapStart).Hours()),
+				End:   at,
+				Hours: int(at.Sub(gapStart).Hours()),
+				Type:  gapType,
 			})
-			gapStart = time.Time{}
+			gapType = ""
 		}
-
-		current = current.Add(time.Hour)
 	}
 
-	// Handle gap that extends to end
-	if !gapStart.IsZero() {
-		gaps = append(gaps, Gap{
-			Start: gapStart,
-			End:   end,
-			Hours: int(end.Sub(gapStart).Hours()),
-		})
+	for current := start.UTC().Truncate(time.Hour); current.Before(end); current = current.Add(time.Hour) {
+		hourType := ""
+		switch {
+		case !dm.calendar.OpenDuring(symbol, current):
+			hourType = GapMarketClosed
+		case !hoursWithData[current]:
+			hourType = GapMissing
+		}
+
+		if hourType != gapType {
+			closeGap(current)
+			gapStart, gapType = current, hourType
+		}
 	}
+	// Handle gap that extends to end
+	closeGap(end)
 
 	return gaps
 }
 
-// EnsureData checks if data exists and fetches if missing
-func (dm *DataManager) EnsureData(ctx context.Context, symbol string, start, end time.Time) error {
-	availability, err := dm.CheckDataAvailability(ctx, symbol, start, end)
+// Close stops the backfill, retention and staleness schedulers, cancels every
+// running fetch job and stops the fetch workers
+func (dm *DataManager) Close() {
+	dm.stopJobs()
+	dm.backfill.wg.Wait()
+	if dm.retention != nil {
+		dm.retention.wg.Wait()
+	}
+	if dm.staleness != nil {
+		dm.staleness.wg.Wait()
+	}
+	if dm.alerts != nil {
+		dm.alerts.wg.Wait()
+	}
+	dm.queue.close()
+}
+
+// PoolMetrics returns the metrics of the read and write database pools
+func (dm *DataManager) PoolMetrics() map[string]db.PoolMetrics {
+	return map[string]db.PoolMetrics{
+		"read":  dm.pool.PoolMetrics(),
+		"write": dm.writePool.PoolMetrics(),
+	}
+}
+
+// QueryMetrics returns the per-query metrics of the read and write
+// database pools
+func (dm *DataManager) QueryMetrics() map[string][]db.QueryMetric {
+	return map[string][]db.QueryMetric{
+		"read":  dm.pool.QueryMetrics(),
+		"write": dm.writePool.QueryMetrics(),
+	}
+}
+
+// SetSlowThresholds changes the slow acquire and slow query thresholds of
+// the read and write database pools
+func (dm *DataManager) SetSlowThresholds(acquireWaitLimit, slowQuery time.Duration) {
+	dm.pool.SetSlowThresholds(acquireWaitLimit, slowQuery)
+	dm.writePool.SetSlowThresholds(acquireWaitLimit, slowQuery)
+}
+
+// ReconnectDatabase drops the connections of both database pools and checks
+// each can dial fresh ones
+func (dm *DataManager) ReconnectDatabase(ctx context.Context) error {
+	if err := dm.pool.Reconnect(ctx); err != nil {
+		return fmt.Errorf("read pool: %w", err)
+	}
+	if err := dm.writePool.Reconnect(ctx); err != nil {
+		return fmt.Errorf("write pool: %w", err)
+	}
+	return nil
+}
+
+// HealthReport runs the deep health check on the read pool and a basic one
+// on the write pool, reported as the "write_database" component
+func (dm *DataManager) HealthReport(ctx context.Context) db.HealthReport {
+	report := dm.pool.DeepHealthCheck(ctx)
+
+	start := time.Now()
+	component := db.HealthComponent{Name: "write_database", Healthy: true}
+	if err := dm.writePool.HealthCheck(ctx); err != nil {
+		component.Healthy = false
+		component.Error = err.Error()
+	}
+	component.LatencyMs = float64(time.Since(start)) / float64(time.Millisecond)
+	report.Add(component)
+	return report
+}
+
+// EnsureOptions are the optional settings of an EnsureData request
+type EnsureOptions struct {
+	Priority    JobPriority
+	CallbackURL string // POSTed a signed JobWebhook when the job finishes
+	RequestedBy string // client that asked for the data, for the fetch audit
+}
+
+// EnsureData checks which parts of the range are missing and starts a
+// background job to fetch them. It returns the job, which is already
+// finished when nothing is missing. ctx only bounds the availability check;
+// the job runs under its own context so it outlives the request.
+func (dm *DataManager) EnsureData(ctx context.Context, symbol string, start, end time.Time, opts EnsureOptions) (FetchJob, error) {
+	if err := dm.validateCallbackURL(opts.CallbackURL); err != nil {
+		return FetchJob{}, err
+	}
+	return dm.startJob(ctx, symbol, start, end, opts, JobSourceAPI)
+}
+
+// startJob creates a job for the missing parts of the range and runs it in
+// the background. A request covered by an unfinished job for the symbol
+// attaches to that job instead of starting another; requests that merely
+// overlap get their own job, whose gap fetches queue behind the symbol's
+// earlier ones and re-check availability before fetching.
+func (dm *DataManager) startJob(ctx context.Context, symbol string, start, end time.Time, opts EnsureOptions, source string) (FetchJob, error) {
+	if opts.Priority == "" {
+		opts.Priority = PriorityNormal
+	}
+
+	dm.jobsMu.Lock()
+	existing := dm.attachJob(symbol, start, end, opts.Priority, opts.CallbackURL)
+	dm.jobsMu.Unlock()
+	if existing != nil {
+		return *existing, nil
+	}
+
+	availability, err := dm.checkAvailability(ctx, symbol, start, end)
 	if err != nil {
-		return fmt.Errorf("failed to check availability: %w", err)
+		return FetchJob{}, fmt.Errorf("failed to check availability: %w", err)
+	}
+
+	// Market closures have nothing to fetch
+	missing := availability.MissingGaps()
+	job := &FetchJob{
+		ID:        newJobID(),
+		Symbol:    symbol,
+		Start:     start,
+		End:       end,
+		State:     JobQueued,
+		Gaps:      make([]GapProgress, 0, len(missing)),
+		Source:    source,
+		Priority:  opts.Priority,
+		CreatedAt: time.Now().UTC(),
+
+		RequestedBy: opts.RequestedBy,
+		CallbackURL: opts.CallbackURL,
+	}
+	jobCtx, cancel := dm.jobContext()
+	job.cancel = cancel
+	for _, gap := range missing {
+		job.Gaps = append(job.Gaps, GapProgress{Gap: gap, State: string(JobQueued)})
+		job.Progress.HoursTotal += hourFiles(gap)
 	}
 
 	// If no gaps, we have all the data
-	if len(availability.Gaps) == 0 {
-		log.Printf("Data already available for %s from %s to %s", symbol, start.Format("2006-01-02"), end.Format("2006-01-02"))
-		return nil
+	if len(job.Gaps) == 0 {
+		log.Info().Str("symbol", symbol).Time("start", start).Time("end", end).Msg("Data already available")
+		job.State = JobSucceeded
+		job.FinishedAt = &job.CreatedAt
+		cancel()
 	}
 
-	// Fetch data for each gap
-	for _, gap := range availability.Gaps {
-		if err := dm.fetchDataRange(ctx, symbol, gap.Start, gap.End); err != nil {
-			return fmt.Errorf("failed to fetch data for gap: %w", err)
+	dm.jobsMu.Lock()
+	// A covering job may have been created during the availability check
+	if !job.done() {
+		if existing := dm.attachJob(symbol, start, end, opts.Priority, opts.CallbackURL); existing != nil {
+			dm.jobsMu.Unlock()
+			cancel()
+			return *existing, nil
 		}
 	}
-
-	return nil
+	dm.pruneJobs()
+	dm.jobs[job.ID] = job
+	snapshot := job.snapshot()
+	dm.jobsMu.Unlock()
+
+	dm.persistJobs()
+	if job.done() {
+		dm.notifyJob(job)
+		go dm.recordJob(job)
+	} else {
+		go dm.runJob(jobCtx, job)
+	}
+	return snapshot, nil
 }
 
-// fetchDataRange fetches missing data using the Python script
-func (dm *DataManager) fetchDataRange(ctx context.Context, symbol string, start, end time.Time) error {
-	// Prevent duplicate fetches
-	key := fmt.Sprintf("%s_%s_%s", symbol, start.Format("20060102"), end.Format("20060102"))
-	
-	dm.mu.Lock()
-	if dm.fetching[key] {
-		dm.mu.Unlock()
-		log.Printf("Already fetching %s", key)
-		return nil
+// fetchDataRange downloads missing ticks from Dukascopy, or runs the Python
+// script when configured to, and returns the number of ticks written. The
+// native fetcher imports only the hours still missing, so a range bridged
+// over hours that have data doesn't duplicate them, and reports each hour to
+// onHour; the script reports neither progress nor a tick count. The OHLC
+// tables are then rebuilt over just the fetched window; a rebuild failure
+// is recorded on the returned rebuilds rather than failing the fetch, since
+// the ticks are already stored.
+func (dm *DataManager) fetchDataRange(ctx context.Context, symbol string, start, end time.Time, onHour func(providers.HourResult)) (int64, []OHLCRebuild, error) {
+	// An earlier job for the symbol may have filled the range while this one
+	// waited in the queue
+	availability, err := dm.hourlyAvailability(ctx, symbol, start, end)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to check availability: %w", err)
+	}
+	missing := availability.MissingGaps()
+	if len(missing) == 0 {
+		log.Info().Str("symbol", symbol).Time("start", start).Time("end", end).Msg("Range already filled")
+		return 0, nil, errAlreadyFilled
+	}
+
+	log.Info().Str("symbol", symbol).Time("start", start).Time("end", end).Msg("Fetching data")
+
+	var ticks int64
+	chain := dm.providerChain(symbol)
+	if !dm.useScript && len(chain) == 0 {
+		return 0, nil, fmt.Errorf("%w: %s", ErrNoProvider, symbol)
+	}
+	if dm.useScript {
+		if err := dm.runFetchScript(ctx, symbol, start, end); err != nil {
+			return 0, nil, err
+		}
+	} else {
+		hours, empty := 0, 0
+		next := start.UTC().Truncate(time.Hour)
+		for _, gap := range missing {
+			// Hours between the missing runs already have data; count them
+			// as done so progress still reaches the whole range
+			for ; next.Before(gap.Start); next = next.Add(time.Hour) {
+				onHour(providers.HourResult{Hour: next})
+			}
+
+			results, err := dm.importer.Import(ctx, chain, symbol, gap.Start, gap.End, onHour)
+			hours += len(results)
+			for _, result := range results {
+				ticks += int64(result.Ticks)
+				if result.NoData {
+					empty++
+				}
+			}
+			if err != nil {
+				if ticks > 0 {
+					dm.cache.InvalidateTag(SymbolTag(symbol))
+				}
+				return ticks, nil, fmt.Errorf("fetch failed after %d hours: %w", hours, err)
+			}
+			next = gap.End
+		}
+		log.Info().
+			Str("symbol", symbol).
+			Int64("ticks", ticks).
+			Int("hours", hours).
+			Int("empty_hours", empty).
+			Msg("Imported ticks")
+	}
+
+	log.Info().Str("symbol", symbol).Msg("Successfully fetched data")
+
+	// Only the window that was written needs new bars
+	from, to := start, end
+	if !dm.useScript {
+		from, to = missing[0].Start, missing[len(missing)-1].End
+	}
+	rebuilds := rebuildOHLC(context.WithoutCancel(ctx), dm.writePool, symbol, from, to)
+	bars := int64(0)
+	for _, rebuild := range rebuilds {
+		bars += rebuild.Bars
+		if rebuild.Error != "" {
+			log.Error().Str("table", rebuild.Table).Str("symbol", symbol).Str("error", rebuild.Error).Msg("OHLC rebuild failed")
+		}
 	}
-	dm.fetching[key] = true
-	dm.mu.Unlock()
+	log.Info().Str("symbol", symbol).Int64("bars", bars).Int("tables", len(rebuilds)).Msg("Rebuilt OHLC bars")
 
-	defer func() {
-		dm.mu.Lock()
-		delete(dm.fetching, key)
-		dm.mu.Unlock()
-	}()
+	dm.updateDataQuality(context.WithoutCancel(ctx), symbol, from, to)
+
+	// Cached responses for the symbol no longer reflect the new data
+	removed := dm.cache.InvalidateTag(SymbolTag(symbol))
+	log.Info().Str("symbol", symbol).Int("entries", removed).Msg("Invalidated cached entries")
+	return ticks, rebuilds, nil
+}
+
+// attachJob finds an unfinished job for the symbol whose range covers
+// [start, end) and attaches the request to it: the job is raised to the
+// request's priority and takes its callback URL if it has none. Returns nil
+// when there is no such job, or when the request's callback can't be
+// honoured by it. Must be called with jobsMu held.
+func (dm *DataManager) attachJob(symbol string, start, end time.Time, priority JobPriority, callbackURL string) *FetchJob {
+	for _, job := range dm.jobs {
+		if job.Symbol != symbol || job.done() || job.Start.After(start) || job.End.Before(end) {
+			continue
+		}
+		if callbackURL != "" && job.CallbackURL != "" && job.CallbackURL != callbackURL {
+			continue
+		}
 
-	log.Printf("Fetching %s data from %s to %s", symbol, start.Format("2006-01-02"), end.Format("2006-01-02"))
+		if callbackURL != "" {
+			job.CallbackURL = callbackURL
+		}
+		if priority.rank() > job.Priority.rank() {
+			job.Priority = priority
+			dm.queue.reprioritize(job.ID, priority.rank())
+		}
+		log.Info().
+			Str("job", job.ID).
+			Str("symbol", symbol).
+			Time("start", start).
+			Time("end", end).
+			Msg("Request attached to fetch job")
+
+		snapshot := job.snapshot()
+		snapshot.Attached = true
+		snapshot.QueuePos = dm.queue.position(job.ID)
+		return &snapshot
+	}
+	return nil
+}
 
-	// Run Python script
+// runFetchScript fetches data with the legacy Python script
+func (dm *DataManager) runFetchScript(ctx context.Context, symbol string, start, end time.Time) error {
 	cmd := exec.CommandContext(ctx, "python3", dm.pythonScript,
 		symbol,
 		start.Format("2006-01-02"),
@@ -218,25 +630,6 @@ func (dm *DataManager) fetchDataRange(ctx context.Context, symbol string, start,
 	if err != nil {
 		return fmt.Errorf("fetch failed: %w\nOutput: %s", err, string(output))
 	}
-
-	log.Printf("Successfully fetched %s data", symbol)
-	
-	// Generate OHLC data after fetching
-	return dm.generateOHLC(ctx)
-}
-
-// generateOHLC triggers OHLC generation
-func (dm *DataManager) generateOHLC(ctx context.Context) error {
-	cmd := exec.CommandContext(ctx, "python3", "-c",
-		`from dukascopy_importer import DukascopyDownloader; d=DukascopyDownloader(); d.generate_ohlcv()`,
-	)
-	cmd.Dir = os.Getenv("SPTRADER_HOME") + "/data_feeds"
-
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("OHLC generation failed: %w\nOutput: %s", err, string(output))
-	}
-
-	log.Println("OHLC data generated successfully")
 	return nil
 }
 
@@ -253,15 +646,21 @@ func (dm *DataManager) GetDataStatus(ctx context.Context) (map[string]interface{
 		ORDER BY symbol
 	`
 
-	rows, err := dm.pool.Query(ctx, query)
+	rows, err := dm.pool.QueryWithTimeout(ctx, dm.pool.ScanTimeout(), query)
 	if err != nil {
-		return nil, err
+		return nil, queryError(err)
 	}
 	defer rows.Close()
 
 	symbols := make([]map[string]interface{}, 0)
 	totalTicks := int64(0)
 
+	// Staleness investigations start from each symbol's latest fetch
+	latest, err := dm.latestFetches(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read latest fetches")
+	}
+
 	for rows.Next() {
 		var symbol string
 		var count int64
@@ -271,19 +670,29 @@ func (dm *DataManager) GetDataStatus(ctx context.Context) (map[string]interface{
 			continue
 		}
 
-		symbols = append(symbols, map[string]interface{}{
-			"symbol":     symbol,
-			"tick_count": count,
-			"first_tick": first,
-			"last_tick":  last,
-			"days":       int(last.Sub(first).Hours() / 24),
-		})
+		entry := map[string]interface{}{
+			"symbol":      symbol,
+			"tick_count":  count,
+			"first_tick":  first,
+			"last_tick":   last,
+			"days":        int(last.Sub(first).Hours() / 24),
+			"history_url": "/api/v1/data/history?symbol=" + url.QueryEscape(symbol),
+		}
+		if record, ok := latest[symbol]; ok {
+			entry["last_fetch"] = record
+		}
+		if staleness, ok := dm.symbolStaleness(symbol); ok {
+			entry["staleness"] = staleness
+		}
+		symbols = append(symbols, entry)
 		totalTicks += count
 	}
 
 	return map[string]interface{}{
-		"total_ticks": totalTicks,
-		"symbols":     symbols,
-		"updated_at":  time.Now(),
+		"total_ticks":  totalTicks,
+		"symbols":      symbols,
+		"gap_failures": dm.RepeatedGapFailures(),
+		"providers":    dm.ProviderStatus(),
+		"updated_at":   time.Now(),
 	}, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/market"
+	"github.com/sptrader/sptrader/internal/providers"
+)
+
+// defaultProviderChain is the chain key used for symbols without their own
+// or their asset class's chain
+const defaultProviderChain = "default"
+
+// ErrNoProvider is returned when no configured provider serves a symbol
+var ErrNoProvider = errors.New("no data provider serves symbol")
+
+// providerChain returns the providers to try for a symbol, in order: the
+// chain configured for the symbol, else for its asset class, else the
+// default chain. Unknown names and providers that don't serve the symbol are
+// left out.
+func (dm *DataManager) providerChain(symbol string) []providers.Provider {
+	names, ok := dm.chains[strings.ToUpper(symbol)]
+	if !ok {
+		names, ok = dm.chains[string(market.ClassOf(symbol))]
+	}
+	if !ok {
+		names = dm.chains[defaultProviderChain]
+	}
+
+	chain := make([]providers.Provider, 0, len(names))
+	for _, name := range names {
+		provider, ok := dm.registry[name]
+		if !ok || !provider.Capabilities().Supports(symbol) {
+			continue
+		}
+		chain = append(chain, provider)
+	}
+	return chain
+}
+
+// ProviderStatus returns the rate limiting state of every provider that
+// limits its requests, by name
+func (dm *DataManager) ProviderStatus() map[string]providers.LimiterStatus {
+	status := make(map[string]providers.LimiterStatus)
+	for name, provider := range dm.registry {
+		if limited, ok := provider.(providers.Limited); ok {
+			status[name] = limited.LimiterStatus()
+		}
+	}
+	return status
+}
+
+// SetProviderLimits applies changed rate limits to every provider that
+// limits its requests. Providers missing from limits become unthrottled, as
+// they would be at startup.
+func (dm *DataManager) SetProviderLimits(limits map[string]config.ProviderLimits) {
+	for name, provider := range dm.registry {
+		if limited, ok := provider.(providers.Limited); ok {
+			limited.SetLimits(providerLimits(limits[name]))
+		}
+	}
+}
+
+// providerLimits converts configured limits to a limiter's
+func providerLimits(limits config.ProviderLimits) providers.Limits {
+	return providers.Limits{
+		RequestsPerSecond: limits.RequestsPerSecond,
+		MaxConcurrent:     limits.MaxConcurrent,
+		Cooldown:          limits.Cooldown,
+	}
+}
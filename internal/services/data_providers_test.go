@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/providers"
+)
+
+// stubProvider is a named provider serving only its capabilities' symbols
+type stubProvider struct {
+	name string
+	caps providers.Capabilities
+}
+
+func (p stubProvider) Name() string                         { return p.name }
+func (p stubProvider) Capabilities() providers.Capabilities { return p.caps }
+
+func (p stubProvider) FetchTicks(ctx context.Context, symbol string, start, end time.Time, emit func(providers.Tick) error) error {
+	return providers.ErrNoData
+}
+
+func TestProviderChain(t *testing.T) {
+	dm := newTestDataManager(t)
+	dm.registry = map[string]providers.Provider{
+		"dukascopy": stubProvider{name: "dukascopy"},
+		"oanda":     stubProvider{name: "oanda", caps: providers.Capabilities{Symbols: []string{"EURUSD", "GBPUSD"}}},
+		"binance":   stubProvider{name: "binance", caps: providers.Capabilities{Symbols: []string{"BTCUSD"}}},
+	}
+	dm.chains = map[string][]string{
+		"GBPUSD":             {"oanda", "dukascopy"},
+		"crypto":             {"binance", "retired", "dukascopy"},
+		defaultProviderChain: {"dukascopy", "oanda"},
+	}
+
+	tests := []struct {
+		symbol string
+		want   []string
+	}{
+		{"gbpusd", []string{"oanda", "dukascopy"}},   // the symbol's own chain, in its order
+		{"BTCUSD", []string{"binance", "dukascopy"}}, // the asset class's, without unknown names
+		{"EURUSD", []string{"dukascopy", "oanda"}},   // the default
+		{"USDJPY", []string{"dukascopy"}},            // without providers not serving it
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, provider := range dm.providerChain(tt.symbol) {
+			got = append(got, provider.Name())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: chain %q, want %q", tt.symbol, got, tt.want)
+		}
+	}
+}
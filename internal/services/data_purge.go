@@ -0,0 +1,327 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/db"
+)
+
+// Purge methods
+const (
+	PurgeDropPartition = "drop_partition" // whole partitions, fast
+	PurgeDelete        = "delete"         // row by row, for partial partitions or one symbol
+)
+
+// ErrPurgeTable is returned for tables that purges may not touch
+var ErrPurgeTable = errors.New("table cannot be purged")
+
+// PurgeStep is one statement of a purge: the rows it expects to remove when
+// planned, or did remove once run
+type PurgeStep struct {
+	Table      string    `json:"table"`
+	Method     string    `json:"method"`
+	Symbol     string    `json:"symbol,omitempty"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Partitions []string  `json:"partitions,omitempty"`
+	Rows       int64     `json:"rows"`
+	DryRun     bool      `json:"dry_run,omitempty"`
+	At         time.Time `json:"at"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// purgeAudit appends every executed purge step to a JSON lines file
+type purgeAudit struct {
+	mu   sync.Mutex
+	path string
+}
+
+// record appends a step, logging rather than failing if the file can't be
+// written
+func (a *purgeAudit) record(step PurgeStep) {
+	log.Info().
+		Str("method", step.Method).
+		Str("table", step.Table).
+		Str("symbol", step.Symbol).
+		Time("start", step.Start).
+		Time("end", step.End).
+		Int("partitions", len(step.Partitions)).
+		Int64("rows", step.Rows).
+		Str("error", step.Error).
+		Msg("Purge step")
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := appendJSONLine(a.path, step); err != nil {
+		log.Error().Err(err).Str("path", a.path).Msg("Failed to write purge audit log")
+	}
+}
+
+// appendJSONLine appends v as one JSON line to the file at path, creating
+// the file and its directory as needed
+func appendJSONLine(path string, v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// purgeableTable reports whether purges may touch a table: the tick table
+// or one of the OHLC tables
+func purgeableTable(table string) bool {
+	if table == tickTable {
+		return true
+	}
+	for _, tf := range ohlcTimeframes {
+		if table == fmt.Sprintf("ohlc_%s_v2", tf) {
+			return true
+		}
+	}
+	return false
+}
+
+// PurgeRange removes data in [start, end) from each listed table, for one
+// symbol or, when symbol is empty, for all of them. Only the listed tables
+// are touched. Partitions lying wholly inside the range are dropped, which
+// is fast; rows left over, or any rows when a symbol is given, are deleted.
+// Every step is written to the audit log.
+//
+// Partition drops are DDL, which QuestDB applies as soon as it runs, so they
+// run first, each on its own. The row deletes of every table then run in
+// one transaction: if any fails, none of them is applied.
+func (dm *DataManager) PurgeRange(ctx context.Context, symbol string, start, end time.Time, tables []string) ([]PurgeStep, error) {
+	return dm.purge(ctx, symbol, start, end, tables, false)
+}
+
+// purge plans and runs a purge; wholePartitions limits it to dropping whole
+// partitions, leaving partial ones for a later pass
+func (dm *DataManager) purge(ctx context.Context, symbol string, start, end time.Time, tables []string, wholePartitions bool) ([]PurgeStep, error) {
+	var drops, deletes []PurgeStep
+	for _, table := range tables {
+		steps, err := dm.planPurge(ctx, table, symbol, start, end, wholePartitions)
+		if err != nil {
+			return nil, err
+		}
+		for _, step := range steps {
+			if step.Method == PurgeDropPartition {
+				drops = append(drops, step)
+			} else {
+				deletes = append(deletes, step)
+			}
+		}
+	}
+
+	executed, err := dm.runPurge(ctx, drops, deletes)
+	if len(executed) > 0 {
+		if symbol != "" {
+			dm.cache.InvalidateTag(SymbolTag(symbol))
+		} else {
+			dm.cache.InvalidatePrefix("")
+		}
+	}
+	return executed, err
+}
+
+// runPurge drops the planned partitions, then runs the planned deletes in
+// one transaction, auditing every step
+func (dm *DataManager) runPurge(ctx context.Context, drops, deletes []PurgeStep) ([]PurgeStep, error) {
+	var executed []PurgeStep
+	for _, step := range drops {
+		var err error
+		step.Rows, err = dm.runPurgeStep(ctx, dm.purgeExec, step)
+		step.At = time.Now().UTC()
+		if err != nil {
+			step.Error = err.Error()
+		}
+		dm.purgeAudit.record(step)
+		executed = append(executed, step)
+		if err != nil {
+			return executed, fmt.Errorf("failed to purge %s: %w", step.Table, err)
+		}
+	}
+	if len(deletes) == 0 {
+		return executed, nil
+	}
+
+	var deleted []PurgeStep
+	err := dm.purgeTx(ctx, func(tx pgx.Tx) error {
+		deleted = deleted[:0]
+		for _, step := range deletes {
+			rows, err := dm.runPurgeStep(ctx, tx, step)
+			if err != nil {
+				return fmt.Errorf("failed to purge %s: %w", step.Table, err)
+			}
+			step.Rows = rows
+			deleted = append(deleted, step)
+		}
+		return nil
+	})
+
+	at := time.Now().UTC()
+	if err != nil {
+		// Rolled back, so none of the deletes removed anything
+		for _, step := range deletes {
+			step.Rows = 0
+			step.At = at
+			step.Error = err.Error()
+			dm.purgeAudit.record(step)
+			executed = append(executed, step)
+		}
+		return executed, err
+	}
+	for _, step := range deleted {
+		step.At = at
+		dm.purgeAudit.record(step)
+		executed = append(executed, step)
+	}
+	return executed, nil
+}
+
+// planPurge works out the steps a purge of one table would run and how many
+// rows each would remove, without changing anything
+func (dm *DataManager) planPurge(ctx context.Context, table, symbol string, start, end time.Time, wholePartitions bool) ([]PurgeStep, error) {
+	if !purgeableTable(table) {
+		return nil, fmt.Errorf("%w: %s", ErrPurgeTable, table)
+	}
+	start, end = start.UTC(), end.UTC()
+
+	var steps []PurgeStep
+	var dropped int64
+	if symbol == "" {
+		drop, err := dm.droppablePartitions(ctx, table, start, end)
+		if err != nil {
+			return nil, err
+		}
+		if len(drop.Partitions) > 0 {
+			steps = append(steps, drop)
+			dropped = drop.Rows
+		}
+	}
+	if wholePartitions {
+		return steps, nil
+	}
+
+	total, err := dm.countRows(ctx, table, symbol, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if remaining := total - dropped; remaining > 0 {
+		steps = append(steps, PurgeStep{
+			Table:  table,
+			Method: PurgeDelete,
+			Symbol: symbol,
+			Start:  start,
+			End:    end,
+			Rows:   remaining,
+		})
+	}
+	return steps, nil
+}
+
+// droppablePartitions lists the partitions of a table lying wholly inside
+// [start, end). The active partition is never included, since QuestDB
+// won't drop the partition being written to.
+func (dm *DataManager) droppablePartitions(ctx context.Context, table string, start, end time.Time) (PurgeStep, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryPurge, table)
+
+	step := PurgeStep{Table: table, Method: PurgeDropPartition, Start: start, End: end}
+
+	rows, err := dm.pool.QueryWithTimeout(ctx, dm.pool.ScanTimeout(),
+		fmt.Sprintf("SELECT name, minTimestamp, maxTimestamp, numRows, active FROM table_partitions('%s')", table))
+	if err != nil {
+		return step, fmt.Errorf("failed to list partitions of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var minTS, maxTS *time.Time
+		var numRows int64
+		var active bool
+		if err := rows.Scan(&name, &minTS, &maxTS, &numRows, &active); err != nil {
+			return step, fmt.Errorf("failed to read partitions of %s: %w", table, err)
+		}
+		if active || minTS == nil || maxTS == nil || strings.ContainsRune(name, '\'') {
+			continue
+		}
+		if !minTS.Before(start) && maxTS.Before(end) {
+			step.Partitions = append(step.Partitions, name)
+			step.Rows += numRows
+		}
+	}
+	return step, rows.Err()
+}
+
+// countRows counts the rows a delete over the range would remove
+func (dm *DataManager) countRows(ctx context.Context, table, symbol string, start, end time.Time) (int64, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryPurge, table)
+
+	query := fmt.Sprintf("SELECT count() FROM %s WHERE timestamp >= $1 AND timestamp < $2", table)
+	args := []interface{}{start, end}
+	if symbol != "" {
+		query += " AND symbol = $3"
+		args = append(args, symbol)
+	}
+
+	var count int64
+	if err := dm.pool.QueryRowWithTimeout(ctx, dm.pool.ScanTimeout(), query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count rows in %s: %w", table, err)
+	}
+	return count, nil
+}
+
+// runPurgeStep executes one planned step on conn, the write pool or a
+// transaction, and returns the rows it removed
+func (dm *DataManager) runPurgeStep(ctx context.Context, conn db.Execer, step PurgeStep) (int64, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryPurge, step.Table)
+
+	switch step.Method {
+	case PurgeDropPartition:
+		quoted := make([]string, len(step.Partitions))
+		for i, name := range step.Partitions {
+			quoted[i] = "'" + name + "'"
+		}
+		query := fmt.Sprintf("ALTER TABLE %s DROP PARTITION LIST %s", step.Table, strings.Join(quoted, ", "))
+		if _, err := conn.Exec(ctx, query); err != nil {
+			return 0, err
+		}
+		// The partition listing already counted the rows
+		return step.Rows, nil
+
+	default:
+		query := fmt.Sprintf("DELETE FROM %s WHERE timestamp >= $1 AND timestamp < $2", step.Table)
+		args := []interface{}{step.Start, step.End}
+		if step.Symbol != "" {
+			query += " AND symbol = $3"
+			args = append(args, step.Symbol)
+		}
+		tag, err := conn.Exec(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		return tag.RowsAffected(), nil
+	}
+}
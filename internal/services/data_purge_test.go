@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// purgeConn stands in for the write pool or a transaction, failing the
+// statements that touch failTable
+type purgeConn struct {
+	pgx.Tx
+	failTable  string
+	statements []string
+}
+
+func (c *purgeConn) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if c.failTable != "" && strings.Contains(sql, c.failTable+" ") {
+		return pgconn.CommandTag{}, errors.New("disk full")
+	}
+	c.statements = append(c.statements, sql)
+	return pgconn.NewCommandTag("DELETE 7"), nil
+}
+
+// newPurgeHarness wires a DataManager's purges to fake connections, running
+// the transaction's statements on tx and committing only if they all succeed
+func newPurgeHarness(t *testing.T) (*DataManager, *purgeConn, *purgeConn) {
+	dm := newTestDataManager(t)
+	pool, tx := &purgeConn{}, &purgeConn{}
+	dm.purgeExec = pool
+	dm.purgeTx = func(ctx context.Context, fn func(pgx.Tx) error) error {
+		if err := fn(tx); err != nil {
+			tx.statements = nil
+			return err
+		}
+		return nil
+	}
+	return dm, pool, tx
+}
+
+func purgeSteps() (drops, deletes []PurgeStep) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	drops = []PurgeStep{
+		{Table: tickTable, Method: PurgeDropPartition, Start: start, End: end, Partitions: []string{"2024-01-01"}, Rows: 100},
+	}
+	deletes = []PurgeStep{
+		{Table: "ohlc_1m_v2", Method: PurgeDelete, Start: start, End: end, Rows: 7},
+		{Table: "ohlc_1h_v2", Method: PurgeDelete, Start: start, End: end, Rows: 7},
+	}
+	return drops, deletes
+}
+
+func TestRunPurge(t *testing.T) {
+	dm, pool, tx := newPurgeHarness(t)
+	drops, deletes := purgeSteps()
+
+	executed, err := dm.runPurge(context.Background(), drops, deletes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pool.statements) != 1 || !strings.HasPrefix(pool.statements[0], "ALTER TABLE "+tickTable+" DROP PARTITION") {
+		t.Errorf("pool ran %q, want the partition drop outside the transaction", pool.statements)
+	}
+	if len(tx.statements) != 2 {
+		t.Errorf("transaction ran %q, want both deletes", tx.statements)
+	}
+	if len(executed) != 3 {
+		t.Fatalf("%d steps executed, want 3", len(executed))
+	}
+	for _, step := range executed {
+		if step.Error != "" || step.At.IsZero() {
+			t.Errorf("%s on %s: error %q at %s, want a clean timestamped step", step.Method, step.Table, step.Error, step.At)
+		}
+	}
+}
+
+// QuestDB applies DDL as it runs, so a failed delete rolls back the other
+// deletes but not the partitions already dropped
+func TestRunPurgeDropsOutsideTransaction(t *testing.T) {
+	dm, pool, tx := newPurgeHarness(t)
+	tx.failTable = "ohlc_1h_v2"
+	drops, deletes := purgeSteps()
+
+	executed, err := dm.runPurge(context.Background(), drops, deletes)
+	if err == nil || !strings.Contains(err.Error(), "ohlc_1h_v2") {
+		t.Fatalf("err = %v, want the failed delete", err)
+	}
+	if len(pool.statements) != 1 {
+		t.Errorf("pool ran %q, want the partition drop kept", pool.statements)
+	}
+	if len(tx.statements) != 0 {
+		t.Errorf("transaction kept %q, want every delete rolled back", tx.statements)
+	}
+
+	if len(executed) != 3 {
+		t.Fatalf("%d steps executed, want the drop and both deletes", len(executed))
+	}
+	if drop := executed[0]; drop.Method != PurgeDropPartition || drop.Rows != 100 || drop.Error != "" {
+		t.Errorf("drop: %d rows, error %q, want it applied with 100 rows", drop.Rows, drop.Error)
+	}
+	for _, step := range executed[1:] {
+		if step.Method != PurgeDelete || step.Rows != 0 || step.Error != err.Error() {
+			t.Errorf("%s on %s: %d rows, error %q, want rolled back with the transaction's error", step.Method, step.Table, step.Rows, step.Error)
+		}
+	}
+}
+
+func TestRunPurgeStopsAtFailedDrop(t *testing.T) {
+	dm, pool, tx := newPurgeHarness(t)
+	pool.failTable = tickTable
+	drops, deletes := purgeSteps()
+
+	executed, err := dm.runPurge(context.Background(), drops, deletes)
+	if err == nil || !strings.Contains(err.Error(), tickTable) {
+		t.Fatalf("err = %v, want the failed drop", err)
+	}
+	if len(executed) != 1 || executed[0].Error == "" {
+		t.Errorf("executed %+v, want only the failed drop", executed)
+	}
+	if len(tx.statements) != 0 {
+		t.Errorf("transaction ran %q after a failed drop, want nothing", tx.statements)
+	}
+}
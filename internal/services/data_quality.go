@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/quality"
+)
+
+// dataQualityTable holds one quality row per symbol and UTC day
+const dataQualityTable = "data_quality"
+
+// ensureQualityTable creates the data quality table if it doesn't exist yet.
+// Rows are upserted on (date, symbol), so refetching a day replaces its row.
+func (dm *DataManager) ensureQualityTable(ctx context.Context) error {
+	return dm.writePool.ExecSchema(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			date TIMESTAMP,
+			symbol SYMBOL,
+			tick_count LONG,
+			first_tick TIMESTAMP,
+			last_tick TIMESTAMP,
+			expected_hours INT,
+			covered_hours INT,
+			sparse_hours INT,
+			coverage DOUBLE,
+			quality_score INT,
+			is_complete BOOLEAN,
+			updated_at TIMESTAMP
+		) timestamp(date) PARTITION BY YEAR WAL
+		DEDUP UPSERT KEYS(date, symbol)
+	`, dataQualityTable))
+}
+
+// updateDataQuality recomputes the quality rows of every UTC day touching
+// [from, to) from the ticks now stored. The rows are written in one
+// transaction, so either every day is updated or none is. Failures are
+// logged; quality rows never fail a fetch.
+func (dm *DataManager) updateDataQuality(ctx context.Context, symbol string, from, to time.Time) []quality.Day {
+	first := from.UTC().Truncate(24 * time.Hour)
+	last := to.UTC().Add(24*time.Hour - 1).Truncate(24 * time.Hour)
+
+	hours, err := dm.hourlyTicks(ctx, symbol, first, last)
+	if err != nil {
+		log.Error().Err(err).Str("symbol", symbol).Msg("Failed to read hourly ticks for data quality")
+		return nil
+	}
+
+	var days []quality.Day
+	for date := first; date.Before(last); date = date.Add(24 * time.Hour) {
+		var expected []time.Time
+		for hour := date; hour.Before(date.Add(24 * time.Hour)); hour = hour.Add(time.Hour) {
+			if dm.calendar.OpenDuring(symbol, hour) {
+				expected = append(expected, hour)
+			}
+		}
+		// Days without trading hours have nothing to assess
+		if len(expected) == 0 {
+			continue
+		}
+
+		days = append(days, quality.Assess(date, expected, hours[date]))
+	}
+	if len(days) == 0 {
+		return nil
+	}
+
+	err = dm.writePool.WithTx(ctx, func(tx pgx.Tx) error {
+		for _, day := range days {
+			if err := dm.writeDataQuality(ctx, tx, symbol, day); err != nil {
+				return fmt.Errorf("failed to write %s: %w", day.Date.Format("2006-01-02"), err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Str("symbol", symbol).Msg("Failed to update data quality")
+		return nil
+	}
+	log.Info().Str("symbol", symbol).Int("days", len(days)).Msg("Updated data quality")
+	return days
+}
+
+// hourlyTicks returns the symbol's tick counts per hour in [from, to),
+// grouped by UTC day
+func (dm *DataManager) hourlyTicks(ctx context.Context, symbol string, from, to time.Time) (map[time.Time][]quality.Hour, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryDataQuality, "market_data_v2")
+
+	query := `
+		SELECT
+			date_trunc('hour', timestamp) as hour,
+			COUNT(*) as tick_count,
+			MIN(timestamp) as first_tick,
+			MAX(timestamp) as last_tick
+		FROM market_data_v2
+		WHERE symbol = $1
+			AND timestamp >= $2
+			AND timestamp < $3
+		GROUP BY hour
+		ORDER BY hour
+	`
+
+	rows, err := dm.pool.QueryWithTimeout(ctx, dm.pool.QueryTimeout(), query, symbol, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byDay := make(map[time.Time][]quality.Hour)
+	for rows.Next() {
+		var hour quality.Hour
+		if err := rows.Scan(&hour.Start, &hour.Ticks, &hour.First, &hour.Last); err != nil {
+			return nil, err
+		}
+		hour.Start = hour.Start.UTC()
+		day := hour.Start.Truncate(24 * time.Hour)
+		byDay[day] = append(byDay[day], hour)
+	}
+	return byDay, rows.Err()
+}
+
+// writeDataQuality upserts one day's quality row on conn, the write pool or
+// a transaction
+func (dm *DataManager) writeDataQuality(ctx context.Context, conn db.Execer, symbol string, day quality.Day) error {
+	ctx = db.WithQueryLabel(ctx, db.QueryDataQuality, dataQualityTable)
+
+	_, err := conn.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s (date, symbol, tick_count, first_tick, last_tick, expected_hours,
+			covered_hours, sparse_hours, coverage, quality_score, is_complete, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`, dataQualityTable),
+		day.Date, symbol, day.TickCount, day.FirstTick, day.LastTick, day.ExpectedHours,
+		day.CoveredHours, day.SparseHours, day.Coverage, day.Score, day.Complete, time.Now().UTC(),
+	)
+	return err
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/config"
+)
+
+// retentionSweepTimeout bounds one retention sweep
+const retentionSweepTimeout = 30 * time.Minute
+
+// retentionSweeper holds the retention scheduler's settings and state
+type retentionSweeper struct {
+	config config.RetentionConfig
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	status RetentionStatus
+}
+
+// RetentionStatus reports the retention sweeper state and its last sweep
+type RetentionStatus struct {
+	Enabled   bool        `json:"enabled"`
+	Interval  string      `json:"interval"`
+	Horizon   string      `json:"horizon"`
+	Tables    []string    `json:"tables"`
+	Sweeps    int64       `json:"sweeps"`
+	LastSweep time.Time   `json:"last_sweep"`
+	LastError string      `json:"last_error,omitempty"`
+	Removed   []PurgeStep `json:"removed"` // steps run by the last sweep
+}
+
+// RetentionPreview is what the next sweep would remove
+type RetentionPreview struct {
+	Cutoff time.Time   `json:"cutoff"`
+	Steps  []PurgeStep `json:"steps"`
+	Rows   int64       `json:"rows"`
+}
+
+// StartRetention configures purging and, when enabled, launches the sweeper
+// that drops data older than the retention horizon from the configured
+// tables. Sweeps only drop whole partitions: rows in the partition straddling
+// the cutoff wait for a later sweep rather than being deleted one by one.
+func (dm *DataManager) StartRetention(cfg config.RetentionConfig) {
+	dm.retention = &retentionSweeper{
+		config: cfg,
+		status: RetentionStatus{
+			Enabled:  cfg.Enabled,
+			Interval: cfg.Interval.String(),
+			Horizon:  cfg.Horizon.String(),
+			Tables:   cfg.Tables,
+			Removed:  make([]PurgeStep, 0),
+		},
+	}
+	if cfg.AuditLog != "" && cfg.AuditLog != "none" {
+		dm.purgeAudit = &purgeAudit{path: cfg.AuditLog}
+	}
+
+	if !cfg.Enabled {
+		log.Info().Msg("Retention sweeper disabled")
+		return
+	}
+
+	dm.retention.wg.Add(1)
+	go func() {
+		defer dm.retention.wg.Done()
+
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		log.Info().
+			Dur("interval", cfg.Interval).
+			Dur("horizon", cfg.Horizon).
+			Strs("tables", cfg.Tables).
+			Msg("Retention sweeper started")
+		for {
+			select {
+			case <-dm.rootCtx.Done():
+				return
+			case <-ticker.C:
+				dm.sweepRetention()
+			}
+		}
+	}()
+}
+
+// GetRetentionStatus returns a snapshot of the retention sweeper state
+func (dm *DataManager) GetRetentionStatus() RetentionStatus {
+	if dm.retention == nil {
+		return RetentionStatus{Removed: make([]PurgeStep, 0)}
+	}
+	dm.retention.mu.RLock()
+	defer dm.retention.mu.RUnlock()
+
+	status := dm.retention.status
+	status.Removed = append([]PurgeStep(nil), dm.retention.status.Removed...)
+	return status
+}
+
+// PreviewRetention reports what the next sweep would remove, changing nothing
+func (dm *DataManager) PreviewRetention(ctx context.Context) (RetentionPreview, error) {
+	preview := RetentionPreview{Steps: make([]PurgeStep, 0)}
+	if dm.retention == nil {
+		return preview, nil
+	}
+
+	preview.Cutoff = time.Now().UTC().Add(-dm.retention.config.Horizon)
+	for _, table := range dm.retention.config.Tables {
+		steps, err := dm.planPurge(ctx, table, "", time.Unix(0, 0), preview.Cutoff, true)
+		if err != nil {
+			return preview, err
+		}
+		for _, step := range steps {
+			step.DryRun = true
+			preview.Rows += step.Rows
+			preview.Steps = append(preview.Steps, step)
+		}
+	}
+	return preview, nil
+}
+
+// sweepRetention drops every whole partition older than the horizon
+func (dm *DataManager) sweepRetention() {
+	ctx, cancel := context.WithTimeout(dm.rootCtx, retentionSweepTimeout)
+	defer cancel()
+
+	cutoff := time.Now().UTC().Add(-dm.retention.config.Horizon)
+	removed, err := dm.purge(ctx, "", time.Unix(0, 0), cutoff, dm.retention.config.Tables, true)
+	if err != nil {
+		log.Error().Err(err).Msg("Retention sweep failed")
+	}
+
+	rows := int64(0)
+	for _, step := range removed {
+		rows += step.Rows
+	}
+	log.Info().
+		Int64("rows", rows).
+		Int("steps", len(removed)).
+		Time("cutoff", cutoff).
+		Msg("Retention sweep finished")
+
+	dm.retention.mu.Lock()
+	defer dm.retention.mu.Unlock()
+	dm.retention.status.Sweeps++
+	dm.retention.status.LastSweep = time.Now().UTC()
+	dm.retention.status.Removed = append(make([]PurgeStep, 0, len(removed)), removed...)
+	dm.retention.status.LastError = ""
+	if err != nil {
+		dm.retention.status.LastError = err.Error()
+	}
+}
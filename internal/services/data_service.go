@@ -2,7 +2,11 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -13,21 +17,111 @@ import (
 
 // DataService handles data retrieval from QuestDB
 type DataService struct {
-	pool *db.Pool
+	pool    *db.Pool
+	catalog catalogPool // the pool, replaceable in tests
+}
+
+// catalogPool is the part of the pool CheckTableExists looks tables up with
+type catalogPool interface {
+	QueryRowWithTimeout(ctx context.Context, timeout time.Duration, sql string, args ...interface{}) pgx.Row
+	QueryTimeout() time.Duration
+	HTTPEnabled() bool
+	ExecHTTP(ctx context.Context, sql string, args ...interface{}) (*db.ExecResult, error)
 }
 
 // NewDataService creates a new data service
 func NewDataService(pool *db.Pool) *DataService {
-	return &DataService{pool: pool}
+	return &DataService{pool: pool, catalog: pool}
 }
 
-// GetCandles retrieves OHLC data for the specified parameters
-func (s *DataService) GetCandles(ctx context.Context, req models.CandleRequest, table string, limit int) ([]models.Candle, error) {
+// GetCandles retrieves OHLC data for the specified parameters. The returned
+// notes describe anything the caller should surface in the response metadata.
+func (s *DataService) GetCandles(ctx context.Context, req models.CandleRequest, table string, limit int) ([]models.Candle, []string, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryCandles, table)
+
+	extras, err := req.ParseExtras()
+	if err != nil {
+		return nil, nil, err
+	}
+	sessions, err := req.ParseSessions()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Check if we're querying an OHLC table or need to aggregate
 	var query string
+	var notes []string
+
+	// Queries without extra columns have a fixed shape per table and interval,
+	// so they run as named prepared statements
+	statementName := ""
 	
+	// Spread only exists on ticks, so spread requests always aggregate from them
+	if extras.Spread {
+		if err := CheckSpreadRange(req.Start, req.End); err != nil {
+			return nil, nil, err
+		}
+		if routed := SpreadTable(table); routed != table {
+			notes = append(notes, fmt.Sprintf("spread requested; aggregated from %s instead of %s", routed, table))
+			table = routed
+		}
+	}
+	
+	// Delta needs buy and sell volume, which not every pre-aggregated table has
+	if extras.Delta {
+		routed, err := s.DeltaTable(ctx, table, req.Start, req.End)
+		if err != nil {
+			return nil, nil, err
+		}
+		if routed != table {
+			notes = append(notes, fmt.Sprintf("delta requested; table %s has no buy and sell volume, aggregated from %s instead", table, routed))
+			table = routed
+		}
+	}
+
+	// Session filters need each tick's hour, so they always aggregate from ticks
+	sessionFilter := ""
+	if len(sessions) > 0 {
+		if err := CheckSessionRange(req.Start, req.End); err != nil {
+			return nil, nil, err
+		}
+		if isPreAggregated(table) {
+			notes = append(notes, fmt.Sprintf("session filter requested; aggregated from %s instead of %s", tickTable, table))
+			table = tickTable
+		}
+		sessionFilter = "\n\t\t\t\t\tAND " + sessionPredicate(sessions)
+	}
+
 	// If the table name contains "ohlc", assume it's pre-aggregated
-	if len(table) > 4 && table[:4] == "ohlc" {
+	if isPreAggregated(table) {
+		// Pre-aggregated tables may not carry the extra columns
+		extraColumns := ""
+		if extras.Any() {
+			columns, err := s.getTableColumns(ctx, table)
+			if err != nil {
+				return nil, nil, err
+			}
+			if extras.VWAP {
+				if columns["vwap"] {
+					extraColumns += ",\n\t\t\t\tvwap"
+				} else {
+					extraColumns += ",\n\t\t\t\tNULL as vwap"
+					notes = append(notes, fmt.Sprintf("table %s has no vwap column; vwap omitted", table))
+				}
+			}
+			if extras.TickCount {
+				if columns["tick_count"] {
+					extraColumns += ",\n\t\t\t\ttick_count"
+				} else {
+					extraColumns += ",\n\t\t\t\tNULL as tick_count"
+					notes = append(notes, fmt.Sprintf("table %s has no tick_count column; tick_count omitted", table))
+				}
+			}
+			if extras.Delta {
+				extraColumns += ",\n\t\t\t\tbuy_volume,\n\t\t\t\tsell_volume"
+			}
+		}
+
 		// Query pre-aggregated table
 		query = fmt.Sprintf(`
 			SELECT 
@@ -36,18 +130,36 @@ func (s *DataService) GetCandles(ctx context.Context, req models.CandleRequest,
 				high,
 				low,
 				close,
-				volume
+				volume%s
 			FROM %s
 			WHERE symbol = $1
 				AND timestamp >= $2
 				AND timestamp <= $3
 			ORDER BY timestamp
 			LIMIT $4
-		`, table)
+		`, extraColumns, table)
+		statementName = fmt.Sprintf("candles_%s", table)
 	} else {
 		// Generate SAMPLE BY query based on timeframe
-		sampleInterval := s.getTimeframeInterval(req.Timeframe)
-		if sampleInterval == "" {
+		if err := CheckTimeframeRange(req.Timeframe, req.Start, req.End); err != nil {
+			return nil, nil, err
+		}
+		interval := sampleInterval(req.Timeframe)
+		if interval == "" {
+			extraColumns := ""
+			if extras.VWAP {
+				extraColumns += ",\n\t\t\t\t\tprice as vwap"
+			}
+			if extras.TickCount {
+				extraColumns += ",\n\t\t\t\t\t1L as tick_count"
+			}
+			if extras.Spread {
+				extraColumns += ",\n\t\t\t\t\tspread as avg_spread,\n\t\t\t\t\tspread as min_spread,\n\t\t\t\t\tspread as max_spread,\n\t\t\t\t\tspread as twa_spread"
+			}
+			if extras.Delta {
+				extraColumns += ",\n\t\t\t\t\task_volume as buy_volume,\n\t\t\t\t\tbid_volume as sell_volume"
+			}
+
 			// Fallback to raw data if timeframe not recognized
 			query = fmt.Sprintf(`
 				SELECT 
@@ -56,15 +168,31 @@ func (s *DataService) GetCandles(ctx context.Context, req models.CandleRequest,
 					bid as high,
 					bid as low,
 					bid as close,
-					volume
+					volume%s
 				FROM %s
 				WHERE symbol = $1
 					AND timestamp >= $2
-					AND timestamp <= $3
+					AND timestamp <= $3%s
 				ORDER BY timestamp
 				LIMIT $4
-			`, table)
+			`, extraColumns, table, sessionFilter)
+			statementName = fmt.Sprintf("candles_%s_raw", table)
 		} else {
+			extraColumns := ""
+			if extras.VWAP {
+				extraColumns += ",\n\t\t\t\t\tsum(price * volume) / sum(volume) as vwap"
+			}
+			if extras.TickCount {
+				extraColumns += ",\n\t\t\t\t\tcount() as tick_count"
+			}
+			if extras.Spread {
+				extraColumns += ",\n\t\t\t\t\tavg(spread) as avg_spread,\n\t\t\t\t\tmin(spread) as min_spread,\n\t\t\t\t\tmax(spread) as max_spread"
+			}
+			// Ask volume is lifted by buyers, bid volume hit by sellers
+			if extras.Delta {
+				extraColumns += ",\n\t\t\t\t\tsum(ask_volume) as buy_volume,\n\t\t\t\t\tsum(bid_volume) as sell_volume"
+			}
+
 			// Use SAMPLE BY to aggregate tick data into OHLC candles
 			query = fmt.Sprintf(`
 				SELECT 
@@ -73,22 +201,28 @@ func (s *DataService) GetCandles(ctx context.Context, req models.CandleRequest,
 					max(bid) as high,
 					min(bid) as low,
 					last(bid) as close,
-					sum(volume) as volume
+					sum(volume) as volume%s
 				FROM %s
 				WHERE symbol = $1
 					AND timestamp >= $2
-					AND timestamp <= $3
+					AND timestamp <= $3%s
 				SAMPLE BY %s ALIGN TO CALENDAR
 				ORDER BY timestamp
 				LIMIT $4
-			`, table, sampleInterval)
+			`, extraColumns, table, sessionFilter, interval)
+			statementName = fmt.Sprintf("candles_%s_%s", table, interval)
 		}
 	}
 
 	start := time.Now()
-	rows, err := s.pool.Query(ctx, query, req.Symbol, req.Start, req.End, limit)
+	var rows pgx.Rows
+	if extras.Any() || sessionFilter != "" {
+		rows, err = s.pool.QueryWithTimeout(ctx, s.pool.QueryTimeout(), query, req.Symbol, req.Start, req.End, limit)
+	} else {
+		rows, err = s.pool.QueryPreparedWithTimeout(ctx, s.pool.QueryTimeout(), statementName, query, req.Symbol, req.Start, req.End, limit)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to query candles: %w", err)
+		return nil, nil, fmt.Errorf("failed to query candles: %w", queryError(err))
 	}
 	defer rows.Close()
 
@@ -102,41 +236,275 @@ func (s *DataService) GetCandles(ctx context.Context, req models.CandleRequest,
 	candles := make([]models.Candle, 0, limit)
 	for rows.Next() {
 		var c models.Candle
-		err := rows.Scan(
+		dest := []interface{}{
 			&c.Timestamp,
 			&c.Open,
 			&c.High,
 			&c.Low,
 			&c.Close,
 			&c.Volume,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan candle: %w", err)
+		}
+		if extras.VWAP {
+			dest = append(dest, &c.VWAP)
+		}
+		if extras.TickCount {
+			dest = append(dest, &c.TickCount)
+		}
+		if extras.Spread {
+			dest = append(dest, &c.AvgSpread, &c.MinSpread, &c.MaxSpread)
+			if sampleInterval(req.Timeframe) == "" {
+				dest = append(dest, &c.TWASpread)
+			}
+		}
+		if extras.Delta {
+			dest = append(dest, &c.BuyVolume, &c.SellVolume)
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan candle: %w", queryError(err))
 		}
 		candles = append(candles, c)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+		return nil, nil, fmt.Errorf("error iterating rows: %w", queryError(err))
 	}
 
-	return candles, nil
+	if extras.Spread {
+		if interval := sampleInterval(req.Timeframe); interval != "" {
+			if err := s.fillTimeWeightedSpread(ctx, req, table, interval, candles); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	candles, integrityNotes := checkCandleIntegrity(candles)
+	notes = append(notes, integrityNotes...)
+	if extras.Delta {
+		fillDelta(candles)
+	}
+
+	return candles, notes, nil
+}
+
+// tickAggregationMaxRange caps extras that scan raw ticks: spread always,
+// delta when the table lacks buy and sell volume. Session filters scan them
+// too.
+const tickAggregationMaxRange = 31 * 24 * time.Hour
+
+// CheckSpreadRange rejects spread requests over ranges too long to aggregate from ticks
+func CheckSpreadRange(start, end time.Time) error {
+	if end.Sub(start) > tickAggregationMaxRange {
+		return fmt.Errorf("%w: include=spread is limited to ranges of %s", ErrRangeTooLarge, tickAggregationMaxRange)
+	}
+	return nil
 }
 
-// GetSymbols retrieves available trading symbols
+// CheckSessionRange rejects session-filtered requests over ranges too long
+// to aggregate from ticks
+func CheckSessionRange(start, end time.Time) error {
+	if end.Sub(start) > tickAggregationMaxRange {
+		return fmt.Errorf("%w: session filters are limited to ranges of %s", ErrRangeTooLarge, tickAggregationMaxRange)
+	}
+	return nil
+}
+
+// CheckSessionTimeframe rejects bars of a day or longer filtered on sessions
+// that span midnight UTC. Those bars are bucketed by UTC day, so each would
+// join the start of one session to the end of the one before it.
+func CheckSessionTimeframe(timeframe string, sessions models.SessionFilter) error {
+	bar, err := timeframeDuration(timeframe)
+	if err != nil || bar < 24*time.Hour || !sessions.SpansMidnight() {
+		return nil
+	}
+	return fmt.Errorf("%w: %s bars are bucketed by UTC day, which splits sessions spanning midnight UTC such as SYDNEY; use a timeframe under 1d", ErrInvalidResolution, timeframe)
+}
+
+// sessionPredicate returns the condition keeping ticks in the sessions'
+// hours. It goes by the timestamp rather than the trading_session column,
+// whose labels differ between the feeds that write it.
+func sessionPredicate(sessions models.SessionFilter) string {
+	hours := sessions.Hours()
+	list := make([]string, len(hours))
+	for i, h := range hours {
+		list[i] = strconv.Itoa(h)
+	}
+	return fmt.Sprintf("hour(timestamp) IN (%s)", strings.Join(list, ", "))
+}
+
+// DeltaTable returns the table a delta-including request must be served
+// from: pre-aggregated tables with buy and sell volume serve it themselves,
+// others route to ticks, within the same range limit as spread
+func (s *DataService) DeltaTable(ctx context.Context, table string, start, end time.Time) (string, error) {
+	if !isPreAggregated(table) {
+		return table, nil
+	}
+	columns, err := s.getTableColumns(ctx, table)
+	if err != nil {
+		return "", queryError(err)
+	}
+	if columns["buy_volume"] && columns["sell_volume"] {
+		return table, nil
+	}
+	if end.Sub(start) > tickAggregationMaxRange {
+		return "", fmt.Errorf("%w: include=delta is limited to ranges of %s, as table %s has no buy and sell volume",
+			ErrRangeTooLarge, tickAggregationMaxRange, table)
+	}
+	return tickTable, nil
+}
+
+// DeltaSource names the path delta comes from on table
+func DeltaSource(table string) string {
+	if isPreAggregated(table) {
+		return models.DeltaFromTable
+	}
+	return models.DeltaFromTicks
+}
+
+// fillDelta sets each candle's net delta, buy less sell volume, and the
+// running total of it from the first candle
+func fillDelta(candles []models.Candle) {
+	var cumulative float64
+	for i := range candles {
+		c := &candles[i]
+		if c.BuyVolume == nil || c.SellVolume == nil {
+			continue
+		}
+		delta := *c.BuyVolume - *c.SellVolume
+		cumulative += delta
+		total := cumulative
+		c.Delta, c.CumulativeDelta = &delta, &total
+	}
+}
+
+// SpreadTable returns the table a spread-including request must be served
+// from: pre-aggregated tables don't carry spread, so those route to ticks
+func SpreadTable(table string) string {
+	if isPreAggregated(table) {
+		return "market_data_v2"
+	}
+	return table
+}
+
+// isPreAggregated reports whether table holds OHLC bars rather than ticks
+func isPreAggregated(table string) bool {
+	return strings.HasPrefix(table, "ohlc")
+}
+
+// fillTimeWeightedSpread sets TWASpread on each candle. Ticks are resampled
+// onto a fine grid carrying the prevailing spread forward, so averaging the
+// grid within a bar weights each spread by how long it was in effect.
+func (s *DataService) fillTimeWeightedSpread(ctx context.Context, req models.CandleRequest, table, interval string, candles []models.Candle) error {
+	ctx = db.WithQueryLabel(ctx, db.QuerySpread, table)
+
+	if len(candles) == 0 {
+		return nil
+	}
+
+	// A one-second grid is only affordable for short bars
+	grid := "1m"
+	if bucket, err := timeframeDuration(interval); err == nil && bucket <= 5*time.Minute {
+		grid = "1s"
+	}
+
+	// Grid points outside the requested sessions don't count toward a bar
+	sessionFilter := ""
+	sessions, err := req.ParseSessions()
+	if err != nil {
+		return err
+	}
+	if len(sessions) > 0 {
+		sessionFilter = "\n\t\tWHERE " + sessionPredicate(sessions)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT timestamp, avg(spread) as twa_spread
+		FROM (
+			SELECT timestamp, last(spread) as spread
+			FROM %s
+			WHERE symbol = $1
+				AND timestamp >= $2
+				AND timestamp <= $3
+			SAMPLE BY %s FILL(PREV) ALIGN TO CALENDAR
+		)%s
+		SAMPLE BY %s ALIGN TO CALENDAR
+	`, table, grid, sessionFilter, interval)
+
+	rows, err := s.pool.QueryWithTimeout(ctx, s.pool.QueryTimeout(), query, req.Symbol, req.Start, req.End)
+	if err != nil {
+		return fmt.Errorf("failed to query time-weighted spread: %w", err)
+	}
+	defer rows.Close()
+
+	twa := make(map[int64]float64, len(candles))
+	for rows.Next() {
+		var ts time.Time
+		var value *float64
+		if err := rows.Scan(&ts, &value); err != nil {
+			return fmt.Errorf("failed to scan time-weighted spread: %w", err)
+		}
+		if value != nil {
+			twa[ts.UnixNano()] = *value
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating time-weighted spread: %w", err)
+	}
+
+	for i := range candles {
+		if value, ok := twa[candles[i].Timestamp.UnixNano()]; ok {
+			v := value
+			candles[i].TWASpread = &v
+		}
+	}
+
+	return nil
+}
+
+// getTableColumns returns the set of column names in a table
+func (s *DataService) getTableColumns(ctx context.Context, table string) (map[string]bool, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryTableColumns, table)
+
+	query := fmt.Sprintf(`SELECT "column" FROM table_columns('%s')`, table)
+
+	rows, err := s.pool.QueryWithTimeout(ctx, s.pool.QueryTimeout(), query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query columns for %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan column name: %w", err)
+		}
+		columns[name] = true
+	}
+
+	return columns, rows.Err()
+}
+
+// ohlcTimeframes lists the timeframes that have a pre-aggregated ohlc_<tf>_v2 table
+var ohlcTimeframes = []string{"1m", "5m", "15m", "30m", "1h", "4h", "1d"}
+
+// GetSymbols retrieves available trading symbols with per-symbol statistics
 func (s *DataService) GetSymbols(ctx context.Context) ([]models.Symbol, error) {
+	ctx = db.WithQueryLabel(ctx, db.QuerySymbols, "")
+
 	query := `
-		SELECT DISTINCT 
+		SELECT 
 			symbol,
+			min(timestamp) as first_tick,
 			max(timestamp) as last_update
 		FROM market_data_v2
 		GROUP BY symbol
 		ORDER BY symbol
 	`
 
-	rows, err := s.pool.Query(ctx, query)
+	rows, err := s.pool.QueryWithTimeout(ctx, s.pool.QueryTimeout(), query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query symbols: %w", err)
+		return nil, fmt.Errorf("failed to query symbols: %w", queryError(err))
 	}
 	defer rows.Close()
 
@@ -144,34 +512,248 @@ func (s *DataService) GetSymbols(ctx context.Context) ([]models.Symbol, error) {
 	for rows.Next() {
 		var sym models.Symbol
 		var symbolStr string
-		err := rows.Scan(&symbolStr, &sym.LastUpdate)
+		err := rows.Scan(&symbolStr, &sym.FirstTick, &sym.LastUpdate)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan symbol: %w", err)
 		}
 
 		// Parse symbol (e.g., "EURUSD" -> EUR/USD)
+		sym.Symbol = symbolStr
 		if len(symbolStr) >= 6 {
-			sym.Symbol = symbolStr
 			sym.BaseCurrency = symbolStr[:3]
 			sym.QuoteCurrency = symbolStr[3:6]
 			sym.Description = fmt.Sprintf("%s/%s", sym.BaseCurrency, sym.QuoteCurrency)
-			sym.MinSize = 0.01    // Default values
-			sym.TickSize = 0.0001 // Default for forex
 		}
+		sym.MinSize = 0.01    // Default values
+		sym.TickSize = 0.0001 // Default for forex
+		sym.MetadataSource = "default"
+		sym.Timeframes = make([]string, 0)
 
 		symbols = append(symbols, sym)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating symbols: %w", queryError(err))
+	}
+
+	// The remaining lookups are best effort: missing tables only leave defaults in place
+	tickCounts, err := s.getSymbolTickCounts(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load tick counts from data_quality")
+	}
+
+	timeframes, err := s.getSymbolTimeframes(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load available timeframes")
+	}
+
+	meta, err := s.getSymbolsMeta(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load symbols_meta")
+	}
+
+	for i := range symbols {
+		sym := &symbols[i]
+		if count, ok := tickCounts[sym.Symbol]; ok {
+			sym.TickCount = count
+			sym.TickCountApproximate = true
+		}
+		if tfs, ok := timeframes[sym.Symbol]; ok {
+			sym.Timeframes = tfs
+		}
+		if m, ok := meta[sym.Symbol]; ok {
+			if m.Description != "" {
+				sym.Description = m.Description
+			}
+			if m.MinSize > 0 {
+				sym.MinSize = m.MinSize
+			}
+			if m.TickSize > 0 {
+				sym.TickSize = m.TickSize
+			}
+			sym.MetadataSource = "symbols_meta"
+		}
+	}
+
 	return symbols, nil
 }
 
-// GetDataRange retrieves the available date range for a symbol
-func (s *DataService) GetDataRange(ctx context.Context, symbol string) (map[string]interface{}, error) {
-	conn, err := s.pool.Acquire(ctx)
+// symbolMeta holds the optional per-symbol overrides from symbols_meta
+type symbolMeta struct {
+	Description string
+	MinSize     float64
+	TickSize    float64
+}
+
+// getSymbolTickCounts sums the daily tick counts recorded in data_quality
+func (s *DataService) getSymbolTickCounts(ctx context.Context) (map[string]int64, error) {
+	query := `
+		SELECT symbol, sum(tick_count) as tick_count
+		FROM data_quality
+		GROUP BY symbol
+	`
+
+	rows, err := s.pool.QueryWithTimeout(ctx, s.pool.QueryTimeout(), query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tick counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var symbol string
+		var count int64
+		if err := rows.Scan(&symbol, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan tick count: %w", err)
+		}
+		counts[symbol] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// getSymbolTimeframes finds which OHLC tables hold rows for each symbol.
+// One catalog lookup finds the tables that exist, and one UNION ALL reads
+// each symbol's latest row from all of them. Each symbol's timeframes are
+// in ascending order.
+func (s *DataService) getSymbolTimeframes(ctx context.Context) (map[string][]string, error) {
+	tables := make([]string, len(ohlcTimeframes))
+	for i, tf := range ohlcTimeframes {
+		tables[i] = fmt.Sprintf("ohlc_%s_v2", tf)
+	}
+	exists, err := s.existingTables(ctx, tables)
 	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, err
 	}
-	defer conn.Release()
+
+	var selects []string
+	for i, tf := range ohlcTimeframes {
+		if exists[tables[i]] {
+			selects = append(selects, fmt.Sprintf(
+				"SELECT symbol, '%s' AS timeframe FROM (SELECT symbol FROM %s LATEST ON timestamp PARTITION BY symbol)",
+				tf, tables[i]))
+		}
+	}
+	result := make(map[string][]string)
+	if len(selects) == 0 {
+		return result, nil
+	}
+
+	ctx = db.WithQueryLabel(ctx, db.QuerySymbols, "ohlc")
+	rows, err := s.pool.QueryWithTimeout(ctx, s.pool.QueryTimeout(), strings.Join(selects, " UNION ALL "))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OHLC table symbols: %w", queryError(err))
+	}
+	defer rows.Close()
+
+	found := make(map[string]map[string]bool)
+	for rows.Next() {
+		var symbol, tf string
+		if err := rows.Scan(&symbol, &tf); err != nil {
+			return nil, fmt.Errorf("failed to scan symbol timeframe: %w", err)
+		}
+		if found[symbol] == nil {
+			found[symbol] = make(map[string]bool)
+		}
+		found[symbol][tf] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read OHLC table symbols: %w", queryError(err))
+	}
+
+	// UNION ALL doesn't promise the order of its parts
+	for symbol, tfs := range found {
+		for _, tf := range ohlcTimeframes {
+			if tfs[tf] {
+				result[symbol] = append(result[symbol], tf)
+			}
+		}
+	}
+	return result, nil
+}
+
+// existingTables looks up which of the named tables exist with one tables()
+// query, caching each answer for CheckTableExists
+func (s *DataService) existingTables(ctx context.Context, tables []string) (map[string]bool, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryTableExists, "")
+
+	placeholders := make([]string, len(tables))
+	args := make([]interface{}, len(tables))
+	for i, table := range tables {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = table
+	}
+	query := fmt.Sprintf("SELECT table_name FROM tables() WHERE table_name IN (%s)", strings.Join(placeholders, ", "))
+
+	rows, err := s.pool.QueryWithTimeout(ctx, s.pool.QueryTimeout(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up tables: %w", queryError(err))
+	}
+	defer rows.Close()
+
+	exists := make(map[string]bool, len(tables))
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan table name: %w", err)
+		}
+		exists[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to look up tables: %w", queryError(err))
+	}
+
+	now := time.Now()
+	tableExistsCache.Lock()
+	for _, table := range tables {
+		tableExistsCache.entries[table] = tableExistsEntry{exists: exists[table], checkedAt: now}
+	}
+	tableExistsCache.Unlock()
+	return exists, nil
+}
+
+// getSymbolsMeta loads instrument metadata from the symbols_meta table
+func (s *DataService) getSymbolsMeta(ctx context.Context) (map[string]symbolMeta, error) {
+	query := `
+		SELECT symbol, description, min_size, tick_size
+		FROM symbols_meta
+	`
+
+	rows, err := s.pool.QueryWithTimeout(ctx, s.pool.QueryTimeout(), query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query symbols_meta: %w", err)
+	}
+	defer rows.Close()
+
+	meta := make(map[string]symbolMeta)
+	for rows.Next() {
+		var symbol string
+		var description *string
+		var minSize, tickSize *float64
+		if err := rows.Scan(&symbol, &description, &minSize, &tickSize); err != nil {
+			return nil, fmt.Errorf("failed to scan symbols_meta: %w", err)
+		}
+
+		var m symbolMeta
+		if description != nil {
+			m.Description = *description
+		}
+		if minSize != nil {
+			m.MinSize = *minSize
+		}
+		if tickSize != nil {
+			m.TickSize = *tickSize
+		}
+		meta[symbol] = m
+	}
+
+	return meta, rows.Err()
+}
+
+// GetDataRange retrieves the available date range for a symbol, ErrNoData
+// when it has no ticks
+func (s *DataService) GetDataRange(ctx context.Context, symbol string) (map[string]interface{}, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryDataRange, "market_data_v2")
 
 	query := `
 		SELECT 
@@ -182,48 +764,50 @@ func (s *DataService) GetDataRange(ctx context.Context, symbol string) (map[stri
 		WHERE symbol = $1
 	`
 
-	var startDate, endDate time.Time
+	var startDate, endDate *time.Time
 	var tickCount int64
 
-	err = conn.QueryRow(ctx, query, symbol).Scan(&startDate, &endDate, &tickCount)
+	err := s.pool.QueryRowWithTimeout(ctx, s.pool.QueryTimeout(), query, symbol).Scan(&startDate, &endDate, &tickCount)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query data range: %w", err)
+		return nil, fmt.Errorf("failed to query data range: %w", queryError(err))
+	}
+	if tickCount == 0 || startDate == nil || endDate == nil {
+		return nil, fmt.Errorf("%w: no ticks for %s", ErrNoData, symbol)
 	}
 
 	return map[string]interface{}{
 		"symbol":     symbol,
-		"start":      startDate,
-		"end":        endDate,
+		"start":      *startDate,
+		"end":        *endDate,
 		"tick_count": tickCount,
 	}, nil
 }
 
-// getTimeframeInterval converts timeframe string to QuestDB SAMPLE BY interval
-func (s *DataService) getTimeframeInterval(timeframe string) string {
-	switch timeframe {
-	case "1m":
-		return "1m"
-	case "5m":
-		return "5m"
-	case "15m":
-		return "15m"
-	case "30m":
-		return "30m"
-	case "1h":
-		return "1h"
-	case "4h":
-		return "4h"
-	case "1d":
-		return "1d"
-	case "1w":
-		return "1w"
-	default:
-		return ""
+// subMinuteMaxRange caps how long a range may be sampled at second resolution
+var subMinuteMaxRange = map[string]time.Duration{
+	"1s":  2 * time.Hour,
+	"5s":  6 * time.Hour,
+	"15s": 12 * time.Hour,
+	"30s": 24 * time.Hour,
+}
+
+// CheckTimeframeRange rejects second-level timeframes over ranges that would
+// produce an unreasonable number of bars
+func CheckTimeframeRange(timeframe string, start, end time.Time) error {
+	maxRange, ok := subMinuteMaxRange[timeframe]
+	if !ok {
+		return nil
 	}
+	if end.Sub(start) > maxRange {
+		return fmt.Errorf("%w: timeframe %s is limited to ranges of %s", ErrRangeTooLarge, timeframe, maxRange)
+	}
+	return nil
 }
 
 // GetTableStats retrieves statistics about a table
 func (s *DataService) GetTableStats(ctx context.Context, table string) (map[string]interface{}, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryTableStats, table)
+
 	query := fmt.Sprintf(`
 		SELECT 
 			count(*) as row_count,
@@ -235,7 +819,7 @@ func (s *DataService) GetTableStats(ctx context.Context, table string) (map[stri
 	var rowCount int64
 	var firstTime, lastTime *time.Time
 
-	err := s.pool.QueryRow(ctx, query).Scan(&rowCount, &firstTime, &lastTime)
+	err := s.pool.QueryRowWithTimeout(ctx, s.pool.ScanTimeout(), query).Scan(&rowCount, &firstTime, &lastTime)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return map[string]interface{}{
@@ -261,8 +845,25 @@ func (s *DataService) GetTableStats(ctx context.Context, table string) (map[stri
 	return stats, nil
 }
 
-// EstimatePoints estimates the number of points for a query
-func (s *DataService) EstimatePoints(ctx context.Context, table string, symbol string, start, end time.Time) (int, error) {
+// estimateMinRange is the shortest range for which EstimatePoints uses the
+// data_quality summaries instead of an exact count
+const estimateMinRange = 2 * 24 * time.Hour
+
+// EstimatePoints estimates the number of points for a query. The returned
+// flag reports whether the figure is an exact count.
+func (s *DataService) EstimatePoints(ctx context.Context, table string, symbol string, start, end time.Time) (int, bool, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryEstimate, table)
+
+	// Counting ticks over long ranges is slow, use the daily summaries instead
+	if table == "market_data_v2" && end.Sub(start) > estimateMinRange {
+		estimate, ok, err := s.estimateFromQuality(ctx, symbol, start, end)
+		if err != nil {
+			log.Debug().Err(err).Msg("data_quality estimate unavailable, counting exactly")
+		} else if ok {
+			return estimate, false, nil
+		}
+	}
+
 	// Use a more efficient count query
 	query := fmt.Sprintf(`
 		SELECT count(*) 
@@ -273,38 +874,150 @@ func (s *DataService) EstimatePoints(ctx context.Context, table string, symbol s
 	`, table)
 
 	var count int
-	err := s.pool.QueryRow(ctx, query, symbol, start, end).Scan(&count)
+	err := s.pool.QueryRowWithTimeout(ctx, s.pool.QueryTimeout(), query, symbol, start, end).Scan(&count)
 	if err != nil {
-		return 0, fmt.Errorf("failed to estimate points: %w", err)
+		return 0, false, fmt.Errorf("failed to estimate points: %w", err)
 	}
 
-	return count, nil
+	return count, true, nil
 }
 
-// CheckTableExists verifies if a table exists
-func (s *DataService) CheckTableExists(ctx context.Context, table string) (bool, error) {
+// estimateFromQuality sums daily tick counts from data_quality, pro-rating
+// the partial days at either end of the range. It reports false when any
+// trading day in the range has no quality row.
+func (s *DataService) estimateFromQuality(ctx context.Context, symbol string, start, end time.Time) (int, bool, error) {
+	firstDay := start.UTC().Truncate(24 * time.Hour)
+
 	query := `
-		SELECT EXISTS (
-			SELECT 1 
-			FROM information_schema.tables 
-			WHERE table_name = $1
-		)
+		SELECT date, tick_count
+		FROM data_quality
+		WHERE symbol = $1
+			AND date >= $2
+			AND date <= $3
 	`
 
-	var exists bool
-	err := s.pool.QueryRow(ctx, query, table).Scan(&exists)
+	rows, err := s.pool.QueryWithTimeout(ctx, s.pool.QueryTimeout(), query, symbol, firstDay, end)
 	if err != nil {
-		// QuestDB might not support information_schema, try alternative
-		testQuery := fmt.Sprintf("SELECT 1 FROM %s LIMIT 1", table)
-		err = s.pool.QueryRow(ctx, testQuery).Scan(&exists)
-		if err != nil {
-			if err == pgx.ErrNoRows {
-				return true, nil // Table exists but is empty
+		return 0, false, fmt.Errorf("failed to query data_quality: %w", err)
+	}
+	defer rows.Close()
+
+	daily := make(map[time.Time]int64)
+	for rows.Next() {
+		var day time.Time
+		var count int64
+		if err := rows.Scan(&day, &count); err != nil {
+			return 0, false, fmt.Errorf("failed to scan data_quality: %w", err)
+		}
+		daily[day.UTC().Truncate(24*time.Hour)] += count
+	}
+	if err := rows.Err(); err != nil {
+		return 0, false, err
+	}
+
+	var total float64
+	for day := firstDay; day.Before(end); day = day.Add(24 * time.Hour) {
+		count, ok := daily[day]
+		if !ok {
+			// Weekends legitimately have no rows; missing weekdays mean the summary is incomplete
+			if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+				continue
 			}
-			return false, nil // Table doesn't exist
+			return 0, false, nil
+		}
+
+		// Pro-rate the portion of the day inside the range
+		dayStart, dayEnd := day, day.Add(24*time.Hour)
+		if start.After(dayStart) {
+			dayStart = start
 		}
-		return true, nil
+		if end.Before(dayEnd) {
+			dayEnd = end
+		}
+		fraction := float64(dayEnd.Sub(dayStart)) / float64(24*time.Hour)
+		total += float64(count) * fraction
 	}
 
-	return exists, nil
-}
\ No newline at end of file
+	return int(total), true, nil
+}
+
+// ErrTableNotFound is returned by CheckTableExists when the table is absent
+var ErrTableNotFound = errors.New("table does not exist")
+
+// TableCheckError reports that the catalog lookup itself failed, so the
+// table's existence is unknown
+type TableCheckError struct {
+	Table string
+	Err   error
+}
+
+func (e *TableCheckError) Error() string {
+	return fmt.Sprintf("failed to check table %s: %v", e.Table, e.Err)
+}
+
+func (e *TableCheckError) Unwrap() error {
+	return e.Err
+}
+
+// tableExistsTTL is how long catalog lookups are cached
+const tableExistsTTL = 30 * time.Second
+
+// tableExistsCache is shared across DataService instances, which are created per request
+var tableExistsCache = struct {
+	sync.Mutex
+	entries map[string]tableExistsEntry
+}{entries: make(map[string]tableExistsEntry)}
+
+type tableExistsEntry struct {
+	exists    bool
+	checkedAt time.Time
+}
+
+// CheckTableExists verifies a table exists using QuestDB's tables() catalog.
+// It returns nil if the table exists, ErrTableNotFound if it doesn't, and a
+// *TableCheckError if the lookup failed.
+func (s *DataService) CheckTableExists(ctx context.Context, table string) error {
+	ctx = db.WithQueryLabel(ctx, db.QueryTableExists, table)
+
+	tableExistsCache.Lock()
+	entry, ok := tableExistsCache.entries[table]
+	tableExistsCache.Unlock()
+
+	if ok && time.Since(entry.checkedAt) < tableExistsTTL {
+		if !entry.exists {
+			return fmt.Errorf("%w: %s", ErrTableNotFound, table)
+		}
+		return nil
+	}
+
+	query := `SELECT table_name FROM tables() WHERE table_name = $1`
+
+	var name string
+	err := s.catalog.QueryRowWithTimeout(ctx, s.catalog.QueryTimeout(), query, table).Scan(&name)
+	exists := true
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) && s.catalog.HTTPEnabled() {
+		// The HTTP endpoint often still answers when PGWire doesn't
+		result, httpErr := s.catalog.ExecHTTP(ctx, query, table)
+		if httpErr == nil {
+			err = nil
+			if len(result.Dataset) == 0 {
+				err = pgx.ErrNoRows
+			}
+		}
+	}
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return &TableCheckError{Table: table, Err: err}
+		}
+		exists = false
+	}
+
+	tableExistsCache.Lock()
+	tableExistsCache.entries[table] = tableExistsEntry{exists: exists, checkedAt: time.Now()}
+	tableExistsCache.Unlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, table)
+	}
+	return nil
+}
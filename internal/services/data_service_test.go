@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+func TestCheckSessionTimeframe(t *testing.T) {
+	tests := []struct {
+		timeframe string
+		session   string
+		ok        bool
+	}{
+		// A UTC day would hold the end of one Sydney session and the start of the next
+		{"1d", "SYDNEY", false},
+		{"1w", "SYDNEY", false},
+		{"36h", "SYDNEY", false},
+		{"1d", "TOKYO,SYDNEY", false},
+		{"1d", "LONDON,SYDNEY", false},
+		// Sessions within a UTC day fit in daily bars
+		{"1d", "LONDON", true},
+		{"1w", "NEWYORK", true},
+		{"1d", "TOKYO,LONDON,NEWYORK", true},
+		// Bars under a day can't join two nights' sessions
+		{"4h", "SYDNEY", true},
+		{"12h", "SYDNEY", true},
+		{"", "SYDNEY", true},
+		{"1d", "", true},
+	}
+	for _, tt := range tests {
+		sessions, err := models.CandleRequest{Session: tt.session}.ParseSessions()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = CheckSessionTimeframe(tt.timeframe, sessions)
+		if tt.ok && err != nil {
+			t.Errorf("%s bars of %s: %v", tt.timeframe, tt.session, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidResolution) {
+			t.Errorf("%s bars of %s: err = %v, want ErrInvalidResolution", tt.timeframe, tt.session, err)
+		}
+	}
+}
+
+// fakeCatalog answers table lookups the way QuestDB's tables() would
+type fakeCatalog struct {
+	tables  map[string]bool
+	err     error // returned by the PGWire lookup instead of an answer
+	http    bool  // whether the HTTP fallback is configured
+	httpErr error
+	queries int
+	posts   int
+}
+
+// catalogRow is the row of a PGWire lookup
+type catalogRow struct {
+	name string
+	err  error
+}
+
+func (r catalogRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*string) = r.name
+	return nil
+}
+
+func (c *fakeCatalog) QueryRowWithTimeout(_ context.Context, _ time.Duration, _ string, args ...interface{}) pgx.Row {
+	c.queries++
+	table := args[0].(string)
+	switch {
+	case c.err != nil:
+		return catalogRow{err: c.err}
+	case !c.tables[table]:
+		return catalogRow{err: pgx.ErrNoRows}
+	}
+	return catalogRow{name: table}
+}
+
+func (c *fakeCatalog) QueryTimeout() time.Duration { return time.Second }
+
+func (c *fakeCatalog) HTTPEnabled() bool { return c.http }
+
+func (c *fakeCatalog) ExecHTTP(_ context.Context, _ string, args ...interface{}) (*db.ExecResult, error) {
+	c.posts++
+	if c.httpErr != nil {
+		return nil, c.httpErr
+	}
+	result := &db.ExecResult{}
+	if table := args[0].(string); c.tables[table] {
+		result.Dataset = [][]interface{}{{table}}
+	}
+	return result, nil
+}
+
+// forgetTables drops cached lookups of the tables once a test ends, since
+// the cache is shared across DataServices
+func forgetTables(t *testing.T, tables ...string) {
+	t.Cleanup(func() {
+		tableExistsCache.Lock()
+		defer tableExistsCache.Unlock()
+		for _, table := range tables {
+			delete(tableExistsCache.entries, table)
+		}
+	})
+}
+
+func TestCheckTableExists(t *testing.T) {
+	refused := errors.New("connection refused")
+	tests := []struct {
+		name     string
+		table    string
+		catalog  *fakeCatalog
+		notFound bool
+		checkErr bool
+		posts    int
+	}{
+		{"exists", "ohlc_check_exists", &fakeCatalog{tables: map[string]bool{"ohlc_check_exists": true}}, false, false, 0},
+		{"missing", "ohlc_check_missing", &fakeCatalog{}, true, false, 0},
+		{"query error", "ohlc_check_error", &fakeCatalog{err: refused}, false, true, 0},
+		{"query error, found over http", "ohlc_check_http_found", &fakeCatalog{tables: map[string]bool{"ohlc_check_http_found": true}, err: refused, http: true}, false, false, 1},
+		{"query error, missing over http", "ohlc_check_http_missing", &fakeCatalog{err: refused, http: true}, true, false, 1},
+		{"query and http error", "ohlc_check_http_error", &fakeCatalog{err: refused, http: true, httpErr: errors.New("503")}, false, true, 1},
+		// A missing table isn't looked up again over HTTP
+		{"missing with http", "ohlc_check_missing_http", &fakeCatalog{http: true}, true, false, 0},
+	}
+	for _, tt := range tests {
+		forgetTables(t, tt.table)
+		s := &DataService{catalog: tt.catalog}
+
+		err := s.CheckTableExists(context.Background(), tt.table)
+		var checkErr *TableCheckError
+		switch {
+		case tt.notFound && !errors.Is(err, ErrTableNotFound):
+			t.Errorf("%s: err = %v, want ErrTableNotFound", tt.name, err)
+		case tt.checkErr && (!errors.As(err, &checkErr) || checkErr.Table != tt.table || errors.Is(err, ErrTableNotFound)):
+			t.Errorf("%s: err = %v, want a TableCheckError for %s", tt.name, err, tt.table)
+		case !tt.notFound && !tt.checkErr && err != nil:
+			t.Errorf("%s: err = %v, want the table found", tt.name, err)
+		}
+		if tt.catalog.posts != tt.posts {
+			t.Errorf("%s: %d HTTP lookups, want %d", tt.name, tt.catalog.posts, tt.posts)
+		}
+	}
+}
+
+func TestCheckTableExistsCachesAnswers(t *testing.T) {
+	forgetTables(t, "ohlc_cached_present", "ohlc_cached_absent", "ohlc_cached_failing")
+	catalog := &fakeCatalog{tables: map[string]bool{"ohlc_cached_present": true}}
+	s := &DataService{catalog: catalog}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := s.CheckTableExists(ctx, "ohlc_cached_present"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CheckTableExists(ctx, "ohlc_cached_absent"); !errors.Is(err, ErrTableNotFound) {
+			t.Fatalf("err = %v, want ErrTableNotFound", err)
+		}
+	}
+	if catalog.queries != 2 {
+		t.Errorf("%d lookups, want one per table", catalog.queries)
+	}
+
+	// A failed lookup says nothing about the table, so it isn't cached
+	catalog.err = errors.New("connection refused")
+	for i := 0; i < 2; i++ {
+		s.CheckTableExists(ctx, "ohlc_cached_failing")
+	}
+	if catalog.queries != 4 {
+		t.Errorf("%d lookups after two failures, want each failure looked up again", catalog.queries)
+	}
+}
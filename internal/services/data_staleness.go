@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/db"
+)
+
+// stalenessCheckTimeout bounds one staleness check of every symbol
+const stalenessCheckTimeout = 30 * time.Second
+
+// Staleness alert events
+const (
+	StalenessEventStale     = "stale"
+	StalenessEventRecovered = "recovered"
+)
+
+// stalenessBreachesTotal counts symbols turning stale since startup
+var stalenessBreachesTotal atomic.Int64
+
+// stalenessMonitor holds the staleness monitor's settings and state
+type stalenessMonitor struct {
+	config  config.StalenessConfig
+	wg      sync.WaitGroup
+	checkMu sync.Mutex // serializes checks so a change alerts once
+	mu      sync.RWMutex
+	checks  int64
+	symbols map[string]SymbolStaleness
+}
+
+// SymbolStaleness is how far one symbol's newest tick lags behind now
+type SymbolStaleness struct {
+	Symbol     string     `json:"symbol"`
+	LatestTick *time.Time `json:"latest_tick"`
+	Lag        string     `json:"lag"`
+	LagSeconds float64    `json:"lag_seconds"`
+	MaxLag     string     `json:"max_lag"`
+	MarketOpen bool       `json:"market_open"`
+	Stale      bool       `json:"stale"`
+	StaleSince *time.Time `json:"stale_since,omitempty"`
+	Breaches   int64      `json:"breaches"` // times the symbol has turned stale
+	CheckedAt  time.Time  `json:"checked_at"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// StalenessStatus reports the monitor state and the last check of each symbol
+type StalenessStatus struct {
+	Enabled       bool              `json:"enabled"`
+	Interval      string            `json:"interval"`
+	MaxLagOpen    string            `json:"max_lag_open"`
+	MaxLagClosed  string            `json:"max_lag_closed"`
+	Checks        int64             `json:"checks"`
+	BreachesTotal int64             `json:"breaches_total"`
+	Stale         int               `json:"stale"` // symbols stale right now
+	Symbols       []SymbolStaleness `json:"symbols"`
+}
+
+// StalenessAlert is the payload POSTed to the staleness webhook when a
+// symbol turns stale or recovers
+type StalenessAlert struct {
+	Event     string          `json:"event"` // stale or recovered
+	Staleness SymbolStaleness `json:"staleness"`
+}
+
+// StartStaleness configures the staleness monitor and, when enabled, launches
+// it. Each check compares every symbol's newest tick against the lag allowed
+// for its market's current state: short while the market is open, long while
+// it is closed so weekends and holidays don't alert.
+func (dm *DataManager) StartStaleness(cfg config.StalenessConfig) {
+	dm.staleness = &stalenessMonitor{
+		config:  cfg,
+		symbols: make(map[string]SymbolStaleness),
+	}
+
+	if !cfg.Enabled {
+		log.Info().Msg("Staleness monitor disabled")
+		return
+	}
+	if cfg.WebhookURL != "" && dm.webhooks == nil {
+		log.Warn().Msg("Staleness alert webhook disabled: job webhooks are off or FETCH_WEBHOOK_SECRET is not set")
+	}
+
+	dm.staleness.wg.Add(1)
+	go func() {
+		defer dm.staleness.wg.Done()
+
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		log.Info().
+			Strs("symbols", cfg.Symbols).
+			Dur("interval", cfg.Interval).
+			Dur("max_lag_open", cfg.MaxLagOpen).
+			Dur("max_lag_closed", cfg.MaxLagClosed).
+			Msg("Staleness monitor started")
+
+		dm.checkStaleness(dm.rootCtx)
+		for {
+			select {
+			case <-dm.rootCtx.Done():
+				return
+			case <-ticker.C:
+				dm.checkStaleness(dm.rootCtx)
+			}
+		}
+	}()
+}
+
+// CheckStaleness checks every monitored symbol now and returns the result
+func (dm *DataManager) CheckStaleness(ctx context.Context) StalenessStatus {
+	dm.checkStaleness(ctx)
+	return dm.GetStalenessStatus()
+}
+
+// GetStalenessStatus returns the result of the last staleness check
+func (dm *DataManager) GetStalenessStatus() StalenessStatus {
+	status := StalenessStatus{Symbols: make([]SymbolStaleness, 0)}
+	if dm.staleness == nil {
+		return status
+	}
+	cfg := dm.staleness.config
+	status.Enabled = cfg.Enabled
+	status.Interval = cfg.Interval.String()
+	status.MaxLagOpen = cfg.MaxLagOpen.String()
+	status.MaxLagClosed = cfg.MaxLagClosed.String()
+	status.BreachesTotal = stalenessBreachesTotal.Load()
+
+	dm.staleness.mu.RLock()
+	defer dm.staleness.mu.RUnlock()
+
+	status.Checks = dm.staleness.checks
+	for _, symbol := range cfg.Symbols {
+		if result, ok := dm.staleness.symbols[symbol]; ok {
+			status.Symbols = append(status.Symbols, result)
+			if result.Stale {
+				status.Stale++
+			}
+		}
+	}
+	return status
+}
+
+// symbolStaleness returns the last check of one symbol, if it is monitored
+func (dm *DataManager) symbolStaleness(symbol string) (SymbolStaleness, bool) {
+	if dm.staleness == nil {
+		return SymbolStaleness{}, false
+	}
+	dm.staleness.mu.RLock()
+	defer dm.staleness.mu.RUnlock()
+
+	result, ok := dm.staleness.symbols[symbol]
+	return result, ok
+}
+
+// checkStaleness checks every monitored symbol, alerting on the ones whose
+// state changed since the previous check
+func (dm *DataManager) checkStaleness(ctx context.Context) {
+	if dm.staleness == nil {
+		return
+	}
+	dm.staleness.checkMu.Lock()
+	defer dm.staleness.checkMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, stalenessCheckTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	for _, symbol := range dm.staleness.config.Symbols {
+		result := dm.measureStaleness(ctx, symbol, now)
+
+		dm.staleness.mu.Lock()
+		previous := dm.staleness.symbols[symbol]
+		result.Breaches = previous.Breaches
+		if result.Error != "" {
+			// A failed query says nothing about the feed; keep the last verdict
+			result.Stale, result.StaleSince = previous.Stale, previous.StaleSince
+		} else if result.Stale {
+			result.StaleSince = previous.StaleSince
+			if !previous.Stale {
+				result.StaleSince = &now
+				result.Breaches++
+			}
+		}
+		dm.staleness.symbols[symbol] = result
+		dm.staleness.mu.Unlock()
+
+		switch {
+		case result.Error != "":
+			log.Error().Str("symbol", symbol).Str("error", result.Error).Msg("Staleness check failed")
+		case result.Stale && !previous.Stale:
+			stalenessBreachesTotal.Add(1)
+			dm.alertStaleness(StalenessEventStale, result)
+		case !result.Stale && previous.Stale:
+			dm.alertStaleness(StalenessEventRecovered, result)
+		}
+	}
+
+	dm.staleness.mu.Lock()
+	dm.staleness.checks++
+	dm.staleness.mu.Unlock()
+}
+
+// measureStaleness compares a symbol's newest tick with the lag allowed now
+func (dm *DataManager) measureStaleness(ctx context.Context, symbol string, now time.Time) SymbolStaleness {
+	ctx = db.WithQueryLabel(ctx, db.QueryLatestTick, "market_data_v2")
+
+	result := SymbolStaleness{
+		Symbol:     symbol,
+		MarketOpen: dm.calendar.Open(symbol, now),
+		CheckedAt:  now,
+	}
+	maxLag := dm.maxLag(symbol, now)
+	result.MaxLag = maxLag.String()
+
+	var latest *time.Time
+	err := dm.pool.QueryRowWithTimeout(ctx, dm.pool.QueryTimeout(), "SELECT max(timestamp) FROM market_data_v2 WHERE symbol = $1", symbol).Scan(&latest)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to read latest tick: %v", err)
+		return result
+	}
+	if latest == nil {
+		// A symbol that has never had a tick is as stale as it gets
+		result.Stale = true
+		return result
+	}
+
+	lag := now.Sub(*latest)
+	result.LatestTick = latest
+	result.Lag = lag.Round(time.Second).String()
+	result.LagSeconds = lag.Seconds()
+	result.Stale = lag > maxLag
+	return result
+}
+
+// maxLag returns how old a symbol's newest tick may be at now: the open lag
+// while the market is open, and the closed lag while it is closed. The open
+// lag only applies once the market has been open for that long, so a fresh
+// open isn't flagged before ticks arrive.
+func (dm *DataManager) maxLag(symbol string, now time.Time) time.Duration {
+	cfg := dm.staleness.config
+	if dm.calendar.Open(symbol, now) && dm.calendar.Open(symbol, now.Add(-cfg.MaxLagOpen)) {
+		return cfg.MaxLagOpen
+	}
+	return cfg.MaxLagClosed
+}
+
+// alertStaleness logs a staleness change and, when configured, POSTs it to
+// the staleness webhook in the background
+func (dm *DataManager) alertStaleness(event string, result SymbolStaleness) {
+	entry := log.Warn()
+	if event == StalenessEventRecovered {
+		entry = log.Info()
+	}
+	entry.
+		Str("event", event).
+		Str("symbol", result.Symbol).
+		Str("lag", result.Lag).
+		Str("max_lag", result.MaxLag).
+		Bool("market_open", result.MarketOpen).
+		Int64("breaches", result.Breaches).
+		Msg("Live symbol staleness changed")
+
+	webhookURL := dm.staleness.config.WebhookURL
+	if webhookURL == "" || dm.webhooks == nil {
+		return
+	}
+	body, err := json.Marshal(StalenessAlert{Event: event, Staleness: result})
+	if err != nil {
+		return
+	}
+	go dm.deliverAlert("staleness", webhookURL, body)
+}
+
+// deliverAlert POSTs a staleness or price alert, retrying failures with the
+// webhook backoff
+func (dm *DataManager) deliverAlert(kind, webhookURL string, body []byte) {
+	for attempt := 1; ; attempt++ {
+		_, err := dm.webhooks.post(dm.rootCtx, webhookURL, body)
+		if err == nil {
+			return
+		}
+		if attempt >= dm.webhooks.retry.attempts || dm.rootCtx.Err() != nil {
+			log.Error().Err(err).Int("attempts", attempt).Msgf("Giving up on %s alert webhook", kind)
+			return
+		}
+
+		timer := time.NewTimer(dm.webhooks.retry.backoff(attempt))
+		select {
+		case <-dm.rootCtx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
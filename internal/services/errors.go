@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sptrader/sptrader/internal/db"
+)
+
+// Errors the query services return so callers can tell failures apart. They
+// are wrapped with what failed; the API maps each to a status.
+var (
+	ErrNoData            = errors.New("no data")
+	ErrInvalidResolution = errors.New("invalid resolution")
+	ErrRangeTooLarge     = errors.New("range too large")
+	ErrInsufficientData  = errors.New("insufficient data")
+	ErrTimeout           = errors.New("query timed out")
+	ErrUnavailable       = errors.New("database unavailable")
+)
+
+// queryError marks a failed query as ErrTimeout or ErrUnavailable when it is
+// one, keeping the database error in the chain for logging and Retry-After
+func queryError(err error) error {
+	switch {
+	case err == nil, errors.Is(err, ErrTimeout), errors.Is(err, ErrUnavailable):
+		return err
+	case errors.Is(err, db.ErrQueryTimeout), errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	case db.IsUnavailable(err):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	default:
+		return err
+	}
+}
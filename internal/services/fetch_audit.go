@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/db"
+)
+
+// fetchAuditTable records every finished fetch job
+const fetchAuditTable = "fetch_audit"
+
+// fetchAuditWriteTimeout bounds writing one audit record
+const fetchAuditWriteTimeout = 10 * time.Second
+
+// FetchRecord is the audit record of one finished fetch job
+type FetchRecord struct {
+	JobID        string    `json:"job_id"`
+	Symbol       string    `json:"symbol"`
+	Source       string    `json:"source"`
+	RequestedBy  string    `json:"requested_by,omitempty"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	State        string    `json:"state"`
+	Ticks        int64     `json:"ticks"`
+	Gaps         int       `json:"gaps"`
+	ResidualGaps int       `json:"residual_gaps"`
+	DurationMs   int64     `json:"duration_ms"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+}
+
+// FetchHistoryQuery selects a page of fetch records, newest first
+type FetchHistoryQuery struct {
+	Symbol string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+// ensureAuditTable creates the audit table if it doesn't exist yet
+func (dm *DataManager) ensureAuditTable(ctx context.Context) error {
+	return dm.writePool.ExecSchema(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			job_id STRING,
+			symbol SYMBOL,
+			source SYMBOL,
+			requested_by STRING,
+			range_start TIMESTAMP,
+			range_end TIMESTAMP,
+			state SYMBOL,
+			ticks LONG,
+			gaps INT,
+			residual_gaps INT,
+			duration_ms LONG,
+			error STRING,
+			created_at TIMESTAMP,
+			finished_at TIMESTAMP
+		) timestamp(finished_at) PARTITION BY MONTH
+	`, fetchAuditTable))
+}
+
+// recordFetch writes a finished job to the audit table. Failures are logged;
+// auditing never affects the job.
+func (dm *DataManager) recordFetch(job *FetchJob) {
+	dm.jobsMu.Lock()
+	snapshot := job.snapshot()
+	dm.jobsMu.Unlock()
+
+	record := FetchRecord{
+		JobID:        snapshot.ID,
+		Symbol:       snapshot.Symbol,
+		Source:       snapshot.Source,
+		RequestedBy:  snapshot.RequestedBy,
+		Start:        snapshot.Start,
+		End:          snapshot.End,
+		State:        string(snapshot.State),
+		Ticks:        snapshot.Rows,
+		Gaps:         len(snapshot.Gaps),
+		ResidualGaps: len(snapshot.Residual),
+		Error:        snapshot.Error,
+		CreatedAt:    snapshot.CreatedAt,
+		FinishedAt:   time.Now().UTC(),
+	}
+	if snapshot.FinishedAt != nil {
+		record.FinishedAt = *snapshot.FinishedAt
+	}
+	if snapshot.StartedAt != nil {
+		record.DurationMs = record.FinishedAt.Sub(*snapshot.StartedAt).Milliseconds()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchAuditWriteTimeout)
+	defer cancel()
+	ctx = db.WithQueryLabel(ctx, db.QueryFetchAudit, fetchAuditTable)
+
+	_, err := dm.writePool.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s (job_id, symbol, source, requested_by, range_start, range_end, state,
+			ticks, gaps, residual_gaps, duration_ms, error, created_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`, fetchAuditTable),
+		record.JobID, record.Symbol, record.Source, record.RequestedBy, record.Start, record.End, record.State,
+		record.Ticks, record.Gaps, record.ResidualGaps, record.DurationMs, record.Error, record.CreatedAt, record.FinishedAt,
+	)
+	if err != nil {
+		log.Error().Err(err).Str("job", record.JobID).Str("symbol", record.Symbol).Msg("Failed to record fetch job in audit")
+	}
+}
+
+// auditColumns are the audit table columns in FetchRecord order
+const auditColumns = `job_id, symbol, source, requested_by, range_start, range_end, state,
+	ticks, gaps, residual_gaps, duration_ms, error, created_at, finished_at`
+
+// scanFetchRecord reads one audit row selected with auditColumns
+func scanFetchRecord(scan func(dest ...interface{}) error) (FetchRecord, error) {
+	var r FetchRecord
+	var source, requestedBy, errText *string
+	err := scan(&r.JobID, &r.Symbol, &source, &requestedBy, &r.Start, &r.End, &r.State,
+		&r.Ticks, &r.Gaps, &r.ResidualGaps, &r.DurationMs, &errText, &r.CreatedAt, &r.FinishedAt)
+	if source != nil {
+		r.Source = *source
+	}
+	if requestedBy != nil {
+		r.RequestedBy = *requestedBy
+	}
+	if errText != nil {
+		r.Error = *errText
+	}
+	return r, err
+}
+
+// FetchHistory returns a page of fetch records finished in [From, To),
+// newest first, and whether more records follow the page
+func (dm *DataManager) FetchHistory(ctx context.Context, q FetchHistoryQuery) ([]FetchRecord, bool, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryFetchAudit, fetchAuditTable)
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE finished_at >= $1 AND finished_at < $2", auditColumns, fetchAuditTable)
+	args := []interface{}{q.From, q.To}
+	if q.Symbol != "" {
+		query += " AND symbol = $3"
+		args = append(args, q.Symbol)
+	}
+	// Fetch one extra row to learn whether another page exists
+	query += fmt.Sprintf(" ORDER BY finished_at DESC LIMIT %d, %d", q.Offset, q.Offset+q.Limit+1)
+
+	rows, err := dm.pool.QueryWithTimeout(ctx, dm.pool.QueryTimeout(), query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query fetch history: %w", err)
+	}
+	defer rows.Close()
+
+	records := make([]FetchRecord, 0, q.Limit)
+	for rows.Next() {
+		record, err := scanFetchRecord(rows.Scan)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read fetch history: %w", err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	more := len(records) > q.Limit
+	if more {
+		records = records[:q.Limit]
+	}
+	return records, more, nil
+}
+
+// latestFetches returns the most recent fetch record of every symbol
+func (dm *DataManager) latestFetches(ctx context.Context) (map[string]FetchRecord, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryFetchAudit, fetchAuditTable)
+
+	rows, err := dm.pool.QueryWithTimeout(ctx, dm.pool.QueryTimeout(), fmt.Sprintf(
+		"SELECT %s FROM %s LATEST ON finished_at PARTITION BY symbol", auditColumns, fetchAuditTable))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latest := make(map[string]FetchRecord)
+	for rows.Next() {
+		record, err := scanFetchRecord(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		latest[record.Symbol] = record
+	}
+	return latest, rows.Err()
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// jobStore persists fetch jobs to a JSON file so they survive restarts. The
+// file is rewritten atomically on every save.
+type jobStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// load reads the saved jobs. A missing file yields no jobs.
+func (s *jobStore) load() ([]*FetchJob, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job store: %w", err)
+	}
+
+	var jobs []*FetchJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to parse job store: %w", err)
+	}
+	return jobs, nil
+}
+
+// save replaces the file with jobs, writing to a temporary file first so a
+// crash never leaves it truncated. Must be called with s.mu held.
+func (s *jobStore) save(jobs []FetchJob) error {
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode jobs: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create job store directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write job store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace job store: %w", err)
+	}
+	return nil
+}
+
+// persistJobs writes every retained job to the store, if one is configured.
+// Failures are logged; persistence never blocks a fetch.
+func (dm *DataManager) persistJobs() {
+	if dm.store == nil {
+		return
+	}
+
+	dm.store.mu.Lock()
+	defer dm.store.mu.Unlock()
+
+	// Snapshot while holding the store lock so saves can't land out of order
+	dm.jobsMu.Lock()
+	dm.pruneJobs()
+	jobs := make([]FetchJob, 0, len(dm.jobs))
+	for _, job := range dm.jobs {
+		jobs = append(jobs, job.snapshot())
+	}
+	dm.jobsMu.Unlock()
+
+	if err := dm.store.save(jobs); err != nil {
+		log.Error().Err(err).Msg("Failed to persist fetch jobs")
+	}
+}
+
+// restoreJobs loads saved jobs. Jobs that were unfinished when the API
+// stopped are resumed when resume is set, and otherwise marked interrupted
+// so an operator can re-trigger them.
+func (dm *DataManager) restoreJobs(resume bool) {
+	if dm.store == nil {
+		return
+	}
+
+	jobs, err := dm.store.load()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to restore fetch jobs")
+		return
+	}
+
+	resumed, interrupted := 0, 0
+	dm.jobsMu.Lock()
+	for _, job := range jobs {
+		if job.Priority == "" {
+			job.Priority = PriorityNormal
+		}
+		if !job.done() {
+			for i := range job.Gaps {
+				switch job.Gaps[i].State {
+				case string(JobRunning), gapRetrying, gapThrottled:
+					job.Gaps[i].State = string(JobQueued)
+					job.Gaps[i].ThrottledUntil = nil
+				}
+			}
+			job.Progress.ThrottledUntil = nil
+
+			if resume {
+				job.State = JobQueued
+				resumed++
+			} else {
+				job.State = JobInterrupted
+				job.Error = fmt.Sprintf("interrupted by restart after %d of %d hours", job.Progress.HoursDone, job.Progress.HoursTotal)
+				interrupted++
+			}
+		}
+		dm.jobs[job.ID] = job
+	}
+	dm.pruneJobs()
+	dm.jobsMu.Unlock()
+
+	for _, job := range jobs {
+		if job.State == JobQueued {
+			ctx, cancel := dm.jobContext()
+			job.cancel = cancel
+			go dm.runJob(ctx, job)
+		}
+	}
+
+	log.Info().
+		Int("jobs", len(jobs)).
+		Int("resumed", resumed).
+		Int("interrupted", interrupted).
+		Msg("Restored fetch jobs")
+	dm.persistJobs()
+}
@@ -0,0 +1,500 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/providers"
+	"github.com/sptrader/sptrader/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// progressLogInterval is how often a running job logs its progress
+const progressLogInterval = 30 * time.Second
+
+// throughputWindow is how many recent hour completions the ETA is based on
+const throughputWindow = 24
+
+// JobState is the lifecycle state of a fetch job
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+
+	// JobInterrupted marks a job that was unfinished when the API restarted
+	// and wasn't resumed
+	JobInterrupted JobState = "interrupted"
+
+	// JobThrottled marks a job that finished with gaps left unfilled only
+	// because the provider throttled requests; refetching later should work
+	JobThrottled JobState = "throttled"
+)
+
+// JobPriority orders waiting gap fetches in the queue
+type JobPriority string
+
+const (
+	PriorityHigh   JobPriority = "high" // interactive requests a user is waiting on
+	PriorityNormal JobPriority = "normal"
+	PriorityLow    JobPriority = "low" // scheduled and bulk backfills
+)
+
+// ErrInvalidPriority is returned for priorities other than high, normal or low
+var ErrInvalidPriority = errors.New("priority must be high, normal or low")
+
+// rank orders priorities for the queue; unknown values rank as normal
+func (p JobPriority) rank() int {
+	switch p {
+	case PriorityHigh:
+		return 2
+	case PriorityLow:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// ParsePriority validates a priority, defaulting an empty one to def
+func ParsePriority(value string, def JobPriority) (JobPriority, error) {
+	switch p := JobPriority(value); p {
+	case "":
+		return def, nil
+	case PriorityHigh, PriorityNormal, PriorityLow:
+		return p, nil
+	default:
+		return "", ErrInvalidPriority
+	}
+}
+
+// Job sources
+const (
+	JobSourceAPI      = "api"      // requested through EnsureData
+	JobSourceBackfill = "backfill" // started by the catch-up scheduler
+)
+
+// Gap states beyond the job states
+const (
+	gapSkipped   = "skipped"   // another job filled the range first
+	gapThrottled = "throttled" // the provider throttled requests; waiting out its cool-down
+)
+
+// ErrJobNotFound is returned for unknown or expired job IDs
+var ErrJobNotFound = errors.New("fetch job not found")
+
+// ErrJobFinished is returned when cancelling a job that has already finished
+var ErrJobFinished = errors.New("fetch job already finished")
+
+// errGapsThrottled means a job's unfilled gaps were all throttled
+var errGapsThrottled = errors.New("provider throttled requests")
+
+// errAlreadyFilled means the range had no gaps by the time its fetch ran
+var errAlreadyFilled = errors.New("range already filled")
+
+// FetchJob tracks one EnsureData request through its gap fetches
+type FetchJob struct {
+	ID         string        `json:"id"`
+	Symbol     string        `json:"symbol"`
+	Start      time.Time     `json:"start"`
+	End        time.Time     `json:"end"`
+	State      JobState      `json:"state"`
+	Source     string        `json:"source,omitempty"`
+	Priority   JobPriority   `json:"priority"`
+	Gaps       []GapProgress `json:"gaps"`
+	Rows       int64         `json:"rows"`
+	Progress   JobProgress   `json:"progress"`
+	Error      string        `json:"error,omitempty"`
+	Residual   []Gap         `json:"residual_gaps,omitempty"`  // gaps still unfilled when the job failed
+	QueuePos   int           `json:"queue_position,omitempty"` // 1-based position of the job's waiting gap
+	Throttles  int           `json:"throttles,omitempty"`      // gap attempts the provider throttled
+	Attached   bool          `json:"attached,omitempty"`       // the request joined this already running job
+	CreatedAt  time.Time     `json:"created_at"`
+	StartedAt  *time.Time    `json:"started_at,omitempty"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+
+	OHLC []OHLCRebuild `json:"ohlc_rebuilds,omitempty"` // OHLC windows rebuilt after each gap
+
+	RequestedBy string            `json:"requested_by,omitempty"`
+	CallbackURL string            `json:"callback_url,omitempty"` // POSTed a JobWebhook when the job finishes
+	Deliveries  []WebhookDelivery `json:"webhook_deliveries,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// JobProgress reports how far through its hour files a job is
+type JobProgress struct {
+	HoursTotal  int       `json:"hours_total"`
+	HoursDone   int       `json:"hours_done"`
+	Percent     float64   `json:"percent"`
+	CurrentHour time.Time `json:"current_hour,omitempty"`
+	HoursPerMin float64   `json:"hours_per_min"`
+	ETASeconds  float64   `json:"eta_seconds"`
+
+	// ThrottledUntil is set while the job waits out a provider cool-down
+	ThrottledUntil *time.Time `json:"throttled_until,omitempty"`
+
+	recent []time.Time // completion times of the latest hours, for throughput
+}
+
+// recordHour advances progress by one hour file completed at now
+func (p *JobProgress) recordHour(hour, now time.Time) {
+	p.HoursDone++
+	p.CurrentHour = hour
+	if p.HoursTotal > 0 {
+		p.Percent = float64(p.HoursDone) / float64(p.HoursTotal) * 100
+	}
+
+	p.recent = append(p.recent, now)
+	if len(p.recent) > throughputWindow {
+		p.recent = p.recent[len(p.recent)-throughputWindow:]
+	}
+	if len(p.recent) < 2 {
+		return
+	}
+
+	elapsed := p.recent[len(p.recent)-1].Sub(p.recent[0])
+	if elapsed <= 0 {
+		return
+	}
+	perSecond := float64(len(p.recent)-1) / elapsed.Seconds()
+	p.HoursPerMin = perSecond * 60
+	if remaining := p.HoursTotal - p.HoursDone; remaining > 0 {
+		p.ETASeconds = float64(remaining) / perSecond
+	} else {
+		p.ETASeconds = 0
+	}
+}
+
+// completeHours marks hours done without per-hour timing, for fetchers that
+// only report when a whole gap finishes
+func (p *JobProgress) completeHours(n int, through time.Time) {
+	p.HoursDone += n
+	p.CurrentHour = through
+	if p.HoursTotal > 0 {
+		p.Percent = float64(p.HoursDone) / float64(p.HoursTotal) * 100
+	}
+}
+
+// hourFiles is the number of hour files covering a gap
+func hourFiles(gap Gap) int {
+	return int((gap.End.Sub(gap.Start.Truncate(time.Hour)) + time.Hour - 1) / time.Hour)
+}
+
+// GapProgress is the fetch state of one gap within a job
+type GapProgress struct {
+	Gap
+	State     string           `json:"state"`
+	Rows      int64            `json:"rows"`
+	Providers map[string]int64 `json:"providers,omitempty"` // ticks each provider filled
+	Attempts  int              `json:"attempts"`
+	Error     string           `json:"error,omitempty"` // latest failure, cleared on success
+
+	ThrottledUntil *time.Time `json:"throttled_until,omitempty"` // end of the provider cool-down the gap waits on
+}
+
+// done reports whether the job has finished
+func (j *FetchJob) done() bool {
+	switch j.State {
+	case JobSucceeded, JobFailed, JobCancelled, JobInterrupted, JobThrottled:
+		return true
+	default:
+		return false
+	}
+}
+
+// gapDone reports whether a gap needs no further fetching, which matters
+// when a restored job resumes
+func (g *GapProgress) gapDone() bool {
+	return g.State == string(JobSucceeded) || g.State == gapSkipped
+}
+
+// snapshot copies the job so it can be returned while the job keeps running
+func (j *FetchJob) snapshot() FetchJob {
+	job := *j
+	job.Gaps = append([]GapProgress(nil), j.Gaps...)
+	for i, gap := range job.Gaps {
+		if gap.Providers != nil {
+			job.Gaps[i].Providers = make(map[string]int64, len(gap.Providers))
+			for name, ticks := range gap.Providers {
+				job.Gaps[i].Providers[name] = ticks
+			}
+		}
+	}
+	job.Residual = append([]Gap(nil), j.Residual...)
+	job.Deliveries = append([]WebhookDelivery(nil), j.Deliveries...)
+	job.OHLC = append([]OHLCRebuild(nil), j.OHLC...)
+	job.Progress.recent = nil
+	job.cancel = nil
+	return job
+}
+
+// newJobID returns a random job identifier
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// GetJob returns a snapshot of a job
+func (dm *DataManager) GetJob(id string) (FetchJob, error) {
+	dm.jobsMu.Lock()
+	defer dm.jobsMu.Unlock()
+
+	dm.pruneJobs()
+	job, ok := dm.jobs[id]
+	if !ok {
+		return FetchJob{}, ErrJobNotFound
+	}
+	snapshot := job.snapshot()
+	snapshot.QueuePos = dm.queue.position(id)
+	return snapshot, nil
+}
+
+// ListJobs returns snapshots of retained jobs, newest first, optionally
+// filtered by symbol
+func (dm *DataManager) ListJobs(symbol string) []FetchJob {
+	dm.jobsMu.Lock()
+	defer dm.jobsMu.Unlock()
+
+	dm.pruneJobs()
+	jobs := make([]FetchJob, 0, len(dm.jobs))
+	for _, job := range dm.jobs {
+		if symbol == "" || job.Symbol == symbol {
+			snapshot := job.snapshot()
+			snapshot.QueuePos = dm.queue.position(job.ID)
+			jobs = append(jobs, snapshot)
+		}
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].CreatedAt.After(jobs[k].CreatedAt)
+	})
+	return jobs
+}
+
+// CancelJob stops a queued or running job. The job stops after the hour file
+// in progress and is marked cancelled with its progress so far.
+func (dm *DataManager) CancelJob(id string) (FetchJob, error) {
+	dm.jobsMu.Lock()
+	defer dm.jobsMu.Unlock()
+
+	job, ok := dm.jobs[id]
+	if !ok {
+		return FetchJob{}, ErrJobNotFound
+	}
+	if job.done() {
+		return job.snapshot(), ErrJobFinished
+	}
+
+	log.Info().Str("job", job.ID).Str("symbol", job.Symbol).Msg("Cancelling fetch job")
+	job.cancel()
+	return job.snapshot(), nil
+}
+
+// SetJobPriority changes the priority of a queued or running job, including
+// any of its gap fetches already waiting in the queue
+func (dm *DataManager) SetJobPriority(id string, priority JobPriority) (FetchJob, error) {
+	dm.jobsMu.Lock()
+	defer dm.jobsMu.Unlock()
+
+	job, ok := dm.jobs[id]
+	if !ok {
+		return FetchJob{}, ErrJobNotFound
+	}
+	if job.done() {
+		return job.snapshot(), ErrJobFinished
+	}
+
+	log.Info().
+		Str("job", job.ID).
+		Str("symbol", job.Symbol).
+		Str("from", string(job.Priority)).
+		Str("to", string(priority)).
+		Msg("Fetch job priority changed")
+	job.Priority = priority
+	dm.queue.reprioritize(job.ID, priority.rank())
+
+	snapshot := job.snapshot()
+	snapshot.QueuePos = dm.queue.position(job.ID)
+	return snapshot, nil
+}
+
+// pruneJobs drops finished fetch jobs and audits older than the retention
+// window. Must be called with jobsMu held.
+func (dm *DataManager) pruneJobs() {
+	cutoff := time.Now().Add(-dm.jobRetention)
+	for id, job := range dm.jobs {
+		if job.done() && job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			delete(dm.jobs, id)
+		}
+	}
+	for id, audit := range dm.audits {
+		if audit.done() && audit.FinishedAt != nil && audit.FinishedAt.Before(cutoff) {
+			delete(dm.audits, id)
+		}
+	}
+}
+
+// updateJob applies fn to a job under the jobs lock
+func (dm *DataManager) updateJob(job *FetchJob, fn func(*FetchJob)) {
+	dm.jobsMu.Lock()
+	defer dm.jobsMu.Unlock()
+	fn(job)
+}
+
+// runJob fetches each of a job's unfinished gaps in order. A gap that still
+// fails after its retries is left unfilled and the job moves on; the job
+// fails only if any gaps remain unfilled at the end.
+func (dm *DataManager) runJob(ctx context.Context, job *FetchJob) {
+	started := time.Now().UTC()
+	dm.updateJob(job, func(j *FetchJob) {
+		j.State = JobRunning
+		j.StartedAt = &started
+		j.Residual = nil
+	})
+
+	defer job.cancel()
+
+	ctx, span := tracing.Start(ctx, "fetch.job",
+		attribute.String("job.id", job.ID),
+		attribute.String("job.symbol", job.Symbol),
+		attribute.Int("job.gaps", len(job.Gaps)),
+	)
+
+	stopLogging := make(chan struct{})
+	defer close(stopLogging)
+	go dm.logJobProgress(job, stopLogging)
+
+	var failure error
+	for i := range job.Gaps {
+		if failure = ctx.Err(); failure != nil {
+			break
+		}
+
+		dm.jobsMu.Lock()
+		finished := job.Gaps[i].gapDone()
+		dm.jobsMu.Unlock()
+		if finished {
+			continue
+		}
+
+		gapCtx, gapSpan := tracing.Start(ctx, "fetch.gap",
+			attribute.String("gap.start", job.Gaps[i].Start.Format(time.RFC3339)),
+			attribute.String("gap.end", job.Gaps[i].End.Format(time.RFC3339)),
+		)
+		err := dm.fetchGap(gapCtx, job, i)
+		tracing.End(gapSpan, err)
+		if errors.Is(err, context.Canceled) {
+			failure = err
+			break
+		}
+		// Throttling says nothing about whether the provider has the data
+		if !errors.Is(err, providers.ErrThrottled) {
+			dm.recordGapOutcome(job.Symbol, job.Gaps[i].Gap, err)
+		}
+	}
+
+	if failure == nil {
+		dm.jobsMu.Lock()
+		throttled := 0
+		for _, gap := range job.Gaps {
+			switch gap.State {
+			case gapThrottled:
+				throttled++
+				job.Residual = append(job.Residual, gap.Gap)
+			case string(JobFailed):
+				job.Residual = append(job.Residual, gap.Gap)
+			}
+		}
+		switch {
+		case len(job.Residual) > 0 && throttled == len(job.Residual):
+			failure = fmt.Errorf("%w: %d of %d gaps unfilled", errGapsThrottled, throttled, len(job.Gaps))
+		case len(job.Residual) > 0:
+			failure = fmt.Errorf("%d of %d gaps unfilled after retries", len(job.Residual), len(job.Gaps))
+		}
+		dm.jobsMu.Unlock()
+	}
+
+	finished := time.Now().UTC()
+	dm.updateJob(job, func(j *FetchJob) {
+		j.FinishedAt = &finished
+		switch {
+		case failure == nil:
+			j.State = JobSucceeded
+		case errors.Is(failure, context.Canceled):
+			j.State = JobCancelled
+			j.Error = fmt.Sprintf("cancelled after %d of %d hours", j.Progress.HoursDone, j.Progress.HoursTotal)
+			for k := range j.Gaps {
+				if j.Gaps[k].State == string(JobQueued) {
+					j.Gaps[k].State = string(JobCancelled)
+				}
+			}
+		case errors.Is(failure, errGapsThrottled):
+			j.State = JobThrottled
+			j.Error = failure.Error()
+		default:
+			j.State = JobFailed
+			j.Error = failure.Error()
+		}
+	})
+
+	dm.persistJobs()
+	dm.notifyJob(job)
+	dm.recordJob(job)
+
+	span.SetAttributes(attribute.Int64("job.rows", int64(job.Rows)))
+	tracing.End(span, failure)
+
+	if errors.Is(failure, context.Canceled) {
+		log.Info().Str("job", job.ID).Str("symbol", job.Symbol).Int64("rows", job.Rows).Msg("Fetch job cancelled")
+	} else if failure != nil {
+		log.Error().Err(failure).Str("job", job.ID).Str("symbol", job.Symbol).Msg("Fetch job failed")
+	} else {
+		log.Info().Str("job", job.ID).Str("symbol", job.Symbol).Int64("rows", job.Rows).Msg("Fetch job finished")
+	}
+}
+
+// logJobProgress logs a running job's progress until stop is closed
+func (dm *DataManager) logJobProgress(job *FetchJob, stop <-chan struct{}) {
+	ticker := time.NewTicker(progressLogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			dm.jobsMu.Lock()
+			p := job.Progress
+			rows := job.Rows
+			dm.jobsMu.Unlock()
+
+			event := log.Info().
+				Str("job", job.ID).
+				Str("symbol", job.Symbol).
+				Int("hours_done", p.HoursDone).
+				Int("hours_total", p.HoursTotal).
+				Float64("percent", p.Percent).
+				Int64("ticks", rows)
+			if p.ThrottledUntil != nil {
+				event.Time("throttled_until", *p.ThrottledUntil).Msg("Fetch job throttled by the provider")
+				continue
+			}
+			event.
+				Time("current_hour", p.CurrentHour).
+				Float64("hours_per_min", p.HoursPerMin).
+				Dur("eta", time.Duration(p.ETASeconds)*time.Second).
+				Msg("Fetch job progress")
+		}
+	}
+}
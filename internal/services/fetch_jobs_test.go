@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/providers"
+)
+
+// newTestDataManager builds a DataManager without database or providers;
+// tests replace its availability check and range fetch
+func newTestDataManager(t *testing.T) *DataManager {
+	rootCtx, stopJobs := context.WithCancel(context.Background())
+	dm := &DataManager{
+		rootCtx:      rootCtx,
+		stopJobs:     stopJobs,
+		cache:        newTestCache(0),
+		queue:        newFetchQueue(1, 0),
+		jobs:         make(map[string]*FetchJob),
+		audits:       make(map[string]*AuditJob),
+		jobRetention: time.Hour,
+		retry:        retryPolicy{attempts: 1},
+		gapFailures:  make(map[string]int),
+		recordJob:    func(*FetchJob) {},
+	}
+	t.Cleanup(func() {
+		dm.stopJobs()
+		dm.queue.close()
+	})
+	return dm
+}
+
+func TestFetchJobOutlivesRequest(t *testing.T) {
+	dm := newTestDataManager(t)
+	start := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+
+	dm.checkAvailability = func(ctx context.Context, symbol string, from, to time.Time) (*DataAvailability, error) {
+		return &DataAvailability{
+			Symbol: symbol,
+			Gaps:   []Gap{{Start: from, End: to, Hours: 2, Type: GapMissing}},
+		}, nil
+	}
+	release := make(chan struct{})
+	fetchErr := make(chan error, 1)
+	dm.fetchRange = func(ctx context.Context, symbol string, from, to time.Time, onHour func(providers.HourResult)) (int64, []OHLCRebuild, error) {
+		<-release
+		// The provider sees the job's context, not the request's
+		fetchErr <- ctx.Err()
+		for hour := from; hour.Before(to); hour = hour.Add(time.Hour) {
+			onHour(providers.HourResult{Hour: hour, Ticks: 100, Provider: "fake"})
+		}
+		return 200, nil, nil
+	}
+
+	reqCtx, cancelRequest := context.WithCancel(context.Background())
+	job, err := dm.EnsureData(reqCtx, "EURUSD", start, end, EnsureOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The handler responds 202 and the request ends
+	cancelRequest()
+	close(release)
+
+	if err := <-fetchErr; err != nil {
+		t.Errorf("fetch ran under a cancelled context: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err = dm.GetJob(job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.done() || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if job.State != JobSucceeded {
+		t.Fatalf("job state = %s (%s), want %s", job.State, job.Error, JobSucceeded)
+	}
+	if job.Rows != 200 {
+		t.Errorf("job wrote %d rows, want 200", job.Rows)
+	}
+	if job.Progress.HoursDone != 2 {
+		t.Errorf("job finished %d hours, want 2", job.Progress.HoursDone)
+	}
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// fetchTask is one gap fetch waiting for or running on a worker
+type fetchTask struct {
+	jobID    string
+	symbol   string
+	priority int // rank of the job's priority when the task was queued
+	queued   time.Time
+	run      func() (int64, error)
+	done     chan fetchResult
+}
+
+// fetchResult is the outcome of a fetch task
+type fetchResult struct {
+	rows int64
+	err  error
+}
+
+// fetchQueue runs gap fetches on a fixed pool of workers. Higher priority
+// tasks start first and tasks of equal priority in FIFO order, except that a
+// task waits while another task for the same symbol is running, so no two
+// fetches write one symbol at once. A waiting task gains a priority level
+// for every aging interval it has waited, so low priority work can't starve.
+type fetchQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*fetchTask
+	active  map[string]bool // symbols with a running task
+	aging   time.Duration   // wait that raises a task one priority level; 0 disables aging
+	closed  bool
+}
+
+// newFetchQueue starts workers that run queued tasks until close is called
+func newFetchQueue(workers int, aging time.Duration) *fetchQueue {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	q := &fetchQueue{active: make(map[string]bool), aging: aging}
+	q.cond = sync.NewCond(&q.mu)
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	return q
+}
+
+// run queues fn at the given priority rank and waits for its result. If ctx
+// is cancelled while the task is still queued it is withdrawn and ctx's
+// error returned; a task that has started always runs to completion.
+func (q *fetchQueue) run(ctx context.Context, jobID, symbol string, priority int, fn func() (int64, error)) (int64, error) {
+	task := &fetchTask{
+		jobID:    jobID,
+		symbol:   symbol,
+		priority: priority,
+		queued:   time.Now(),
+		run:      fn,
+		done:     make(chan fetchResult, 1),
+	}
+
+	q.mu.Lock()
+	q.pending = append(q.pending, task)
+	q.cond.Signal()
+	q.mu.Unlock()
+
+	select {
+	case result := <-task.done:
+		return result.rows, result.err
+	case <-ctx.Done():
+		if q.withdraw(task) {
+			return 0, ctx.Err()
+		}
+		result := <-task.done
+		return result.rows, result.err
+	}
+}
+
+// withdraw removes a task that hasn't started, reporting whether it was found
+func (q *fetchQueue) withdraw(task *fetchTask) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.removePending(task)
+}
+
+// removePending drops a task from the pending list, reporting whether it was
+// there. Must be called with q.mu held.
+func (q *fetchQueue) removePending(task *fetchTask) bool {
+	for i, pending := range q.pending {
+		if pending == task {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// effectivePriority is a task's priority rank raised by its aging
+func (q *fetchQueue) effectivePriority(task *fetchTask, now time.Time) int {
+	if q.aging <= 0 {
+		return task.priority
+	}
+	return task.priority + int(now.Sub(task.queued)/q.aging)
+}
+
+// ordered returns the pending tasks in the order they would start, ignoring
+// symbol conflicts. Must be called with q.mu held.
+func (q *fetchQueue) ordered() []*fetchTask {
+	now := time.Now()
+	tasks := append([]*fetchTask(nil), q.pending...)
+	sort.SliceStable(tasks, func(i, k int) bool {
+		return q.effectivePriority(tasks[i], now) > q.effectivePriority(tasks[k], now)
+	})
+	return tasks
+}
+
+// position returns the 1-based queue position of a job's waiting task, or 0
+// if the job has nothing queued
+func (q *fetchQueue) position(jobID string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, task := range q.ordered() {
+		if task.jobID == jobID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// reprioritize changes the priority rank of a job's waiting tasks
+func (q *fetchQueue) reprioritize(jobID string, priority int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, task := range q.pending {
+		if task.jobID == jobID {
+			task.priority = priority
+		}
+	}
+	q.cond.Broadcast()
+}
+
+// close stops the workers once their current tasks finish. Tasks still
+// queued are left for their callers to withdraw on cancellation.
+func (q *fetchQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// next blocks until a runnable task is available and claims its symbol.
+// Returns nil once the queue is closed.
+func (q *fetchQueue) next() *fetchTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.closed {
+			return nil
+		}
+		for _, task := range q.ordered() {
+			if q.active[task.symbol] {
+				continue
+			}
+			q.removePending(task)
+			q.active[task.symbol] = true
+			return task
+		}
+		q.cond.Wait()
+	}
+}
+
+// worker runs tasks until the queue is closed
+func (q *fetchQueue) worker() {
+	for {
+		task := q.next()
+		if task == nil {
+			return
+		}
+
+		rows, err := task.run()
+		task.done <- fetchResult{rows: rows, err: err}
+
+		q.mu.Lock()
+		delete(q.active, task.symbol)
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/providers"
+	"github.com/sptrader/sptrader/internal/providers/dukascopy"
+)
+
+// gapRetrying marks a gap waiting out its backoff before another attempt
+const gapRetrying = "retrying"
+
+// retryPolicy bounds how often and how patiently a failed gap is retried
+type retryPolicy struct {
+	attempts int
+	base     time.Duration
+	max      time.Duration
+}
+
+// backoff returns the wait before the given retry (1 for the first),
+// doubling from base up to max and jittered over its upper half so gaps that
+// failed together don't retry together
+func (p retryPolicy) backoff(retry int) time.Duration {
+	wait := p.max
+	if retry < 32 {
+		if d := p.base << (retry - 1); d > 0 && d < p.max {
+			wait = d
+		}
+	}
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryable reports whether a failed gap fetch is worth another attempt.
+// Cancellation and client errors other than rate limiting won't get better
+// by waiting.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, errAlreadyFilled) || errors.Is(err, ErrNoProvider) {
+		return false
+	}
+	if errors.Is(err, providers.ErrThrottled) {
+		return true
+	}
+	var fetchErr *dukascopy.FetchError
+	if errors.As(err, &fetchErr) && fetchErr.StatusCode >= 400 && fetchErr.StatusCode < 500 {
+		return fetchErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// fetchGap fetches one gap of a job, retrying failures with backoff. Each
+// attempt queues separately so a gap waiting to retry doesn't hold a worker,
+// and resumes after the last hour the previous attempt wrote.
+func (dm *DataManager) fetchGap(ctx context.Context, job *FetchJob, i int) error {
+	gap := job.Gaps[i].Gap
+	resumeAt := gap.Start
+
+	for attempt := 1; ; attempt++ {
+		var reported int64
+		dm.jobsMu.Lock()
+		priority := job.Priority.rank()
+		dm.jobsMu.Unlock()
+
+		rows, err := dm.queue.run(ctx, job.ID, job.Symbol, priority, func() (int64, error) {
+			dm.updateJob(job, func(j *FetchJob) {
+				j.Gaps[i].State = string(JobRunning)
+				j.Gaps[i].Attempts++
+				j.Gaps[i].ThrottledUntil = nil
+				j.Progress.ThrottledUntil = nil
+			})
+			ticks, rebuilds, err := dm.fetchRange(ctx, job.Symbol, resumeAt, gap.End, func(result providers.HourResult) {
+				now := time.Now()
+				reported += int64(result.Ticks)
+				resumeAt = result.Hour.Add(time.Hour)
+				dm.updateJob(job, func(j *FetchJob) {
+					j.Gaps[i].Rows += int64(result.Ticks)
+					if result.Provider != "" {
+						if j.Gaps[i].Providers == nil {
+							j.Gaps[i].Providers = make(map[string]int64)
+						}
+						j.Gaps[i].Providers[result.Provider] += int64(result.Ticks)
+					}
+					j.Rows += int64(result.Ticks)
+					j.Progress.recordHour(result.Hour, now)
+				})
+			})
+			dm.updateJob(job, func(j *FetchJob) {
+				j.OHLC = append(j.OHLC, rebuilds...)
+			})
+			return ticks, err
+		})
+
+		retry := err != nil && retryable(err) && attempt < dm.retry.attempts
+		var throttled *providers.ThrottledError
+		isThrottled := errors.As(err, &throttled)
+		var wait time.Duration
+		if retry {
+			wait = dm.retry.backoff(attempt)
+			// Retrying before the cool-down ends would only hold a worker
+			if isThrottled {
+				if cooldown := time.Until(throttled.Until); cooldown > wait {
+					wait = cooldown
+				}
+			}
+		}
+
+		dm.updateJob(job, func(j *FetchJob) {
+			// Hours reported during the fetch are already counted
+			j.Gaps[i].Rows += rows - reported
+			j.Rows += rows - reported
+			switch {
+			case errors.Is(err, errAlreadyFilled) && attempt == 1:
+				j.Gaps[i].State = gapSkipped
+			case errors.Is(err, errAlreadyFilled):
+				// An earlier attempt wrote the rest of the gap
+				j.Gaps[i].State = string(JobSucceeded)
+				j.Gaps[i].Error = ""
+			case errors.Is(err, context.Canceled):
+				j.Gaps[i].State = string(JobCancelled)
+			case isThrottled:
+				// Left throttled rather than failed even once attempts run out
+				until := throttled.Until
+				j.Gaps[i].State = gapThrottled
+				j.Gaps[i].Error = err.Error()
+				j.Gaps[i].ThrottledUntil = &until
+				j.Throttles++
+				if retry {
+					j.Progress.ThrottledUntil = &until
+				}
+			case retry:
+				j.Gaps[i].State = gapRetrying
+				j.Gaps[i].Error = err.Error()
+			case err != nil:
+				j.Gaps[i].State = string(JobFailed)
+				j.Gaps[i].Error = err.Error()
+			default:
+				j.Gaps[i].State = string(JobSucceeded)
+				j.Gaps[i].Error = ""
+				if dm.useScript {
+					j.Progress.completeHours(hourFiles(gap), gap.End)
+				}
+			}
+		})
+		dm.persistJobs()
+
+		if !retry {
+			if errors.Is(err, errAlreadyFilled) {
+				return nil
+			}
+			return err
+		}
+
+		log.Warn().
+			Err(err).
+			Str("job", job.ID).
+			Str("symbol", job.Symbol).
+			Time("gap_start", gap.Start).
+			Time("gap_end", gap.End).
+			Int("attempt", attempt).
+			Int("attempts", dm.retry.attempts).
+			Dur("retry_in", wait.Round(time.Millisecond)).
+			Msg("Gap fetch failed, retrying")
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			dm.updateJob(job, func(j *FetchJob) {
+				j.Gaps[i].State = string(JobCancelled)
+			})
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// gapKey identifies a gap across jobs
+func gapKey(symbol string, gap Gap) string {
+	return fmt.Sprintf("%s %s/%s", symbol, gap.Start.Format(time.RFC3339), gap.End.Format(time.RFC3339))
+}
+
+// recordGapOutcome tracks gaps that keep failing after retries. A gap that
+// fails in more than one job likely points at a hole on the provider's side
+// rather than a transient error, so it gets its own warning.
+func (dm *DataManager) recordGapOutcome(symbol string, gap Gap, err error) {
+	key := gapKey(symbol, gap)
+
+	dm.jobsMu.Lock()
+	if err == nil {
+		delete(dm.gapFailures, key)
+		dm.jobsMu.Unlock()
+		return
+	}
+	dm.gapFailures[key]++
+	failures := dm.gapFailures[key]
+	dm.jobsMu.Unlock()
+
+	if failures > 1 {
+		log.Warn().
+			Err(err).
+			Str("symbol", symbol).
+			Time("gap_start", gap.Start).
+			Time("gap_end", gap.End).
+			Int("failed_jobs", failures).
+			Msg("Repeated gap failure after retries, provider data may be missing")
+	}
+}
+
+// RepeatedGapFailures returns gaps that have failed in more than one job,
+// keyed by symbol and range, with their failure counts
+func (dm *DataManager) RepeatedGapFailures() map[string]int {
+	dm.jobsMu.Lock()
+	defer dm.jobsMu.Unlock()
+
+	repeated := make(map[string]int)
+	for key, failures := range dm.gapFailures {
+		if failures > 1 {
+			repeated[key] = failures
+		}
+	}
+	return repeated
+}
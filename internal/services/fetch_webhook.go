@@ -0,0 +1,211 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Webhook request headers. The signature is the hex HMAC-SHA256, keyed with
+// the shared secret, of the timestamp, a dot, and the body, so receivers can
+// reject both forged and replayed deliveries.
+const (
+	WebhookSignatureHeader = "X-SPTrader-Signature"
+	WebhookTimestampHeader = "X-SPTrader-Timestamp"
+)
+
+// ErrWebhooksDisabled is returned when a callback URL is given but outbound
+// webhooks are switched off or have no signing secret
+var ErrWebhooksDisabled = errors.New("job webhooks are disabled")
+
+// ErrInvalidCallbackURL is returned for callback URLs that aren't absolute
+// http(s) URLs
+var ErrInvalidCallbackURL = errors.New("callback_url must be an absolute http or https URL")
+
+// WebhookDelivery records one attempt to deliver a job's completion webhook
+type WebhookDelivery struct {
+	Attempt    int       `json:"attempt"`
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// JobWebhook is the payload POSTed to a job's callback URL when it finishes
+type JobWebhook struct {
+	JobID        string    `json:"job_id"`
+	Symbol       string    `json:"symbol"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	State        JobState  `json:"state"`
+	Outcome      string    `json:"outcome"` // success, partial, failure or cancelled
+	TicksAdded   int64     `json:"ticks_added"`
+	ResidualGaps []Gap     `json:"residual_gaps"`
+	Error        string    `json:"error,omitempty"`
+	FinishedAt   time.Time `json:"finished_at"`
+}
+
+// webhookSender delivers job webhooks; a nil sender means webhooks are off
+type webhookSender struct {
+	client *http.Client
+	secret []byte
+	retry  retryPolicy
+}
+
+// validateCallbackURL checks a callback URL before a job is created
+func (dm *DataManager) validateCallbackURL(callbackURL string) error {
+	if callbackURL == "" {
+		return nil
+	}
+	if dm.webhooks == nil {
+		return ErrWebhooksDisabled
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidCallbackURL
+	}
+	return nil
+}
+
+// webhookPayload builds the completion payload for a finished job
+func webhookPayload(job FetchJob) JobWebhook {
+	payload := JobWebhook{
+		JobID:        job.ID,
+		Symbol:       job.Symbol,
+		Start:        job.Start,
+		End:          job.End,
+		State:        job.State,
+		TicksAdded:   job.Rows,
+		ResidualGaps: job.Residual,
+		Error:        job.Error,
+	}
+	if payload.ResidualGaps == nil {
+		payload.ResidualGaps = []Gap{}
+	}
+	if job.FinishedAt != nil {
+		payload.FinishedAt = *job.FinishedAt
+	}
+
+	switch job.State {
+	case JobSucceeded:
+		payload.Outcome = "success"
+	case JobCancelled:
+		payload.Outcome = "cancelled"
+	default:
+		payload.Outcome = "failure"
+		for _, gap := range job.Gaps {
+			if gap.gapDone() {
+				payload.Outcome = "partial"
+				break
+			}
+		}
+	}
+	return payload
+}
+
+// notifyJob delivers a finished job's webhook in the background, if it has
+// a callback URL
+func (dm *DataManager) notifyJob(job *FetchJob) {
+	dm.jobsMu.Lock()
+	snapshot := job.snapshot()
+	dm.jobsMu.Unlock()
+
+	if snapshot.CallbackURL == "" || dm.webhooks == nil {
+		return
+	}
+	go dm.deliverWebhook(job, webhookPayload(snapshot), snapshot.CallbackURL)
+}
+
+// deliverWebhook POSTs the payload, retrying failures with backoff, and
+// records every attempt on the job
+func (dm *DataManager) deliverWebhook(job *FetchJob, payload JobWebhook, callbackURL string) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Error().Err(err).Str("job", job.ID).Msg("Failed to encode fetch job webhook")
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		statusCode, err := dm.webhooks.post(dm.rootCtx, callbackURL, body)
+
+		delivery := WebhookDelivery{Attempt: attempt, At: time.Now().UTC(), StatusCode: statusCode}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		dm.updateJob(job, func(j *FetchJob) {
+			j.Deliveries = append(j.Deliveries, delivery)
+		})
+		dm.persistJobs()
+
+		if err == nil {
+			log.Info().Str("job", job.ID).Str("url", callbackURL).Msg("Fetch job webhook delivered")
+			return
+		}
+		if attempt >= dm.webhooks.retry.attempts || dm.rootCtx.Err() != nil {
+			log.Error().
+				Err(err).
+				Str("job", job.ID).
+				Str("url", callbackURL).
+				Int("attempts", attempt).
+				Msg("Giving up on fetch job webhook")
+			return
+		}
+
+		wait := dm.webhooks.retry.backoff(attempt)
+		log.Warn().
+			Err(err).
+			Str("job", job.ID).
+			Str("url", callbackURL).
+			Int("attempt", attempt).
+			Int("attempts", dm.webhooks.retry.attempts).
+			Dur("retry_in", wait.Round(time.Millisecond)).
+			Msg("Fetch job webhook failed, retrying")
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-dm.rootCtx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// post sends one signed delivery. Any 2xx response counts as delivered.
+func (s *webhookSender) post(ctx context.Context, callbackURL string, body []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
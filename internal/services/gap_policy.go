@@ -0,0 +1,52 @@
+package services
+
+import "time"
+
+// GapPolicy decides which missing gaps are worth fetching. Single missing
+// hours are usually thin liquidity around the daily rollover rather than
+// lost data, and several small holes close together are cheaper to fetch as
+// one span.
+type GapPolicy struct {
+	MinGapHours float64 `json:"min_gap_hours"` // smaller gaps are left unless they end the range
+	BridgeHours float64 `json:"bridge_hours"`  // gaps closer together than this are merged
+
+	minGap time.Duration
+	bridge time.Duration
+}
+
+// newGapPolicy creates a gap policy; zero durations disable either rule
+func newGapPolicy(minGap, bridge time.Duration) GapPolicy {
+	return GapPolicy{
+		MinGapHours: minGap.Hours(),
+		BridgeHours: bridge.Hours(),
+		minGap:      minGap,
+		bridge:      bridge,
+	}
+}
+
+// apply merges missing gaps separated by less than the bridge, then marks
+// the missing gaps still shorter than the minimum as below_threshold. A
+// merge never crosses a market closure, and a gap reaching end is always
+// kept since it is usually the most recent data a client is waiting for.
+func (p GapPolicy) apply(gaps []Gap, end time.Time) []Gap {
+	merged := make([]Gap, 0, len(gaps))
+	for _, gap := range gaps {
+		if gap.Type == GapMissing && len(merged) > 0 {
+			prev := &merged[len(merged)-1]
+			if prev.Type == GapMissing && gap.Start.Sub(prev.End) < p.bridge {
+				prev.End = gap.End
+				prev.Hours = int(prev.End.Sub(prev.Start).Hours())
+				continue
+			}
+		}
+		merged = append(merged, gap)
+	}
+
+	for i := range merged {
+		gap := &merged[i]
+		if gap.Type == GapMissing && gap.End.Sub(gap.Start) < p.minGap && gap.End.Before(end) {
+			gap.Type = GapIgnored
+		}
+	}
+	return merged
+}
@@ -0,0 +1,522 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/db"
+)
+
+// auditMaxRange caps the range one integrity audit covers
+const auditMaxRange = 92 * 24 * time.Hour
+
+// auditChunk is about how much of the range each step of an audit compares,
+// so it reports progress and notices cancellation between steps
+const auditChunk = 7 * 24 * time.Hour
+
+// maxAuditFindings caps the findings an audit keeps; any more are counted
+// but dropped
+const maxAuditFindings = 10000
+
+// DefaultAuditTolerance is the difference allowed between a stored and a
+// recomputed value when the request doesn't say
+const DefaultAuditTolerance = 1e-9
+
+// Tick sources an OHLC table may have been built from
+const (
+	AuditSourceBid = "bid" // bid over every tick, as the refresher and rebuilds write tables
+	AuditSourceMid = "mid" // price over ticks with volume, as the Python importers write them
+)
+
+// Audit finding kinds
+const (
+	AuditMissing  = "missing"  // the ticks make a bar the table doesn't have
+	AuditExtra    = "extra"    // the table has a bar no ticks make
+	AuditMismatch = "mismatch" // both have the bar, with values further apart than the tolerance
+)
+
+// Audit verdicts
+const (
+	AuditClean      = "clean"
+	AuditDivergent  = "divergent"
+	AuditIncomplete = "incomplete" // failed or cancelled before every bar was compared
+)
+
+// Errors for audit requests
+var (
+	ErrInvalidAudit  = errors.New("invalid audit")
+	ErrAuditNotFound = errors.New("audit job not found")
+	ErrAuditFinished = errors.New("audit job already finished")
+)
+
+// AuditRequest asks for an OHLC table to be checked against the ticks
+// beneath it
+type AuditRequest struct {
+	Symbol      string
+	Timeframe   string // one of the OHLC tables' timeframes
+	Start       time.Time
+	End         time.Time
+	Tolerance   float64 // 0 means DefaultAuditTolerance
+	Source      string  // AuditSourceBid or AuditSourceMid; empty to detect it from the table
+	RequestedBy string
+}
+
+// AuditBar is the part of a bar an audit compares
+type AuditBar struct {
+	Open      float64 `json:"open"`
+	High      float64 `json:"high"`
+	Low       float64 `json:"low"`
+	Close     float64 `json:"close"`
+	Volume    float64 `json:"volume"`
+	TickCount int64   `json:"tick_count"`
+}
+
+// AuditFinding is one bar where the table and the ticks disagree
+type AuditFinding struct {
+	Timestamp time.Time `json:"timestamp"`
+	Kind      string    `json:"kind"`
+	Fields    []string  `json:"fields,omitempty"`   // the values that differ, for mismatches
+	Expected  *AuditBar `json:"expected,omitempty"` // recomputed from the ticks
+	Stored    *AuditBar `json:"stored,omitempty"`
+}
+
+// AuditSummary counts an audit's bars and findings
+type AuditSummary struct {
+	ExpectedBars int    `json:"expected_bars"`
+	StoredBars   int    `json:"stored_bars"`
+	Matched      int    `json:"matched"`
+	Missing      int    `json:"missing"`
+	Extra        int    `json:"extra"`
+	Mismatched   int    `json:"mismatched"`
+	Truncated    bool   `json:"findings_truncated,omitempty"` // only the first maxAuditFindings were kept
+	Verdict      string `json:"verdict,omitempty"`            // set when the audit finishes
+}
+
+// AuditProgress reports how far through its range an audit is
+type AuditProgress struct {
+	ChunksTotal int       `json:"chunks_total"`
+	ChunksDone  int       `json:"chunks_done"`
+	Percent     float64   `json:"percent"`
+	Through     time.Time `json:"through,omitempty"` // bars before this have been compared
+}
+
+// AuditJob compares one OHLC table with bars recomputed from the ticks over
+// a range, in the background
+type AuditJob struct {
+	ID          string        `json:"id"`
+	Symbol      string        `json:"symbol"`
+	Timeframe   string        `json:"timeframe"`
+	Table       string        `json:"table"`
+	Start       time.Time     `json:"start"` // aligned to whole bars
+	End         time.Time     `json:"end"`
+	Tolerance   float64       `json:"tolerance"`
+	Source      string        `json:"source,omitempty"` // the ticks' source column, once given or detected
+	State       JobState      `json:"state"`
+	Progress    AuditProgress `json:"progress"`
+	Summary     AuditSummary  `json:"summary"`
+	Error       string        `json:"error,omitempty"`
+	RequestedBy string        `json:"requested_by,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	StartedAt   *time.Time    `json:"started_at,omitempty"`
+	FinishedAt  *time.Time    `json:"finished_at,omitempty"`
+
+	findings []AuditFinding
+	cancel   context.CancelFunc
+}
+
+// auditRecord is the audit log line written when an audit finishes
+type auditRecord struct {
+	Event    string         `json:"event"` // always "integrity_audit"
+	Job      AuditJob       `json:"job"`
+	Findings []AuditFinding `json:"findings"`
+}
+
+// done reports whether the audit has finished
+func (j *AuditJob) done() bool {
+	switch j.State {
+	case JobSucceeded, JobFailed, JobCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// StartAudit validates the request and starts an audit job. The range is
+// widened to whole bars of the timeframe.
+func (dm *DataManager) StartAudit(req AuditRequest) (AuditJob, error) {
+	table := ""
+	for _, tf := range ohlcTimeframes {
+		if tf == req.Timeframe {
+			table = fmt.Sprintf("ohlc_%s_v2", tf)
+		}
+	}
+	if table == "" {
+		return AuditJob{}, fmt.Errorf("%w: timeframe must be one of %v", ErrInvalidAudit, ohlcTimeframes)
+	}
+	if !req.End.After(req.Start) {
+		return AuditJob{}, fmt.Errorf("%w: end must be after start", ErrInvalidAudit)
+	}
+	if req.End.Sub(req.Start) > auditMaxRange {
+		return AuditJob{}, fmt.Errorf("%w: audits are limited to ranges of %s", ErrInvalidAudit, auditMaxRange)
+	}
+	if req.Tolerance < 0 {
+		return AuditJob{}, fmt.Errorf("%w: tolerance can't be negative", ErrInvalidAudit)
+	}
+	if req.Tolerance == 0 {
+		req.Tolerance = DefaultAuditTolerance
+	}
+	switch req.Source {
+	case "", AuditSourceBid, AuditSourceMid:
+	default:
+		return AuditJob{}, fmt.Errorf("%w: source must be %s, %s or empty to detect it", ErrInvalidAudit, AuditSourceBid, AuditSourceMid)
+	}
+
+	bucket, err := timeframeDuration(req.Timeframe)
+	if err != nil {
+		return AuditJob{}, err
+	}
+	job := &AuditJob{
+		ID:          newJobID(),
+		Symbol:      req.Symbol,
+		Timeframe:   req.Timeframe,
+		Table:       table,
+		Start:       req.Start.UTC().Truncate(bucket),
+		End:         req.End.UTC().Add(bucket - 1).Truncate(bucket),
+		Tolerance:   req.Tolerance,
+		Source:      req.Source,
+		State:       JobQueued,
+		RequestedBy: req.RequestedBy,
+		CreatedAt:   time.Now().UTC(),
+	}
+	ctx, cancel := dm.jobContext()
+	job.cancel = cancel
+
+	dm.jobsMu.Lock()
+	dm.audits[job.ID] = job
+	snapshot := job.snapshot()
+	dm.jobsMu.Unlock()
+
+	log.Info().
+		Str("audit", job.ID).
+		Str("symbol", job.Symbol).
+		Str("table", job.Table).
+		Time("start", job.Start).
+		Time("end", job.End).
+		Msg("Integrity audit started")
+	go dm.runAudit(ctx, job)
+	return snapshot, nil
+}
+
+// snapshot copies the audit, without its findings, so it can be returned
+// while the audit keeps running
+func (j *AuditJob) snapshot() AuditJob {
+	job := *j
+	job.findings = nil
+	job.cancel = nil
+	return job
+}
+
+// GetAudit returns an audit and a page of its findings, in time order, with
+// the number of findings kept
+func (dm *DataManager) GetAudit(id string, offset, limit int) (AuditJob, []AuditFinding, int, error) {
+	dm.jobsMu.Lock()
+	defer dm.jobsMu.Unlock()
+
+	dm.pruneJobs()
+	job, ok := dm.audits[id]
+	if !ok {
+		return AuditJob{}, nil, 0, ErrAuditNotFound
+	}
+	total := len(job.findings)
+	start, end := min(offset, total), min(offset+limit, total)
+	page := append([]AuditFinding{}, job.findings[start:end]...)
+	return job.snapshot(), page, total, nil
+}
+
+// ListAudits returns retained audits, newest first
+func (dm *DataManager) ListAudits() []AuditJob {
+	dm.jobsMu.Lock()
+	defer dm.jobsMu.Unlock()
+
+	dm.pruneJobs()
+	jobs := make([]AuditJob, 0, len(dm.audits))
+	for _, job := range dm.audits {
+		jobs = append(jobs, job.snapshot())
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].CreatedAt.After(jobs[k].CreatedAt)
+	})
+	return jobs
+}
+
+// CancelAudit stops a running audit after the chunk in progress; it is
+// marked cancelled with the findings so far
+func (dm *DataManager) CancelAudit(id string) (AuditJob, error) {
+	dm.jobsMu.Lock()
+	defer dm.jobsMu.Unlock()
+
+	job, ok := dm.audits[id]
+	if !ok {
+		return AuditJob{}, ErrAuditNotFound
+	}
+	if job.done() {
+		return job.snapshot(), ErrAuditFinished
+	}
+
+	log.Info().Str("audit", job.ID).Str("symbol", job.Symbol).Msg("Cancelling integrity audit")
+	job.cancel()
+	return job.snapshot(), nil
+}
+
+// runAudit compares the table with the ticks a chunk at a time, then
+// records the verdict and writes the findings to the audit log. Without a
+// source the first chunk holding stored bars settles it; chunks before
+// that are recomputed from bid.
+func (dm *DataManager) runAudit(ctx context.Context, job *AuditJob) {
+	defer job.cancel()
+
+	bucket, _ := timeframeDuration(job.Timeframe)
+	chunk := bucket * ((auditChunk + bucket - 1) / bucket)
+	started := time.Now().UTC()
+	dm.updateAudit(job, func(j *AuditJob) {
+		j.State = JobRunning
+		j.StartedAt = &started
+		j.Progress.ChunksTotal = int((j.End.Sub(j.Start) + chunk - 1) / chunk)
+	})
+
+	var failure error
+	for from := job.Start; from.Before(job.End); from = from.Add(chunk) {
+		if failure = ctx.Err(); failure != nil {
+			break
+		}
+		to := from.Add(chunk)
+		if to.After(job.End) {
+			to = job.End
+		}
+
+		stored, err := dm.auditBars(ctx, job, fmt.Sprintf(storedAuditQuery, job.Table), from, to)
+		if err != nil {
+			failure = fmt.Errorf("failed to read %s: %w", job.Table, err)
+			break
+		}
+		var expected map[time.Time]AuditBar
+		if job.Source == "" && len(stored) > 0 {
+			recomputed := make(map[string]map[time.Time]AuditBar, 2)
+			for _, source := range []string{AuditSourceBid, AuditSourceMid} {
+				if recomputed[source], err = dm.auditBars(ctx, job, tickAuditQuery(job.Timeframe, source), from, to); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				source := detectAuditSource(recomputed, stored, job.Tolerance)
+				dm.updateAudit(job, func(j *AuditJob) { j.Source = source })
+				expected = recomputed[source]
+			}
+		} else {
+			source := job.Source
+			if source == "" {
+				source = AuditSourceBid
+			}
+			expected, err = dm.auditBars(ctx, job, tickAuditQuery(job.Timeframe, source), from, to)
+		}
+		if err != nil {
+			failure = fmt.Errorf("failed to recompute bars from ticks: %w", err)
+			break
+		}
+
+		dm.updateAudit(job, func(j *AuditJob) {
+			j.compare(expected, stored)
+			j.Progress.ChunksDone++
+			j.Progress.Percent = float64(j.Progress.ChunksDone) / float64(j.Progress.ChunksTotal) * 100
+			j.Progress.Through = to
+		})
+	}
+
+	finished := time.Now().UTC()
+	var record auditRecord
+	dm.updateAudit(job, func(j *AuditJob) {
+		j.FinishedAt = &finished
+		switch {
+		case failure == nil:
+			j.State = JobSucceeded
+			j.Summary.Verdict = AuditClean
+			if j.Summary.Missing+j.Summary.Extra+j.Summary.Mismatched > 0 {
+				j.Summary.Verdict = AuditDivergent
+			}
+		case errors.Is(failure, context.Canceled):
+			j.State = JobCancelled
+			j.Summary.Verdict = AuditIncomplete
+			j.Error = fmt.Sprintf("cancelled after %d of %d chunks", j.Progress.ChunksDone, j.Progress.ChunksTotal)
+		default:
+			j.State = JobFailed
+			j.Summary.Verdict = AuditIncomplete
+			j.Error = failure.Error()
+		}
+		record = auditRecord{Event: "integrity_audit", Job: j.snapshot(), Findings: append([]AuditFinding{}, j.findings...)}
+	})
+
+	s := record.Job.Summary
+	log.Info().
+		Str("audit", job.ID).
+		Str("symbol", job.Symbol).
+		Str("table", job.Table).
+		Str("state", string(record.Job.State)).
+		Str("verdict", s.Verdict).
+		Int("expected_bars", s.ExpectedBars).
+		Int("stored_bars", s.StoredBars).
+		Int("missing", s.Missing).
+		Int("extra", s.Extra).
+		Int("mismatched", s.Mismatched).
+		Msg("Integrity audit finished")
+	if dm.auditLog == "" {
+		return
+	}
+	dm.auditLogMu.Lock()
+	defer dm.auditLogMu.Unlock()
+	if err := appendJSONLine(dm.auditLog, record); err != nil {
+		log.Error().Err(err).Str("audit", job.ID).Str("path", dm.auditLog).Msg("Failed to write integrity audit log")
+	}
+}
+
+// updateAudit applies fn to an audit under the jobs lock
+func (dm *DataManager) updateAudit(job *AuditJob, fn func(*AuditJob)) {
+	dm.jobsMu.Lock()
+	defer dm.jobsMu.Unlock()
+	fn(job)
+}
+
+// compare adds the findings and counts of one chunk's bars. Prices must be
+// within the tolerance, volume within it relative to the larger volume, and
+// tick counts equal.
+func (j *AuditJob) compare(expected, stored map[time.Time]AuditBar) {
+	j.Summary.ExpectedBars += len(expected)
+	j.Summary.StoredBars += len(stored)
+
+	var findings []AuditFinding
+	for ts, want := range expected {
+		have, ok := stored[ts]
+		if !ok {
+			j.Summary.Missing++
+			findings = append(findings, AuditFinding{Timestamp: ts, Kind: AuditMissing, Expected: &want})
+			continue
+		}
+
+		var fields []string
+		for _, f := range []struct {
+			name       string
+			want, have float64
+		}{
+			{"open", want.Open, have.Open},
+			{"high", want.High, have.High},
+			{"low", want.Low, have.Low},
+			{"close", want.Close, have.Close},
+		} {
+			if math.Abs(f.want-f.have) > j.Tolerance {
+				fields = append(fields, f.name)
+			}
+		}
+		if math.Abs(want.Volume-have.Volume) > j.Tolerance*max(1, math.Abs(want.Volume), math.Abs(have.Volume)) {
+			fields = append(fields, "volume")
+		}
+		if want.TickCount != have.TickCount {
+			fields = append(fields, "tick_count")
+		}
+		if len(fields) == 0 {
+			j.Summary.Matched++
+			continue
+		}
+		j.Summary.Mismatched++
+		findings = append(findings, AuditFinding{Timestamp: ts, Kind: AuditMismatch, Fields: fields, Expected: &want, Stored: &have})
+	}
+	for ts, have := range stored {
+		if _, ok := expected[ts]; !ok {
+			j.Summary.Extra++
+			findings = append(findings, AuditFinding{Timestamp: ts, Kind: AuditExtra, Stored: &have})
+		}
+	}
+
+	sort.Slice(findings, func(a, b int) bool {
+		return findings[a].Timestamp.Before(findings[b].Timestamp)
+	})
+	if room := maxAuditFindings - len(j.findings); len(findings) > room {
+		findings = findings[:room]
+		j.Summary.Truncated = true
+	}
+	j.findings = append(j.findings, findings...)
+}
+
+// tickAuditQuery recomputes a timeframe's bars from the ticks the way a
+// table built from source is
+func tickAuditQuery(timeframe, source string) string {
+	column, filter := "bid", ""
+	if source == AuditSourceMid {
+		column, filter = "price", "\n\t\t\tAND volume > 0"
+	}
+	return fmt.Sprintf(`
+		SELECT
+			timestamp,
+			first(%[1]s) as open,
+			max(%[1]s) as high,
+			min(%[1]s) as low,
+			last(%[1]s) as close,
+			sum(volume) as volume,
+			count() as tick_count
+		FROM %[2]s
+		WHERE symbol = $1
+			AND timestamp >= $2
+			AND timestamp < $3%[3]s
+		SAMPLE BY %[4]s ALIGN TO CALENDAR
+	`, column, tickTable, filter, timeframe)
+}
+
+// detectAuditSource returns the source whose recomputed bars disagree with
+// the stored ones least, bid on a tie
+func detectAuditSource(recomputed map[string]map[time.Time]AuditBar, stored map[time.Time]AuditBar, tolerance float64) string {
+	best, fewest := AuditSourceBid, -1
+	for _, source := range []string{AuditSourceBid, AuditSourceMid} {
+		probe := AuditJob{Tolerance: tolerance}
+		probe.compare(recomputed[source], stored)
+		s := probe.Summary
+		if n := s.Missing + s.Extra + s.Mismatched; fewest < 0 || n < fewest {
+			best, fewest = source, n
+		}
+	}
+	return best
+}
+
+// storedAuditQuery reads an OHLC table's bars
+const storedAuditQuery = `
+	SELECT timestamp, open, high, low, close, volume, tick_count
+	FROM %s
+	WHERE symbol = $1
+		AND timestamp >= $2
+		AND timestamp < $3
+`
+
+// auditBars runs one of the audit queries over [from, to), keyed by bar
+// timestamp. A duplicated stored bar counts once, as its last row.
+func (dm *DataManager) auditBars(ctx context.Context, job *AuditJob, query string, from, to time.Time) (map[time.Time]AuditBar, error) {
+	ctx = db.WithQueryLabel(ctx, db.QueryIntegrity, job.Table)
+
+	rows, err := dm.pool.QueryWithTimeout(ctx, dm.pool.ScanTimeout(), query, job.Symbol, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bars := make(map[time.Time]AuditBar)
+	for rows.Next() {
+		var ts time.Time
+		var bar AuditBar
+		if err := rows.Scan(&ts, &bar.Open, &bar.High, &bar.Low, &bar.Close, &bar.Volume, &bar.TickCount); err != nil {
+			return nil, err
+		}
+		bars[ts.UTC()] = bar
+	}
+	return bars, rows.Err()
+}
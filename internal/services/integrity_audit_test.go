@@ -0,0 +1,112 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type auditTick struct {
+	at       time.Time
+	bid, ask float64
+	volume   float64
+}
+
+var auditT0 = time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+
+// auditTicks span three minutes; the last holds only a tick without volume
+var auditTicks = []auditTick{
+	{auditT0.Add(5 * time.Second), 1.1000, 1.1002, 1},
+	{auditT0.Add(20 * time.Second), 1.1004, 1.1006, 2},
+	{auditT0.Add(40 * time.Second), 1.0998, 1.1000, 0},
+	{auditT0.Add(70 * time.Second), 1.1010, 1.1012, 1},
+	{auditT0.Add(110 * time.Second), 1.1008, 1.1010, 3},
+	{auditT0.Add(150 * time.Second), 1.1001, 1.1003, 0},
+}
+
+// auditFixtureBars aggregates ticks into 1m bars as tickAuditQuery does for source
+func auditFixtureBars(ticks []auditTick, source string) map[time.Time]AuditBar {
+	bars := make(map[time.Time]AuditBar)
+	for _, tick := range ticks {
+		price := tick.bid
+		if source == AuditSourceMid {
+			if tick.volume <= 0 {
+				continue
+			}
+			price = (tick.bid + tick.ask) / 2
+		}
+		ts := tick.at.Truncate(time.Minute)
+		bar, ok := bars[ts]
+		if !ok {
+			bar = AuditBar{Open: price, High: price, Low: price}
+		}
+		bar.High = max(bar.High, price)
+		bar.Low = min(bar.Low, price)
+		bar.Close = price
+		bar.Volume += tick.volume
+		bar.TickCount++
+		bars[ts] = bar
+	}
+	return bars
+}
+
+func TestDetectAuditSource(t *testing.T) {
+	recomputed := map[string]map[time.Time]AuditBar{
+		AuditSourceBid: auditFixtureBars(auditTicks, AuditSourceBid),
+		AuditSourceMid: auditFixtureBars(auditTicks, AuditSourceMid),
+	}
+	for _, source := range []string{AuditSourceBid, AuditSourceMid} {
+		stored := auditFixtureBars(auditTicks, source)
+		if got := detectAuditSource(recomputed, stored, DefaultAuditTolerance); got != source {
+			t.Errorf("table built from %s detected as %s", source, got)
+		}
+	}
+}
+
+func TestAuditCompareMidBuiltTable(t *testing.T) {
+	stored := auditFixtureBars(auditTicks, AuditSourceMid)
+
+	job := AuditJob{Tolerance: DefaultAuditTolerance}
+	job.compare(auditFixtureBars(auditTicks, AuditSourceMid), stored)
+	if s := job.Summary; s.Matched != 2 || s.Missing+s.Extra+s.Mismatched != 0 {
+		t.Errorf("mid recomputation against a mid-built table: %+v, want 2 matched and no findings", s)
+	}
+
+	// Auditing from bid flags every bar, and the volume-less minute as missing
+	job = AuditJob{Tolerance: DefaultAuditTolerance}
+	job.compare(auditFixtureBars(auditTicks, AuditSourceBid), stored)
+	if s := job.Summary; s.Mismatched != 2 || s.Missing != 1 || s.Matched != 0 {
+		t.Errorf("bid recomputation against a mid-built table: %+v, want 2 mismatched and 1 missing", s)
+	}
+}
+
+func TestAuditCompareFindings(t *testing.T) {
+	expected := auditFixtureBars(auditTicks, AuditSourceBid)
+	stored := auditFixtureBars(auditTicks, AuditSourceBid)
+
+	first, second, third := auditT0, auditT0.Add(time.Minute), auditT0.Add(2*time.Minute)
+	bar := stored[second]
+	bar.Close += 0.0005
+	stored[second] = bar
+	delete(stored, third)
+	stray := auditT0.Add(5 * time.Minute)
+	stored[stray] = AuditBar{Open: 1, High: 1, Low: 1, Close: 1, Volume: 1, TickCount: 1}
+
+	job := AuditJob{Tolerance: DefaultAuditTolerance}
+	job.compare(expected, stored)
+
+	want := AuditSummary{ExpectedBars: 3, StoredBars: 3, Matched: 1, Missing: 1, Extra: 1, Mismatched: 1}
+	if job.Summary != want {
+		t.Errorf("summary = %+v, want %+v", job.Summary, want)
+	}
+	var got []string
+	for _, f := range job.findings {
+		got = append(got, f.Timestamp.Sub(first).String()+" "+f.Kind)
+	}
+	if wantFindings := []string{"1m0s mismatch", "2m0s missing", "5m0s extra"}; !reflect.DeepEqual(got, wantFindings) {
+		t.Errorf("findings = %v, want %v", got, wantFindings)
+	}
+	if fields := job.findings[0].Fields; !reflect.DeepEqual(fields, []string{"close"}) {
+		t.Errorf("mismatched fields = %v, want [close]", fields)
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/db"
+)
+
+// baseTimeframe is built from ticks; every coarser timeframe is built from it
+const baseTimeframe = "1m"
+
+// OHLCRebuild records the regeneration of one OHLC table over a window
+type OHLCRebuild struct {
+	Table      string    `json:"table"`
+	Symbol     string    `json:"symbol"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Bars       int64     `json:"bars"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// rebuildOHLC regenerates every OHLC table for symbol over [from, to),
+// padded by one bucket of the table's timeframe on each side so the bars
+// straddling the edges are rebuilt whole. The 1m table is built from ticks
+// first and the coarser tables from it, so a failure there stops the rest.
+// Like the refresher, this relies on the tables' DEDUP UPSERT KEYS.
+func rebuildOHLC(ctx context.Context, pool *db.Pool, symbol string, from, to time.Time) []OHLCRebuild {
+	rebuilds := make([]OHLCRebuild, 0, len(ohlcTimeframes))
+	for _, timeframe := range ohlcTimeframes {
+		rebuild := rebuildOHLCTable(ctx, pool, timeframe, symbol, from, to)
+		rebuilds = append(rebuilds, rebuild)
+		if rebuild.Error != "" && timeframe == baseTimeframe {
+			break
+		}
+	}
+	return rebuilds
+}
+
+// rebuildOHLCTable regenerates one timeframe's table over the padded window
+func rebuildOHLCTable(ctx context.Context, pool *db.Pool, timeframe, symbol string, from, to time.Time) OHLCRebuild {
+	started := time.Now()
+	table := fmt.Sprintf("ohlc_%s_v2", timeframe)
+	rebuild := OHLCRebuild{Table: table, Symbol: symbol}
+
+	bucket, err := timeframeDuration(timeframe)
+	if err != nil {
+		rebuild.Error = err.Error()
+		return rebuild
+	}
+	rebuild.From = from.UTC().Truncate(bucket).Add(-bucket)
+	rebuild.To = to.UTC().Add(bucket - 1).Truncate(bucket).Add(bucket)
+
+	var query string
+	if timeframe == baseTimeframe {
+		query = fmt.Sprintf(`
+			INSERT INTO %s (timestamp, symbol, open, high, low, close, volume, tick_count, vwap)
+			SELECT
+				timestamp,
+				symbol,
+				first(bid) as open,
+				max(bid) as high,
+				min(bid) as low,
+				last(bid) as close,
+				sum(volume) as volume,
+				count() as tick_count,
+				sum(price * volume) / sum(volume) as vwap
+			FROM %s
+			WHERE symbol = $1
+				AND timestamp >= $2
+				AND timestamp < $3
+			SAMPLE BY %s ALIGN TO CALENDAR
+		`, table, tickTable, timeframe)
+	} else {
+		query = fmt.Sprintf(`
+			INSERT INTO %s (timestamp, symbol, open, high, low, close, volume, tick_count, vwap)
+			SELECT
+				timestamp,
+				symbol,
+				first(open) as open,
+				max(high) as high,
+				min(low) as low,
+				last(close) as close,
+				sum(volume) as volume,
+				sum(tick_count) as tick_count,
+				sum(vwap * volume) / sum(volume) as vwap
+			FROM ohlc_%s_v2
+			WHERE symbol = $1
+				AND timestamp >= $2
+				AND timestamp < $3
+			SAMPLE BY %s ALIGN TO CALENDAR
+		`, table, baseTimeframe, timeframe)
+	}
+
+	tag, err := pool.Exec(ctx, query, symbol, rebuild.From, rebuild.To)
+	rebuild.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		rebuild.Error = fmt.Sprintf("failed to rebuild window: %v", err)
+		log.Error().Err(err).Str("table", table).Str("symbol", symbol).Msg("OHLC rebuild failed")
+		return rebuild
+	}
+	rebuild.Bars = tag.RowsAffected()
+
+	log.Debug().
+		Str("table", table).
+		Str("symbol", symbol).
+		Time("from", rebuild.From).
+		Time("to", rebuild.To).
+		Int64("bars", rebuild.Bars).
+		Msg("Rebuilt OHLC window")
+	return rebuild
+}
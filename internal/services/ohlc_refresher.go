@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/db"
+)
+
+// refreshTrailingBuckets is how many buckets behind the high-water mark get
+// regenerated on each pass, so ticks that arrive late are folded in
+const refreshTrailingBuckets = 2
+
+// refreshMaxBuckets caps the buckets one pass regenerates. A table that is
+// empty or far behind starts from its high-water mark or the first tick and
+// catches up over successive passes instead of in one unbounded INSERT.
+const refreshMaxBuckets = 1440
+
+// OHLCRefresher keeps the pre-aggregated OHLC tables in step with live ticks.
+// Rows are rewritten with INSERT ... SELECT, which relies on the ohlc_*_v2
+// tables having DEDUP UPSERT KEYS(timestamp, symbol) enabled.
+type OHLCRefresher struct {
+	pool    *db.Pool
+	config  config.OHLCRefreshConfig
+	mu      sync.RWMutex
+	status  OHLCRefreshStatus
+	trigger chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// OHLCRefreshStatus reports the scheduler state and the outcome of the last run
+type OHLCRefreshStatus struct {
+	Enabled    bool                `json:"enabled"`
+	Running    bool                `json:"running"`
+	Interval   string              `json:"interval"`
+	Symbols    []string            `json:"symbols"`
+	Timeframes []string            `json:"timeframes"`
+	Runs       int64               `json:"runs"`
+	LastRun    time.Time           `json:"last_run"`
+	LastError  string              `json:"last_error,omitempty"`
+	Tables     []TableRefreshState `json:"tables"`
+}
+
+// TableRefreshState is the last refresh result for one symbol in one OHLC table
+type TableRefreshState struct {
+	Table       string    `json:"table"`
+	Symbol      string    `json:"symbol"`
+	HighWater   time.Time `json:"high_water"`
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"` // before now while the table catches up
+	LastRun     time.Time `json:"last_run"`
+	DurationMs  int64     `json:"duration_ms"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// NewOHLCRefresher creates a new OHLC refresh scheduler
+func NewOHLCRefresher(pool *db.Pool, cfg config.OHLCRefreshConfig) *OHLCRefresher {
+	return &OHLCRefresher{
+		pool:    pool,
+		config:  cfg,
+		trigger: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		status: OHLCRefreshStatus{
+			Enabled:    cfg.Enabled,
+			Interval:   cfg.Interval.String(),
+			Symbols:    cfg.Symbols,
+			Timeframes: cfg.Timeframes,
+			Tables:     make([]TableRefreshState, 0),
+		},
+	}
+}
+
+// Start launches the background refresh loop
+func (r *OHLCRefresher) Start() {
+	if !r.config.Enabled {
+		log.Info().Msg("OHLC refresh scheduler disabled")
+		return
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+
+		log.Info().
+			Dur("interval", r.config.Interval).
+			Strs("symbols", r.config.Symbols).
+			Strs("timeframes", r.config.Timeframes).
+			Msg("OHLC refresh scheduler started")
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.runOnce()
+			case <-r.trigger:
+				r.runOnce()
+			}
+		}
+	}()
+}
+
+// Stop halts the refresh loop and waits for an in-flight run to finish
+func (r *OHLCRefresher) Stop() {
+	select {
+	case <-r.stop:
+		return
+	default:
+		close(r.stop)
+	}
+	r.wg.Wait()
+	log.Info().Msg("OHLC refresh scheduler stopped")
+}
+
+// Trigger requests an immediate refresh. It returns false if a run is already queued.
+func (r *OHLCRefresher) Trigger() bool {
+	select {
+	case r.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// GetStatus returns a snapshot of the scheduler state
+func (r *OHLCRefresher) GetStatus() OHLCRefreshStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	status := r.status
+	status.Tables = append([]TableRefreshState(nil), r.status.Tables...)
+	return status
+}
+
+// runOnce refreshes every configured symbol and timeframe
+func (r *OHLCRefresher) runOnce() {
+	r.mu.Lock()
+	r.status.Running = true
+	r.mu.Unlock()
+
+	// Bound a single pass so a stuck query can't stall the scheduler
+	ctx, cancel := context.WithTimeout(context.Background(), 2*r.config.Interval+time.Minute)
+	defer cancel()
+
+	tables := make([]TableRefreshState, 0, len(r.config.Symbols)*len(r.config.Timeframes))
+	var lastErr error
+
+	for _, tf := range r.config.Timeframes {
+		for _, symbol := range r.config.Symbols {
+			state := r.refreshTable(ctx, tf, symbol)
+			if state.Error != "" {
+				lastErr = fmt.Errorf("%s %s: %s", state.Table, symbol, state.Error)
+			}
+			tables = append(tables, state)
+		}
+	}
+
+	r.mu.Lock()
+	r.status.Running = false
+	r.status.Runs++
+	r.status.LastRun = time.Now().UTC()
+	r.status.Tables = tables
+	r.status.LastError = ""
+	if lastErr != nil {
+		r.status.LastError = lastErr.Error()
+	}
+	r.mu.Unlock()
+}
+
+// refreshTable regenerates the trailing window of one OHLC table for a symbol
+func (r *OHLCRefresher) refreshTable(ctx context.Context, timeframe, symbol string) TableRefreshState {
+	start := time.Now()
+	table := fmt.Sprintf("ohlc_%s_v2", timeframe)
+	ctx = db.WithQueryLabel(ctx, db.QueryOHLCRefresh, table)
+	state := TableRefreshState{
+		Table:   table,
+		Symbol:  symbol,
+		LastRun: start.UTC(),
+	}
+
+	bucket, err := timeframeDuration(timeframe)
+	if err != nil {
+		state.Error = err.Error()
+		return state
+	}
+
+	highWater, err := r.highWater(ctx, table, symbol)
+	if err != nil {
+		state.Error = err.Error()
+		return state
+	}
+	state.HighWater = highWater
+
+	windowStart, windowEnd := refreshWindow(highWater, bucket)
+	state.WindowStart, state.WindowEnd = windowStart, windowEnd
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (timestamp, symbol, open, high, low, close, volume, tick_count, vwap)
+		SELECT
+			timestamp,
+			symbol,
+			first(bid) as open,
+			max(bid) as high,
+			min(bid) as low,
+			last(bid) as close,
+			sum(volume) as volume,
+			count() as tick_count,
+			sum(price * volume) / sum(volume) as vwap
+		FROM market_data_v2
+		WHERE symbol = $1
+			AND timestamp >= $2
+			AND timestamp < $3
+		SAMPLE BY %s ALIGN TO CALENDAR
+	`, table, timeframe)
+
+	if _, err := r.pool.Exec(ctx, query, symbol, windowStart, windowEnd); err != nil {
+		state.Error = fmt.Sprintf("failed to refresh window: %v", err)
+		log.Error().Err(err).Str("table", table).Str("symbol", symbol).Msg("OHLC refresh failed")
+		return state
+	}
+
+	state.DurationMs = time.Since(start).Milliseconds()
+	log.Debug().
+		Str("table", table).
+		Str("symbol", symbol).
+		Time("window_start", windowStart).
+		Time("window_end", windowEnd).
+		Int64("duration_ms", state.DurationMs).
+		Msg("Refreshed OHLC window")
+
+	return state
+}
+
+// refreshWindow returns the buckets a pass regenerates: the trailing ones up
+// to the high-water mark and whatever follows, up to refreshMaxBuckets in all
+func refreshWindow(highWater time.Time, bucket time.Duration) (start, end time.Time) {
+	start = highWater.Truncate(bucket).Add(-time.Duration(refreshTrailingBuckets-1) * bucket)
+	return start, start.Add(refreshMaxBuckets * bucket)
+}
+
+// highWater returns the latest bar in the table, falling back to the first
+// tick for the symbol when the table has no rows yet
+func (r *OHLCRefresher) highWater(ctx context.Context, table, symbol string) (time.Time, error) {
+	var latest *time.Time
+	query := fmt.Sprintf("SELECT max(timestamp) FROM %s WHERE symbol = $1", table)
+	if err := r.pool.QueryRow(ctx, query, symbol).Scan(&latest); err != nil {
+		return time.Time{}, fmt.Errorf("failed to read high-water mark: %w", err)
+	}
+	if latest != nil {
+		return *latest, nil
+	}
+
+	var first *time.Time
+	err := r.pool.QueryRow(ctx, "SELECT min(timestamp) FROM market_data_v2 WHERE symbol = $1", symbol).Scan(&first)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read first tick: %w", err)
+	}
+	if first == nil {
+		return time.Time{}, fmt.Errorf("no tick data for %s", symbol)
+	}
+	return *first, nil
+}
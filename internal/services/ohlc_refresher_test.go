@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefreshWindow(t *testing.T) {
+	tests := []struct {
+		name      string
+		highWater time.Time
+		bucket    time.Duration
+		start     time.Time
+		end       time.Time
+	}{
+		{
+			"caught up",
+			time.Date(2024, 3, 4, 12, 34, 56, 0, time.UTC), time.Minute,
+			time.Date(2024, 3, 4, 12, 33, 0, 0, time.UTC),
+			time.Date(2024, 3, 5, 12, 33, 0, 0, time.UTC),
+		},
+		{
+			// An empty table starts from the first tick, a year back, and
+			// covers one pass's worth of buckets rather than the whole year
+			"from the first tick",
+			time.Date(2023, 3, 4, 9, 15, 0, 0, time.UTC), time.Hour,
+			time.Date(2023, 3, 4, 8, 0, 0, 0, time.UTC),
+			time.Date(2023, 3, 4, 8, 0, 0, 0, time.UTC).Add(refreshMaxBuckets * time.Hour),
+		},
+	}
+	for _, tt := range tests {
+		start, end := refreshWindow(tt.highWater, tt.bucket)
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("%s: window [%s, %s), want [%s, %s)", tt.name, start, end, tt.start, tt.end)
+		}
+	}
+}
@@ -0,0 +1,586 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// Price alert tables. Alerts are kept in memory; every change appends the
+// alert's new state to priceAlertsTable, so the latest row of each alert is
+// its state at restart. Each firing appends to priceAlertTriggersTable.
+const (
+	priceAlertsTable        = "price_alerts"
+	priceAlertTriggersTable = "price_alert_triggers"
+)
+
+// alertWriteTimeout bounds writing one alert change or trigger
+const alertWriteTimeout = 10 * time.Second
+
+// alertCheckTimeout bounds one check of every active alert
+const alertCheckTimeout = 30 * time.Second
+
+// alertRetention is how long triggered and expired alerts stay listable
+const alertRetention = 7 * 24 * time.Hour
+
+// Price alert conditions
+const (
+	AlertAbove   = "above"   // the price is at or above the level
+	AlertBelow   = "below"   // the price is at or below the level
+	AlertCrosses = "crosses" // the price moved from one side of the level to, or through, the other
+)
+
+// Price alert states
+const (
+	AlertActive    = "active"
+	AlertTriggered = "triggered" // fired, and without repeat done
+	AlertExpired   = "expired"
+	AlertDeleted   = "deleted"
+)
+
+// Errors for alert requests
+var (
+	ErrAlertsDisabled = errors.New("price alerts are disabled")
+	ErrAlertNotFound  = errors.New("alert not found")
+	ErrAlertQuota     = errors.New("alert quota reached")
+	ErrInvalidAlert   = errors.New("invalid alert")
+)
+
+// PriceAlert notifies its owner when a symbol's mid price meets a condition
+// on a level
+type PriceAlert struct {
+	ID          string     `json:"id"`
+	Owner       string     `json:"owner"` // the client that registered it, by X-Client-ID or address
+	Symbol      string     `json:"symbol"`
+	Condition   string     `json:"condition"` // above, below or crosses
+	Price       float64    `json:"price"`
+	Repeat      bool       `json:"repeat"`                 // fire each time the condition newly holds, not just once
+	CallbackURL string     `json:"callback_url,omitempty"` // receives signed triggers; without one they are only logged
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	State       string     `json:"state"`
+	Armed       bool       `json:"armed"`                // fires the next time the condition holds
+	LastPrice   *float64   `json:"last_price,omitempty"` // mid at the last check
+	Triggers    int        `json:"triggers"`
+	TriggeredAt *time.Time `json:"triggered_at,omitempty"` // the last time it fired
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// AlertTrigger records one firing of an alert
+type AlertTrigger struct {
+	AlertID     string    `json:"alert_id"`
+	Owner       string    `json:"owner"`
+	Symbol      string    `json:"symbol"`
+	Condition   string    `json:"condition"`
+	Level       float64   `json:"level"`
+	Price       float64   `json:"price"`     // the mid that fired it
+	TickTime    time.Time `json:"tick_time"` // of the tick that mid is from
+	Notified    string    `json:"notified"`  // "webhook" or "log"
+	TriggeredAt time.Time `json:"triggered_at"`
+}
+
+// AlertWebhook is the payload POSTed to an alert's callback URL when it
+// fires
+type AlertWebhook struct {
+	Event   string       `json:"event"` // always "triggered"
+	Alert   PriceAlert   `json:"alert"`
+	Trigger AlertTrigger `json:"trigger"`
+}
+
+// alertBook holds price alerts and the evaluator's state
+type alertBook struct {
+	config  config.AlertsConfig
+	wg      sync.WaitGroup
+	checkMu sync.Mutex // serializes checks so a price fires an alert once
+	mu      sync.Mutex
+	alerts  map[string]*PriceAlert
+
+	// The database reads and writes alerts make, replaceable in tests
+	quotes func(ctx context.Context, symbols []string) (map[string]models.Quote, error)
+	save   func(ctx context.Context, a PriceAlert) error
+	record func(ctx context.Context, t AlertTrigger) error
+}
+
+// evaluate moves the alert to a new mid price and reports whether it fires.
+// above and below hold while the price is at or past the level, so an alert
+// registered on the wrong side of its level fires at the first check;
+// crosses holds when the price moved from one side of the level to, or
+// through, the other since the previous check, so it never fires on the
+// first. An alert fires when its condition holds while armed. Without
+// repeat that ends it; with repeat, above and below re-arm once their
+// condition stops holding, and crosses stays armed.
+func (a *PriceAlert) evaluate(price float64) bool {
+	previous := a.LastPrice
+	a.LastPrice = &price
+
+	var holds bool
+	switch a.Condition {
+	case AlertAbove:
+		holds = price >= a.Price
+	case AlertBelow:
+		holds = price <= a.Price
+	case AlertCrosses:
+		holds = previous != nil &&
+			((*previous < a.Price && price >= a.Price) || (*previous > a.Price && price <= a.Price))
+	}
+
+	if !holds {
+		if a.Repeat {
+			a.Armed = true
+		}
+		return false
+	}
+	if !a.Armed {
+		return false
+	}
+
+	a.Triggers++
+	a.Armed = a.Repeat && a.Condition == AlertCrosses
+	if !a.Repeat {
+		a.State = AlertTriggered
+	}
+	return true
+}
+
+// StartAlerts configures price alerts, restores the saved ones and, when
+// enabled, launches the evaluator that checks every active alert against
+// its symbol's latest mid price each interval
+func (dm *DataManager) StartAlerts(cfg config.AlertsConfig) {
+	dm.alerts = &alertBook{
+		config: cfg,
+		alerts: make(map[string]*PriceAlert),
+		quotes: dm.latestQuotes,
+		save:   dm.persistAlert,
+		record: dm.recordTrigger,
+	}
+
+	if !cfg.Enabled {
+		log.Info().Msg("Price alerts disabled")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(dm.rootCtx, alertWriteTimeout)
+	if err := dm.ensureAlertTables(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to create price alert tables, alerts won't survive restarts")
+	}
+	dm.restoreAlerts(ctx)
+	cancel()
+
+	dm.alerts.wg.Add(1)
+	go func() {
+		defer dm.alerts.wg.Done()
+
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		log.Info().
+			Dur("interval", cfg.Interval).
+			Int("max_per_key", cfg.MaxPerKey).
+			Msg("Price alert evaluator started")
+
+		for {
+			select {
+			case <-dm.rootCtx.Done():
+				return
+			case <-ticker.C:
+				dm.checkAlerts(dm.rootCtx)
+			}
+		}
+	}()
+}
+
+// CreateAlert validates and registers an alert for its owner, who may hold
+// at most the configured number of active alerts
+func (dm *DataManager) CreateAlert(ctx context.Context, alert PriceAlert) (PriceAlert, error) {
+	if dm.alerts == nil || !dm.alerts.config.Enabled {
+		return PriceAlert{}, ErrAlertsDisabled
+	}
+	switch alert.Condition {
+	case AlertAbove, AlertBelow, AlertCrosses:
+	default:
+		return PriceAlert{}, fmt.Errorf("%w: condition must be %s, %s or %s", ErrInvalidAlert, AlertAbove, AlertBelow, AlertCrosses)
+	}
+	if alert.Price <= 0 {
+		return PriceAlert{}, fmt.Errorf("%w: price must be positive", ErrInvalidAlert)
+	}
+	now := time.Now().UTC()
+	if alert.ExpiresAt != nil && !alert.ExpiresAt.After(now) {
+		return PriceAlert{}, fmt.Errorf("%w: expires_at is in the past", ErrInvalidAlert)
+	}
+	if err := dm.validateCallbackURL(alert.CallbackURL); err != nil {
+		return PriceAlert{}, err
+	}
+
+	alert.ID = newJobID()
+	alert.State = AlertActive
+	alert.Armed = true
+	alert.LastPrice, alert.TriggeredAt, alert.Triggers = nil, nil, 0
+	alert.CreatedAt, alert.UpdatedAt = now, now
+
+	dm.alerts.mu.Lock()
+	defer dm.alerts.mu.Unlock()
+
+	if limit := dm.alerts.config.MaxPerKey; limit > 0 {
+		active := 0
+		for _, a := range dm.alerts.alerts {
+			if a.Owner == alert.Owner && a.State == AlertActive {
+				active++
+			}
+		}
+		if active >= limit {
+			return PriceAlert{}, fmt.Errorf("%w: %s already has %d active alerts", ErrAlertQuota, alert.Owner, active)
+		}
+	}
+
+	if err := dm.alerts.save(ctx, alert); err != nil {
+		return PriceAlert{}, err
+	}
+	dm.alerts.alerts[alert.ID] = &alert
+	log.Info().
+		Str("alert", alert.ID).
+		Str("owner", alert.Owner).
+		Str("symbol", alert.Symbol).
+		Str("condition", alert.Condition).
+		Float64("price", alert.Price).
+		Msg("Price alert registered")
+	return alert, nil
+}
+
+// ListAlerts returns the owner's alerts, oldest first
+func (dm *DataManager) ListAlerts(owner string) []PriceAlert {
+	alerts := make([]PriceAlert, 0)
+	if dm.alerts == nil {
+		return alerts
+	}
+	dm.alerts.mu.Lock()
+	defer dm.alerts.mu.Unlock()
+
+	dm.pruneAlerts()
+	for _, a := range dm.alerts.alerts {
+		if a.Owner == owner {
+			alerts = append(alerts, *a)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].CreatedAt.Before(alerts[j].CreatedAt)
+	})
+	return alerts
+}
+
+// GetAlert returns one of the owner's alerts. Other owners' alerts are not
+// found.
+func (dm *DataManager) GetAlert(owner, id string) (PriceAlert, error) {
+	if dm.alerts == nil {
+		return PriceAlert{}, ErrAlertNotFound
+	}
+	dm.alerts.mu.Lock()
+	defer dm.alerts.mu.Unlock()
+
+	a, ok := dm.alerts.alerts[id]
+	if !ok || a.Owner != owner {
+		return PriceAlert{}, ErrAlertNotFound
+	}
+	return *a, nil
+}
+
+// DeleteAlert removes one of the owner's alerts, returning it as deleted
+func (dm *DataManager) DeleteAlert(ctx context.Context, owner, id string) (PriceAlert, error) {
+	if dm.alerts == nil {
+		return PriceAlert{}, ErrAlertNotFound
+	}
+	dm.alerts.mu.Lock()
+	defer dm.alerts.mu.Unlock()
+
+	a, ok := dm.alerts.alerts[id]
+	if !ok || a.Owner != owner {
+		return PriceAlert{}, ErrAlertNotFound
+	}
+	deleted := *a
+	deleted.State = AlertDeleted
+	deleted.UpdatedAt = time.Now().UTC()
+	if err := dm.alerts.save(ctx, deleted); err != nil {
+		return PriceAlert{}, err
+	}
+	delete(dm.alerts.alerts, id)
+	return deleted, nil
+}
+
+// pruneAlerts drops triggered and expired alerts past alertRetention. Must
+// be called with dm.alerts.mu held.
+func (dm *DataManager) pruneAlerts() {
+	cutoff := time.Now().Add(-alertRetention)
+	for id, a := range dm.alerts.alerts {
+		if a.State != AlertActive && a.UpdatedAt.Before(cutoff) {
+			delete(dm.alerts.alerts, id)
+		}
+	}
+}
+
+// checkAlerts expires the active alerts past their expiry and evaluates the
+// rest against their symbol's latest mid price, firing the ones that hold.
+// An alert's new state is only saved when it expires, fires or re-arms; its
+// last price is not, so after a restart crosses needs a check to set a
+// baseline again.
+func (dm *DataManager) checkAlerts(ctx context.Context) {
+	dm.alerts.checkMu.Lock()
+	defer dm.alerts.checkMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, alertCheckTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	var changed []PriceAlert
+	var symbols []string
+	seen := make(map[string]bool)
+	dm.alerts.mu.Lock()
+	dm.pruneAlerts()
+	for _, a := range dm.alerts.alerts {
+		if a.State != AlertActive {
+			continue
+		}
+		if a.ExpiresAt != nil && !a.ExpiresAt.After(now) {
+			a.State, a.UpdatedAt = AlertExpired, now
+			changed = append(changed, *a)
+			continue
+		}
+		if !seen[a.Symbol] {
+			seen[a.Symbol] = true
+			symbols = append(symbols, a.Symbol)
+		}
+	}
+	dm.alerts.mu.Unlock()
+
+	quotes, err := dm.alerts.quotes(ctx, symbols)
+	if err != nil {
+		log.Error().Err(err).Msg("Price alert check failed")
+	}
+
+	var fired []AlertTrigger
+	dm.alerts.mu.Lock()
+	for _, a := range dm.alerts.alerts {
+		quote, ok := quotes[a.Symbol]
+		if !ok || a.State != AlertActive {
+			continue
+		}
+		armed := a.Armed
+		if a.evaluate(quote.Mid) {
+			a.TriggeredAt = &now
+			trigger := AlertTrigger{
+				AlertID:     a.ID,
+				Owner:       a.Owner,
+				Symbol:      a.Symbol,
+				Condition:   a.Condition,
+				Level:       a.Price,
+				Price:       quote.Mid,
+				TickTime:    quote.Timestamp,
+				Notified:    "log",
+				TriggeredAt: now,
+			}
+			if a.CallbackURL != "" && dm.webhooks != nil {
+				trigger.Notified = "webhook"
+			}
+			fired = append(fired, trigger)
+		} else if a.Armed == armed {
+			continue
+		}
+		a.UpdatedAt = now
+		changed = append(changed, *a)
+	}
+	dm.alerts.mu.Unlock()
+
+	for _, alert := range changed {
+		if err := dm.alerts.save(ctx, alert); err != nil {
+			log.Error().Err(err).Str("alert", alert.ID).Msg("Failed to save price alert")
+		}
+	}
+	for _, trigger := range fired {
+		dm.fireAlert(ctx, trigger)
+	}
+}
+
+// fireAlert records a trigger, logs it and, when the alert has a callback
+// URL, POSTs it there in the background, tracked so Close waits for it
+func (dm *DataManager) fireAlert(ctx context.Context, trigger AlertTrigger) {
+	log.Info().
+		Str("alert", trigger.AlertID).
+		Str("owner", trigger.Owner).
+		Str("symbol", trigger.Symbol).
+		Str("condition", trigger.Condition).
+		Float64("level", trigger.Level).
+		Float64("price", trigger.Price).
+		Msg("Price alert triggered")
+
+	if err := dm.alerts.record(ctx, trigger); err != nil {
+		log.Error().Err(err).Str("alert", trigger.AlertID).Msg("Failed to record price alert trigger")
+	}
+	if trigger.Notified != "webhook" {
+		return
+	}
+
+	alert, err := dm.GetAlert(trigger.Owner, trigger.AlertID)
+	if err != nil {
+		return
+	}
+	body, err := json.Marshal(AlertWebhook{Event: "triggered", Alert: alert, Trigger: trigger})
+	if err != nil {
+		return
+	}
+	dm.alerts.wg.Add(1)
+	go func() {
+		defer dm.alerts.wg.Done()
+		dm.deliverAlert("price", alert.CallbackURL, body)
+	}()
+}
+
+// ensureAlertTables creates the alert and trigger tables if they don't
+// exist yet
+func (dm *DataManager) ensureAlertTables(ctx context.Context) error {
+	err := dm.writePool.ExecSchema(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id SYMBOL CAPACITY 4096 NOCACHE,
+			owner STRING,
+			symbol SYMBOL,
+			condition SYMBOL,
+			price DOUBLE,
+			repeat BOOLEAN,
+			callback_url STRING,
+			expires_at TIMESTAMP,
+			state SYMBOL,
+			armed BOOLEAN,
+			triggers INT,
+			triggered_at TIMESTAMP,
+			created_at TIMESTAMP,
+			updated_at TIMESTAMP
+		) timestamp(updated_at) PARTITION BY MONTH
+	`, priceAlertsTable))
+	if err != nil {
+		return err
+	}
+	return dm.writePool.ExecSchema(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			alert_id SYMBOL CAPACITY 4096 NOCACHE,
+			owner STRING,
+			symbol SYMBOL,
+			condition SYMBOL,
+			level DOUBLE,
+			price DOUBLE,
+			tick_time TIMESTAMP,
+			notified SYMBOL,
+			triggered_at TIMESTAMP
+		) timestamp(triggered_at) PARTITION BY MONTH
+	`, priceAlertTriggersTable))
+}
+
+// alertColumns are the alert table columns in PriceAlert order
+const alertColumns = `id, owner, symbol, condition, price, repeat, callback_url, expires_at,
+	state, armed, triggers, triggered_at, created_at, updated_at`
+
+// persistAlert appends the alert's current state to the alert table
+func (dm *DataManager) persistAlert(ctx context.Context, a PriceAlert) error {
+	ctx, cancel := context.WithTimeout(ctx, alertWriteTimeout)
+	defer cancel()
+	ctx = db.WithQueryLabel(ctx, db.QueryPriceAlerts, priceAlertsTable)
+
+	_, err := dm.writePool.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s (%s)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`, priceAlertsTable, alertColumns),
+		a.ID, a.Owner, a.Symbol, a.Condition, a.Price, a.Repeat, a.CallbackURL, a.ExpiresAt,
+		a.State, a.Armed, a.Triggers, a.TriggeredAt, a.CreatedAt, a.UpdatedAt,
+	)
+	if err != nil {
+		return queryError(fmt.Errorf("failed to save alert %s: %w", a.ID, err))
+	}
+	return nil
+}
+
+// recordTrigger appends a firing to the trigger table
+func (dm *DataManager) recordTrigger(ctx context.Context, t AlertTrigger) error {
+	ctx, cancel := context.WithTimeout(ctx, alertWriteTimeout)
+	defer cancel()
+	ctx = db.WithQueryLabel(ctx, db.QueryPriceAlerts, priceAlertTriggersTable)
+
+	_, err := dm.writePool.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s (alert_id, owner, symbol, condition, level, price, tick_time, notified, triggered_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, priceAlertTriggersTable),
+		t.AlertID, t.Owner, t.Symbol, t.Condition, t.Level, t.Price, t.TickTime, t.Notified, t.TriggeredAt,
+	)
+	return err
+}
+
+// restoreAlerts loads the latest saved state of every alert, keeping the
+// active ones and those finished within alertRetention
+func (dm *DataManager) restoreAlerts(ctx context.Context) {
+	ctx = db.WithQueryLabel(ctx, db.QueryPriceAlerts, priceAlertsTable)
+
+	rows, err := dm.pool.QueryWithTimeout(ctx, dm.pool.QueryTimeout(), fmt.Sprintf(
+		"SELECT %s FROM %s LATEST ON updated_at PARTITION BY id", alertColumns, priceAlertsTable))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to restore price alerts")
+		return
+	}
+	defer rows.Close()
+
+	dm.alerts.mu.Lock()
+	defer dm.alerts.mu.Unlock()
+
+	for rows.Next() {
+		var a PriceAlert
+		var callbackURL *string
+		err := rows.Scan(&a.ID, &a.Owner, &a.Symbol, &a.Condition, &a.Price, &a.Repeat, &callbackURL, &a.ExpiresAt,
+			&a.State, &a.Armed, &a.Triggers, &a.TriggeredAt, &a.CreatedAt, &a.UpdatedAt)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to restore price alerts")
+			return
+		}
+		if callbackURL != nil {
+			a.CallbackURL = *callbackURL
+		}
+		if a.State != AlertDeleted {
+			dm.alerts.alerts[a.ID] = &a
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Error().Err(err).Msg("Failed to restore price alerts")
+	}
+	dm.pruneAlerts()
+	log.Info().Int("alerts", len(dm.alerts.alerts)).Msg("Restored price alerts")
+}
+
+// AlertHistory returns the triggers of one of the owner's alerts, newest
+// first
+func (dm *DataManager) AlertHistory(ctx context.Context, owner, id string) ([]AlertTrigger, error) {
+	if _, err := dm.GetAlert(owner, id); err != nil {
+		return nil, err
+	}
+	ctx = db.WithQueryLabel(ctx, db.QueryPriceAlerts, priceAlertTriggersTable)
+
+	rows, err := dm.pool.QueryWithTimeout(ctx, dm.pool.QueryTimeout(), fmt.Sprintf(`
+		SELECT alert_id, owner, symbol, condition, level, price, tick_time, notified, triggered_at
+		FROM %s WHERE alert_id = $1 ORDER BY triggered_at DESC
+	`, priceAlertTriggersTable), id)
+	if err != nil {
+		return nil, queryError(fmt.Errorf("failed to query alert history: %w", err))
+	}
+	defer rows.Close()
+
+	triggers := make([]AlertTrigger, 0)
+	for rows.Next() {
+		var t AlertTrigger
+		if err := rows.Scan(&t.AlertID, &t.Owner, &t.Symbol, &t.Condition, &t.Level, &t.Price, &t.TickTime, &t.Notified, &t.TriggeredAt); err != nil {
+			return nil, fmt.Errorf("failed to read alert history: %w", err)
+		}
+		triggers = append(triggers, t)
+	}
+	return triggers, rows.Err()
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+func TestPriceAlertEvaluate(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		repeat    bool
+		prices    []float64
+		fires     []bool
+	}{
+		{"above fires once", AlertAbove, false, []float64{1.09, 1.10, 1.11, 1.09, 1.12}, []bool{false, true, false, false, false}},
+		{"below fires once", AlertBelow, false, []float64{1.11, 1.10, 1.09}, []bool{false, true, false}},
+		{"above already past the level", AlertAbove, false, []float64{1.12}, []bool{true}},
+		// Re-arms only once the price falls back under the level
+		{"above re-arms", AlertAbove, true, []float64{1.11, 1.12, 1.09, 1.10, 1.11}, []bool{true, false, false, true, false}},
+		{"below re-arms", AlertBelow, true, []float64{1.09, 1.11, 1.08}, []bool{true, false, true}},
+		// Never on the first price, which only sets the baseline
+		{"crosses fires once", AlertCrosses, false, []float64{1.11, 1.09, 1.10, 1.08, 1.12}, []bool{false, true, false, false, false}},
+		{"crosses through", AlertCrosses, false, []float64{1.09, 1.11}, []bool{false, true}},
+		{"crosses stays armed", AlertCrosses, true, []float64{1.09, 1.11, 1.12, 1.08, 1.08, 1.10}, []bool{false, true, false, true, false, true}},
+	}
+	for _, tt := range tests {
+		a := &PriceAlert{Condition: tt.condition, Price: 1.10, Repeat: tt.repeat, State: AlertActive, Armed: true}
+		for i, price := range tt.prices {
+			if fired := a.evaluate(price); fired != tt.fires[i] {
+				t.Errorf("%s: price %d (%g) fired = %v, want %v", tt.name, i, price, fired, tt.fires[i])
+			}
+		}
+		wantTriggers := 0
+		for _, fire := range tt.fires {
+			if fire {
+				wantTriggers++
+			}
+		}
+		if a.Triggers != wantTriggers {
+			t.Errorf("%s: %d triggers, want %d", tt.name, a.Triggers, wantTriggers)
+		}
+		wantState := AlertActive
+		if !tt.repeat && wantTriggers > 0 {
+			wantState = AlertTriggered
+		}
+		if a.State != wantState {
+			t.Errorf("%s: state %s, want %s", tt.name, a.State, wantState)
+		}
+	}
+}
+
+// alertHarness replaces the alert book's database calls with a price feed
+// and records of saved alerts and triggers
+type alertHarness struct {
+	mu       sync.Mutex
+	mids     map[string]float64
+	saved    []PriceAlert
+	triggers []AlertTrigger
+}
+
+func newAlertHarness(t *testing.T) (*DataManager, *alertHarness) {
+	h := &alertHarness{mids: make(map[string]float64)}
+	dm := newTestDataManager(t)
+	dm.alerts = &alertBook{
+		config: config.AlertsConfig{Enabled: true, Interval: time.Second},
+		alerts: make(map[string]*PriceAlert),
+		quotes: func(_ context.Context, symbols []string) (map[string]models.Quote, error) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			quotes := make(map[string]models.Quote)
+			for _, symbol := range symbols {
+				if mid, ok := h.mids[symbol]; ok {
+					quotes[symbol] = models.Quote{Symbol: symbol, Mid: mid, Timestamp: time.Now()}
+				}
+			}
+			return quotes, nil
+		},
+		save: func(_ context.Context, a PriceAlert) error {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.saved = append(h.saved, a)
+			return nil
+		},
+		record: func(_ context.Context, trigger AlertTrigger) error {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.triggers = append(h.triggers, trigger)
+			return nil
+		},
+	}
+	return dm, h
+}
+
+// tick sets the symbol's mid and runs one check
+func (h *alertHarness) tick(dm *DataManager, symbol string, mid float64) {
+	h.mu.Lock()
+	h.mids[symbol] = mid
+	h.mu.Unlock()
+	dm.checkAlerts(context.Background())
+}
+
+func (h *alertHarness) fired() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ids := make([]string, len(h.triggers))
+	for i, trigger := range h.triggers {
+		ids[i] = trigger.AlertID
+	}
+	return ids
+}
+
+func TestCheckAlerts(t *testing.T) {
+	dm, h := newAlertHarness(t)
+	create := func(condition string, price float64, repeat bool) PriceAlert {
+		t.Helper()
+		alert, err := dm.CreateAlert(context.Background(), PriceAlert{
+			Owner: "client", Symbol: "EURUSD", Condition: condition, Price: price, Repeat: repeat,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return alert
+	}
+	above := create(AlertAbove, 1.10, false)
+	below := create(AlertBelow, 1.08, true)
+	crosses := create(AlertCrosses, 1.09, false)
+
+	h.tick(dm, "EURUSD", 1.085) // crosses takes its baseline
+	if fired := h.fired(); len(fired) != 0 {
+		t.Fatalf("first tick fired %v", fired)
+	}
+	h.tick(dm, "EURUSD", 1.095)
+	h.tick(dm, "EURUSD", 1.101)
+	h.tick(dm, "EURUSD", 1.079)
+	h.tick(dm, "EURUSD", 1.085) // below re-arms
+	h.tick(dm, "EURUSD", 1.075)
+
+	want := []string{crosses.ID, above.ID, below.ID, below.ID}
+	fired := h.fired()
+	if len(fired) != len(want) {
+		t.Fatalf("fired %v, want %v", fired, want)
+	}
+	for i := range want {
+		if fired[i] != want[i] {
+			t.Errorf("trigger %d fired %s, want %s", i, fired[i], want[i])
+		}
+	}
+
+	for id, state := range map[string]string{above.ID: AlertTriggered, crosses.ID: AlertTriggered, below.ID: AlertActive} {
+		alert, err := dm.GetAlert("client", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alert.State != state {
+			t.Errorf("alert %s is %s, want %s", alert.Condition, alert.State, state)
+		}
+	}
+	if alert, _ := dm.GetAlert("client", below.ID); alert.Triggers != 2 || alert.TriggeredAt == nil {
+		t.Errorf("repeating alert has %d triggers, triggered at %v, want 2", alert.Triggers, alert.TriggeredAt)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if trigger := h.triggers[1]; trigger.Price != 1.101 || trigger.Level != 1.10 || trigger.Notified != "log" {
+		t.Errorf("above trigger = %+v, want price 1.101 at level 1.10, logged", trigger)
+	}
+}
+
+func TestCheckAlertsExpires(t *testing.T) {
+	dm, h := newAlertHarness(t)
+	past := time.Now().Add(-time.Minute)
+	dm.alerts.alerts["expired"] = &PriceAlert{
+		ID: "expired", Owner: "client", Symbol: "EURUSD", Condition: AlertAbove, Price: 1.10,
+		State: AlertActive, Armed: true, ExpiresAt: &past,
+	}
+
+	// Expired before its condition is checked
+	h.tick(dm, "EURUSD", 1.20)
+	if fired := h.fired(); len(fired) != 0 {
+		t.Errorf("expired alert fired: %v", fired)
+	}
+	alert, err := dm.GetAlert("client", "expired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alert.State != AlertExpired {
+		t.Errorf("state = %s, want %s", alert.State, AlertExpired)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.saved) != 1 || h.saved[0].State != AlertExpired {
+		t.Errorf("saved %+v, want the alert once as expired", h.saved)
+	}
+}
+
+func TestFireAlertDeliveryTracked(t *testing.T) {
+	dm, h := newAlertHarness(t)
+	release := make(chan struct{})
+	received := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	defer server.Close()
+	dm.webhooks = &webhookSender{client: server.Client(), secret: []byte("secret"), retry: retryPolicy{attempts: 1}}
+	dm.alerts.alerts["hook"] = &PriceAlert{
+		ID: "hook", Owner: "client", Symbol: "EURUSD", Condition: AlertAbove, Price: 1.10,
+		CallbackURL: server.URL, State: AlertActive, Armed: true,
+	}
+
+	h.tick(dm, "EURUSD", 1.11)
+	<-received
+
+	// The delivery holds the wait group Close waits on until it finishes
+	waited := make(chan struct{})
+	go func() {
+		dm.alerts.wg.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("wait group released while the webhook was still being delivered")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait group not released after the delivery finished")
+	}
+}
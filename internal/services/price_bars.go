@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/bars"
+	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// maxPriceBars caps the bars one request may build; a size that would build
+// more over the range is refused rather than truncated
+const maxPriceBars = 10000
+
+// priceBarsMaxRange caps the range price bars are built over, since every
+// tick in it is read
+const priceBarsMaxRange = 31 * 24 * time.Hour
+
+// errTooManyBars stops the tick stream once the cap is passed
+var errTooManyBars = errors.New("too many bars")
+
+// StreamTicks calls fn with each of symbol's ticks from start up to end, in
+// time order, priced at the bid as candles are. Rows are read as fn consumes
+// them, so the range is never held in memory. An error from fn stops the
+// stream and is returned as is.
+func (s *DataService) StreamTicks(ctx context.Context, symbol string, start, end time.Time, fn func(bars.Tick) error) error {
+	ctx = db.WithQueryLabel(ctx, db.QueryTicks, "market_data_v2")
+
+	rows, err := s.pool.QueryWithTimeout(ctx, s.pool.ScanTimeout(), `
+		SELECT timestamp, bid, volume
+		FROM market_data_v2
+		WHERE symbol = $1
+			AND timestamp >= $2
+			AND timestamp < $3
+		ORDER BY timestamp
+	`, symbol, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to query ticks: %w", queryError(err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tick bars.Tick
+		if err := rows.Scan(&tick.Timestamp, &tick.Price, &tick.Volume); err != nil {
+			return fmt.Errorf("failed to scan tick: %w", queryError(err))
+		}
+		if err := fn(tick); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating ticks: %w", queryError(err))
+	}
+	return nil
+}
+
+// GetPriceBars builds the bars of builder, which must be of the request's
+// type and size, from the requested range's ticks. Bars are collected as
+// they complete; passing maxPriceBars fails with ErrRangeTooLarge.
+func (s *DataService) GetPriceBars(ctx context.Context, req models.PriceBarRequest, builder bars.Builder) (*models.PriceBarResponse, error) {
+	barType, size := req.BarSize()
+	if req.End.Sub(req.Start) > priceBarsMaxRange {
+		return nil, fmt.Errorf("%w: %s bars are limited to ranges of %s", ErrRangeTooLarge, barType, priceBarsMaxRange)
+	}
+
+	response := &models.PriceBarResponse{
+		Symbol:  req.Symbol,
+		Type:    barType,
+		Size:    size,
+		Start:   req.Start,
+		End:     req.End,
+		Bars:    []bars.Bar{},
+		MaxBars: maxPriceBars,
+	}
+
+	start := time.Now()
+	err := s.StreamTicks(ctx, req.Symbol, req.Start, req.End, func(tick bars.Tick) error {
+		response.TicksRead++
+		response.Bars = append(response.Bars, builder.Add(tick)...)
+		if len(response.Bars) > maxPriceBars {
+			return errTooManyBars
+		}
+		return nil
+	})
+	if errors.Is(err, errTooManyBars) {
+		return nil, fmt.Errorf("%w: %s size %g builds more than %d bars over this range, use a larger size or a shorter range",
+			ErrRangeTooLarge, barType, size, maxPriceBars)
+	}
+	if err != nil {
+		return nil, err
+	}
+	response.Count = len(response.Bars)
+	response.QueryTimeMs = time.Since(start).Milliseconds()
+
+	log.Debug().
+		Str("symbol", req.Symbol).
+		Str("type", barType).
+		Float64("size", size).
+		Int64("ticks", response.TicksRead).
+		Int("bars", response.Count).
+		Int64("query_time_ms", response.QueryTimeMs).
+		Msg("Built price bars")
+
+	return response, nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// quoteCacheTTL is how long a symbol's latest tick is served from cache:
+// short enough that quotes stay live, long enough that clients polling
+// together share one query
+const quoteCacheTTL = time.Second
+
+// MaxQuoteSymbols caps the symbols of one batch quote request
+const MaxQuoteSymbols = 50
+
+// GetQuotes returns the latest tick of each symbol, in the order given,
+// leaving out symbols without ticks. Age and staleness are worked out as
+// the quotes are served, so a cached tick still ages; a quote is stale when
+// it is older than the staleness monitor allows for its market's state.
+func (dm *DataManager) GetQuotes(ctx context.Context, symbols []string) ([]models.Quote, error) {
+	cached := make(map[string]models.Quote, len(symbols))
+	var missing []string
+	for _, symbol := range symbols {
+		if quote, ok := dm.quotes.Get(symbol); ok {
+			cached[symbol] = quote
+		} else {
+			missing = append(missing, symbol)
+		}
+	}
+
+	if len(missing) > 0 {
+		loaded, err := dm.latestQuotes(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for symbol, quote := range loaded {
+			dm.quotes.Set(symbol, quote, quoteCacheTTL, SymbolTag(symbol))
+			cached[symbol] = quote
+		}
+	}
+
+	now := time.Now().UTC()
+	quotes := make([]models.Quote, 0, len(symbols))
+	for _, symbol := range symbols {
+		quote, ok := cached[symbol]
+		if !ok {
+			continue
+		}
+		age := now.Sub(quote.Timestamp)
+		quote.AgeMs = age.Milliseconds()
+		quote.Stale = dm.staleness != nil && age > dm.maxLag(symbol, now)
+		quotes = append(quotes, quote)
+	}
+	return quotes, nil
+}
+
+// latestQuotes reads the latest tick of each symbol. Symbols without ticks
+// are left out.
+func (dm *DataManager) latestQuotes(ctx context.Context, symbols []string) (map[string]models.Quote, error) {
+	quotes := make(map[string]models.Quote, len(symbols))
+	if len(symbols) == 0 {
+		return quotes, nil
+	}
+	ctx = db.WithQueryLabel(ctx, db.QueryLatestTick, tickTable)
+
+	placeholders := make([]string, len(symbols))
+	args := make([]interface{}, len(symbols))
+	for i, symbol := range symbols {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = symbol
+	}
+	rows, err := dm.pool.QueryWithTimeout(ctx, dm.pool.QueryTimeout(), fmt.Sprintf(
+		"SELECT symbol, bid, ask, timestamp FROM %s WHERE symbol IN (%s) LATEST ON timestamp PARTITION BY symbol",
+		tickTable, strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		return nil, queryError(fmt.Errorf("failed to read latest ticks: %w", err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var q models.Quote
+		if err := rows.Scan(&q.Symbol, &q.Bid, &q.Ask, &q.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to read latest ticks: %w", err)
+		}
+		q.Mid = (q.Bid + q.Ask) / 2
+		q.Spread = q.Ask - q.Bid
+		quotes[q.Symbol] = q
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(err)
+	}
+	return quotes, nil
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/config"
+)
+
+// redisTimeout bounds each Redis round trip so a slow cache never stalls a request
+const redisTimeout = 500 * time.Millisecond
+
+// RedisCache is a Cache shared by every API replica. Values are stored as
+// JSON and returned from Get as raw bytes for TypedCache to decode. TTL
+// jitter applies; stale-while-revalidate does not, since Redis removes keys
+// at expiry.
+type RedisCache struct {
+	client   *redis.Client
+	prefix   string
+	settings atomic.Pointer[redisSettings] // replaced whole by Reconfigure
+	loads    loadGroup
+
+	hits         atomic.Int64
+	misses       atomic.Int64
+	negativeHits atomic.Int64
+	tooLarge     atomic.Int64
+	windows      windowCounters
+}
+
+// redisSettings are the RedisCache settings that can change while running
+type redisSettings struct {
+	jitter      float64
+	negativeTTL time.Duration
+	maxEntry    int64
+}
+
+// NewRedisCache connects to Redis using CacheConfig.RedisURL
+func NewRedisCache(cfg config.CacheConfig) (*RedisCache, error) {
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse redis URL: %w", err)
+	}
+
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to ping redis: %w", err)
+	}
+
+	log.Info().Str("addr", opts.Addr).Msg("Redis cache initialized")
+
+	r := &RedisCache{
+		client: client,
+		prefix: cfg.RedisPrefix,
+	}
+	r.Reconfigure(cfg)
+	return r, nil
+}
+
+// Reconfigure applies changed TTL jitter, negative TTL and entry size
+// settings. The Redis URL and key prefix are fixed when the cache is created.
+func (r *RedisCache) Reconfigure(cfg config.CacheConfig) {
+	r.settings.Store(&redisSettings{
+		jitter:      cfg.TTLJitter,
+		negativeTTL: cfg.NegativeTTL,
+		maxEntry:    cfg.MaxEntryBytes,
+	})
+}
+
+// Get retrieves the raw JSON stored under key. Membership of the negative
+// tag set is checked in the same round trip to count negative hits.
+func (r *RedisCache) Get(key string) (interface{}, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	pipe := r.client.Pipeline()
+	get := pipe.Get(ctx, r.prefix+key)
+	negative := pipe.SIsMember(ctx, r.tagKey(negativeTag), r.prefix+key)
+	_, _ = pipe.Exec(ctx)
+
+	data, err := get.Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Warn().Err(err).Str("key", key).Msg("Redis get failed")
+		}
+		r.misses.Add(1)
+		r.windows.recordMiss(time.Now())
+		return nil, false
+	}
+
+	r.hits.Add(1)
+	r.windows.recordHit(time.Now())
+	if negative.Val() {
+		r.negativeHits.Add(1)
+	}
+	return data, true
+}
+
+// Set stores data as JSON with the TTL mapped to Redis expiry. Tags are kept
+// as Redis sets of keys that expire no earlier than their members. Empty
+// results use the negative TTL and payloads over MaxEntryBytes are skipped.
+func (r *RedisCache) Set(key string, data interface{}, ttl time.Duration, tags ...string) {
+	settings := r.settings.Load()
+	if isNegative(data) {
+		ttl, tags = negativeEntry(ttl, settings.negativeTTL, tags)
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Failed to encode cache value")
+		return
+	}
+	if settings.maxEntry > 0 && int64(len(payload)) > settings.maxEntry {
+		r.tooLarge.Add(1)
+		log.Warn().
+			Str("key", key).
+			Int("size_bytes", len(payload)).
+			Int64("max_entry_bytes", settings.maxEntry).
+			Msg("Value too large to cache")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	ttl = jitterTTL(ttl, settings.jitter)
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, r.prefix+key, payload, ttl)
+	for _, tag := range tags {
+		tagKey := r.tagKey(tag)
+		pipe.SAdd(ctx, tagKey, r.prefix+key)
+		pipe.ExpireGT(ctx, tagKey, ttl)
+		pipe.ExpireNX(ctx, tagKey, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Redis set failed")
+	}
+}
+
+// tagKey is the Redis set holding the keys carrying tag
+func (r *RedisCache) tagKey(tag string) string {
+	return r.prefix + "tag:" + tag
+}
+
+// InvalidateTag removes every key carrying tag along with the tag set
+func (r *RedisCache) InvalidateTag(tag string) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tagKey := r.tagKey(tag)
+	keys, err := r.client.SMembers(ctx, tagKey).Result()
+	if err != nil {
+		log.Warn().Err(err).Str("tag", tag).Msg("Redis tag lookup failed")
+		return 0
+	}
+
+	removed := int64(0)
+	if len(keys) > 0 {
+		removed, err = r.client.Del(ctx, keys...).Result()
+		if err != nil {
+			log.Warn().Err(err).Str("tag", tag).Msg("Redis tag invalidation failed")
+		}
+	}
+	r.client.Del(ctx, tagKey)
+
+	return int(removed)
+}
+
+// Delete removes a key
+func (r *RedisCache) Delete(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	if err := r.client.Del(ctx, r.prefix+key).Err(); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Redis delete failed")
+	}
+}
+
+// InvalidatePrefix removes every key starting with prefix using SCAN
+func (r *RedisCache) InvalidatePrefix(prefix string) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	removed := 0
+	iter := r.client.Scan(ctx, 0, r.prefix+prefix+"*", 500).Iterator()
+	batch := make([]string, 0, 500)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		n, err := r.client.Del(ctx, batch...).Result()
+		if err != nil {
+			log.Warn().Err(err).Msg("Redis batch delete failed")
+		}
+		removed += int(n)
+		batch = batch[:0]
+	}
+
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == cap(batch) {
+			flush()
+		}
+	}
+	flush()
+
+	if err := iter.Err(); err != nil {
+		log.Warn().Err(err).Str("prefix", prefix).Msg("Redis scan failed")
+	}
+
+	return removed
+}
+
+// GetOrLoad returns the cached value or loads it, deduplicating concurrent
+// loads within this replica. Freshly loaded values are returned as-is. It
+// reports whether the value was found in Redis.
+func (r *RedisCache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func() (interface{}, error), tags ...string) (interface{}, bool, error) {
+	return r.loads.getOrLoad(ctx, key, r.Get, func(key string, data interface{}) {
+		r.Set(key, data, ttl, tags...)
+	}, loader)
+}
+
+// ResetStats zeroes this replica's lifetime counters
+func (r *RedisCache) ResetStats() {
+	r.hits.Store(0)
+	r.misses.Store(0)
+	r.negativeHits.Store(0)
+	r.tooLarge.Store(0)
+}
+
+// GetStats returns this replica's view of cache performance
+func (r *RedisCache) GetStats() CacheStats {
+	stats := CacheStats{
+		Backend:      "redis",
+		Hits:         r.hits.Load(),
+		Misses:       r.misses.Load(),
+		NegativeHits: r.negativeHits.Load(),
+		TooLarge:     r.tooLarge.Load(),
+		Windows:      r.windows.snapshot(time.Now()),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if size, err := r.client.DBSize(ctx).Result(); err == nil {
+		stats.Size = int(size)
+	}
+
+	return stats
+}
+
+// Close releases the Redis connection pool
+func (r *RedisCache) Close() error {
+	return r.client.Close()
+}
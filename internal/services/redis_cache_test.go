@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/sptrader/sptrader/internal/config"
+)
+
+// cacheBackend creates a Cache along with a function moving its clock on
+type cacheBackend struct {
+	name string
+	new  func(t *testing.T) (Cache, func(time.Duration))
+}
+
+var cacheBackends = []cacheBackend{
+	{"memory", func(t *testing.T) (Cache, func(time.Duration)) {
+		cache, clock := newClockedCache(config.CacheConfig{MaxSize: 100})
+		return cache, clock.advance
+	}},
+	{"redis", func(t *testing.T) (Cache, func(time.Duration)) {
+		server := miniredis.RunT(t)
+		cache, err := NewRedisCache(config.CacheConfig{RedisURL: "redis://" + server.Addr(), RedisPrefix: "test:"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { cache.Close() })
+		return cache, server.FastForward
+	}},
+}
+
+// cachedKeys returns the keys the typed cache holds, in order
+func cachedKeys(typed *TypedCache[string], keys ...string) []string {
+	var present []string
+	for _, key := range keys {
+		if _, ok := typed.Get(key); ok {
+			present = append(present, key)
+		}
+	}
+	return present
+}
+
+// Both backends honour the Cache contract the services rely on, so the
+// backend can be switched by configuration alone
+func TestCacheContract(t *testing.T) {
+	quietLogs(t)
+	for _, backend := range cacheBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			t.Run("get and set", func(t *testing.T) {
+				cache, _ := backend.new(t)
+				typed := NewTypedCache[string](cache, "contract")
+				if _, ok := typed.Get("a"); ok {
+					t.Fatal("hit on an empty cache")
+				}
+				typed.Set("a", "value", time.Minute)
+				if got, ok := typed.Get("a"); !ok || got != "value" {
+					t.Errorf("Get = %q, %t, want the stored value", got, ok)
+				}
+				typed.Set("a", "replaced", time.Minute)
+				if got, _ := typed.Get("a"); got != "replaced" {
+					t.Errorf("Get after replacing = %q, want replaced", got)
+				}
+
+				if stats := cache.GetStats(); stats.Hits != 2 || stats.Misses != 1 {
+					t.Errorf("%d hits and %d misses, want 2 and 1", stats.Hits, stats.Misses)
+				}
+				cache.ResetStats()
+				if stats := cache.GetStats(); stats.Hits != 0 || stats.Misses != 0 {
+					t.Errorf("%d hits and %d misses after reset, want none", stats.Hits, stats.Misses)
+				}
+			})
+
+			t.Run("ttl", func(t *testing.T) {
+				cache, advance := backend.new(t)
+				typed := NewTypedCache[string](cache, "contract")
+				typed.Set("short", "value", time.Minute)
+				typed.Set("long", "value", time.Hour)
+
+				advance(59 * time.Second)
+				if got := cachedKeys(typed, "short", "long"); !reflect.DeepEqual(got, []string{"short", "long"}) {
+					t.Errorf("cached %v before expiry, want both", got)
+				}
+				advance(2 * time.Second)
+				if got := cachedKeys(typed, "short", "long"); !reflect.DeepEqual(got, []string{"long"}) {
+					t.Errorf("cached %v after a minute, want only the hour-long entry", got)
+				}
+			})
+
+			t.Run("delete", func(t *testing.T) {
+				cache, _ := backend.new(t)
+				typed := NewTypedCache[string](cache, "contract")
+				typed.Set("a", "value", time.Minute)
+				typed.Set("b", "value", time.Minute)
+				typed.Delete("a")
+				typed.Delete("missing")
+				if got := cachedKeys(typed, "a", "b"); !reflect.DeepEqual(got, []string{"b"}) {
+					t.Errorf("cached %v after deleting a, want only b", got)
+				}
+			})
+
+			t.Run("invalidate tag", func(t *testing.T) {
+				cache, _ := backend.new(t)
+				typed := NewTypedCache[string](cache, "contract")
+				typed.Set("eurusd:1h", "value", time.Minute, SymbolTag("EURUSD"), ResolutionTag("1h"))
+				typed.Set("eurusd:1d", "value", time.Minute, SymbolTag("EURUSD"), ResolutionTag("1d"))
+				typed.Set("gbpusd:1h", "value", time.Minute, SymbolTag("GBPUSD"), ResolutionTag("1h"))
+				all := []string{"eurusd:1h", "eurusd:1d", "gbpusd:1h"}
+
+				if n := cache.InvalidateTag(SymbolTag("EURUSD")); n != 2 {
+					t.Errorf("invalidated %d entries, want 2", n)
+				}
+				if got := cachedKeys(typed, all...); !reflect.DeepEqual(got, []string{"gbpusd:1h"}) {
+					t.Errorf("cached %v after invalidating EURUSD, want only gbpusd:1h", got)
+				}
+				if n := cache.InvalidateTag(SymbolTag("EURUSD")); n != 0 {
+					t.Errorf("invalidated %d entries again, want none", n)
+				}
+
+				// Entries stored after an invalidation carry the tag again
+				typed.Set("eurusd:1h", "value", time.Minute, SymbolTag("EURUSD"), ResolutionTag("1h"))
+				if n := cache.InvalidateTag(ResolutionTag("1h")); n != 2 {
+					t.Errorf("invalidated %d 1h entries, want 2", n)
+				}
+				if got := cachedKeys(typed, all...); len(got) != 0 {
+					t.Errorf("cached %v after invalidating 1h, want none", got)
+				}
+			})
+
+			t.Run("invalidate prefix", func(t *testing.T) {
+				cache, _ := backend.new(t)
+				typed := NewTypedCache[string](cache, "contract")
+				typed.Set("eurusd:1h", "value", time.Minute)
+				typed.Set("eurusd:1d", "value", time.Minute)
+				typed.Set("gbpusd:1h", "value", time.Minute)
+
+				if n := cache.InvalidatePrefix("contract:eurusd:"); n != 2 {
+					t.Errorf("invalidated %d entries, want 2", n)
+				}
+				if got := cachedKeys(typed, "eurusd:1h", "eurusd:1d", "gbpusd:1h"); !reflect.DeepEqual(got, []string{"gbpusd:1h"}) {
+					t.Errorf("cached %v after invalidating the prefix, want only gbpusd:1h", got)
+				}
+			})
+
+			t.Run("get or load", func(t *testing.T) {
+				cache, _ := backend.new(t)
+				typed := NewTypedCache[string](cache, "contract")
+				loads := 0
+				load := func(context.Context) (string, error) {
+					loads++
+					return "loaded", nil
+				}
+				for i, wantHit := range []bool{false, true} {
+					value, hit, err := typed.GetOrLoad(context.Background(), "a", time.Minute, load)
+					if err != nil || value != "loaded" || hit != wantHit {
+						t.Errorf("call %d: GetOrLoad = %q, %t, %v, want loaded, hit %t", i, value, hit, err, wantHit)
+					}
+				}
+				if loads != 1 {
+					t.Errorf("loader ran %d times, want once", loads)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// aggregateBar accumulates one aggregated bar
+type aggregateBar struct {
+	candle     models.Candle
+	vwapSum    float64 // VWAP × volume of the candles that have one
+	vwapVolume float64
+	avgSpreads []float64
+	twaSpreads []float64
+}
+
+// aggregateBars aggregates source candles, in time order, into bars stamped with
+// the bucket each candle's timestamp falls in; no candle may straddle a
+// bucket boundary. Tick counts and buy and sell volume add up, leaving delta
+// to be recomputed from them, and VWAP is weighted by each candle's volume.
+// The average spread is the mean of the candles' averages, not weighted by
+// their ticks; the time-weighted spread, weighting each candle equally,
+// stays exact when the candles are of equal length.
+func aggregateBars(source []models.Candle, bucket func(time.Time) time.Time) []models.Candle {
+	var bars []*aggregateBar
+	for _, in := range source {
+		start := bucket(in.Timestamp)
+		if len(bars) == 0 || !bars[len(bars)-1].candle.Timestamp.Equal(start) {
+			bars = append(bars, &aggregateBar{candle: models.Candle{
+				Timestamp: start,
+				Open:      in.Open,
+				High:      in.High,
+				Low:       in.Low,
+			}})
+		}
+
+		bar := bars[len(bars)-1]
+		c := &bar.candle
+		c.High = max(c.High, in.High)
+		c.Low = min(c.Low, in.Low)
+		c.Close = in.Close
+		c.Volume += in.Volume
+		if in.TickCount != nil {
+			c.TickCount = addInt64(c.TickCount, *in.TickCount)
+		}
+		if in.VWAP != nil {
+			bar.vwapSum += *in.VWAP * in.Volume
+			bar.vwapVolume += in.Volume
+		}
+		if in.MinSpread != nil && (c.MinSpread == nil || *in.MinSpread < *c.MinSpread) {
+			c.MinSpread = in.MinSpread
+		}
+		if in.MaxSpread != nil && (c.MaxSpread == nil || *in.MaxSpread > *c.MaxSpread) {
+			c.MaxSpread = in.MaxSpread
+		}
+		if in.AvgSpread != nil {
+			bar.avgSpreads = append(bar.avgSpreads, *in.AvgSpread)
+		}
+		if in.TWASpread != nil {
+			bar.twaSpreads = append(bar.twaSpreads, *in.TWASpread)
+		}
+		if in.BuyVolume != nil {
+			c.BuyVolume = addFloat64(c.BuyVolume, *in.BuyVolume)
+		}
+		if in.SellVolume != nil {
+			c.SellVolume = addFloat64(c.SellVolume, *in.SellVolume)
+		}
+	}
+
+	candles := make([]models.Candle, len(bars))
+	for i, bar := range bars {
+		if bar.vwapVolume > 0 {
+			vwap := bar.vwapSum / bar.vwapVolume
+			bar.candle.VWAP = &vwap
+		}
+		bar.candle.AvgSpread = mean(bar.avgSpreads)
+		bar.candle.TWASpread = mean(bar.twaSpreads)
+		candles[i] = bar.candle
+	}
+	return candles
+}
+
+// addInt64 returns a pointer to the sum of *p, nil counting as 0, and n
+func addInt64(p *int64, n int64) *int64 {
+	if p != nil {
+		n += *p
+	}
+	return &n
+}
+
+// addFloat64 returns a pointer to the sum of *p, nil counting as 0, and v
+func addFloat64(p *float64, v float64) *float64 {
+	if p != nil {
+		v += *p
+	}
+	return &v
+}
+
+// mean returns a pointer to the mean of values, nil when there are none
+func mean(values []float64) *float64 {
+	if len(values) == 0 {
+		return nil
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	m := sum / float64(len(values))
+	return &m
+}
+
+// resampleBars aggregates candles into bars of resolution counted from
+// midnight UTC of origin's day, as SAMPLE BY ALIGN TO CALENDAR counts from
+// the first day it samples; weeks count from the Monday before it
+func resampleBars(candles []models.Candle, resolution string, origin time.Time) ([]models.Candle, error) {
+	bar, err := timeframeDuration(resolution)
+	if err != nil {
+		return nil, err
+	}
+	origin = origin.UTC()
+	day := time.Date(origin.Year(), origin.Month(), origin.Day(), 0, 0, 0, 0, time.UTC)
+	if bar == 7*24*time.Hour {
+		day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return aggregateBars(candles, func(t time.Time) time.Time {
+		return day.Add(t.Sub(day) / bar * bar)
+	}), nil
+}
+
+// resampleSource returns the configured resolution an unconfigured one is
+// resampled from: the coarsest pre-aggregated resolution whose bars divide
+// it evenly. It returns false for configured resolutions and those without
+// a source, which are sampled from ticks.
+func (v *ViewportService) resampleSource(resolution string) (string, bool) {
+	resolutions := v.dataConfig().Resolutions
+	if _, ok := resolutions[resolution]; ok {
+		return "", false
+	}
+	length, err := timeframeDuration(resolution)
+	if err != nil {
+		return "", false
+	}
+
+	var source string
+	var sourceLength time.Duration
+	for name, cfg := range resolutions {
+		l, err := timeframeDuration(name)
+		if err != nil || !isPreAggregated(cfg.Table) || l >= length || length%l != 0 {
+			continue
+		}
+		if l > sourceLength {
+			source, sourceLength = name, l
+		}
+	}
+	return source, source != ""
+}
+
+// customResolution returns the settings of a timeframe no resolution is
+// configured for: its resample source's table, or ticks, and the request
+// point limit. Sampling from ticks is limited to ranges of
+// tickAggregationMaxRange.
+func (v *ViewportService) customResolution(tf Timeframe, start, end time.Time) (config.ResolutionConfig, error) {
+	cfg := config.ResolutionConfig{
+		Table:       tickTable,
+		MaxPoints:   v.dataConfig().MaxPointsPerRequest,
+		Description: fmt.Sprintf("custom %s bars sampled from ticks", tf),
+	}
+	if source, ok := v.resampleSource(tf.String()); ok {
+		cfg.Table = v.dataConfig().Resolutions[source].Table
+		cfg.Description = fmt.Sprintf("custom %s bars resampled from %s", tf, source)
+		return cfg, nil
+	}
+	if end.Sub(start) > tickAggregationMaxRange {
+		return cfg, fmt.Errorf("%w: timeframe %s has no pre-aggregated source and is limited to ranges of %s", ErrRangeTooLarge, tf, tickAggregationMaxRange)
+	}
+	return cfg, nil
+}
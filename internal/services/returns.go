@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/analytics"
+	"github.com/sptrader/sptrader/internal/market"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// Days a year's bars are spread over: forex trades on weekdays, crypto every
+// day
+const (
+	forexDaysPerYear  = 252
+	cryptoDaysPerYear = 365
+)
+
+// GetReturns returns the per-bar returns of the symbol's candles, fetched
+// and cached as /candles does, and their statistics. When the candles stop
+// short of the range end, the next URL starts at the last candle so its
+// close is the base of the next page's first return.
+func (v *ViewportService) GetReturns(ctx context.Context, req models.ReturnsRequest, kind string) (*models.ReturnsResponse, error) {
+	start := time.Now()
+	candles, err := v.GetSmartCandles(ctx, models.CandleRequest{
+		Symbol:    req.Symbol,
+		Timeframe: req.Timeframe,
+		Start:     req.Start,
+		End:       req.End,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(candles.Candles) < 2 {
+		return nil, fmt.Errorf("%w: returns need at least 2 candles, %s has %d between %s and %s",
+			ErrInsufficientData, req.Symbol, len(candles.Candles), req.Start.Format(time.RFC3339), req.End.Format(time.RFC3339))
+	}
+
+	closes := make([]float64, len(candles.Candles))
+	for i, c := range candles.Candles {
+		closes[i] = c.Close
+	}
+	returns, err := analytics.Returns(closes, kind)
+	if err != nil {
+		return nil, err
+	}
+	perYear, err := barsPerYear(req.Symbol, candles.Resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]models.ReturnPoint, len(returns))
+	for i, r := range returns {
+		points[i] = models.ReturnPoint{Timestamp: candles.Candles[i+1].Timestamp, Return: r}
+	}
+
+	metadata := candles.Metadata
+	metadata.QueryTimeMs = time.Since(start).Milliseconds()
+	metadata.PointsReturned = len(points)
+	metadata.NextURL = ""
+	if !metadata.DataComplete {
+		last := candles.Candles[len(candles.Candles)-1].Timestamp
+		metadata.NextURL = fmt.Sprintf(
+			"/api/v1/returns?symbol=%s&start=%s&end=%s&tf=%s&type=%s",
+			req.Symbol,
+			last.Format(time.RFC3339),
+			req.End.Format(time.RFC3339),
+			candles.Resolution,
+			kind,
+		)
+	}
+
+	return &models.ReturnsResponse{
+		Symbol:     req.Symbol,
+		Resolution: candles.Resolution,
+		Type:       kind,
+		Start:      req.Start,
+		End:        req.End,
+		Count:      len(points),
+		Returns:    points,
+		Stats:      analytics.Summarize(closes, returns, perYear),
+		Metadata:   metadata,
+	}, nil
+}
+
+// barsPerYear returns how many bars of resolution a year of the symbol's
+// trading holds
+func barsPerYear(symbol, resolution string) (float64, error) {
+	if resolution == "1w" {
+		return 52, nil
+	}
+	bar, err := timeframeDuration(resolution)
+	if err != nil {
+		return 0, err
+	}
+	days := forexDaysPerYear
+	if market.ClassOf(symbol) == market.Crypto {
+		days = cryptoDaysPerYear
+	}
+	return float64(time.Duration(days)*24*time.Hour) / float64(bar), nil
+}
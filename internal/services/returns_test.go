@@ -0,0 +1,32 @@
+package services
+
+import "testing"
+
+func TestBarsPerYear(t *testing.T) {
+	tests := []struct {
+		symbol, resolution string
+		want               float64
+	}{
+		{"EURUSD", "1d", 252},
+		{"EURUSD", "1h", 252 * 24},
+		{"EURUSD", "15m", 252 * 24 * 4},
+		{"EURUSD", "1w", 52},
+		{"BTCUSD", "1d", 365},
+		{"BTCUSD", "1h", 365 * 24},
+		{"BTCUSD", "1w", 52},
+	}
+	for _, tt := range tests {
+		got, err := barsPerYear(tt.symbol, tt.resolution)
+		if err != nil {
+			t.Errorf("barsPerYear(%s, %s): %v", tt.symbol, tt.resolution, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("barsPerYear(%s, %s) = %g, want %g", tt.symbol, tt.resolution, got, tt.want)
+		}
+	}
+
+	if _, err := barsPerYear("EURUSD", "tick"); err == nil {
+		t.Error("barsPerYear accepted a resolution without a bar length")
+	}
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"time"
+	_ "time/tzdata" // ny_close days must not depend on the host having zoneinfo
+
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// nyCloseHour is the hour of the New York forex close that ny_close days
+// start at
+const nyCloseHour = 17
+
+// newYork is the zone ny_close days are bounded in
+var newYork = mustLoadLocation("America/New_York")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// Alignable reports whether alignment applies to a resolution
+func Alignable(resolution string) bool {
+	return resolution == "1d" || resolution == "1w"
+}
+
+// alignments returns the alignments a resolution offers, the default first
+func alignments(resolution string) []string {
+	if !Alignable(resolution) {
+		return nil
+	}
+	return []string{models.AlignUTC, models.AlignNYClose}
+}
+
+// sessionStart returns the start of the ny_close day, or for 1w week, holding
+// t: the latest 17:00 New York at or before it, for weeks the one on Sunday
+// when the forex week opens. The boundary is 21:00 UTC under daylight saving
+// and 22:00 UTC otherwise, and the days it changes on are 23 and 25 hours
+// long, so it is computed in New York time rather than at a UTC offset.
+func sessionStart(t time.Time, resolution string) time.Time {
+	local := t.In(newYork)
+	day := local.Day()
+	if local.Hour() < nyCloseHour {
+		day--
+	}
+	start := time.Date(local.Year(), local.Month(), day, nyCloseHour, 0, 0, 0, newYork)
+	if resolution == "1w" {
+		start = time.Date(start.Year(), start.Month(), start.Day()-int(start.Weekday()), nyCloseHour, 0, 0, 0, newYork)
+	}
+	return start.UTC()
+}
+
+// nextSessionStart returns the start of the ny_close day or week after the
+// one starting at start. Days are at most 25 hours and weeks 7 days and an
+// hour, so one more than that is always in the next.
+func nextSessionStart(start time.Time, resolution string) time.Time {
+	span := 25 * time.Hour
+	if resolution == "1w" {
+		span = 8 * 24 * time.Hour
+	}
+	return sessionStart(start.Add(span), resolution)
+}
+
+// alignSessions aggregates hourly candles, in time order, into ny_close days
+// or weeks stamped with their start. Hourly bars never straddle a boundary,
+// which always falls on a UTC hour.
+func alignSessions(hourly []models.Candle, resolution string) []models.Candle {
+	return aggregateBars(hourly, func(t time.Time) time.Time {
+		return sessionStart(t, resolution)
+	})
+}
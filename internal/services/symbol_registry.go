@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/db"
+)
+
+// symbolRefreshTimeout bounds one read of the symbols in the database
+const symbolRefreshTimeout = 30 * time.Second
+
+// maxSymbolSuggestions caps the close matches offered for an unknown symbol
+const maxSymbolSuggestions = 5
+
+// UnknownSymbolError is returned for a symbol the registry doesn't know,
+// with the known symbols closest to it
+type UnknownSymbolError struct {
+	Symbol      string
+	Suggestions []string
+}
+
+func (e *UnknownSymbolError) Error() string {
+	if len(e.Suggestions) == 0 {
+		return fmt.Sprintf("unknown symbol %q", e.Symbol)
+	}
+	return fmt.Sprintf("unknown symbol %q, did you mean %s?", e.Symbol, strings.Join(e.Suggestions, ", "))
+}
+
+// SymbolRegistry knows the symbols requests may name: the configured list,
+// or those with ticks in the database, re-read periodically. Until the
+// first discovery succeeds every symbol is allowed, so a database that is
+// down at startup doesn't turn into rejected requests once it is back.
+type SymbolRegistry struct {
+	pool   *db.Pool
+	config config.SymbolsConfig
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	status SymbolRegistryStatus
+	known  map[string]bool
+}
+
+// SymbolRegistryStatus reports where the known symbols came from and when
+type SymbolRegistryStatus struct {
+	Discover    bool      `json:"discover"`
+	Loaded      bool      `json:"loaded"` // false until discovery first succeeds
+	Count       int       `json:"count"`
+	Symbols     []string  `json:"symbols"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// NewSymbolRegistry creates a registry of the symbols cfg allows. Listed
+// symbols are known at once; discovered ones after Refresh.
+func NewSymbolRegistry(pool *db.Pool, cfg config.SymbolsConfig) *SymbolRegistry {
+	r := &SymbolRegistry{
+		pool:   pool,
+		config: cfg,
+		stop:   make(chan struct{}),
+		status: SymbolRegistryStatus{Discover: cfg.Discover, Symbols: make([]string, 0)},
+	}
+	if !cfg.Discover {
+		r.set(cfg.List)
+	}
+	return r
+}
+
+// Start discovers the symbols now and then every refresh interval. It does
+// nothing for a configured list.
+func (r *SymbolRegistry) Start() {
+	if !r.config.Discover {
+		log.Info().Int("symbols", len(r.config.List)).Msg("Symbol allowlist configured")
+		return
+	}
+
+	if _, err := r.Refresh(context.Background()); err != nil {
+		log.Warn().Err(err).Msg("Symbol discovery failed, allowing any symbol until it succeeds")
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if _, err := r.Refresh(context.Background()); err != nil {
+					log.Warn().Err(err).Msg("Symbol discovery failed, keeping the known symbols")
+				}
+			}
+		}
+	}()
+}
+
+// Stop halts periodic discovery
+func (r *SymbolRegistry) Stop() {
+	select {
+	case <-r.stop:
+		return
+	default:
+		close(r.stop)
+	}
+	r.wg.Wait()
+}
+
+// Refresh re-reads the symbols in the database when discovering. A failed
+// read keeps the symbols known before it.
+func (r *SymbolRegistry) Refresh(ctx context.Context) (SymbolRegistryStatus, error) {
+	if !r.config.Discover {
+		return r.GetStatus(), nil
+	}
+
+	symbols, err := r.discover(ctx)
+	if err != nil {
+		r.mu.Lock()
+		r.status.LastError = err.Error()
+		r.mu.Unlock()
+		return r.GetStatus(), err
+	}
+	r.set(symbols)
+	log.Info().Int("symbols", len(symbols)).Msg("Symbols discovered")
+	return r.GetStatus(), nil
+}
+
+// discover reads the distinct symbols with ticks
+func (r *SymbolRegistry) discover(ctx context.Context) ([]string, error) {
+	ctx = db.WithQueryLabel(ctx, db.QuerySymbols, "market_data_v2")
+	rows, err := r.pool.QueryWithTimeout(ctx, symbolRefreshTimeout, "SELECT DISTINCT symbol FROM market_data_v2")
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover symbols: %w", err)
+	}
+	defer rows.Close()
+
+	var symbols []string
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			return nil, fmt.Errorf("failed to scan symbol: %w", err)
+		}
+		symbols = append(symbols, symbol)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating symbols: %w", err)
+	}
+	return symbols, nil
+}
+
+// set replaces the known symbols
+func (r *SymbolRegistry) set(symbols []string) {
+	known := make(map[string]bool, len(symbols))
+	sorted := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		if symbol != "" && !known[symbol] {
+			known[symbol] = true
+			sorted = append(sorted, symbol)
+		}
+	}
+	sort.Strings(sorted)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.known = known
+	r.status.Loaded = true
+	r.status.Count = len(sorted)
+	r.status.Symbols = sorted
+	r.status.RefreshedAt = time.Now().UTC()
+	r.status.LastError = ""
+}
+
+// GetStatus returns a snapshot of the registry
+func (r *SymbolRegistry) GetStatus() SymbolRegistryStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.status
+}
+
+// Discovering reports whether the symbols come from the database, in which
+// case a symbol not fetched yet is unknown until the next refresh
+func (r *SymbolRegistry) Discovering() bool {
+	return r.config.Discover
+}
+
+// Check returns an *UnknownSymbolError for a symbol that isn't known
+func (r *SymbolRegistry) Check(symbol string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.status.Loaded || r.known[symbol] {
+		return nil
+	}
+	return &UnknownSymbolError{Symbol: symbol, Suggestions: suggestSymbols(symbol, r.status.Symbols)}
+}
+
+// Search returns the known symbols containing query, ignoring case, or all
+// of them for an empty query. ok is false while no symbols are loaded.
+func (r *SymbolRegistry) Search(query string) (symbols []string, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.status.Loaded {
+		return nil, false
+	}
+
+	query = strings.ToUpper(query)
+	symbols = make([]string, 0)
+	for _, symbol := range r.status.Symbols {
+		if strings.Contains(strings.ToUpper(symbol), query) {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols, true
+}
+
+// suggestSymbols returns the known symbols sharing a prefix with symbol or
+// within two edits of it, ignoring case, nearest first
+func suggestSymbols(symbol string, known []string) []string {
+	type candidate struct {
+		symbol   string
+		distance int
+	}
+
+	target := strings.ToUpper(symbol)
+	var candidates []candidate
+	for _, k := range known {
+		upper := strings.ToUpper(k)
+		distance := levenshtein(target, upper)
+		if distance <= 2 || (len(target) >= 3 && strings.HasPrefix(upper, target)) {
+			candidates = append(candidates, candidate{symbol: k, distance: distance})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	suggestions := make([]string, 0, maxSymbolSuggestions)
+	for _, c := range candidates {
+		if len(suggestions) == maxSymbolSuggestions {
+			break
+		}
+		suggestions = append(suggestions, c.symbol)
+	}
+	return suggestions
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// tableStatsWorkers bounds how many stat queries run at once
+const tableStatsWorkers = 4
+
+// KnownTables returns the tick table followed by every OHLC table
+func KnownTables() []string {
+	tables := []string{"market_data_v2"}
+	for _, tf := range ohlcTimeframes {
+		tables = append(tables, fmt.Sprintf("ohlc_%s_v2", tf))
+	}
+	return tables
+}
+
+// GetAllTableStats collects statistics for every known table concurrently.
+// Missing tables are reported with Exists false; per-table query failures are
+// recorded on the entry rather than failing the whole call.
+func (s *DataService) GetAllTableStats(ctx context.Context, bySymbol bool) (map[string]models.TableStats, error) {
+	tables := KnownTables()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]models.TableStats, len(tables))
+	jobs := make(chan string)
+
+	for i := 0; i < tableStatsWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for table := range jobs {
+				stats := s.collectTableStats(ctx, table, bySymbol)
+				mu.Lock()
+				results[table] = stats
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, table := range tables {
+		select {
+		case jobs <- table:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("table stats cancelled: %w", queryError(err))
+	}
+
+	return results, nil
+}
+
+// collectTableStats gathers statistics for a single table
+func (s *DataService) collectTableStats(ctx context.Context, table string, bySymbol bool) models.TableStats {
+	ctx = db.WithQueryLabel(ctx, db.QueryTableStats, table)
+
+	stats := models.TableStats{Table: table}
+
+	if err := s.CheckTableExists(ctx, table); err != nil {
+		if !errors.Is(err, ErrTableNotFound) {
+			stats.Error = err.Error()
+		}
+		return stats
+	}
+	stats.Exists = true
+
+	query := fmt.Sprintf(`
+		SELECT 
+			count(*) as row_count,
+			min(timestamp) as first_timestamp,
+			max(timestamp) as last_timestamp
+		FROM %s
+	`, table)
+
+	if err := s.pool.QueryRowWithTimeout(ctx, s.pool.ScanTimeout(), query).Scan(&stats.RowCount, &stats.FirstTimestamp, &stats.LastTimestamp); err != nil {
+		stats.Error = fmt.Sprintf("failed to get table stats: %v", err)
+		return stats
+	}
+
+	if !bySymbol {
+		return stats
+	}
+
+	symbolQuery := fmt.Sprintf(`
+		SELECT 
+			symbol,
+			count(*) as row_count,
+			min(timestamp) as first_timestamp,
+			max(timestamp) as last_timestamp
+		FROM %s
+		GROUP BY symbol
+		ORDER BY symbol
+	`, table)
+
+	rows, err := s.pool.QueryWithTimeout(ctx, s.pool.ScanTimeout(), symbolQuery)
+	if err != nil {
+		stats.Error = fmt.Sprintf("failed to get symbol stats: %v", err)
+		return stats
+	}
+	defer rows.Close()
+
+	stats.Symbols = make(map[string]models.SymbolStats)
+	for rows.Next() {
+		var symbol string
+		var sym models.SymbolStats
+		if err := rows.Scan(&symbol, &sym.RowCount, &sym.FirstTimestamp, &sym.LastTimestamp); err != nil {
+			stats.Error = fmt.Sprintf("failed to scan symbol stats: %v", err)
+			return stats
+		}
+		stats.Symbols[symbol] = sym
+	}
+	if err := rows.Err(); err != nil {
+		stats.Error = fmt.Sprintf("error iterating symbol stats: %v", err)
+	}
+
+	return stats
+}
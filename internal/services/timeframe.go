@@ -0,0 +1,109 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Timeframe is a bar length: N minutes, hours or days, one of the second
+// timeframes sampled from ticks, or 1w
+type Timeframe struct {
+	N    int
+	Unit string // "s", "m", "h", "d" or "w"
+}
+
+// timeframeUnits are the units of N×unit timeframes, with the largest N each
+// allows: up to a day of minutes, a week of hours and a month of days
+var timeframeUnits = map[string]struct {
+	length time.Duration
+	maxN   int
+}{
+	"m": {time.Minute, 24 * 60},
+	"h": {time.Hour, 7 * 24},
+	"d": {24 * time.Hour, 31},
+}
+
+// ParseTimeframe parses a timeframe such as 2h or 90m into its canonical
+// form, in the largest unit that divides it evenly, so 120m is 2h and 24h
+// is 1d. Second timeframes are those in subMinuteMaxRange, and weeks only 1w.
+func ParseTimeframe(timeframe string) (Timeframe, error) {
+	if len(timeframe) < 2 {
+		return Timeframe{}, fmt.Errorf("invalid timeframe %q, want N followed by m, h or d", timeframe)
+	}
+	digits, unit := timeframe[:len(timeframe)-1], timeframe[len(timeframe)-1:]
+	n, err := strconv.Atoi(digits)
+	if err != nil || n <= 0 || strconv.Itoa(n) != digits {
+		return Timeframe{}, fmt.Errorf("invalid timeframe %q, want a positive whole number of m, h or d", timeframe)
+	}
+
+	switch unit {
+	case "s":
+		if _, ok := subMinuteMaxRange[timeframe]; !ok {
+			return Timeframe{}, fmt.Errorf("unsupported timeframe %q, second timeframes are 1s, 5s, 15s and 30s", timeframe)
+		}
+		return Timeframe{N: n, Unit: unit}, nil
+	case "w":
+		if n != 1 {
+			return Timeframe{}, fmt.Errorf("unsupported timeframe %q, the only week timeframe is 1w", timeframe)
+		}
+		return Timeframe{N: n, Unit: unit}, nil
+	}
+
+	u, ok := timeframeUnits[unit]
+	if !ok {
+		return Timeframe{}, fmt.Errorf("invalid timeframe %q, want N followed by m, h or d", timeframe)
+	}
+	if n > u.maxN {
+		return Timeframe{}, fmt.Errorf("timeframe %q is too long, at most %d%s", timeframe, u.maxN, unit)
+	}
+	return canonicalTimeframe(time.Duration(n) * u.length), nil
+}
+
+// canonicalTimeframe expresses a whole number of minutes in the largest of
+// days, hours and minutes that divides it
+func canonicalTimeframe(d time.Duration) Timeframe {
+	for _, unit := range []string{"d", "h", "m"} {
+		if length := timeframeUnits[unit].length; d%length == 0 {
+			return Timeframe{N: int(d / length), Unit: unit}
+		}
+	}
+	return Timeframe{N: int(d / time.Minute), Unit: "m"}
+}
+
+// String returns the timeframe as requested and as QuestDB's SAMPLE BY takes
+// it, e.g. 2h
+func (t Timeframe) String() string {
+	return strconv.Itoa(t.N) + t.Unit
+}
+
+// Duration returns the length of the timeframe's bars
+func (t Timeframe) Duration() time.Duration {
+	switch t.Unit {
+	case "s":
+		return time.Duration(t.N) * time.Second
+	case "w":
+		return time.Duration(t.N) * 7 * 24 * time.Hour
+	default:
+		return time.Duration(t.N) * timeframeUnits[t.Unit].length
+	}
+}
+
+// sampleInterval returns the SAMPLE BY interval of a timeframe, or "" when
+// it isn't one, in which case ticks are returned unaggregated
+func sampleInterval(timeframe string) string {
+	tf, err := ParseTimeframe(timeframe)
+	if err != nil {
+		return ""
+	}
+	return tf.String()
+}
+
+// timeframeDuration converts a timeframe string to its bucket length
+func timeframeDuration(timeframe string) (time.Duration, error) {
+	tf, err := ParseTimeframe(timeframe)
+	if err != nil {
+		return 0, err
+	}
+	return tf.Duration(), nil
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseTimeframe(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     string
+		duration time.Duration
+	}{
+		{"1m", "1m", time.Minute},
+		{"5m", "5m", 5 * time.Minute},
+		{"90m", "90m", 90 * time.Minute},
+		// Canonical in the largest unit that divides it evenly
+		{"60m", "1h", time.Hour},
+		{"120m", "2h", 2 * time.Hour},
+		{"1440m", "1d", 24 * time.Hour},
+		{"4h", "4h", 4 * time.Hour},
+		{"24h", "1d", 24 * time.Hour},
+		{"36h", "36h", 36 * time.Hour},
+		{"168h", "7d", 7 * 24 * time.Hour},
+		{"1d", "1d", 24 * time.Hour},
+		{"31d", "31d", 31 * 24 * time.Hour},
+		{"1s", "1s", time.Second},
+		{"5s", "5s", 5 * time.Second},
+		{"15s", "15s", 15 * time.Second},
+		{"30s", "30s", 30 * time.Second},
+		{"1w", "1w", 7 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		tf, err := ParseTimeframe(tt.in)
+		if err != nil {
+			t.Errorf("ParseTimeframe(%q): %v", tt.in, err)
+			continue
+		}
+		if tf.String() != tt.want || tf.Duration() != tt.duration {
+			t.Errorf("ParseTimeframe(%q) = %s of %s, want %s of %s", tt.in, tf, tf.Duration(), tt.want, tt.duration)
+		}
+	}
+}
+
+func TestParseTimeframeRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		// Out of bounds
+		{"zero", "0m"},
+		{"negative", "-5m"},
+		{"over a day of minutes", "1441m"},
+		{"over a week of hours", "169h"},
+		{"over a month of days", "32d"},
+		{"unsupported seconds", "10s"},
+		{"more than a minute of seconds", "60s"},
+		{"several weeks", "2w"},
+		{"overflowing", "99999999999999999999m"},
+		// Malformed
+		{"empty", ""},
+		{"unit only", "m"},
+		{"number only", "15"},
+		{"unknown unit", "1y"},
+		{"upper case unit", "1H"},
+		{"leading zero", "05m"},
+		{"plus sign", "+5m"},
+		{"fraction", "1.5h"},
+		{"spaces", " 1h"},
+		{"unit first", "h1"},
+		{"two units", "1h30m"},
+		{"word", "tick"},
+	}
+	for _, tt := range tests {
+		if tf, err := ParseTimeframe(tt.in); err == nil {
+			t.Errorf("%s: ParseTimeframe(%q) = %s, want an error", tt.name, tt.in, tf)
+		}
+	}
+}
+
+func TestTimeframeHelpers(t *testing.T) {
+	for _, tf := range []string{"1s", "5s", "15s", "30s"} {
+		if got := sampleInterval(tf); got != tf {
+			t.Errorf("sampleInterval(%s) = %q, want %s", tf, got, tf)
+		}
+	}
+	if got := sampleInterval("120m"); got != "2h" {
+		t.Errorf("sampleInterval(120m) = %q, want 2h", got)
+	}
+	if got := sampleInterval("tick"); got != "" {
+		t.Errorf("sampleInterval(tick) = %q, want none", got)
+	}
+	if d, err := timeframeDuration("15s"); err != nil || d != 15*time.Second {
+		t.Errorf("timeframeDuration(15s) = %s, %v, want 15s", d, err)
+	}
+	if d, err := timeframeDuration("15m"); err != nil || d != 15*time.Minute {
+		t.Errorf("timeframeDuration(15m) = %s, %v, want 15m", d, err)
+	}
+	if _, err := timeframeDuration("15"); err == nil {
+		t.Error("timeframeDuration(15) succeeded")
+	}
+}
+
+func TestCheckTimeframeRange(t *testing.T) {
+	start := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		timeframe string
+		span      time.Duration
+		ok        bool
+	}{
+		{"1s", 2 * time.Hour, true},
+		{"1s", 2*time.Hour + time.Second, false},
+		{"5s", 6 * time.Hour, true},
+		{"5s", 6*time.Hour + time.Second, false},
+		{"15s", 12 * time.Hour, true},
+		{"15s", 12*time.Hour + time.Second, false},
+		{"30s", 24 * time.Hour, true},
+		{"30s", 24*time.Hour + time.Second, false},
+		// Minute and longer timeframes are bounded by their resolution's
+		// MaxRange instead
+		{"1m", 365 * 24 * time.Hour, true},
+		{"1h", 365 * 24 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		err := CheckTimeframeRange(tt.timeframe, start, start.Add(tt.span))
+		if tt.ok && err != nil {
+			t.Errorf("%s over %s: %v, want it allowed", tt.timeframe, tt.span, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrRangeTooLarge) {
+			t.Errorf("%s over %s: err = %v, want ErrRangeTooLarge", tt.timeframe, tt.span, err)
+		}
+	}
+}
+
+// Every second timeframe the parser accepts has a range guard, and the
+// reverse
+func TestSubMinuteTimeframesGuarded(t *testing.T) {
+	for _, seconds := range []int{1, 2, 5, 10, 15, 20, 30, 45} {
+		in := fmt.Sprintf("%ds", seconds)
+		_, err := ParseTimeframe(in)
+		_, guarded := subMinuteMaxRange[in]
+		if (err == nil) != guarded {
+			t.Errorf("%s: parses %t, guarded %t, want both or neither", in, err == nil, guarded)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sptrader/sptrader/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TypedCache is a type-safe view over a Cache. Keys are namespaced so values
+// of different types can't collide, and values read back with the wrong type
+// are treated as misses rather than panicking. Raw JSON from serializing
+// backends is decoded into T.
+type TypedCache[T any] struct {
+	cache     Cache
+	namespace string
+}
+
+// NewTypedCache creates a typed view over cache for one value type
+func NewTypedCache[T any](cache Cache, namespace string) *TypedCache[T] {
+	return &TypedCache[T]{cache: cache, namespace: namespace}
+}
+
+// key prefixes a key with the cache's namespace
+func (t *TypedCache[T]) key(key string) string {
+	return t.namespace + ":" + key
+}
+
+// Get retrieves a value of type T
+func (t *TypedCache[T]) Get(key string) (T, bool) {
+	var zero T
+
+	data, found := t.cache.Get(t.key(key))
+	if !found {
+		return zero, false
+	}
+
+	value, ok := t.decode(data)
+	if !ok {
+		log.Warn().
+			Str("namespace", t.namespace).
+			Str("type", fmt.Sprintf("%T", data)).
+			Msg("Cached value has unexpected type, dropping it")
+		t.cache.Delete(t.key(key))
+		return zero, false
+	}
+
+	return value, true
+}
+
+// Set stores a value of type T
+func (t *TypedCache[T]) Set(key string, value T, ttl time.Duration, tags ...string) {
+	t.cache.Set(t.key(key), value, ttl, tags...)
+}
+
+// Delete removes a value
+func (t *TypedCache[T]) Delete(key string) {
+	t.cache.Delete(t.key(key))
+}
+
+// GetOrLoad returns the cached value or loads it with stampede protection.
+// The loader's context carries the load's span. A wrongly typed entry is
+// dropped and loaded again. It reports whether this caller's lookup hit:
+// callers that waited on another's load did not.
+func (t *TypedCache[T]) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error), tags ...string) (T, bool, error) {
+	var zero T
+
+	getCtx, getSpan := tracing.Start(ctx, "cache.get", attribute.String("cache.namespace", t.namespace))
+	defer getSpan.End()
+	load := func() (interface{}, error) {
+		loadCtx, loadSpan := tracing.Start(getCtx, "cache.load", attribute.String("cache.namespace", t.namespace))
+		value, err := loader(loadCtx)
+		tracing.End(loadSpan, err)
+		return value, err
+	}
+
+	// The underlying cache counts the lookup, so there's no separate Get
+	// here that would count a second miss
+	data, hit, err := t.cache.GetOrLoad(getCtx, t.key(key), ttl, load, tags...)
+	if err != nil {
+		return zero, false, err
+	}
+	value, ok := t.decode(data)
+	if !ok {
+		log.Warn().
+			Str("namespace", t.namespace).
+			Str("type", fmt.Sprintf("%T", data)).
+			Msg("Cached value has unexpected type, reloading it")
+		t.cache.Delete(t.key(key))
+		if data, hit, err = t.cache.GetOrLoad(getCtx, t.key(key), ttl, load, tags...); err != nil {
+			return zero, false, err
+		}
+		if value, ok = t.decode(data); !ok {
+			return zero, false, fmt.Errorf("cache %s: unexpected value type %T", t.namespace, data)
+		}
+	}
+	getSpan.SetAttributes(attribute.Bool("cache.hit", hit))
+
+	return value, hit, nil
+}
+
+// decode converts a cached value to T, unmarshaling raw JSON if needed
+func (t *TypedCache[T]) decode(data interface{}) (T, bool) {
+	if value, ok := data.(T); ok {
+		return value, true
+	}
+
+	var value T
+	raw, ok := data.([]byte)
+	if !ok {
+		return value, false
+	}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return value, false
+	}
+	return value, true
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/config"
+)
+
+func newTestCache(staleGrace time.Duration) *CacheService {
+	return NewCacheService(config.CacheConfig{MaxSize: 100, MaxBytes: 1 << 20, StaleGrace: staleGrace})
+}
+
+func TestTypedCacheGetOrLoadCountsOneLookup(t *testing.T) {
+	for _, grace := range []time.Duration{0, time.Minute} {
+		cache := newTestCache(grace)
+		typed := NewTypedCache[string](cache, "test")
+		load := func(context.Context) (string, error) { return "loaded", nil }
+
+		value, hit, err := typed.GetOrLoad(context.Background(), "key", time.Minute, load)
+		if err != nil || value != "loaded" || hit {
+			t.Fatalf("grace %s: cold GetOrLoad = %q, %v, %v, want the loaded value and a miss", grace, value, hit, err)
+		}
+		if stats := cache.GetStats(); stats.Hits != 0 || stats.Misses != 1 {
+			t.Errorf("grace %s: cold GetOrLoad recorded %d hits and %d misses, want 0 and 1", grace, stats.Hits, stats.Misses)
+		}
+
+		if _, hit, err := typed.GetOrLoad(context.Background(), "key", time.Minute, load); err != nil || !hit {
+			t.Fatalf("grace %s: warm GetOrLoad = %v, %v, want a hit", grace, hit, err)
+		}
+		if stats := cache.GetStats(); stats.Hits != 1 || stats.Misses != 1 {
+			t.Errorf("grace %s: warm GetOrLoad left %d hits and %d misses, want 1 and 1", grace, stats.Hits, stats.Misses)
+		}
+	}
+}
+
+func TestTypedCacheGetOrLoadReplacesWronglyTypedEntry(t *testing.T) {
+	cache := newTestCache(0)
+	typed := NewTypedCache[string](cache, "test")
+	cache.Set(typed.key("key"), 42, time.Minute)
+
+	loads := 0
+	value, hit, err := typed.GetOrLoad(context.Background(), "key", time.Minute, func(context.Context) (string, error) {
+		loads++
+		return "loaded", nil
+	})
+	if err != nil || value != "loaded" || hit {
+		t.Fatalf("GetOrLoad = %q, %v, %v, want the loaded value and a miss", value, hit, err)
+	}
+	if loads != 1 {
+		t.Errorf("loader ran %d times, want 1", loads)
+	}
+	if cached, ok := typed.Get("key"); !ok || cached != "loaded" {
+		t.Errorf("Get after reload = %q, %v, want the loaded value", cached, ok)
+	}
+}
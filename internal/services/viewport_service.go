@@ -2,78 +2,150 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/sptrader/sptrader/internal/config"
 	"github.com/sptrader/sptrader/internal/db"
+	"github.com/sptrader/sptrader/internal/market"
 	"github.com/sptrader/sptrader/internal/models"
 )
 
+// tickTable is the raw tick table every resolution can be aggregated from
+const tickTable = "market_data_v2"
+
+// candleLoadTimeout bounds a cache-filling candle load
+const candleLoadTimeout = 30 * time.Second
+
 // ViewportService manages intelligent data loading based on viewport
 type ViewportService struct {
 	pool     *db.Pool
-	cache    *CacheService
-	config   config.DataConfig
+	cache    Cache
+	candles  *TypedCache[*models.CandleResponse]
+	config   atomic.Pointer[config.DataConfig] // replaced whole by SetDataConfig
+	tiers    atomic.Pointer[config.TTLTiers]   // candle cache TTLs by data age
+	calendar *market.Calendar                  // closed periods continuous series skip
+
+	// load is loadCandles, replaceable in tests
+	load func(ctx context.Context, req models.CandleRequest, resolution string, resConfig config.ResolutionConfig, extras models.CandleExtras, sessions models.SessionFilter, alignment string, start time.Time) (*models.CandleResponse, error)
+
+	verifyMu     sync.Mutex
+	verification *TableVerification // latest VerifyTables report
 }
 
-// NewViewportService creates a new viewport service
-func NewViewportService(pool *db.Pool, cache *CacheService) *ViewportService {
-	// Load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to load config, using defaults")
-		// Use default configuration as fallback
-		cfg = &config.Config{
-			Data: config.DataConfig{
-				MaxPointsPerRequest: 10000,
-				Resolutions: map[string]config.ResolutionConfig{
-					"1m": {
-						Table:       "market_data_v2",
-						MinRange:    1 * time.Hour,
-						MaxRange:    24 * time.Hour,
-						MaxPoints:   1440,
-						Description: "1-minute bars for intraday",
-					},
-					"5m": {
-						Table:       "market_data_v2", 
-						MinRange:    4 * time.Hour,
-						MaxRange:    7 * 24 * time.Hour,
-						MaxPoints:   2016,
-						Description: "5-minute bars",
-					},
-					"1h": {
-						Table:       "market_data_v2",
-						MinRange:    24 * time.Hour,
-						MaxRange:    90 * 24 * time.Hour,
-						MaxPoints:   2160,
-						Description: "Hourly bars",
-					},
-					"4h": {
-						Table:       "market_data_v2",
-						MinRange:    7 * 24 * time.Hour,
-						MaxRange:    365 * 24 * time.Hour,
-						MaxPoints:   2190,
-						Description: "4-hour bars",
-					},
-					"1d": {
-						Table:       "market_data_v2",
-						MinRange:    30 * 24 * time.Hour,
-						MaxRange:    5 * 365 * 24 * time.Hour,
-						MaxPoints:   1825,
-						Description: "Daily bars",
-					},
-				},
-			},
+// NewViewportService creates a new viewport service caching candles for the
+// TTLs of tiers
+func NewViewportService(pool *db.Pool, cache Cache, cfg config.DataConfig, tiers config.TTLTiers, calendar *market.Calendar) *ViewportService {
+	v := &ViewportService{
+		pool:     pool,
+		cache:    cache,
+		candles:  NewTypedCache[*models.CandleResponse](cache, "candles"),
+		calendar: calendar,
+	}
+	v.load = v.loadCandles
+	v.config.Store(&cfg)
+	v.tiers.Store(&tiers)
+	return v
+}
+
+// dataConfig returns the current data settings, which callers must not modify
+func (v *ViewportService) dataConfig() *config.DataConfig {
+	return v.config.Load()
+}
+
+// SetDataConfig replaces the data settings. Requests already running keep
+// the settings they started with.
+func (v *ViewportService) SetDataConfig(cfg config.DataConfig) {
+	v.config.Store(&cfg)
+}
+
+// SetCacheTiers replaces the candle cache TTL tiers. Entries already cached
+// keep the TTL they were stored with.
+func (v *ViewportService) SetCacheTiers(tiers config.TTLTiers) {
+	v.tiers.Store(&tiers)
+}
+
+// TableCheck is the verification result of one resolution table
+type TableCheck struct {
+	Table       string   `json:"table"`
+	Resolutions []string `json:"resolutions"`
+	Exists      bool     `json:"exists"`
+	Error       string   `json:"error,omitempty"` // lookup failure; existence unknown
+}
+
+// TableVerification reports whether every configured resolution table exists
+type TableVerification struct {
+	CheckedAt time.Time    `json:"checked_at"`
+	Tables    []TableCheck `json:"tables"`
+	Missing   []string     `json:"missing"`
+	Failed    []string     `json:"failed"` // tables whose lookup failed
+	OK        bool         `json:"ok"`
+}
+
+// VerifyTables checks every configured resolution table against the
+// tables() catalog, logs the result per table and keeps the report for
+// LastTableVerification
+func (v *ViewportService) VerifyTables(ctx context.Context) TableVerification {
+	dataService := NewDataService(v.pool)
+
+	resolutions := make(map[string][]string)
+	for resolution, cfg := range v.dataConfig().Resolutions {
+		resolutions[cfg.Table] = append(resolutions[cfg.Table], resolution)
+	}
+	tables := make([]string, 0, len(resolutions))
+	for table := range resolutions {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	report := TableVerification{
+		CheckedAt: time.Now().UTC(),
+		Missing:   []string{},
+		Failed:    []string{},
+	}
+	for _, table := range tables {
+		sort.Strings(resolutions[table])
+		check := TableCheck{Table: table, Resolutions: resolutions[table]}
+
+		err := dataService.CheckTableExists(ctx, table)
+		switch {
+		case err == nil:
+			check.Exists = true
+			log.Info().Str("table", table).Strs("resolutions", check.Resolutions).Msg("Table verified")
+		case errors.Is(err, ErrTableNotFound):
+			report.Missing = append(report.Missing, table)
+			log.Warn().Str("table", table).Strs("resolutions", check.Resolutions).Msg("Table missing, these resolutions will aggregate from ticks")
+		default:
+			check.Error = err.Error()
+			report.Failed = append(report.Failed, table)
+			log.Warn().Err(err).Str("table", table).Strs("resolutions", check.Resolutions).Msg("Table verification failed")
 		}
+		report.Tables = append(report.Tables, check)
 	}
+	report.OK = len(report.Missing) == 0 && len(report.Failed) == 0
+
+	v.verifyMu.Lock()
+	v.verification = &report
+	v.verifyMu.Unlock()
+	return report
+}
 
-	return &ViewportService{
-		pool:   pool,
-		cache:  cache,
-		config: cfg.Data,
+// LastTableVerification returns the latest VerifyTables report, or false if
+// the tables haven't been verified yet
+func (v *ViewportService) LastTableVerification() (TableVerification, bool) {
+	v.verifyMu.Lock()
+	defer v.verifyMu.Unlock()
+
+	if v.verification == nil {
+		return TableVerification{}, false
 	}
+	return *v.verification, true
 }
 
 // SelectOptimalResolution picks the best resolution for a time range
@@ -82,9 +154,10 @@ func (v *ViewportService) SelectOptimalResolution(start, end time.Time) (string,
 
 	// Order matters - check from finest to coarsest
 	resolutionOrder := []string{"1m", "5m", "1h", "4h", "1d"}
+	resolutions := v.dataConfig().Resolutions
 
 	for _, res := range resolutionOrder {
-		cfg := v.config.Resolutions[res]
+		cfg := resolutions[res]
 		if duration >= cfg.MinRange && duration <= cfg.MaxRange {
 			log.Debug().
 				Str("resolution", res).
@@ -96,7 +169,7 @@ func (v *ViewportService) SelectOptimalResolution(start, end time.Time) (string,
 	}
 
 	// Default to daily for very long ranges
-	return "1d", v.config.Resolutions["1d"]
+	return "1d", resolutions["1d"]
 }
 
 // GetSmartCandles retrieves candles with automatic resolution selection
@@ -109,44 +182,215 @@ func (v *ViewportService) GetSmartCandles(ctx context.Context, req models.Candle
 	
 	// If timeframe is specified, use it as the resolution
 	if req.Timeframe != "" {
-		resolution = req.Timeframe
-		var ok bool
-		resConfig, ok = v.config.Resolutions[resolution]
-		if !ok {
-			return nil, fmt.Errorf("invalid timeframe: %s", resolution)
+		var err error
+		if resolution, resConfig, err = v.resolveResolution(req.Timeframe, req.Start, req.End); err != nil {
+			return nil, err
+		}
+		if err := CheckTimeframeRange(resolution, req.Start, req.End); err != nil {
+			return nil, err
 		}
 	} else if resolution == "" {
 		resolution, resConfig = v.SelectOptimalResolution(req.Start, req.End)
 	} else {
-		var ok bool
-		resConfig, ok = v.config.Resolutions[resolution]
-		if !ok {
-			return nil, fmt.Errorf("invalid resolution: %s", resolution)
+		var err error
+		if resolution, resConfig, err = v.resolveResolution(resolution, req.Start, req.End); err != nil {
+			return nil, err
 		}
 	}
 
-	// Check cache first
-	cacheKey := v.cache.GenerateKey(req.Symbol, resolution, req.Start, req.End)
-	if cached, found := v.cache.Get(cacheKey); found {
+	extras, err := req.ParseExtras()
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := req.ParseSessions()
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckSessionTimeframe(resolution, sessions); err != nil {
+		return nil, err
+	}
+
+	// Alignment only moves day boundaries; a resolution picked for the range
+	// that has none ignores it, one asked for is an error
+	alignment, err := req.ParseAlignment()
+	if err != nil {
+		return nil, err
+	}
+	if alignment != models.AlignUTC && !Alignable(resolution) {
+		if req.Timeframe != "" || req.Resolution != "" {
+			return nil, fmt.Errorf("%w: alignment %s applies to 1d and 1w, not %s", ErrInvalidResolution, alignment, resolution)
+		}
+		alignment = models.AlignUTC
+	}
+	alignmentKey := ""
+	if alignment != models.AlignUTC {
+		alignmentKey = alignment
+	}
+	continuousKey := ""
+	if req.Continuous {
+		continuousKey = "continuous"
+	}
+
+	// Serve from cache, with concurrent misses for the same key sharing one load.
+	// The loader may run on another goroutine for stale revalidation.
+	cacheKey := GenerateCacheKey(req.Symbol, resolution, req.Start, req.End, extras.Key(), alignmentKey, continuousKey, sessions.Key())
+	cached, hit, err := v.candles.GetOrLoad(ctx, cacheKey, v.getCacheTTL(req.End), func(ctx context.Context) (*models.CandleResponse, error) {
+		// The load may be shared with other waiters or finish in the background
+		// for stale revalidation, so it must outlive this request
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), candleLoadTimeout)
+		defer cancel()
+		return v.load(loadCtx, req, resolution, resConfig, extras, sessions, alignment, start)
+	}, SymbolTag(req.Symbol), ResolutionTag(resolution))
+	if err != nil {
+		return nil, err
+	}
+
+	// The cached response is shared between requests and must not be modified;
+	// per-request metadata goes on a shallow copy
+	response := *cached
+	response.Metadata.CacheHit = hit
+	response.Metadata.QueryTimeMs = time.Since(start).Milliseconds()
+	response.Metadata.ServerTime = time.Now().UTC()
+	if response.Metadata.CacheHit {
 		log.Debug().Str("cache_key", cacheKey).Msg("Cache hit")
-		response := cached.(*models.CandleResponse)
-		response.Metadata.CacheHit = true
-		response.Metadata.QueryTimeMs = time.Since(start).Milliseconds()
-		return response, nil
 	}
 
+	return &response, nil
+}
+
+// resolveResolution returns the canonical name and settings of a requested
+// resolution. One no resolution is configured for is resampled from a finer
+// one, or sampled from ticks.
+func (v *ViewportService) resolveResolution(name string, start, end time.Time) (string, config.ResolutionConfig, error) {
+	if cfg, ok := v.dataConfig().Resolutions[name]; ok {
+		return name, cfg, nil
+	}
+	tf, err := ParseTimeframe(name)
+	if err != nil {
+		return "", config.ResolutionConfig{}, fmt.Errorf("%w: %w", ErrInvalidResolution, err)
+	}
+	if cfg, ok := v.dataConfig().Resolutions[tf.String()]; ok {
+		return tf.String(), cfg, nil
+	}
+	cfg, err := v.customResolution(tf, start, end)
+	return tf.String(), cfg, err
+}
+
+// loadCandles queries candles for a resolved request and builds the response.
+// ny_close days and weeks are aggregated from hourly bars, starting from the
+// beginning of the session holding the requested start.
+func (v *ViewportService) loadCandles(ctx context.Context, req models.CandleRequest, resolution string, resConfig config.ResolutionConfig, extras models.CandleExtras, sessions models.SessionFilter, alignment string, start time.Time) (*models.CandleResponse, error) {
 	// Create data service to fetch candles
 	dataService := NewDataService(v.pool)
 	
 	// Use the request as-is, resolution is already set correctly above
 	reqCopy := req
 	reqCopy.Resolution = resolution
+	// Tick-table queries, such as session-filtered ones, sample by the
+	// timeframe, which is empty when the resolution was picked for the range
+	reqCopy.Timeframe = resolution
+
+	table := resConfig.Table
+	limit := resConfig.MaxPoints
+	if alignment == models.AlignNYClose {
+		reqCopy.Start = sessionStart(req.Start, resolution)
+		reqCopy.Resolution, reqCopy.Timeframe = "1h", "1h"
+		table = tickTable
+		if hourly, ok := v.dataConfig().Resolutions["1h"]; ok {
+			table = hourly.Table
+		}
+		limit = int(reqCopy.End.Sub(reqCopy.Start).Hours()) + 1
+	}
+	// Timeframes without a table of their own are resampled from a finer one
+	source, resample := "", false
+	if alignment != models.AlignNYClose {
+		source, resample = v.resampleSource(resolution)
+	}
+	if resample {
+		length, _ := timeframeDuration(resolution)
+		sourceLength, _ := timeframeDuration(source)
+		reqCopy.Resolution, reqCopy.Timeframe = source, source
+		limit = (resConfig.MaxPoints + 1) * int(length/sourceLength)
+	}
+
+	// Fall back to aggregating ticks if the configured table is missing
+	if extras.Spread {
+		table = SpreadTable(table)
+	}
+	var fallbackNote string
+	if len(sessions) > 0 && table != tickTable {
+		fallbackNote = fmt.Sprintf("session filter requested; aggregated from %s instead of %s", tickTable, table)
+		table = tickTable
+	}
+	if table != tickTable {
+		if err := dataService.CheckTableExists(ctx, table); err != nil {
+			if !errors.Is(err, ErrTableNotFound) {
+				return nil, queryError(err)
+			}
+			log.Warn().Str("table", table).Msg("Configured table missing, aggregating from ticks")
+			fallbackNote = fmt.Sprintf("table %s not found; aggregated from %s", table, tickTable)
+			table = tickTable
+		}
+	}
+	if extras.Delta {
+		routed, err := dataService.DeltaTable(ctx, table, reqCopy.Start, reqCopy.End)
+		if err != nil {
+			return nil, err
+		}
+		if routed != table {
+			fallbackNote = fmt.Sprintf("table %s has no buy and sell volume; delta aggregated from %s", table, routed)
+			table = routed
+		}
+	}
 	
 	// Fetch candles with limit
-	candles, err := dataService.GetCandles(ctx, reqCopy, resConfig.Table, resConfig.MaxPoints)
+	candles, notes, err := dataService.GetCandles(ctx, reqCopy, table, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get candles: %w", err)
 	}
+	if alignment == models.AlignNYClose {
+		candles = alignSessions(candles, resolution)
+		if len(candles) > resConfig.MaxPoints {
+			candles = candles[:resConfig.MaxPoints]
+		}
+		if extras.Delta {
+			fillDelta(candles)
+		}
+		notes = append(notes, fmt.Sprintf("%s bars start at the 17:00 New York close, aggregated from hourly bars", resolution))
+	}
+	if resample {
+		if candles, err = resampleBars(candles, resolution, req.Start); err != nil {
+			return nil, err
+		}
+		if len(candles) > resConfig.MaxPoints {
+			candles = candles[:resConfig.MaxPoints]
+		}
+		if extras.Delta {
+			fillDelta(candles)
+		}
+		notes = append(notes, fmt.Sprintf("%s bars resampled from %s bars", resolution, source))
+	}
+	if fallbackNote != "" {
+		notes = append(notes, fallbackNote)
+	}
+
+	deltaSource := ""
+	if extras.Delta {
+		deltaSource = DeltaSource(table)
+	}
+
+	// Continuous slots start at the bar holding the requested start
+	var continuous *models.ContinuousMapping
+	if req.Continuous {
+		origin := reqCopy.Start
+		if bar, err := timeframeDuration(resolution); err == nil && alignment != models.AlignNYClose {
+			origin = req.Start.Truncate(bar)
+		}
+		continuous, err = v.indexContinuous(req.Symbol, resolution, origin, candles)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// Build response
 	response := &models.CandleResponse{
@@ -158,7 +402,7 @@ func (v *ViewportService) GetSmartCandles(ctx context.Context, req models.Candle
 		Count:      len(candles),
 		Candles:    candles,
 		Metadata: models.Metadata{
-			TableUsed:      resConfig.Table,
+			TableUsed:      table,
 			QueryTimeMs:    time.Since(start).Milliseconds(),
 			CacheHit:       false,
 			PointsReturned: len(candles),
@@ -167,29 +411,48 @@ func (v *ViewportService) GetSmartCandles(ctx context.Context, req models.Candle
 			DataSource:     "v2", // or from req.Source
 			ServerTime:     time.Now().UTC(),
 			TimeRange:      req.End.Sub(req.Start),
+			Notes:          notes,
+			DeltaSource:    deltaSource,
+			Continuous:     continuous,
 		},
 	}
 
 	// Generate next URL if data is incomplete
 	if !response.Metadata.DataComplete && len(candles) > 0 {
 		lastTime := candles[len(candles)-1].Timestamp
+		next, params := lastTime.Add(time.Second), ""
+		if alignment == models.AlignNYClose {
+			next, params = nextSessionStart(lastTime, resolution), "&alignment="+alignment
+		}
+		if resample {
+			// The next page's bars must start where this one's last ends
+			length, _ := timeframeDuration(resolution)
+			next = lastTime.Add(length)
+		}
+		if include := extras.Key(); include != "" {
+			params += "&include=" + include
+		}
+		if req.Continuous {
+			params += "&continuous=true"
+		}
+		if len(sessions) > 0 {
+			params += "&" + sessions.Key()
+		}
 		response.Metadata.NextURL = fmt.Sprintf(
-			"/api/v1/candles?symbol=%s&start=%s&end=%s&resolution=%s",
+			"/api/v1/candles?symbol=%s&start=%s&end=%s&resolution=%s%s",
 			req.Symbol,
-			lastTime.Add(time.Second).Format(time.RFC3339),
+			next.Format(time.RFC3339),
 			req.End.Format(time.RFC3339),
 			resolution,
+			params,
 		)
 	}
 
-	// Cache the response
-	v.cache.Set(cacheKey, response, v.getCacheTTL(req.End))
-
 	return response, nil
 }
 
 // ExplainQuery explains what table and resolution would be used
-func (v *ViewportService) ExplainQuery(req models.CandleRequest) *models.ExplainResponse {
+func (v *ViewportService) ExplainQuery(ctx context.Context, req models.CandleRequest) *models.ExplainResponse {
 	resolution, resConfig := v.SelectOptimalResolution(req.Start, req.End)
 	
 	// Calculate estimated points
@@ -209,9 +472,14 @@ func (v *ViewportService) ExplainQuery(req models.CandleRequest) *models.Explain
 		estimatedPoints = int(duration.Hours() / 24)
 	}
 
+	// Session filters keep only the bars within the sessions' hours; an
+	// invalid filter is left for the candle endpoints to reject
+	sessions, _ := req.ParseSessions()
+	estimatedPoints = sessionPoints(estimatedPoints, resolution, sessions)
+
 	// Build alternatives
 	alternatives := make([]models.ResolutionAlternative, 0)
-	for res, cfg := range v.config.Resolutions {
+	for res, cfg := range v.dataConfig().Resolutions {
 		if res != resolution {
 			alt := models.ResolutionAlternative{
 				Resolution: res,
@@ -219,6 +487,14 @@ func (v *ViewportService) ExplainQuery(req models.CandleRequest) *models.Explain
 			
 			// Calculate points for this resolution
 			switch res {
+			case "1s":
+				alt.EstimatedPoints = int(duration.Seconds())
+			case "5s":
+				alt.EstimatedPoints = int(duration.Seconds() / 5)
+			case "15s":
+				alt.EstimatedPoints = int(duration.Seconds() / 15)
+			case "30s":
+				alt.EstimatedPoints = int(duration.Seconds() / 30)
 			case "1m":
 				alt.EstimatedPoints = int(duration.Minutes())
 			case "5m":
@@ -230,6 +506,7 @@ func (v *ViewportService) ExplainQuery(req models.CandleRequest) *models.Explain
 			case "1d":
 				alt.EstimatedPoints = int(duration.Hours() / 24)
 			}
+			alt.EstimatedPoints = sessionPoints(alt.EstimatedPoints, res, sessions)
 			
 			// Check if it's within range
 			if duration >= cfg.MinRange && duration <= cfg.MaxRange {
@@ -240,7 +517,7 @@ func (v *ViewportService) ExplainQuery(req models.CandleRequest) *models.Explain
 		}
 	}
 
-	return &models.ExplainResponse{
+	response := &models.ExplainResponse{
 		Symbol:          req.Symbol,
 		TimeRange:       duration,
 		Resolution:      resolution,
@@ -250,13 +527,54 @@ func (v *ViewportService) ExplainQuery(req models.CandleRequest) *models.Explain
 		Reason:          fmt.Sprintf("Selected %s resolution for %.0f hour range", resolution, duration.Hours()),
 		Alternatives:    alternatives,
 	}
+	if len(sessions) > 0 {
+		response.TableUsed = tickTable
+		response.Reason += fmt.Sprintf(", aggregated from ticks for %s (%.0f%% of the day)", strings.TrimPrefix(sessions.Key(), "session="), sessions.Fraction()*100)
+	}
+
+	// Report how many source rows the query would scan
+	dataService := NewDataService(v.pool)
+	rows, exact, err := dataService.EstimatePoints(ctx, response.TableUsed, req.Symbol, req.Start, req.End)
+	if err != nil {
+		log.Warn().Err(err).Str("table", response.TableUsed).Msg("Failed to estimate source rows")
+	} else {
+		response.SourceRows = rows
+		response.SourceRowsExact = exact
+	}
+
+	return response
 }
 
-// GetDataContract returns the current data contract
+// sessionPoints scales a point estimate at resolution to the share of the
+// day the sessions cover. Bars of a day or more each still hold some
+// session, so their count is kept.
+func sessionPoints(points int, resolution string, sessions models.SessionFilter) int {
+	if bar, err := timeframeDuration(resolution); err == nil && bar >= 24*time.Hour {
+		return points
+	}
+	return int(float64(points) * sessions.Fraction())
+}
+
+// GetDataContract returns the current data contract: the contract file the
+// configuration was loaded from, or one built from the configured
+// resolutions, with the cache TTL tiers in force and the alignments daily
+// and weekly bars can be asked for
 func (v *ViewportService) GetDataContract() *models.DataContract {
+	dataConfig := v.dataConfig()
+	if dataConfig.Contract != nil {
+		contract := *dataConfig.Contract
+		contract.CacheTiers = v.cacheTierContract()
+		contract.Resolutions = make(map[string]models.ResolutionContract, len(dataConfig.Contract.Resolutions))
+		for res, resolution := range dataConfig.Contract.Resolutions {
+			resolution.Alignments = alignments(res)
+			contract.Resolutions[res] = resolution
+		}
+		return &contract
+	}
+
 	resolutions := make(map[string]models.ResolutionContract)
 	
-	for res, cfg := range v.config.Resolutions {
+	for res, cfg := range dataConfig.Resolutions {
 		resolutions[res] = models.ResolutionContract{
 			Resolution:  res,
 			MinRangeMs:  cfg.MinRange.Milliseconds(),
@@ -265,38 +583,50 @@ func (v *ViewportService) GetDataContract() *models.DataContract {
 			Table:       cfg.Table,
 			Description: cfg.Description,
 			Recommended: v.getRecommendation(res),
+			Alignments:  alignments(res),
 		}
 	}
 
 	return &models.DataContract{
-		MaxPointsPerRequest: v.config.MaxPointsPerRequest,
+		MaxPointsPerRequest: dataConfig.MaxPointsPerRequest,
 		Resolutions:         resolutions,
 		PerformanceTargets: models.PerformanceTargets{
 			ExcellentMs:  50,
 			GoodMs:       100,
 			AcceptableMs: 500,
 		},
-		Version:   "1.0.0",
-		Generated: time.Now().UTC(),
+		CacheTiers: v.cacheTierContract(),
+		Version:    "1.0.0",
+		Generated:  time.Now().UTC(),
 	}
 }
 
-// getCacheTTL determines cache duration based on data recency
-func (v *ViewportService) getCacheTTL(endTime time.Time) time.Duration {
-	age := time.Since(endTime)
-	
-	if age < 1*time.Hour {
-		return 10 * time.Second // Recent data
-	} else if age < 24*time.Hour {
-		return 1 * time.Minute // Today's data
-	} else {
-		return 5 * time.Minute // Historical data
+// cacheTierContract describes the candle cache TTL tiers for the contract
+func (v *ViewportService) cacheTierContract() []models.CacheTierContract {
+	tiers := *v.tiers.Load()
+	contract := make([]models.CacheTierContract, len(tiers))
+	for i, tier := range tiers {
+		contract[i] = models.CacheTierContract{
+			MaxAgeMs: tier.MaxAge.Milliseconds(),
+			TTLMs:    tier.TTL.Milliseconds(),
+		}
 	}
+	return contract
+}
+
+// getCacheTTL determines cache duration based on data recency, from the
+// configured TTL tiers
+func (v *ViewportService) getCacheTTL(endTime time.Time) time.Duration {
+	return v.tiers.Load().TTL(time.Since(endTime))
 }
 
 // getRecommendation provides usage recommendation for resolution
 func (v *ViewportService) getRecommendation(resolution string) string {
 	switch resolution {
+	case "1s":
+		return "Tick-level inspection of short windows"
+	case "5s", "15s", "30s":
+		return "Scalping and execution analysis"
 	case "1m":
 		return "Scalping and micro-movements"
 	case "5m":
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/config"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+func newTestViewport() *ViewportService {
+	cfg := config.DataConfig{Resolutions: map[string]config.ResolutionConfig{
+		"1h": {Table: "ohlc_1h_v2", MaxRange: 30 * 24 * time.Hour, MaxPoints: 1000},
+	}}
+	return NewViewportService(nil, newTestCache(0), cfg, config.TTLTiers{{TTL: time.Hour}}, nil)
+}
+
+// Run with -race: callers sharing one cached response must not write to it
+func TestGetSmartCandlesConcurrentCallersOnOneKey(t *testing.T) {
+	v := newTestViewport()
+	release := make(chan struct{})
+	var loads atomic.Int32
+	v.load = func(ctx context.Context, req models.CandleRequest, resolution string, _ config.ResolutionConfig, _ models.CandleExtras, _ models.SessionFilter, _ string, _ time.Time) (*models.CandleResponse, error) {
+		loads.Add(1)
+		<-release
+		return &models.CandleResponse{
+			Symbol:     req.Symbol,
+			Resolution: resolution,
+			Count:      1,
+			Candles:    []models.Candle{{Timestamp: req.Start, Open: 1, High: 1, Low: 1, Close: 1}},
+		}, nil
+	}
+
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	req := models.CandleRequest{Symbol: "EURUSD", Timeframe: "1h", Start: start, End: start.Add(24 * time.Hour)}
+
+	const callers = 16
+	responses := make([]*models.CandleResponse, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i], errs[i] = v.GetSmartCandles(context.Background(), req)
+			if errs[i] == nil {
+				responses[i].Metadata.Notes = append(responses[i].Metadata.Notes, "caller note")
+			}
+		}()
+	}
+	for loads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("loader ran %d times, want 1", n)
+	}
+	misses := 0
+	for i, response := range responses {
+		if errs[i] != nil {
+			t.Fatalf("caller %d: %v", i, errs[i])
+		}
+		if response.Count != 1 {
+			t.Errorf("caller %d got %d candles, want 1", i, response.Count)
+		}
+		if !response.Metadata.CacheHit {
+			misses++
+		}
+	}
+	// Callers that waited on the load didn't hit, only those arriving after it
+	if misses == 0 {
+		t.Error("every caller reported a cache hit, want the loading and waiting ones to report misses")
+	}
+
+	response, err := v.GetSmartCandles(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.Metadata.CacheHit {
+		t.Error("a call after the load reported a cache miss")
+	}
+	if len(response.Metadata.Notes) != 0 {
+		t.Errorf("cached response picked up callers' notes: %v", response.Metadata.Notes)
+	}
+}
+
+func TestGetSmartCandlesRejectsSessionsAcrossMidnightOnDailyBars(t *testing.T) {
+	v := newTestViewport()
+	loads := 0
+	v.load = func(_ context.Context, req models.CandleRequest, resolution string, _ config.ResolutionConfig, _ models.CandleExtras, _ models.SessionFilter, _ string, _ time.Time) (*models.CandleResponse, error) {
+		loads++
+		return &models.CandleResponse{Symbol: req.Symbol, Resolution: resolution}, nil
+	}
+
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		timeframe string
+		session   string
+		ok        bool
+	}{
+		{"1d", "SYDNEY", false},
+		{"1w", "TOKYO,SYDNEY", false},
+		{"1d", "LONDON", true},
+		{"1h", "SYDNEY", true},
+	}
+	for _, tt := range tests {
+		before := loads
+		req := models.CandleRequest{Symbol: "EURUSD", Timeframe: tt.timeframe, Session: tt.session, Start: start, End: start.Add(14 * 24 * time.Hour)}
+		_, err := v.GetSmartCandles(context.Background(), req)
+		if tt.ok && err != nil {
+			t.Errorf("%s bars of %s: %v", tt.timeframe, tt.session, err)
+		}
+		if !tt.ok {
+			if !errors.Is(err, ErrInvalidResolution) {
+				t.Errorf("%s bars of %s: err = %v, want ErrInvalidResolution", tt.timeframe, tt.session, err)
+			}
+			if loads != before {
+				t.Errorf("%s bars of %s were loaded before being rejected", tt.timeframe, tt.session)
+			}
+		}
+	}
+}
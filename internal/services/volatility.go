@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sptrader/sptrader/internal/analytics"
+	"github.com/sptrader/sptrader/internal/models"
+)
+
+// DefaultATRPeriod is the ATR period, and realized volatility window, when
+// the request doesn't say
+const DefaultATRPeriod = 14
+
+// GetVolatility returns the symbol's true range, Wilder ATR and annualized
+// close-to-close realized volatility per candle, with candles fetched and
+// cached as /candles does. A range with fewer candles than the period fails
+// with ErrInsufficientData, as nothing would be past the warm-up.
+func (v *ViewportService) GetVolatility(ctx context.Context, req models.VolatilityRequest) (*models.VolatilityResponse, error) {
+	start := time.Now()
+	period := req.ATRPeriod
+	if period == 0 {
+		period = DefaultATRPeriod
+	}
+
+	candles, err := v.GetSmartCandles(ctx, models.CandleRequest{
+		Symbol:    req.Symbol,
+		Timeframe: req.Timeframe,
+		Start:     req.Start,
+		End:       req.End,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(candles.Candles) < period {
+		return nil, fmt.Errorf("%w: atr_period %d needs at least %d candles, %s has %d at %s between %s and %s",
+			ErrInsufficientData, period, period, req.Symbol, len(candles.Candles), candles.Resolution,
+			req.Start.Format(time.RFC3339), req.End.Format(time.RFC3339))
+	}
+
+	perYear, err := barsPerYear(req.Symbol, candles.Resolution)
+	if err != nil {
+		return nil, err
+	}
+	closes := make([]float64, len(candles.Candles))
+	for i, c := range candles.Candles {
+		closes[i] = c.Close
+	}
+	trueRanges := analytics.TrueRanges(candles.Candles)
+	atr := analytics.WilderATR(trueRanges, period)
+	vol, err := analytics.RealizedVolatility(closes, period, perYear)
+	if err != nil {
+		return nil, err
+	}
+	returns, err := analytics.LogReturns(closes)
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]models.VolatilityPoint, len(candles.Candles))
+	for i, c := range candles.Candles {
+		series[i] = models.VolatilityPoint{
+			Timestamp:   c.Timestamp,
+			TrueRange:   trueRanges[i],
+			ATR:         atr[i],
+			RealizedVol: vol[i],
+		}
+	}
+
+	response := &models.VolatilityResponse{
+		Symbol:            req.Symbol,
+		Resolution:        candles.Resolution,
+		Start:             req.Start,
+		End:               req.End,
+		ATRPeriod:         period,
+		BarsPerYear:       perYear,
+		Count:             len(series),
+		Series:            series,
+		LatestATR:         analytics.Last(atr),
+		LatestRealizedVol: analytics.Last(vol),
+		Metadata:          candles.Metadata,
+	}
+	if len(returns) >= 2 {
+		realized := analytics.Stdev(returns) * math.Sqrt(perYear)
+		response.RealizedVol = &realized
+	}
+	response.Metadata.QueryTimeMs = time.Since(start).Milliseconds()
+	response.Metadata.NextURL = ""
+	return response, nil
+}
@@ -0,0 +1,22 @@
+-- Per-day data quality summaries
+-- The API upserts a row for every day a fetch touches; tables created by
+-- the API already have dedup enabled. Run the ALTER on a data_quality table
+-- created by the older offline script so refetched days replace their row.
+
+CREATE TABLE IF NOT EXISTS data_quality (
+    date TIMESTAMP,
+    symbol SYMBOL,
+    tick_count LONG,
+    first_tick TIMESTAMP,
+    last_tick TIMESTAMP,
+    expected_hours INT,
+    covered_hours INT,
+    sparse_hours INT,
+    coverage DOUBLE,
+    quality_score INT,
+    is_complete BOOLEAN,
+    updated_at TIMESTAMP
+) timestamp(date) PARTITION BY YEAR WAL
+DEDUP UPSERT KEYS(date, symbol);
+
+ALTER TABLE data_quality DEDUP ENABLE UPSERT KEYS(date, symbol);
@@ -0,0 +1,12 @@
+-- Enable upsert semantics on the OHLC tables
+-- The API's OHLC refresh scheduler rewrites the trailing buckets of each
+-- table on every pass; with dedup enabled the rewritten rows replace the
+-- existing ones instead of creating duplicate bars.
+
+ALTER TABLE ohlc_1m_v2 DEDUP ENABLE UPSERT KEYS(timestamp, symbol);
+ALTER TABLE ohlc_5m_v2 DEDUP ENABLE UPSERT KEYS(timestamp, symbol);
+ALTER TABLE ohlc_15m_v2 DEDUP ENABLE UPSERT KEYS(timestamp, symbol);
+ALTER TABLE ohlc_30m_v2 DEDUP ENABLE UPSERT KEYS(timestamp, symbol);
+ALTER TABLE ohlc_1h_v2 DEDUP ENABLE UPSERT KEYS(timestamp, symbol);
+ALTER TABLE ohlc_4h_v2 DEDUP ENABLE UPSERT KEYS(timestamp, symbol);
+ALTER TABLE ohlc_1d_v2 DEDUP ENABLE UPSERT KEYS(timestamp, symbol);